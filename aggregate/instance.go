@@ -234,6 +234,9 @@ func GetInstancePaged(db *database.Database, query *bson.M, page,
 						if rule.Port != "" {
 							key += ":" + rule.Port
 						}
+						if len(rule.IcmpTypes) > 0 {
+							key += ":" + strings.Join(rule.IcmpTypes, ",")
+						}
 
 						rules := firewallRules[key]
 						if rules == nil {
@@ -248,6 +251,12 @@ func GetInstancePaged(db *database.Database, query *bson.M, page,
 						for _, sourceIp := range rule.SourceIps {
 							rules.Add(sourceIp)
 						}
+						for _, sourceRole := range rule.NetworkRoles {
+							rules.Add("role:" + sourceRole)
+						}
+						for _, sourceFire := range rule.Firewalls {
+							rules.Add("firewall:" + sourceFire.Hex())
+						}
 					}
 				}
 			}
@@ -24,6 +24,7 @@ type datacenterData struct {
 	PrivateStorageClass string               `json:"private_storage_class"`
 	BackupStorage       primitive.ObjectID   `json:"backup_storage"`
 	BackupStorageClass  string               `json:"backup_storage_class"`
+	BackupEncryption    bool                 `json:"backup_encryption"`
 }
 
 func datacenterPut(c *gin.Context) {
@@ -64,6 +65,7 @@ func datacenterPut(c *gin.Context) {
 	dc.PrivateStorageClass = data.PrivateStorageClass
 	dc.BackupStorage = data.BackupStorage
 	dc.BackupStorageClass = data.BackupStorageClass
+	dc.BackupEncryption = data.BackupEncryption
 
 	fields := set.NewSet(
 		"name",
@@ -75,6 +77,7 @@ func datacenterPut(c *gin.Context) {
 		"private_storage_class",
 		"backup_storage",
 		"backup_storage_class",
+		"backup_encryption",
 	)
 
 	errData, err := dc.Validate(db)
@@ -128,6 +131,7 @@ func datacenterPost(c *gin.Context) {
 		PrivateStorageClass: data.PrivateStorageClass,
 		BackupStorage:       data.BackupStorage,
 		BackupStorageClass:  data.BackupStorageClass,
+		BackupEncryption:    data.BackupEncryption,
 	}
 
 	errData, err := dc.Validate(db)
@@ -38,6 +38,7 @@ type diskData struct {
 	Size             int                `json:"size"`
 	NewSize          int                `json:"new_size"`
 	Backup           bool               `json:"backup"`
+	BackupPolicy     *disk.BackupPolicy `json:"backup_policy"`
 }
 
 type disksMultiData struct {
@@ -86,6 +87,7 @@ func diskPut(c *gin.Context) {
 		"delete_protection",
 		"index",
 		"backup",
+		"backup_policy",
 		"new_size",
 	)
 
@@ -97,6 +99,7 @@ func diskPut(c *gin.Context) {
 	dsk.DeleteProtection = dta.DeleteProtection
 	dsk.Index = dta.Index
 	dsk.Backup = dta.Backup
+	dsk.BackupPolicy = dta.BackupPolicy
 
 	if dsk.State == disk.Available && dta.State == disk.Snapshot {
 		dsk.State = disk.Snapshot
@@ -231,6 +234,7 @@ func diskPost(c *gin.Context) {
 		Backing:          dta.Backing,
 		Size:             dta.Size,
 		Backup:           dta.Backup,
+		BackupPolicy:     dta.BackupPolicy,
 	}
 
 	errData, err := dsk.Validate(db)
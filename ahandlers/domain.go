@@ -17,13 +17,22 @@ import (
 )
 
 type domainData struct {
-	Id           primitive.ObjectID `json:"id"`
-	Name         string             `json:"name"`
-	Comment      string             `json:"comment"`
-	Organization primitive.ObjectID `json:"organization"`
-	Type         string             `json:"type"`
-	AwsId        string             `json:"aws_id"`
-	AwsSecret    string             `json:"aws_secret"`
+	Id               primitive.ObjectID  `json:"id"`
+	Name             string              `json:"name"`
+	Comment          string              `json:"comment"`
+	Organization     primitive.ObjectID  `json:"organization"`
+	Type             string              `json:"type"`
+	AwsId            string              `json:"aws_id"`
+	AwsSecret        string              `json:"aws_secret"`
+	CloudflareToken  string              `json:"cloudflare_token"`
+	Rfc2136Server    string              `json:"rfc2136_server"`
+	Rfc2136KeyName   string              `json:"rfc2136_key_name"`
+	Rfc2136Algorithm string              `json:"rfc2136_algorithm"`
+	Rfc2136Secret    string              `json:"rfc2136_secret"`
+	PowerDnsUrl      string              `json:"powerdns_url"`
+	PowerDnsServer   string              `json:"powerdns_server"`
+	PowerDnsApiKey   string              `json:"powerdns_api_key"`
+	Records          []*domain.RecordSet `json:"records"`
 }
 
 type domainsData struct {
@@ -57,12 +66,23 @@ func domainPut(c *gin.Context) {
 		return
 	}
 
+	domn.PreCommit()
+
 	domn.Name = data.Name
 	domn.Comment = data.Comment
 	domn.Organization = data.Organization
 	domn.Type = data.Type
 	domn.AwsId = data.AwsId
 	domn.AwsSecret = data.AwsSecret
+	domn.CloudflareToken = data.CloudflareToken
+	domn.Rfc2136Server = data.Rfc2136Server
+	domn.Rfc2136KeyName = data.Rfc2136KeyName
+	domn.Rfc2136Algorithm = data.Rfc2136Algorithm
+	domn.Rfc2136Secret = data.Rfc2136Secret
+	domn.PowerDnsUrl = data.PowerDnsUrl
+	domn.PowerDnsServer = data.PowerDnsServer
+	domn.PowerDnsApiKey = data.PowerDnsApiKey
+	domn.Records = data.Records
 
 	fields := set.NewSet(
 		"name",
@@ -71,6 +91,15 @@ func domainPut(c *gin.Context) {
 		"type",
 		"aws_id",
 		"aws_secret",
+		"cloudflare_token",
+		"rfc2136_server",
+		"rfc2136_key_name",
+		"rfc2136_algorithm",
+		"rfc2136_secret",
+		"powerdns_url",
+		"powerdns_server",
+		"powerdns_api_key",
+		"records",
 	)
 
 	errData, err := domn.Validate(db)
@@ -84,6 +113,12 @@ func domainPut(c *gin.Context) {
 		return
 	}
 
+	err = domn.PostCommit(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
 	err = domn.CommitFields(db, fields)
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
@@ -112,12 +147,21 @@ func domainPost(c *gin.Context) {
 	}
 
 	domn := &domain.Domain{
-		Name:         data.Name,
-		Comment:      data.Comment,
-		Organization: data.Organization,
-		Type:         data.Type,
-		AwsId:        data.AwsId,
-		AwsSecret:    data.AwsSecret,
+		Name:             data.Name,
+		Comment:          data.Comment,
+		Organization:     data.Organization,
+		Type:             data.Type,
+		AwsId:            data.AwsId,
+		AwsSecret:        data.AwsSecret,
+		CloudflareToken:  data.CloudflareToken,
+		Rfc2136Server:    data.Rfc2136Server,
+		Rfc2136KeyName:   data.Rfc2136KeyName,
+		Rfc2136Algorithm: data.Rfc2136Algorithm,
+		Rfc2136Secret:    data.Rfc2136Secret,
+		PowerDnsUrl:      data.PowerDnsUrl,
+		PowerDnsServer:   data.PowerDnsServer,
+		PowerDnsApiKey:   data.PowerDnsApiKey,
+		Records:          data.Records,
 	}
 
 	errData, err := domn.Validate(db)
@@ -23,6 +23,8 @@ type firewallData struct {
 	Organization primitive.ObjectID `json:"organization"`
 	NetworkRoles []string           `json:"network_roles"`
 	Ingress      []*firewall.Rule   `json:"ingress"`
+	Egress       []*firewall.Rule   `json:"egress"`
+	LogDropped   bool               `json:"log_dropped"`
 }
 
 type firewallsData struct {
@@ -61,6 +63,8 @@ func firewallPut(c *gin.Context) {
 	fire.Organization = data.Organization
 	fire.NetworkRoles = data.NetworkRoles
 	fire.Ingress = data.Ingress
+	fire.Egress = data.Egress
+	fire.LogDropped = data.LogDropped
 
 	fields := set.NewSet(
 		"name",
@@ -68,6 +72,8 @@ func firewallPut(c *gin.Context) {
 		"organization",
 		"network_roles",
 		"ingress",
+		"egress",
+		"log_dropped",
 	)
 
 	errData, err := fire.Validate(db)
@@ -114,6 +120,8 @@ func firewallPost(c *gin.Context) {
 		Organization: data.Organization,
 		NetworkRoles: data.NetworkRoles,
 		Ingress:      data.Ingress,
+		Egress:       data.Egress,
+		LogDropped:   data.LogDropped,
 	}
 
 	errData, err := fire.Validate(db)
@@ -205,6 +213,30 @@ func firewallGet(c *gin.Context) {
 	c.JSON(200, fire)
 }
 
+func firewallStatsGet(c *gin.Context) {
+	db := c.MustGet("db").(*database.Database)
+
+	firewallId, ok := utils.ParseObjectId(c.Param("firewall_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	fire, err := firewall.Get(db, firewallId)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	stats, err := fire.GetInstanceStats(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, stats)
+}
+
 func firewallsGet(c *gin.Context) {
 	db := c.MustGet("db").(*database.Database)
 
@@ -68,6 +68,10 @@ func Register(engine *gin.Engine) {
 	csrfGroup.POST("/block", blockPost)
 	csrfGroup.DELETE("/block/:block_id", blockDelete)
 
+	csrfGroup.GET("/capture", capturesGet)
+	csrfGroup.GET("/capture/:capture_id", captureGet)
+	csrfGroup.DELETE("/capture/:capture_id", captureDelete)
+
 	csrfGroup.GET("/certificate", certificatesGet)
 	csrfGroup.GET("/certificate/:cert_id", certificateGet)
 	csrfGroup.PUT("/certificate/:cert_id", certificatePut)
@@ -98,6 +102,7 @@ func Register(engine *gin.Engine) {
 	csrfGroup.POST("/disk", diskPost)
 	csrfGroup.DELETE("/disk", disksDelete)
 	csrfGroup.DELETE("/disk/:disk_id", diskDelete)
+	csrfGroup.POST("/disk/:disk_id/export", diskExportPost)
 
 	csrfGroup.GET("/domain", domainsGet)
 	csrfGroup.GET("/domain/:domain_id", domainGet)
@@ -108,8 +113,13 @@ func Register(engine *gin.Engine) {
 
 	csrfGroup.GET("/event", eventGet)
 
+	csrfGroup.GET("/export", exportsGet)
+	csrfGroup.GET("/export/:export_id", exportGet)
+	csrfGroup.DELETE("/export/:export_id", exportDelete)
+
 	csrfGroup.GET("/firewall", firewallsGet)
 	csrfGroup.GET("/firewall/:firewall_id", firewallGet)
+	csrfGroup.GET("/firewall/:firewall_id/stats", firewallStatsGet)
 	csrfGroup.PUT("/firewall/:firewall_id", firewallPut)
 	csrfGroup.POST("/firewall", firewallPost)
 	csrfGroup.DELETE("/firewall", firewallsDelete)
@@ -118,6 +128,9 @@ func Register(engine *gin.Engine) {
 	csrfGroup.GET("/image", imagesGet)
 	csrfGroup.GET("/image/:image_id", imageGet)
 	csrfGroup.PUT("/image/:image_id", imagePut)
+	csrfGroup.POST("/image", imagePost)
+	csrfGroup.POST("/image/:image_id/restore", imageRestorePost)
+	csrfGroup.POST("/image/:image_id/export", imageExportPost)
 	csrfGroup.DELETE("/image", imagesDelete)
 	csrfGroup.DELETE("/image/:image_id", imageDelete)
 
@@ -125,6 +138,8 @@ func Register(engine *gin.Engine) {
 	csrfGroup.PUT("/instance", instancesPut)
 	csrfGroup.GET("/instance/:instance_id", instanceGet)
 	csrfGroup.GET("/instance/:instance_id/vnc", instanceVncGet)
+	csrfGroup.GET("/instance/:instance_id/firewall_log", instanceFirewallLogGet)
+	csrfGroup.POST("/instance/:instance_id/capture", instanceCapturePost)
 	csrfGroup.PUT("/instance/:instance_id", instancePut)
 	csrfGroup.POST("/instance", instancePost)
 	csrfGroup.DELETE("/instance", instancesDelete)
@@ -137,6 +152,8 @@ func Register(engine *gin.Engine) {
 
 	csrfGroup.GET("/node", nodesGet)
 	csrfGroup.GET("/node/:node_id", nodeGet)
+	csrfGroup.GET("/node/:node_id/backing", nodeBackingGet)
+	csrfGroup.GET("/node/:node_id/cache", nodeCacheGet)
 	csrfGroup.PUT("/node/:node_id", nodePut)
 	csrfGroup.PUT("/node/:node_id/:operation", nodeOperationPut)
 	csrfGroup.DELETE("/node/:node_id", nodeDelete)
@@ -186,6 +203,20 @@ func Register(engine *gin.Engine) {
 	csrfGroup.DELETE("/vpc", vpcsDelete)
 	csrfGroup.DELETE("/vpc/:vpc_id", vpcDelete)
 
+	csrfGroup.GET("/peering", peeringsGet)
+	csrfGroup.GET("/peering/:peering_id", peeringGet)
+	csrfGroup.PUT("/peering/:peering_id", peeringPut)
+	csrfGroup.POST("/peering", peeringPost)
+	csrfGroup.DELETE("/peering", peeringsDelete)
+	csrfGroup.DELETE("/peering/:peering_id", peeringDelete)
+
+	csrfGroup.GET("/floating_ip", floatingIpsGet)
+	csrfGroup.GET("/floating_ip/:floating_ip_id", floatingIpGet)
+	csrfGroup.PUT("/floating_ip/:floating_ip_id", floatingIpPut)
+	csrfGroup.POST("/floating_ip", floatingIpPost)
+	csrfGroup.DELETE("/floating_ip", floatingIpsDelete)
+	csrfGroup.DELETE("/floating_ip/:floating_ip_id", floatingIpDelete)
+
 	csrfGroup.GET("/zone", zonesGet)
 	csrfGroup.GET("/zone/:zone_id", zoneGet)
 	csrfGroup.PUT("/zone/:zone_id", zonePut)
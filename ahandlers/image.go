@@ -2,10 +2,15 @@ package ahandlers
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"path"
 	"strconv"
 	"strings"
 
 	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/pritunl/mongo-go-driver/bson"
 	"github.com/pritunl/mongo-go-driver/bson/primitive"
@@ -13,16 +18,63 @@ import (
 	"github.com/pritunl/pritunl-cloud/database"
 	"github.com/pritunl/pritunl-cloud/datacenter"
 	"github.com/pritunl/pritunl-cloud/demo"
+	"github.com/pritunl/pritunl-cloud/disk"
+	"github.com/pritunl/pritunl-cloud/errortypes"
 	"github.com/pritunl/pritunl-cloud/event"
 	"github.com/pritunl/pritunl-cloud/image"
+	"github.com/pritunl/pritunl-cloud/instance"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/paths"
+	"github.com/pritunl/pritunl-cloud/storage"
 	"github.com/pritunl/pritunl-cloud/utils"
 )
 
 type imageData struct {
-	Id           primitive.ObjectID `json:"id"`
+	Id                   primitive.ObjectID   `json:"id"`
+	Name                 string               `json:"name"`
+	Comment              string               `json:"comment"`
+	Organization         primitive.ObjectID   `json:"organization"`
+	OsFamily             string               `json:"os_family"`
+	OsVersion            string               `json:"os_version"`
+	Architecture         string               `json:"architecture"`
+	MinDisk              int                  `json:"min_disk"`
+	MinMemory            int                  `json:"min_memory"`
+	DefaultUser          string               `json:"default_user"`
+	CloudInit            bool                 `json:"cloud_init"`
+	Tags                 []string             `json:"tags"`
+	Lifecycle            string               `json:"lifecycle"`
+	Shares               []primitive.ObjectID `json:"shares"`
+	PublishedDatacenters []primitive.ObjectID `json:"published_datacenters"`
+	Prefetch             []primitive.ObjectID `json:"prefetch"`
+}
+
+type imageRestoreData struct {
+	Name             string             `json:"name"`
+	Comment          string             `json:"comment"`
+	Node             primitive.ObjectID `json:"node"`
+	Instance         primitive.ObjectID `json:"instance"`
+	Index            string             `json:"index"`
+	Size             int                `json:"size"`
+	DeleteProtection bool               `json:"delete_protection"`
+}
+
+type imageImportData struct {
 	Name         string             `json:"name"`
-	Comment        string             `json:"comment"`
+	Comment      string             `json:"comment"`
 	Organization primitive.ObjectID `json:"organization"`
+	Datacenter   primitive.ObjectID `json:"datacenter"`
+	Url          string             `json:"url"`
+	Firmware     string             `json:"firmware"`
+	Format       string             `json:"format"`
+	Checksum     string             `json:"checksum"`
+	Signature    string             `json:"signature"`
+	SigningKey   string             `json:"signing_key"`
+}
+
+type imageImportStatus struct {
+	Id    primitive.ObjectID `json:"id"`
+	Name  string             `json:"name"`
+	State string             `json:"state"`
 }
 
 type imagesData struct {
@@ -59,11 +111,35 @@ func imagePut(c *gin.Context) {
 	img.Name = dta.Name
 	img.Comment = dta.Comment
 	img.Organization = dta.Organization
+	img.OsFamily = dta.OsFamily
+	img.OsVersion = dta.OsVersion
+	img.Architecture = dta.Architecture
+	img.MinDisk = dta.MinDisk
+	img.MinMemory = dta.MinMemory
+	img.DefaultUser = dta.DefaultUser
+	img.CloudInit = dta.CloudInit
+	img.Tags = dta.Tags
+	img.Lifecycle = dta.Lifecycle
+	img.Shares = dta.Shares
+	img.PublishedDatacenters = dta.PublishedDatacenters
+	img.Prefetch = dta.Prefetch
 
 	fields := set.NewSet(
 		"name",
 		"comment",
 		"organization",
+		"os_family",
+		"os_version",
+		"architecture",
+		"min_disk",
+		"min_memory",
+		"default_user",
+		"cloud_init",
+		"tags",
+		"lifecycle",
+		"shares",
+		"published_datacenters",
+		"prefetch",
 	)
 
 	errData, err := img.Validate(db)
@@ -88,6 +164,378 @@ func imagePut(c *gin.Context) {
 	c.JSON(200, img)
 }
 
+// Reads the upload form fields until the file part, fields must precede
+// the file to validate the import before the file is written
+func imageUploadBind(c *gin.Context, dta *imageImportData) (
+	file *multipart.Part, err error) {
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Failed to read upload"),
+		}
+		return
+	}
+
+	for {
+		part, e := reader.NextPart()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(e, "handler: Failed to read upload"),
+			}
+			return
+		}
+
+		if part.FormName() == "file" {
+			file = part
+			break
+		}
+
+		valueByt, e := ioutil.ReadAll(io.LimitReader(part, 65536))
+		if e != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(e, "handler: Failed to read upload"),
+			}
+			return
+		}
+		value := string(valueByt)
+
+		switch part.FormName() {
+		case "name":
+			dta.Name = value
+		case "comment":
+			dta.Comment = value
+		case "organization":
+			dta.Organization, _ = primitive.ObjectIDFromHex(value)
+		case "datacenter":
+			dta.Datacenter, _ = primitive.ObjectIDFromHex(value)
+		case "firmware":
+			dta.Firmware = value
+		case "format":
+			dta.Format = value
+		case "checksum":
+			dta.Checksum = value
+		case "signature":
+			dta.Signature = value
+		case "signing_key":
+			dta.SigningKey = value
+		}
+	}
+
+	if file == nil {
+		err = &errortypes.ParseError{
+			errors.New("handler: Missing image upload file"),
+		}
+		return
+	}
+
+	return
+}
+
+func imagePost(c *gin.Context) {
+	if demo.Blocked(c) {
+		return
+	}
+
+	db := c.MustGet("db").(*database.Database)
+	dta := &imageImportData{}
+	srcPth := ""
+	started := false
+	var file *multipart.Part
+	var err error
+
+	defer func() {
+		if srcPth != "" && !started {
+			utils.Remove(srcPth)
+		}
+	}()
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, err = imageUploadBind(c, dta)
+		if err != nil {
+			utils.AbortWithError(c, 500, err)
+			return
+		}
+	} else {
+		err = c.Bind(dta)
+		if err != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(err, "handler: Bind error"),
+			}
+			utils.AbortWithError(c, 500, err)
+			return
+		}
+
+		if dta.Url == "" {
+			errData := &errortypes.ErrorData{
+				Error:   "image_source_required",
+				Message: "Missing image url or upload",
+			}
+			c.JSON(400, errData)
+			return
+		}
+	}
+
+	if dta.Format != "" && !data.ValidImageFormat(dta.Format) {
+		errData := &errortypes.ErrorData{
+			Error:   "image_format_invalid",
+			Message: "Image format is invalid",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	switch dta.Firmware {
+	case "", image.Unknown, image.Bios, image.Uefi:
+	default:
+		errData := &errortypes.ErrorData{
+			Error:   "image_firmware_invalid",
+			Message: "Image firmware is invalid",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	if dta.Signature != "" && dta.SigningKey == "" {
+		errData := &errortypes.ErrorData{
+			Error:   "image_signing_key_required",
+			Message: "Image signature requires signing key",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	if dta.Datacenter.IsZero() {
+		errData := &errortypes.ErrorData{
+			Error:   "datacenter_required",
+			Message: "Missing required datacenter",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	dc, err := datacenter.Get(db, dta.Datacenter)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if dc.PrivateStorage.IsZero() {
+		errData := &errortypes.ErrorData{
+			Error:   "private_storage_required",
+			Message: "Datacenter does not have private storage",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	if file != nil {
+		err = utils.ExistsMkdir(paths.GetTempPath(), 0755)
+		if err != nil {
+			utils.AbortWithError(c, 500, err)
+			return
+		}
+
+		srcPth = paths.GetImageTempPath()
+		err = data.WriteImageFile(file, srcPth)
+		if err != nil {
+			utils.AbortWithError(c, 500, err)
+			return
+		}
+	}
+
+	name := dta.Name
+	if name == "" && dta.Url != "" {
+		name = path.Base(strings.SplitN(dta.Url, "?", 2)[0])
+	}
+	if name == "" {
+		name = "Imported Image"
+	}
+
+	opts := &data.ImportOptions{
+		Id:           primitive.NewObjectID(),
+		Name:         name,
+		Comment:      dta.Comment,
+		Organization: dta.Organization,
+		Firmware:     dta.Firmware,
+		Format:       dta.Format,
+		Checksum:     dta.Checksum,
+		Signature:    dta.Signature,
+		SigningKey:   dta.SigningKey,
+	}
+
+	go data.RunImport(dc, opts, dta.Url, srcPth)
+	started = true
+
+	c.JSON(200, &imageImportStatus{
+		Id:    opts.Id,
+		Name:  opts.Name,
+		State: "importing",
+	})
+}
+
+func imageRestorePost(c *gin.Context) {
+	if demo.Blocked(c) {
+		return
+	}
+
+	db := c.MustGet("db").(*database.Database)
+	dta := &imageRestoreData{}
+
+	imageId, ok := utils.ParseObjectId(c.Param("image_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	err := c.Bind(dta)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	img, err := image.Get(db, imageId)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if !img.Restorable() {
+		errData := &errortypes.ErrorData{
+			Error:   "invalid_restore_image",
+			Message: "Only backup and snapshot images can be restored",
+		}
+
+		c.JSON(400, errData)
+		return
+	}
+
+	store, err := storage.Get(db, img.Storage)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	available, err := data.ImageAvailable(store, img)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+	if !available {
+		errData := &errortypes.ErrorData{
+			Error:   "image_not_available",
+			Message: "Image not restored from archive",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	ndeId := dta.Node
+	size := dta.Size
+
+	if !dta.Instance.IsZero() {
+		inst, e := instance.Get(db, dta.Instance)
+		if e != nil {
+			utils.AbortWithError(c, 500, e)
+			return
+		}
+
+		if inst.Organization != img.Organization {
+			errData := &errortypes.ErrorData{
+				Error:   "instance_organization_invalid",
+				Message: "Instance must be in the image organization",
+			}
+			c.JSON(400, errData)
+			return
+		}
+
+		if ndeId.IsZero() {
+			ndeId = inst.Node
+		} else if ndeId != inst.Node {
+			errData := &errortypes.ErrorData{
+				Error:   "instance_node_invalid",
+				Message: "Node must match instance node",
+			}
+			c.JSON(400, errData)
+			return
+		}
+	}
+
+	if !img.Disk.IsZero() {
+		srcDsk, e := disk.Get(db, img.Disk)
+		if e != nil {
+			if _, ok := e.(*database.NotFoundError); !ok {
+				utils.AbortWithError(c, 500, e)
+				return
+			}
+		} else {
+			if ndeId.IsZero() {
+				ndeId = srcDsk.Node
+			}
+			if srcDsk.Size > size {
+				size = srcDsk.Size
+			}
+		}
+	}
+
+	if !ndeId.IsZero() {
+		_, err = node.Get(db, ndeId)
+		if err != nil {
+			if _, ok := err.(*database.NotFoundError); ok {
+				errData := &errortypes.ErrorData{
+					Error:   "node_invalid",
+					Message: "Node does not exist",
+				}
+				c.JSON(400, errData)
+			} else {
+				utils.AbortWithError(c, 500, err)
+			}
+			return
+		}
+	}
+
+	name := dta.Name
+	if name == "" {
+		name = fmt.Sprintf("%s-restore", img.Name)
+	}
+
+	dsk := &disk.Disk{
+		Name:             name,
+		Comment:          dta.Comment,
+		Organization:     img.Organization,
+		Instance:         dta.Instance,
+		Index:            dta.Index,
+		Node:             ndeId,
+		Image:            img.Id,
+		DeleteProtection: dta.DeleteProtection,
+		Size:             size,
+	}
+
+	errData, err := dsk.Validate(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if errData != nil {
+		c.JSON(400, errData)
+		return
+	}
+
+	err = dsk.Insert(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	event.PublishDispatch(db, "disk.change")
+
+	c.JSON(200, dsk)
+}
+
 func imageDelete(c *gin.Context) {
 	if demo.Blocked(c) {
 		return
@@ -181,6 +629,9 @@ func imagesGet(c *gin.Context) {
 			"storage": &bson.M{
 				"$in": storages,
 			},
+			"lifecycle": &bson.M{
+				"$ne": image.Obsolete,
+			},
 		}
 
 		images, err := image.GetAllNames(db, query)
@@ -196,6 +647,9 @@ func imagesGet(c *gin.Context) {
 		if !dc.PrivateStorage.IsZero() {
 			query = &bson.M{
 				"storage": dc.PrivateStorage,
+				"lifecycle": &bson.M{
+					"$ne": image.Obsolete,
+				},
 			}
 
 			images2, err := image.GetAllNames(db, query)
@@ -245,6 +699,16 @@ func imagesGet(c *gin.Context) {
 			query["type"] = typ
 		}
 
+		tag := strings.TrimSpace(c.Query("tag"))
+		if tag != "" {
+			query["tags"] = tag
+		}
+
+		lifecycle := strings.TrimSpace(c.Query("lifecycle"))
+		if lifecycle != "" {
+			query["lifecycle"] = lifecycle
+		}
+
 		organization, ok := utils.ParseObjectId(c.Query("organization"))
 		if ok {
 			query["organization"] = organization
@@ -16,6 +16,7 @@ import (
 	"github.com/pritunl/pritunl-cloud/drive"
 	"github.com/pritunl/pritunl-cloud/errortypes"
 	"github.com/pritunl/pritunl-cloud/event"
+	"github.com/pritunl/pritunl-cloud/firewall"
 	"github.com/pritunl/pritunl-cloud/image"
 	"github.com/pritunl/pritunl-cloud/instance"
 	"github.com/pritunl/pritunl-cloud/iscsi"
@@ -27,32 +28,35 @@ import (
 )
 
 type instanceData struct {
-	Id               primitive.ObjectID `json:"id"`
-	Organization     primitive.ObjectID `json:"organization"`
-	Zone             primitive.ObjectID `json:"zone"`
-	Vpc              primitive.ObjectID `json:"vpc"`
-	Subnet           primitive.ObjectID `json:"subnet"`
-	Node             primitive.ObjectID `json:"node"`
-	Image            primitive.ObjectID `json:"image"`
-	ImageBacking     bool               `json:"image_backing"`
-	Domain           primitive.ObjectID `json:"domain"`
-	Name             string             `json:"name"`
-	Comment          string             `json:"comment"`
-	State            string             `json:"state"`
-	Uefi             bool               `json:"uefi"`
-	DeleteProtection bool               `json:"delete_protection"`
-	InitDiskSize     int                `json:"init_disk_size"`
-	Memory           int                `json:"memory"`
-	Processors       int                `json:"processors"`
-	NetworkRoles     []string           `json:"network_roles"`
-	UsbDevices       []*usb.Device      `json:"usb_devices"`
-	PciDevices       []*pci.Device      `json:"pci_devices"`
-	DriveDevices     []*drive.Device    `json:"drive_devices"`
-	IscsiDevices     []*iscsi.Device    `json:"iscsi_devices"`
-	Vnc              bool               `json:"vnc"`
-	NoPublicAddress  bool               `json:"no_public_address"`
-	NoHostAddress    bool               `json:"no_host_address"`
-	Count            int                `json:"count"`
+	Id               primitive.ObjectID         `json:"id"`
+	Organization     primitive.ObjectID         `json:"organization"`
+	Zone             primitive.ObjectID         `json:"zone"`
+	Vpc              primitive.ObjectID         `json:"vpc"`
+	Subnet           primitive.ObjectID         `json:"subnet"`
+	StaticPrivateIp  string                     `json:"static_private_ip"`
+	Node             primitive.ObjectID         `json:"node"`
+	Image            primitive.ObjectID         `json:"image"`
+	ImageBacking     bool                       `json:"image_backing"`
+	Domain           primitive.ObjectID         `json:"domain"`
+	Name             string                     `json:"name"`
+	Comment          string                     `json:"comment"`
+	State            string                     `json:"state"`
+	Uefi             bool                       `json:"uefi"`
+	DeleteProtection bool                       `json:"delete_protection"`
+	InitDiskSize     int                        `json:"init_disk_size"`
+	Memory           int                        `json:"memory"`
+	Processors       int                        `json:"processors"`
+	NetworkRoles     []string                   `json:"network_roles"`
+	NetworkAdapters  []*instance.NetworkAdapter `json:"network_adapters"`
+	UsbDevices       []*usb.Device              `json:"usb_devices"`
+	PciDevices       []*pci.Device              `json:"pci_devices"`
+	DriveDevices     []*drive.Device            `json:"drive_devices"`
+	IscsiDevices     []*iscsi.Device            `json:"iscsi_devices"`
+	Vnc              bool                       `json:"vnc"`
+	NoPublicAddress  bool                       `json:"no_public_address"`
+	NoHostAddress    bool                       `json:"no_host_address"`
+	DhcpServer       bool                       `json:"dhcp_server"`
+	Count            int                        `json:"count"`
 }
 
 type instanceMultiData struct {
@@ -97,6 +101,7 @@ func instancePut(c *gin.Context) {
 	inst.Comment = dta.Comment
 	inst.Vpc = dta.Vpc
 	inst.Subnet = dta.Subnet
+	inst.StaticPrivateIp = dta.StaticPrivateIp
 	if dta.State != "" {
 		inst.State = dta.State
 	}
@@ -105,6 +110,7 @@ func instancePut(c *gin.Context) {
 	inst.Memory = dta.Memory
 	inst.Processors = dta.Processors
 	inst.NetworkRoles = dta.NetworkRoles
+	inst.NetworkAdapters = dta.NetworkAdapters
 	inst.UsbDevices = dta.UsbDevices
 	inst.PciDevices = dta.PciDevices
 	inst.DriveDevices = dta.DriveDevices
@@ -113,12 +119,14 @@ func instancePut(c *gin.Context) {
 	inst.Domain = dta.Domain
 	inst.NoPublicAddress = dta.NoPublicAddress
 	inst.NoHostAddress = dta.NoHostAddress
+	inst.DhcpServer = dta.DhcpServer
 
 	fields := set.NewSet(
 		"name",
 		"comment",
 		"vpc",
 		"subnet",
+		"static_private_ip",
 		"state",
 		"restart",
 		"restart_block_ip",
@@ -127,6 +135,7 @@ func instancePut(c *gin.Context) {
 		"memory",
 		"processors",
 		"network_roles",
+		"network_adapters",
 		"usb_devices",
 		"pci_devices",
 		"drive_devices",
@@ -137,6 +146,7 @@ func instancePut(c *gin.Context) {
 		"domain",
 		"no_public_address",
 		"no_host_address",
+		"dhcp_server",
 	)
 
 	errData, err := inst.Validate(db)
@@ -248,6 +258,7 @@ func instancePost(c *gin.Context) {
 			Zone:             dta.Zone,
 			Vpc:              dta.Vpc,
 			Subnet:           dta.Subnet,
+			StaticPrivateIp:  dta.StaticPrivateIp,
 			Node:             dta.Node,
 			Image:            dta.Image,
 			ImageBacking:     dta.ImageBacking,
@@ -259,6 +270,7 @@ func instancePost(c *gin.Context) {
 			Memory:           dta.Memory,
 			Processors:       dta.Processors,
 			NetworkRoles:     dta.NetworkRoles,
+			NetworkAdapters:  dta.NetworkAdapters,
 			UsbDevices:       dta.UsbDevices,
 			PciDevices:       dta.PciDevices,
 			DriveDevices:     dta.DriveDevices,
@@ -267,6 +279,7 @@ func instancePost(c *gin.Context) {
 			Domain:           dta.Domain,
 			NoPublicAddress:  dta.NoPublicAddress,
 			NoHostAddress:    dta.NoHostAddress,
+			DhcpServer:       dta.DhcpServer,
 		}
 
 		errData, err := inst.Validate(db)
@@ -582,3 +595,21 @@ func instanceVncGet(c *gin.Context) {
 		return
 	}
 }
+
+func instanceFirewallLogGet(c *gin.Context) {
+	db := c.MustGet("db").(*database.Database)
+
+	instanceId, ok := utils.ParseObjectId(c.Param("instance_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	entries, err := firewall.GetLogs(db, instanceId, 500)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, entries)
+}
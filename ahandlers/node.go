@@ -4,17 +4,20 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dropbox/godropbox/container/set"
 	"github.com/gin-gonic/gin"
 	"github.com/pritunl/mongo-go-driver/bson"
 	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/backing"
 	"github.com/pritunl/pritunl-cloud/database"
 	"github.com/pritunl/pritunl-cloud/demo"
 	"github.com/pritunl/pritunl-cloud/drive"
 	"github.com/pritunl/pritunl-cloud/errortypes"
 	"github.com/pritunl/pritunl-cloud/event"
 	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/prefetch"
 	"github.com/pritunl/pritunl-cloud/utils"
 )
 
@@ -51,6 +54,7 @@ type nodeData struct {
 	ForwardedForHeader   string                  `json:"forwarded_for_header"`
 	ForwardedProtoHeader string                  `json:"forwarded_proto_header"`
 	Firewall             bool                    `json:"firewall"`
+	FirewallBackend      string                  `json:"firewall_backend"`
 	NetworkRoles         []string                `json:"network_roles"`
 	OracleUser           string                  `json:"oracle_user"`
 	OracleHostRoute      bool                    `json:"oracle_host_route"`
@@ -116,6 +120,7 @@ func nodePut(c *gin.Context) {
 	nde.ForwardedForHeader = data.ForwardedForHeader
 	nde.ForwardedProtoHeader = data.ForwardedProtoHeader
 	nde.Firewall = data.Firewall
+	nde.FirewallBackend = data.FirewallBackend
 	nde.NetworkRoles = data.NetworkRoles
 	nde.OracleUser = data.OracleUser
 	nde.OracleHostRoute = data.OracleHostRoute
@@ -151,6 +156,7 @@ func nodePut(c *gin.Context) {
 		"forwarded_for_header",
 		"forwarded_proto_header",
 		"firewall",
+		"firewall_backend",
 		"network_roles",
 		"oracle_user",
 		"oracle_host_route",
@@ -287,6 +293,52 @@ func nodeGet(c *gin.Context) {
 	c.JSON(200, nde)
 }
 
+func nodeBackingGet(c *gin.Context) {
+	db := c.MustGet("db").(*database.Database)
+
+	nodeId, ok := utils.ParseObjectId(c.Param("node_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	report, err := backing.Get(db, nodeId)
+	if err != nil {
+		if _, ok := err.(*database.NotFoundError); ok {
+			report = backing.NewReport(nodeId)
+			report.Timestamp = time.Time{}
+		} else {
+			utils.AbortWithError(c, 500, err)
+			return
+		}
+	}
+
+	c.JSON(200, report)
+}
+
+func nodeCacheGet(c *gin.Context) {
+	db := c.MustGet("db").(*database.Database)
+
+	nodeId, ok := utils.ParseObjectId(c.Param("node_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	status, err := prefetch.Get(db, nodeId)
+	if err != nil {
+		if _, ok := err.(*database.NotFoundError); ok {
+			status = prefetch.NewStatus(nodeId, primitive.NilObjectID)
+			status.Timestamp = time.Time{}
+		} else {
+			utils.AbortWithError(c, 500, err)
+			return
+		}
+	}
+
+	c.JSON(200, status)
+}
+
 func nodesGet(c *gin.Context) {
 	db := c.MustGet("db").(*database.Database)
 
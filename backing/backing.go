@@ -0,0 +1,91 @@
+package backing
+
+import (
+	"time"
+
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/mongo-go-driver/mongo/options"
+	"github.com/pritunl/pritunl-cloud/database"
+)
+
+type Image struct {
+	Name       string               `bson:"name" json:"name"`
+	Image      primitive.ObjectID   `bson:"image" json:"image"`
+	ImageName  string               `bson:"image_name" json:"image_name"`
+	Etag       string               `bson:"etag" json:"etag"`
+	Size       int64                `bson:"size" json:"size"`
+	Disks      []primitive.ObjectID `bson:"disks" json:"disks"`
+	Current    bool                 `bson:"current" json:"current"`
+	Deprecated bool                 `bson:"deprecated" json:"deprecated"`
+	Orphaned   bool                 `bson:"orphaned" json:"orphaned"`
+	LastUsed   time.Time            `bson:"last_used" json:"last_used"`
+}
+
+type Report struct {
+	Id             primitive.ObjectID `bson:"_id" json:"id"`
+	Timestamp      time.Time          `bson:"timestamp" json:"timestamp"`
+	TotalSize      int64              `bson:"total_size" json:"total_size"`
+	ReferencedSize int64              `bson:"referenced_size" json:"referenced_size"`
+	OrphanedSize   int64              `bson:"orphaned_size" json:"orphaned_size"`
+	DuplicateSize  int64              `bson:"duplicate_size" json:"duplicate_size"`
+	Removed        int                `bson:"removed" json:"removed"`
+	RemovedSize    int64              `bson:"removed_size" json:"removed_size"`
+	Flattened      int                `bson:"flattened" json:"flattened"`
+	Images         []*Image           `bson:"images" json:"images"`
+}
+
+func (r *Report) Add(img *Image) {
+	r.TotalSize += img.Size
+	if img.Orphaned {
+		r.OrphanedSize += img.Size
+	} else {
+		r.ReferencedSize += img.Size
+	}
+	if !img.Current {
+		r.DuplicateSize += img.Size
+	}
+
+	r.Images = append(r.Images, img)
+}
+
+func (r *Report) Commit(db *database.Database) (err error) {
+	coll := db.BackingReports()
+
+	opts := &options.UpdateOptions{}
+	opts.SetUpsert(true)
+
+	_, err = coll.UpdateOne(db, &bson.M{
+		"_id": r.Id,
+	}, &bson.M{
+		"$set": r,
+	}, opts)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func Get(db *database.Database, ndeId primitive.ObjectID) (
+	report *Report, err error) {
+
+	coll := db.BackingReports()
+	report = &Report{}
+
+	err = coll.FindOneId(ndeId, report)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func NewReport(ndeId primitive.ObjectID) *Report {
+	return &Report{
+		Id:        ndeId,
+		Timestamp: time.Now(),
+		Images:    []*Image{},
+	}
+}
@@ -1,11 +1,12 @@
 package backup
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
-	"strings"
 	"time"
 
 	"github.com/dropbox/godropbox/container/set"
@@ -26,11 +27,38 @@ import (
 
 type Backup struct {
 	Destination string
+	ReportPath  string
 	node        *node.Node
 	virtPath    string
+	target      target
+	report      *Report
 	errorCount  int
 }
 
+func getFileHash(pth string) (hash string, size int64, err error) {
+	file, err := os.Open(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "backup: Failed to open file"),
+		}
+		return
+	}
+	defer file.Close()
+
+	hsh := sha256.New()
+	size, err = io.Copy(hsh, file)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "backup: Failed to read file"),
+		}
+		return
+	}
+
+	hash = fmt.Sprintf("%x", hsh.Sum(nil))
+
+	return
+}
+
 func (b *Backup) backupDisk(db *database.Database,
 	dsk *disk.Disk, dest string) (err error) {
 
@@ -80,271 +108,252 @@ func (b *Backup) backupDisk(db *database.Database,
 	return
 }
 
-func (b *Backup) backupDisks(db *database.Database) (err error) {
-	logrus.WithFields(logrus.Fields{
-		"node_id": b.node.Id.Hex(),
-	}).Info("backup: Exporting disks")
-
-	trashDir := path.Join(b.Destination, "trash")
-	disksDir := path.Join(b.Destination, "disks")
-	err = utils.ExistsMkdir(disksDir, 0755)
+func (b *Backup) trashStale(dir, typ string, names set.Set) (err error) {
+	exported, err := b.target.List(dir)
 	if err != nil {
 		return
 	}
 
-	disks, err := disk.GetAll(db, &bson.M{
-		"node": b.node.Id,
-	})
-
-	diskFilenames := set.NewSet()
-	for _, dsk := range disks {
-		filename := fmt.Sprintf("%s.qcow2", dsk.Id.Hex())
-		diskFilenames.Add(filename)
+	for nameInf := range exported.Iter() {
+		name := nameInf.(string)
+		if names.Contains(name) {
+			continue
+		}
 
-		destPath := path.Join(disksDir, filename)
+		item := &ReportItem{
+			Type:  typ,
+			Name:  name,
+			State: Trashed,
+		}
 
-		err = b.backupDisk(db, dsk, destPath)
-		if err != nil {
+		e := b.target.Trash(dir, name)
+		if e != nil {
 			b.errorCount += 1
+			item.State = Failed
+			item.Error = e.Error()
+
 			logrus.WithFields(logrus.Fields{
-				"disk_id": dsk.Id.Hex(),
-				"error":   err,
-			}).Error("qemu: Failed to backup disk")
+				"node_id": b.node.Id.Hex(),
+				"type":    typ,
+				"name":    name,
+				"error":   e,
+			}).Error("backup: Failed to move file to trash")
 		} else {
 			logrus.WithFields(logrus.Fields{
 				"node_id": b.node.Id.Hex(),
-				"disk_id": dsk.Id.Hex(),
-			}).Info("backup: Disk exported")
+				"type":    typ,
+				"name":    name,
+			}).Info("backup: File moved to trash")
 		}
+
+		b.report.Add(item)
 	}
 
-	exportedDisks, err := ioutil.ReadDir(disksDir)
-	if err != nil {
-		err = &errortypes.ReadError{
-			errors.Wrap(err, "backup: Failed to read disks directory"),
-		}
-		return
+	return
+}
+
+func (b *Backup) storeFile(dir, typ, name, pth string, temp bool) {
+	item := &ReportItem{
+		Type:  typ,
+		Name:  name,
+		State: Uploaded,
 	}
 
-	trashDiskDir := path.Join(trashDir, "disks")
-	for _, item := range exportedDisks {
-		filename := item.Name()
-		diskPath := path.Join(disksDir, filename)
-		newDiskPath := path.Join(trashDiskDir, filename)
-		idStr := strings.Split(path.Base(filename), ".")[0]
+	err := func() (err error) {
+		hash, size, err := getFileHash(pth)
+		if err != nil {
+			return
+		}
+		item.Sha256 = hash
+		item.Size = size
 
-		if !diskFilenames.Contains(filename) {
-			err = utils.ExistsMkdir(trashDiskDir, 0755)
-			if err != nil {
-				return
-			}
+		curHash, err := b.target.Hash(dir, name)
+		if err != nil {
+			return
+		}
 
-			err = os.Rename(diskPath, newDiskPath)
-			if err != nil {
-				b.errorCount += 1
-				logrus.WithFields(logrus.Fields{
-					"node_id": b.node.Id.Hex(),
-					"disk_id": idStr,
-					"error":   err,
-				}).Error("backup: Failed to move disk to trash")
-			} else {
-				logrus.WithFields(logrus.Fields{
-					"node_id": b.node.Id.Hex(),
-					"disk_id": idStr,
-				}).Info("backup: Disk moved to trash")
+		if curHash == hash {
+			item.State = Skipped
+			if temp {
+				_ = os.Remove(pth)
 			}
+			return
+		}
+
+		err = b.target.Store(dir, name, pth, hash, temp)
+		if err != nil {
+			return
 		}
+
+		return
+	}()
+	if err != nil {
+		b.errorCount += 1
+		item.State = Failed
+		item.Error = err.Error()
+
+		logrus.WithFields(logrus.Fields{
+			"node_id": b.node.Id.Hex(),
+			"type":    typ,
+			"name":    name,
+			"error":   err,
+		}).Error("backup: Failed to store file")
+	} else {
+		logrus.WithFields(logrus.Fields{
+			"node_id": b.node.Id.Hex(),
+			"type":    typ,
+			"name":    name,
+			"state":   item.State,
+		}).Info("backup: File exported")
 	}
 
-	return
+	b.report.Add(item)
 }
 
-func (b *Backup) backupBackingDisks(db *database.Database) (err error) {
+func (b *Backup) backupDisks(db *database.Database) (err error) {
 	logrus.WithFields(logrus.Fields{
 		"node_id": b.node.Id.Hex(),
-	}).Info("backup: Exporting backing disks")
+	}).Info("backup: Exporting disks")
 
-	trashDir := path.Join(b.Destination, "trash")
-	backingDisksDir := path.Join(b.Destination, "backing")
-	curBackingDisksDir := path.Join(b.virtPath, "backing")
-	err = utils.ExistsMkdir(backingDisksDir, 0755)
+	disks, err := disk.GetAll(db, &bson.M{
+		"node": b.node.Id,
+	})
 	if err != nil {
 		return
 	}
 
-	exists, err := utils.Exists(curBackingDisksDir)
-	if err != nil {
-		return
-	}
+	diskFilenames := set.NewSet()
+	for _, dsk := range disks {
+		filename := fmt.Sprintf("%s.qcow2", dsk.Id.Hex())
+		diskFilenames.Add(filename)
 
-	curBackingDisks := []os.FileInfo{}
-	if exists {
-		curBackingDisks, err = ioutil.ReadDir(curBackingDisksDir)
+		tempPath := b.target.TempPath("disks", filename)
+		err = utils.ExistsMkdir(path.Dir(tempPath), 0755)
 		if err != nil {
-			err = &errortypes.ReadError{
-				errors.Wrap(
-					err,
-					"backup: Failed to read backing disks directory",
-				),
-			}
 			return
 		}
-	}
 
-	backingFilenames := set.NewSet()
-	for _, item := range curBackingDisks {
-		filename := item.Name()
-		backingFilenames.Add(filename)
-
-		backingPath := path.Join(curBackingDisksDir, filename)
-		newBackingPath := path.Join(backingDisksDir, filename)
+		if b.target.Staged("disks", filename) {
+			logrus.WithFields(logrus.Fields{
+				"disk_id": dsk.Id.Hex(),
+			}).Info("backup: Resuming staged disk upload")
 
-		_ = os.Remove(newBackingPath)
+			b.storeFile("disks", "disk", filename, tempPath, true)
+			continue
+		}
 
-		err = utils.Exec("", "cp", backingPath, newBackingPath)
+		err = b.backupDisk(db, dsk, tempPath)
 		if err != nil {
-			return
+			_ = os.Remove(tempPath)
+			b.errorCount += 1
+			b.report.Add(&ReportItem{
+				Type:  "disk",
+				Name:  filename,
+				State: Failed,
+				Error: err.Error(),
+			})
+
+			logrus.WithFields(logrus.Fields{
+				"disk_id": dsk.Id.Hex(),
+				"error":   err,
+			}).Error("qemu: Failed to backup disk")
+
+			err = nil
+			continue
 		}
 
-		logrus.WithFields(logrus.Fields{
-			"node_id":      b.node.Id.Hex(),
-			"backing_disk": filename,
-		}).Info("backup: Backing disk exported")
+		b.storeFile("disks", "disk", filename, tempPath, true)
 	}
 
-	exportedBackingDisks, err := ioutil.ReadDir(backingDisksDir)
+	err = b.trashStale("disks", "disk", diskFilenames)
 	if err != nil {
-		err = &errortypes.ReadError{
-			errors.Wrap(
-				err,
-				"backup: Failed to read backing disks directory",
-			),
-		}
 		return
 	}
 
-	trashBackingDir := path.Join(trashDir, "backing")
-	for _, item := range exportedBackingDisks {
-		filename := item.Name()
-		backingPath := path.Join(backingDisksDir, filename)
-		newBackingPath := path.Join(trashBackingDir, filename)
-
-		if !backingFilenames.Contains(filename) {
-			err = utils.ExistsMkdir(trashBackingDir, 0755)
-			if err != nil {
-				return
-			}
-
-			err = os.Rename(backingPath, newBackingPath)
-			if err != nil {
-				b.errorCount += 1
-				logrus.WithFields(logrus.Fields{
-					"node_id":      b.node.Id.Hex(),
-					"backing_disk": filename,
-					"error":        err,
-				}).Error("backup: Failed to move backing disk to trash")
-			} else {
-				logrus.WithFields(logrus.Fields{
-					"node_id":      b.node.Id.Hex(),
-					"backing_disk": filename,
-				}).Info("backup: Backing disk moved to trash")
-			}
-		}
-	}
-
 	return
 }
 
-func (b *Backup) backupLeases(db *database.Database) (err error) {
+func (b *Backup) backupDir(dir, typ string) (err error) {
 	logrus.WithFields(logrus.Fields{
 		"node_id": b.node.Id.Hex(),
-	}).Info("backup: Exporting leases")
+		"type":    typ,
+	}).Info("backup: Exporting directory")
 
-	trashDir := path.Join(b.Destination, "trash")
-	leasesDir := path.Join(b.Destination, "leases")
-	curLeasesDir := path.Join(b.virtPath, "leases")
-	err = utils.ExistsMkdir(leasesDir, 0755)
-	if err != nil {
-		return
-	}
+	curDir := path.Join(b.virtPath, dir)
 
-	exists, err := utils.Exists(curLeasesDir)
+	exists, err := utils.Exists(curDir)
 	if err != nil {
 		return
 	}
 
-	curLeases := []os.FileInfo{}
+	curItems := []os.FileInfo{}
 	if exists {
-		curLeases, err = ioutil.ReadDir(curLeasesDir)
+		curItems, err = ioutil.ReadDir(curDir)
 		if err != nil {
 			err = &errortypes.ReadError{
-				errors.Wrap(
-					err,
-					"backup: Failed to read leases directory",
-				),
+				errors.Wrapf(err, "backup: Failed to read %s directory", dir),
 			}
 			return
 		}
 	}
 
-	leaseFilename := set.NewSet()
-	for _, item := range curLeases {
+	filenames := set.NewSet()
+	for _, item := range curItems {
+		if item.IsDir() {
+			continue
+		}
+
 		filename := item.Name()
-		leaseFilename.Add(filename)
+		filenames.Add(filename)
 
-		leasePath := path.Join(curLeasesDir, filename)
-		newLeasePath := path.Join(leasesDir, filename)
+		b.storeFile(dir, typ, filename, path.Join(curDir, filename), false)
+	}
 
-		_ = os.Remove(newLeasePath)
+	err = b.trashStale(dir, typ, filenames)
+	if err != nil {
+		return
+	}
 
-		err = utils.Exec("", "cp", leasePath, newLeasePath)
-		if err != nil {
-			return
-		}
+	return
+}
 
-		logrus.WithFields(logrus.Fields{
-			"node_id": b.node.Id.Hex(),
-			"lease":   filename,
-		}).Info("backup: Lease exported")
+func (b *Backup) backupBackingDisks(db *database.Database) (err error) {
+	err = b.backupDir("backing", "backing_disk")
+	if err != nil {
+		return
 	}
 
-	exportedLeases, err := ioutil.ReadDir(leasesDir)
+	return
+}
+
+func (b *Backup) backupLeases(db *database.Database) (err error) {
+	err = b.backupDir("leases", "lease")
 	if err != nil {
-		err = &errortypes.ReadError{
-			errors.Wrap(
-				err,
-				"backup: Failed to read leases directory",
-			),
-		}
 		return
 	}
 
-	trashLeasesDir := path.Join(trashDir, "leases")
-	for _, item := range exportedLeases {
-		filename := item.Name()
-		leasePath := path.Join(leasesDir, filename)
-		newLeasePath := path.Join(trashLeasesDir, filename)
+	return
+}
 
-		if !leaseFilename.Contains(filename) {
-			err = utils.ExistsMkdir(trashLeasesDir, 0755)
-			if err != nil {
-				return
-			}
+func (b *Backup) writeReport() (err error) {
+	b.report.End = time.Now()
+	b.report.ErrorCount = b.errorCount
+	b.report.Success = b.errorCount == 0
 
-			err = os.Rename(leasePath, newLeasePath)
-			if err != nil {
-				b.errorCount += 1
-				logrus.WithFields(logrus.Fields{
-					"node_id": b.node.Id.Hex(),
-					"lease":   filename,
-					"error":   err,
-				}).Error("backup: Failed to move lease to trash")
-			} else {
-				logrus.WithFields(logrus.Fields{
-					"node_id": b.node.Id.Hex(),
-					"lease":   filename,
-				}).Info("backup: Lease moved to trash")
-			}
+	data, err := b.report.Marshal()
+	if err != nil {
+		return
+	}
+
+	err = b.target.WriteReport(data)
+	if err != nil {
+		return
+	}
+
+	if b.ReportPath != "" {
+		err = utils.CreateWrite(b.ReportPath, string(data), 0644)
+		if err != nil {
+			return
 		}
 	}
 
@@ -371,24 +380,49 @@ func (b *Backup) Run() (err error) {
 	b.node = nde
 	b.virtPath = nde.GetVirtPath()
 
-	err = b.backupDisks(db)
+	b.target, err = newTarget(db, b.Destination,
+		path.Join(b.virtPath, "backup"))
 	if err != nil {
 		return
 	}
 
-	err = b.backupBackingDisks(db)
+	b.report = &Report{
+		Node:        nde.Id,
+		Destination: b.target.String(),
+		Start:       time.Now(),
+		Items:       []*ReportItem{},
+	}
+
+	err = b.backupDisks(db)
+	if err == nil {
+		err = b.backupBackingDisks(db)
+	}
+	if err == nil {
+		err = b.backupLeases(db)
+	}
 	if err != nil {
-		return
+		b.errorCount += 1
+	}
+
+	e := b.writeReport()
+	if e != nil {
+		logrus.WithFields(logrus.Fields{
+			"node_id": b.node.Id.Hex(),
+			"error":   e,
+		}).Error("backup: Failed to write report")
+		if err == nil {
+			err = e
+		}
 	}
 
-	err = b.backupLeases(db)
 	if err != nil {
 		return
 	}
 
 	if b.errorCount > 0 {
 		err = &errortypes.ExecError{
-			errors.Wrap(err, "backup: Backup encountered errors"),
+			errors.Newf("backup: Backup encountered %d errors",
+				b.errorCount),
 		}
 		return
 	}
@@ -396,8 +430,9 @@ func (b *Backup) Run() (err error) {
 	return
 }
 
-func New(dest string) *Backup {
+func New(dest, reportPath string) *Backup {
 	return &Backup{
 		Destination: dest,
+		ReportPath:  reportPath,
 	}
 }
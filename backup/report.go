@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+)
+
+const (
+	Uploaded = "uploaded"
+	Skipped  = "skipped"
+	Trashed  = "trashed"
+	Failed   = "failed"
+)
+
+type ReportItem struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
+	State  string `json:"state"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Node        primitive.ObjectID `json:"node"`
+	Destination string             `json:"destination"`
+	Start       time.Time          `json:"start"`
+	End         time.Time          `json:"end"`
+	Success     bool               `json:"success"`
+	ErrorCount  int                `json:"error_count"`
+	Uploaded    int                `json:"uploaded"`
+	Skipped     int                `json:"skipped"`
+	Trashed     int                `json:"trashed"`
+	Failed      int                `json:"failed"`
+	Items       []*ReportItem      `json:"items"`
+}
+
+func (r *Report) Add(item *ReportItem) {
+	switch item.State {
+	case Uploaded:
+		r.Uploaded += 1
+	case Skipped:
+		r.Skipped += 1
+	case Trashed:
+		r.Trashed += 1
+	case Failed:
+		r.Failed += 1
+	}
+
+	r.Items = append(r.Items, item)
+}
+
+func (r *Report) Marshal() (data []byte, err error) {
+	data, err = json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "backup: Failed to marshal report"),
+		}
+		return
+	}
+
+	return
+}
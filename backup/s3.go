@@ -0,0 +1,439 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	minio "github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/credentials"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/storage"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	minPartSize = 64 * 1024 * 1024
+	maxParts    = 9000
+)
+
+type uploadState struct {
+	Key      string `json:"key"`
+	UploadId string `json:"upload_id"`
+	Hash     string `json:"hash"`
+}
+
+type s3Target struct {
+	store    *storage.Storage
+	prefix   string
+	tempDir  string
+	stateDir string
+	core     *minio.Core
+}
+
+func (t *s3Target) String() string {
+	return fmt.Sprintf("s3://%s/%s/%s", t.store.Endpoint,
+		t.store.Bucket, t.prefix)
+}
+
+func (t *s3Target) key(dir, name string) string {
+	return path.Join(t.prefix, dir, name)
+}
+
+func (t *s3Target) connect() (err error) {
+	if t.core != nil {
+		return
+	}
+
+	core, err := minio.NewCore(t.store.Endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(t.store.AccessKey,
+			t.store.SecretKey, ""),
+		Secure: !t.store.Insecure,
+	})
+	if err != nil {
+		err = &errortypes.ConnectionError{
+			errors.Wrap(err, "backup: Failed to connect to storage"),
+		}
+		return
+	}
+
+	t.core = core
+
+	return
+}
+
+func (t *s3Target) TempPath(dir, name string) string {
+	return path.Join(t.tempDir, fmt.Sprintf("backup-%s-%s", dir, name))
+}
+
+func (t *s3Target) List(dir string) (names set.Set, err error) {
+	names = set.NewSet()
+
+	err = t.connect()
+	if err != nil {
+		return
+	}
+
+	prefix := t.key(dir, "") + "/"
+	for object := range t.core.ListObjects(
+		context.Background(),
+		t.store.Bucket, minio.ListObjectsOptions{
+			Prefix:    prefix,
+			Recursive: false,
+		},
+	) {
+		if object.Err != nil {
+			err = &errortypes.RequestError{
+				errors.Wrap(object.Err, "backup: Failed to list objects"),
+			}
+			return
+		}
+
+		name := strings.TrimPrefix(object.Key, prefix)
+		if name == "" || strings.HasSuffix(name, "/") {
+			continue
+		}
+		names.Add(name)
+	}
+
+	return
+}
+
+func (t *s3Target) Hash(dir, name string) (hash string, err error) {
+	err = t.connect()
+	if err != nil {
+		return
+	}
+
+	obj, e := t.core.StatObject(context.Background(), t.store.Bucket,
+		t.key(dir, name), minio.StatObjectOptions{})
+	if e != nil {
+		if minio.ToErrorResponse(e).Code == "NoSuchKey" {
+			return
+		}
+		err = &errortypes.ReadError{
+			errors.Wrap(e, "backup: Failed to stat object"),
+		}
+		return
+	}
+
+	hash = obj.Metadata.Get("X-Amz-Meta-Sha256")
+
+	return
+}
+
+func (t *s3Target) statePath(key string) string {
+	hash := md5.Sum([]byte(t.store.Endpoint + "/" + t.store.Bucket +
+		"/" + key))
+	return path.Join(t.stateDir, fmt.Sprintf("%x.json", hash))
+}
+
+func (t *s3Target) loadState(key string) (state *uploadState) {
+	data, err := ioutil.ReadFile(t.statePath(key))
+	if err != nil {
+		return
+	}
+
+	state = &uploadState{}
+	err = json.Unmarshal(data, state)
+	if err != nil || state.Key != key {
+		state = nil
+		return
+	}
+
+	return
+}
+
+func (t *s3Target) saveState(state *uploadState) (err error) {
+	err = utils.ExistsMkdir(t.stateDir, 0700)
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "backup: Failed to marshal upload state"),
+		}
+		return
+	}
+
+	err = utils.CreateWrite(t.statePath(state.Key), string(data), 0600)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (t *s3Target) uploadedParts(key, uploadId string) (
+	parts map[int]minio.ObjectPart, err error) {
+
+	parts = map[int]minio.ObjectPart{}
+	marker := 0
+
+	for {
+		result, e := t.core.ListObjectParts(context.Background(),
+			t.store.Bucket, key, uploadId, marker, 1000)
+		if e != nil {
+			err = &errortypes.RequestError{
+				errors.Wrap(e, "backup: Failed to list upload parts"),
+			}
+			return
+		}
+
+		for _, part := range result.ObjectParts {
+			parts[part.PartNumber] = part
+		}
+
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+
+	return
+}
+
+func (t *s3Target) upload(key, pth, hash string) (err error) {
+	file, err := os.Open(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "backup: Failed to open file"),
+		}
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "backup: Failed to stat file"),
+		}
+		return
+	}
+	size := info.Size()
+
+	partSize := int64(minPartSize)
+	if size/partSize >= maxParts {
+		partSize = (size/maxParts/1048576 + 1) * 1048576
+	}
+
+	uploadId := ""
+	parts := map[int]minio.ObjectPart{}
+
+	state := t.loadState(key)
+	if state != nil && state.Hash == hash {
+		parts, err = t.uploadedParts(key, state.UploadId)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"key":       key,
+				"upload_id": state.UploadId,
+				"error":     err,
+			}).Warn("backup: Failed to resume upload, restarting")
+			parts = map[int]minio.ObjectPart{}
+			err = nil
+		} else {
+			uploadId = state.UploadId
+
+			logrus.WithFields(logrus.Fields{
+				"key":            key,
+				"upload_id":      uploadId,
+				"uploaded_parts": len(parts),
+			}).Info("backup: Resuming upload")
+		}
+	} else if state != nil {
+		_ = t.core.AbortMultipartUpload(context.Background(),
+			t.store.Bucket, key, state.UploadId)
+	}
+
+	if uploadId == "" {
+		uploadId, err = t.core.NewMultipartUpload(context.Background(),
+			t.store.Bucket, key, minio.PutObjectOptions{
+				UserMetadata: map[string]string{
+					"sha256": hash,
+				},
+			})
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "backup: Failed to create upload"),
+			}
+			return
+		}
+
+		err = t.saveState(&uploadState{
+			Key:      key,
+			UploadId: uploadId,
+			Hash:     hash,
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	completeParts := []minio.CompletePart{}
+	buf := make([]byte, partSize)
+
+	for partNum := 1; ; partNum++ {
+		offset := int64(partNum-1) * partSize
+		if offset >= size && partNum > 1 {
+			break
+		}
+
+		n, e := file.ReadAt(buf, offset)
+		if e != nil && e != io.EOF {
+			err = &errortypes.ReadError{
+				errors.Wrap(e, "backup: Failed to read file"),
+			}
+			return
+		}
+		data := buf[:n]
+
+		partMd5 := md5.Sum(data)
+		partEtag := fmt.Sprintf("%x", partMd5)
+
+		if part, ok := parts[partNum]; ok &&
+			strings.Trim(part.ETag, "\"") == partEtag &&
+			part.Size == int64(n) {
+
+			completeParts = append(completeParts, minio.CompletePart{
+				PartNumber: partNum,
+				ETag:       part.ETag,
+			})
+			continue
+		}
+
+		part, e := t.core.PutObjectPart(context.Background(),
+			t.store.Bucket, key, uploadId, partNum,
+			bytes.NewReader(data), int64(n), "", "", nil)
+		if e != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(e, "backup: Failed to upload part"),
+			}
+			return
+		}
+
+		completeParts = append(completeParts, minio.CompletePart{
+			PartNumber: partNum,
+			ETag:       part.ETag,
+		})
+
+		if int64(n) < partSize {
+			break
+		}
+	}
+
+	_, err = t.core.CompleteMultipartUpload(context.Background(),
+		t.store.Bucket, key, uploadId, completeParts)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "backup: Failed to complete upload"),
+		}
+		return
+	}
+
+	_ = os.Remove(t.statePath(key))
+
+	return
+}
+
+func (t *s3Target) Store(dir, name, pth, hash string, temp bool) (
+	err error) {
+
+	err = t.connect()
+	if err != nil {
+		return
+	}
+
+	// Staged copies are kept on failure to resume the upload on the
+	// next run
+	err = t.upload(t.key(dir, name), pth, hash)
+	if err != nil {
+		return
+	}
+
+	if temp {
+		_ = os.Remove(pth)
+	}
+
+	return
+}
+
+// Returns true if a staged copy exists with an incomplete upload
+func (t *s3Target) Staged(dir, name string) bool {
+	if t.loadState(t.key(dir, name)) == nil {
+		return false
+	}
+
+	exists, _ := utils.ExistsFile(t.TempPath(dir, name))
+	return exists
+}
+
+func (t *s3Target) Trash(dir, name string) (err error) {
+	err = t.connect()
+	if err != nil {
+		return
+	}
+
+	key := t.key(dir, name)
+	trashKey := path.Join(t.prefix, "trash", dir, name)
+
+	_, err = t.core.ComposeObject(context.Background(),
+		minio.CopyDestOptions{
+			Bucket: t.store.Bucket,
+			Object: trashKey,
+		},
+		minio.CopySrcOptions{
+			Bucket: t.store.Bucket,
+			Object: key,
+		},
+	)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "backup: Failed to copy object to trash"),
+		}
+		return
+	}
+
+	err = t.core.RemoveObject(context.Background(), t.store.Bucket,
+		key, minio.RemoveObjectOptions{})
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "backup: Failed to remove object"),
+		}
+		return
+	}
+
+	return
+}
+
+func (t *s3Target) WriteReport(data []byte) (err error) {
+	err = t.connect()
+	if err != nil {
+		return
+	}
+
+	_, err = t.core.Client.PutObject(context.Background(), t.store.Bucket,
+		path.Join(t.prefix, "report.json"), bytes.NewReader(data),
+		int64(len(data)), minio.PutObjectOptions{
+			ContentType: "application/json",
+		})
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "backup: Failed to write report"),
+		}
+		return
+	}
+
+	return
+}
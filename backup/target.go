@@ -0,0 +1,262 @@
+package backup
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/storage"
+	"github.com/pritunl/pritunl-cloud/utils"
+)
+
+type target interface {
+	String() string
+	TempPath(dir, name string) string
+	List(dir string) (names set.Set, err error)
+	Hash(dir, name string) (hash string, err error)
+	Store(dir, name, pth, hash string, temp bool) (err error)
+	Trash(dir, name string) (err error)
+	Staged(dir, name string) bool
+	WriteReport(data []byte) (err error)
+}
+
+type localTarget struct {
+	root string
+}
+
+func (t *localTarget) String() string {
+	return t.root
+}
+
+func (t *localTarget) TempPath(dir, name string) string {
+	return path.Join(t.root, dir, "."+name+".tmp")
+}
+
+func (t *localTarget) List(dir string) (names set.Set, err error) {
+	names = set.NewSet()
+	dirPath := path.Join(t.root, dir)
+
+	err = utils.ExistsMkdir(dirPath, 0755)
+	if err != nil {
+		return
+	}
+
+	items, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrapf(err, "backup: Failed to read %s directory", dir),
+		}
+		return
+	}
+
+	for _, item := range items {
+		name := item.Name()
+		if strings.HasPrefix(name, ".") ||
+			strings.HasSuffix(name, ".sha256") {
+
+			continue
+		}
+		names.Add(name)
+	}
+
+	return
+}
+
+func (t *localTarget) Hash(dir, name string) (hash string, err error) {
+	pth := path.Join(t.root, dir, name)
+
+	exists, err := utils.Exists(pth)
+	if err != nil || !exists {
+		return
+	}
+
+	data, e := ioutil.ReadFile(pth + ".sha256")
+	if e != nil {
+		if os.IsNotExist(e) {
+			return
+		}
+		err = &errortypes.ReadError{
+			errors.Wrap(e, "backup: Failed to read hash file"),
+		}
+		return
+	}
+
+	hash = strings.TrimSpace(string(data))
+
+	return
+}
+
+func (t *localTarget) Store(dir, name, pth, hash string, temp bool) (
+	err error) {
+
+	dirPath := path.Join(t.root, dir)
+	destPath := path.Join(dirPath, name)
+
+	err = utils.ExistsMkdir(dirPath, 0755)
+	if err != nil {
+		return
+	}
+
+	_ = os.Remove(destPath + ".sha256")
+
+	if temp {
+		err = os.Rename(pth, destPath)
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "backup: Failed to move file"),
+			}
+			return
+		}
+	} else {
+		tmpPath := t.TempPath(dir, name)
+		_ = os.Remove(tmpPath)
+
+		err = utils.Exec("", "cp", pth, tmpPath)
+		if err != nil {
+			return
+		}
+
+		err = os.Rename(tmpPath, destPath)
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "backup: Failed to move file"),
+			}
+			return
+		}
+	}
+
+	if hash != "" {
+		err = utils.CreateWrite(destPath+".sha256", hash+"\n", 0644)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (t *localTarget) Staged(dir, name string) bool {
+	return false
+}
+
+func (t *localTarget) Trash(dir, name string) (err error) {
+	trashDir := path.Join(t.root, "trash", dir)
+	pth := path.Join(t.root, dir, name)
+
+	err = utils.ExistsMkdir(trashDir, 0755)
+	if err != nil {
+		return
+	}
+
+	err = os.Rename(pth, path.Join(trashDir, name))
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "backup: Failed to move file to trash"),
+		}
+		return
+	}
+
+	_ = os.Remove(pth + ".sha256")
+
+	return
+}
+
+func (t *localTarget) WriteReport(data []byte) (err error) {
+	err = utils.CreateWrite(path.Join(t.root, "report.json"),
+		string(data), 0644)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func newTarget(db *database.Database, dest, tempDir string) (
+	tgt target, err error) {
+
+	if !strings.Contains(dest, "://") {
+		tgt = &localTarget{
+			root: dest,
+		}
+		return
+	}
+
+	u, err := url.Parse(dest)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "backup: Failed to parse destination"),
+		}
+		return
+	}
+
+	var store *storage.Storage
+	prefix := strings.Trim(u.Path, "/")
+
+	switch u.Scheme {
+	case "s3":
+		bucket := prefix
+		prefix = ""
+		if i := strings.Index(bucket, "/"); i != -1 {
+			prefix = bucket[i+1:]
+			bucket = bucket[:i]
+		}
+
+		store = &storage.Storage{
+			Endpoint: u.Host,
+			Bucket:   bucket,
+			Insecure: u.Query().Get("insecure") == "true",
+		}
+
+		// Credentials in the destination would be visible in the
+		// process list
+		if u.User != nil {
+			err = &errortypes.ParseError{
+				errors.New("backup: Destination credentials not " +
+					"supported, use AWS_ACCESS_KEY_ID and " +
+					"AWS_SECRET_ACCESS_KEY"),
+			}
+			return
+		}
+
+		store.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		store.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	case "storage":
+		storeId, e := primitive.ObjectIDFromHex(u.Host)
+		if e == nil {
+			store, err = storage.Get(db, storeId)
+		} else {
+			store, err = storage.GetName(db, u.Host)
+		}
+		if err != nil {
+			return
+		}
+	default:
+		err = &errortypes.ParseError{
+			errors.Newf("backup: Unknown destination scheme '%s'", u.Scheme),
+		}
+		return
+	}
+
+	if store.Endpoint == "" || store.Bucket == "" {
+		err = &errortypes.ParseError{
+			errors.New("backup: Destination missing endpoint or bucket"),
+		}
+		return
+	}
+
+	tgt = &s3Target{
+		store:    store,
+		prefix:   prefix,
+		tempDir:  tempDir,
+		stateDir: path.Join(tempDir, "uploads"),
+	}
+
+	return
+}
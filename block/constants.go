@@ -3,6 +3,7 @@ package block
 const (
 	External = "external"
 	Host     = "host"
+	Floating = "floating"
 	IPv4     = "ipv4"
 	IPv6     = "ipv6"
 )
@@ -0,0 +1,130 @@
+package capture
+
+import (
+	"time"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/image"
+)
+
+type Capture struct {
+	Id           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name         string             `bson:"name" json:"name"`
+	Comment      string             `bson:"comment" json:"comment"`
+	Organization primitive.ObjectID `bson:"organization" json:"organization"`
+	Instance     primitive.ObjectID `bson:"instance" json:"instance"`
+	Disk         primitive.ObjectID `bson:"disk" json:"disk"`
+	Image        primitive.ObjectID `bson:"image,omitempty" json:"image"`
+	Mode         string             `bson:"mode" json:"mode"`
+	Generalize   bool               `bson:"generalize" json:"generalize"`
+	Metadata     *image.Metadata    `bson:"metadata" json:"metadata"`
+	Version      int                `bson:"version" json:"version"`
+	State        string             `bson:"state" json:"state"`
+	Error        string             `bson:"error" json:"error"`
+	Timestamp    time.Time          `bson:"timestamp" json:"timestamp"`
+}
+
+func (c *Capture) Validate(db *database.Database) (
+	errData *errortypes.ErrorData, err error) {
+
+	if c.Name == "" {
+		errData = &errortypes.ErrorData{
+			Error:   "capture_name_required",
+			Message: "Missing required image name",
+		}
+		return
+	}
+
+	if c.Mode == "" {
+		c.Mode = Stop
+	}
+
+	switch c.Mode {
+	case Stop, Freeze:
+	default:
+		errData = &errortypes.ErrorData{
+			Error:   "capture_mode_invalid",
+			Message: "Capture mode is invalid",
+		}
+		return
+	}
+
+	if c.Instance.IsZero() || c.Disk.IsZero() {
+		errData = &errortypes.ErrorData{
+			Error:   "capture_source_required",
+			Message: "Missing capture instance or disk",
+		}
+		return
+	}
+
+	if c.Metadata == nil {
+		c.Metadata = &image.Metadata{}
+	}
+
+	if c.Generalize {
+		switch c.Metadata.OsFamily {
+		case "", image.Linux, image.Bsd:
+		default:
+			errData = &errortypes.ErrorData{
+				Error:   "capture_generalize_unsupported",
+				Message: "Generalization only supported on Linux and BSD",
+			}
+			return
+		}
+	}
+
+	if c.State == "" {
+		c.State = Pending
+	}
+
+	if c.Timestamp.IsZero() {
+		c.Timestamp = time.Now()
+	}
+
+	return
+}
+
+func (c *Capture) Commit(db *database.Database) (err error) {
+	coll := db.Captures()
+
+	err = coll.Commit(c.Id, c)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (c *Capture) CommitFields(db *database.Database, fields set.Set) (
+	err error) {
+
+	coll := db.Captures()
+
+	err = coll.CommitFields(c.Id, c, fields)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (c *Capture) Insert(db *database.Database) (err error) {
+	coll := db.Captures()
+
+	_, err = coll.InsertOne(db, c)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func NewCapture() *Capture {
+	return &Capture{
+		Id: primitive.NewObjectID(),
+	}
+}
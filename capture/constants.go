@@ -0,0 +1,11 @@
+package capture
+
+const (
+	Stop   = "stop"
+	Freeze = "freeze"
+
+	Pending   = "pending"
+	Capturing = "capturing"
+	Completed = "completed"
+	Failed    = "failed"
+)
@@ -0,0 +1,116 @@
+package capture
+
+import (
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/mongo-go-driver/mongo/options"
+	"github.com/pritunl/pritunl-cloud/database"
+)
+
+func Get(db *database.Database, captureId primitive.ObjectID) (
+	cpt *Capture, err error) {
+
+	coll := db.Captures()
+	cpt = &Capture{}
+
+	err = coll.FindOneId(captureId, cpt)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func GetOrg(db *database.Database, orgId, captureId primitive.ObjectID) (
+	cpt *Capture, err error) {
+
+	coll := db.Captures()
+	cpt = &Capture{}
+
+	err = coll.FindOne(db, &bson.M{
+		"_id":          captureId,
+		"organization": orgId,
+	}).Decode(cpt)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func GetAll(db *database.Database, query *bson.M) (
+	cpts []*Capture, err error) {
+
+	coll := db.Captures()
+	cpts = []*Capture{}
+
+	cursor, err := coll.Find(
+		db,
+		query,
+		&options.FindOptions{
+			Sort: &bson.D{
+				{"timestamp", -1},
+			},
+		},
+	)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		cpt := &Capture{}
+		err = cursor.Decode(cpt)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		cpts = append(cpts, cpt)
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func GetDiskPending(db *database.Database, diskId primitive.ObjectID) (
+	cpts []*Capture, err error) {
+
+	cpts, err = GetAll(db, &bson.M{
+		"disk":  diskId,
+		"state": Pending,
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func Remove(db *database.Database, captureId primitive.ObjectID) (
+	err error) {
+
+	coll := db.Captures()
+
+	_, err = coll.DeleteOne(db, &bson.M{
+		"_id": captureId,
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+		default:
+			return
+		}
+	}
+
+	return
+}
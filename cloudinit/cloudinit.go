@@ -20,6 +20,7 @@ import (
 	"github.com/pritunl/pritunl-cloud/instance"
 	"github.com/pritunl/pritunl-cloud/node"
 	"github.com/pritunl/pritunl-cloud/paths"
+	"github.com/pritunl/pritunl-cloud/resolver"
 	"github.com/pritunl/pritunl-cloud/settings"
 	"github.com/pritunl/pritunl-cloud/utils"
 	"github.com/pritunl/pritunl-cloud/vm"
@@ -37,22 +38,23 @@ MIME-Version: 1.0
 
 const netConfigTmpl = `version: 1
 config:
-  - type: physical
-    name: eth0
+{{range .Interfaces}}  - type: physical
+    name: {{.Name}}
     mac_address: {{.Mac}}{{.Mtu}}
     subnets:
       - type: static
         address: {{.Address}}
         netmask: {{.Netmask}}
-        network: {{.Network}}
+        network: {{.Network}}{{if .Gateway}}
         gateway: {{.Gateway}}
-        dns_nameservers:
-          - 8.8.8.8
-          - 8.8.4.4
+        dns_nameservers:{{range .Dns}}
+          - {{.}}{{end}}{{if .Search}}
+        dns_search:
+          - {{.Search}}{{end}}{{end}}
       - type: static
-        address: {{.Address6}}
-        gateway: {{.Gateway6}}
-`
+        address: {{.Address6}}{{if .Gateway6}}
+        gateway: {{.Gateway6}}{{end}}
+{{end}}`
 
 const netMtu = `
     mtu: %d`
@@ -94,12 +96,19 @@ var (
 )
 
 type netConfigData struct {
+	Interfaces []*netInterfaceData
+}
+
+type netInterfaceData struct {
+	Name     string
 	Mac      string
 	Mtu      string
 	Address  string
 	Netmask  string
 	Network  string
 	Gateway  string
+	Dns      []string
+	Search   string
 	Address6 string
 	Gateway6 string
 }
@@ -236,22 +245,6 @@ func getNetData(db *database.Database, inst *instance.Instance,
 		return
 	}
 
-	adapter := virt.NetworkAdapters[0]
-
-	if adapter.Vpc.IsZero() {
-		err = &errortypes.NotFoundError{
-			errors.Wrap(err, "cloudinit: Instance missing VPC"),
-		}
-		return
-	}
-
-	if adapter.Subnet.IsZero() {
-		err = &errortypes.NotFoundError{
-			errors.Wrap(err, "cloudinit: Instance missing VPC subnet"),
-		}
-		return
-	}
-
 	zne, err := zone.Get(db, node.Self.Zone)
 	if err != nil {
 		return
@@ -262,34 +255,7 @@ func getNetData(db *database.Database, inst *instance.Instance,
 		vxlan = true
 	}
 
-	vc, err := vpc.Get(db, adapter.Vpc)
-	if err != nil {
-		return
-	}
-
-	vcNet, err := vc.GetNetwork()
-	if err != nil {
-		return
-	}
-
-	addr, gatewayAddr, err := vc.GetIp(db, inst.Subnet, inst.Id)
-	if err != nil {
-		return
-	}
-
-	addr6 := vc.GetIp6(addr)
-	gatewayAddr6 := vc.GetIp6(gatewayAddr)
-
-	data := netConfigData{
-		Mac:      adapter.MacAddress,
-		Address:  addr.String(),
-		Netmask:  net.IP(vcNet.Mask).String(),
-		Network:  vcNet.IP.String(),
-		Gateway:  gatewayAddr.String(),
-		Address6: addr6.String(),
-		Gateway6: gatewayAddr6.String(),
-	}
-
+	mtu := ""
 	jumboFrames := node.Self.JumboFrames
 	if jumboFrames || vxlan {
 		mtuSize := 0
@@ -303,7 +269,77 @@ func getNetData(db *database.Database, inst *instance.Instance,
 			mtuSize -= 54
 		}
 
-		data.Mtu = fmt.Sprintf(netMtu, mtuSize)
+		mtu = fmt.Sprintf(netMtu, mtuSize)
+	}
+
+	data := netConfigData{
+		Interfaces: []*netInterfaceData{},
+	}
+
+	for i, adapter := range virt.NetworkAdapters {
+		if adapter.Vpc.IsZero() {
+			err = &errortypes.NotFoundError{
+				errors.Wrap(err, "cloudinit: Instance missing VPC"),
+			}
+			return
+		}
+
+		if adapter.Subnet.IsZero() {
+			err = &errortypes.NotFoundError{
+				errors.Wrap(err, "cloudinit: Instance missing VPC subnet"),
+			}
+			return
+		}
+
+		vc, e := vpc.Get(db, adapter.Vpc)
+		if e != nil {
+			err = e
+			return
+		}
+
+		vcNet, e := vc.GetNetwork()
+		if e != nil {
+			err = e
+			return
+		}
+
+		addr, gatewayAddr, e := vc.GetIp(db, adapter.Subnet, inst.Id)
+		if e != nil {
+			err = e
+			return
+		}
+
+		addr6 := vc.GetIp6(addr)
+
+		iface := &netInterfaceData{
+			Name:     fmt.Sprintf("eth%d", i),
+			Mac:      adapter.MacAddress,
+			Mtu:      mtu,
+			Address:  addr.String(),
+			Netmask:  net.IP(vcNet.Mask).String(),
+			Network:  vcNet.IP.String(),
+			Address6: addr6.String(),
+		}
+
+		// Default routes are only configured on the primary adapter
+		if i == 0 {
+			iface.Gateway = gatewayAddr.String()
+			iface.Gateway6 = vc.GetIp6(gatewayAddr).String()
+
+			if vc.InternalDns {
+				iface.Dns = []string{
+					gatewayAddr.String(),
+				}
+				iface.Search = resolver.GetDomain(vc)
+			} else {
+				iface.Dns = []string{
+					settings.Hypervisor.DnsServer,
+					settings.Hypervisor.DnsServer2,
+				}
+			}
+		}
+
+		data.Interfaces = append(data.Interfaces, iface)
 	}
 
 	output := &bytes.Buffer{}
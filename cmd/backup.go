@@ -2,23 +2,57 @@ package cmd
 
 import (
 	"flag"
+	"fmt"
+	"os"
 
 	"github.com/dropbox/godropbox/errors"
 	"github.com/pritunl/pritunl-cloud/backup"
 	"github.com/pritunl/pritunl-cloud/errortypes"
 )
 
+const backupHelp = `
+Usage: pritunl-cloud backup [--report PATH] DESTINATION
+
+Destinations:
+  /path                     Local directory
+  s3://endpoint/bucket/dir  S3 bucket, credentials are read from the
+                            AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+                            environment variables
+  storage://name/dir        Storage configured in pritunl-cloud
+
+Options:
+  --report PATH             Also write the backup report to a local file
+`
+
 func Backup() (err error) {
-	dest := flag.Arg(1)
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, backupHelp)
+	}
+	reportPath := flags.String("report", "", "")
+
+	err = flags.Parse(flag.Args()[1:])
+	if err == flag.ErrHelp {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "cmd: Failed to parse backup options"),
+		}
+		return
+	}
 
+	dest := flags.Arg(0)
 	if dest == "" {
+		flags.Usage()
 		err = &errortypes.ParseError{
-			errors.New("cmd: Missing backup destination path"),
+			errors.New("cmd: Missing backup destination"),
 		}
 		return
 	}
 
-	back := backup.New(dest)
+	back := backup.New(dest, *reportPath)
 
 	err = back.Run()
 	if err != nil {
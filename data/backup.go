@@ -0,0 +1,308 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	minio "github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/credentials"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/encryption"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/image"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/storage"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/sirupsen/logrus"
+)
+
+type backupManifest struct {
+	Image          primitive.ObjectID `json:"image"`
+	Disk           primitive.ObjectID `json:"disk"`
+	Organization   primitive.ObjectID `json:"organization"`
+	Key            string             `json:"key"`
+	Size           int64              `json:"size"`
+	Checksum       string             `json:"checksum"`
+	Encrypted      bool               `json:"encrypted"`
+	KeyFingerprint string             `json:"key_fingerprint,omitempty"`
+	Timestamp      time.Time          `json:"timestamp"`
+}
+
+func getManifestKey(img *image.Image) string {
+	return img.Key + ".manifest"
+}
+
+func getFileChecksum(pth string) (checksum string, size int64, err error) {
+	file, err := os.Open(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to open file"),
+		}
+		return
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err = io.Copy(hash, file)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to read file"),
+		}
+		return
+	}
+
+	checksum = fmt.Sprintf("%x", hash.Sum(nil))
+
+	return
+}
+
+func encryptBackup(db *database.Database, img *image.Image,
+	pth string) (fingerprint string, err error) {
+
+	if img.Organization.IsZero() {
+		err = &errortypes.WriteError{
+			errors.New("data: Cannot encrypt image without organization"),
+		}
+		return
+	}
+
+	key, err := encryption.GetOrgKey(db, img.Organization)
+	if err != nil {
+		return
+	}
+
+	encPth := pth + ".enc"
+	defer utils.Remove(encPth)
+
+	err = encryption.EncryptFile(key, pth, encPth)
+	if err != nil {
+		return
+	}
+
+	err = utils.Exec("", "mv", "-f", encPth, pth)
+	if err != nil {
+		return
+	}
+
+	fingerprint = encryption.Fingerprint(key)
+
+	return
+}
+
+func decryptImage(db *database.Database, img *image.Image,
+	pth string) (err error) {
+
+	if img.Checksum != "" {
+		checksum, _, e := getFileChecksum(pth)
+		if e != nil {
+			err = e
+			return
+		}
+
+		if checksum != img.Checksum {
+			err = &errortypes.VerificationError{
+				errors.New("data: Image checksum mismatch"),
+			}
+			return
+		}
+	}
+
+	if !img.Encrypted {
+		return
+	}
+
+	key, err := encryption.GetOrgKey(db, img.Organization)
+	if err != nil {
+		return
+	}
+
+	decPth := pth + ".dec"
+	defer utils.Remove(decPth)
+
+	err = encryption.DecryptFile(key, pth, decPth)
+	if err != nil {
+		return
+	}
+
+	err = utils.Exec("", "mv", "-f", decPth, pth)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func putManifest(client *minio.Client, store *storage.Storage,
+	img *image.Image, manifest *backupManifest) (err error) {
+
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "data: Failed to marshal backup manifest"),
+		}
+		return
+	}
+
+	_, err = client.PutObject(context.Background(), store.Bucket,
+		getManifestKey(img), bytes.NewReader(manifestData),
+		int64(len(manifestData)), minio.PutObjectOptions{
+			ContentType: "application/json",
+		})
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "data: Failed to write backup manifest"),
+		}
+		return
+	}
+
+	return
+}
+
+func getManifest(client *minio.Client, store *storage.Storage,
+	img *image.Image) (manifest *backupManifest, err error) {
+
+	obj, err := client.GetObject(context.Background(), store.Bucket,
+		getManifestKey(img), minio.GetObjectOptions{})
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to read backup manifest"),
+		}
+		return
+	}
+	defer obj.Close()
+
+	manifestData, err := ioutil.ReadAll(obj)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to read backup manifest"),
+		}
+		return
+	}
+
+	manifest = &backupManifest{}
+	err = json.Unmarshal(manifestData, manifest)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "data: Failed to parse backup manifest"),
+		}
+		return
+	}
+
+	return
+}
+
+func VerifyBackup(db *database.Database, img *image.Image) (err error) {
+	cacheDir := node.Self.GetCachePath()
+
+	store, err := storage.Get(db, img.Storage)
+	if err != nil {
+		return
+	}
+
+	client, err := minio.New(store.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(store.AccessKey, store.SecretKey, ""),
+		Secure: !store.Insecure,
+	})
+	if err != nil {
+		err = &errortypes.ConnectionError{
+			errors.Wrap(err, "data: Failed to connect to storage"),
+		}
+		return
+	}
+
+	err = utils.ExistsMkdir(cacheDir, 0755)
+	if err != nil {
+		return
+	}
+
+	tmpPath := path.Join(cacheDir,
+		fmt.Sprintf("verify-%s", primitive.NewObjectID().Hex()))
+	defer utils.Remove(tmpPath)
+
+	logrus.WithFields(logrus.Fields{
+		"image_id":   img.Id.Hex(),
+		"storage_id": store.Id.Hex(),
+		"key":        img.Key,
+	}).Info("data: Verifying disk backup")
+
+	verifyErr := func() (err error) {
+		manifest, err := getManifest(client, store, img)
+		if err != nil {
+			return
+		}
+
+		err = client.FGetObject(context.Background(), store.Bucket,
+			img.Key, tmpPath, minio.GetObjectOptions{})
+		if err != nil {
+			err = &errortypes.ReadError{
+				errors.Wrap(err, "data: Failed to download backup"),
+			}
+			return
+		}
+
+		checksum, size, err := getFileChecksum(tmpPath)
+		if err != nil {
+			return
+		}
+
+		if checksum != manifest.Checksum || size != manifest.Size ||
+			(img.Checksum != "" && checksum != img.Checksum) {
+
+			err = &errortypes.VerificationError{
+				errors.New("data: Backup checksum mismatch"),
+			}
+			return
+		}
+
+		if img.Encrypted {
+			key, e := encryption.GetOrgKey(db, img.Organization)
+			if e != nil {
+				err = e
+				return
+			}
+
+			file, e := os.Open(tmpPath)
+			if e != nil {
+				err = &errortypes.ReadError{
+					errors.Wrap(e, "data: Failed to open backup"),
+				}
+				return
+			}
+			defer file.Close()
+
+			err = encryption.Decrypt(key, ioutil.Discard, file)
+			if err != nil {
+				return
+			}
+		}
+
+		return
+	}()
+
+	img.LastVerified = time.Now()
+	if verifyErr != nil {
+		img.VerifyState = image.VerifyFailed
+	} else {
+		img.VerifyState = image.Verified
+	}
+
+	err = img.CommitFields(db, set.NewSet("verify_state", "last_verified"))
+	if err != nil {
+		return
+	}
+
+	err = verifyErr
+
+	return
+}
@@ -0,0 +1,146 @@
+package data
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/image"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/sirupsen/logrus"
+)
+
+func GetImageCacheName(img *image.Image) string {
+	return fmt.Sprintf("image-%s-%s", img.Id.Hex(), img.Etag)
+}
+
+func GetImageCachePath(img *image.Image) string {
+	return path.Join(node.Self.GetCachePath(), GetImageCacheName(img))
+}
+
+func PrefetchImage(db *database.Database, img *image.Image) (
+	pth string, err error) {
+
+	err = utils.ExistsMkdir(node.Self.GetCachePath(), 0755)
+	if err != nil {
+		return
+	}
+
+	pth = GetImageCachePath(img)
+
+	err = getImage(db, img, pth)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func getImageCache() (items []os.FileInfo, err error) {
+	cacheDir := node.Self.GetCachePath()
+	items = []os.FileInfo{}
+
+	exists, err := utils.ExistsDir(cacheDir)
+	if err != nil || !exists {
+		return
+	}
+
+	infos, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to read cache directory"),
+		}
+		return
+	}
+
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasPrefix(info.Name(), "image-") {
+			items = append(items, info)
+		}
+	}
+
+	return
+}
+
+func GetImageCacheSize() (size int64, err error) {
+	items, err := getImageCache()
+	if err != nil {
+		return
+	}
+
+	for _, item := range items {
+		size += item.Size()
+	}
+
+	return
+}
+
+func EvictImageCache(minFree uint64, pinned set.Set) (
+	evicted int, err error) {
+
+	cacheDir := node.Self.GetCachePath()
+
+	items, err := getImageCache()
+	if err != nil || len(items) == 0 {
+		return
+	}
+
+	free, _, err := utils.DiskUsage(cacheDir)
+	if err != nil {
+		return
+	}
+
+	if free >= minFree {
+		return
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ModTime().Before(items[j].ModTime())
+	})
+
+	for _, item := range items {
+		if free >= minFree {
+			break
+		}
+
+		if pinned.Contains(item.Name()) {
+			continue
+		}
+
+		pth := path.Join(cacheDir, item.Name())
+
+		logrus.WithFields(logrus.Fields{
+			"path":      pth,
+			"last_used": item.ModTime(),
+			"free":      free,
+		}).Info("data: Evicting image cache")
+
+		lockId := imageLock.Lock(pth)
+		e := os.Remove(pth)
+		imageLock.Unlock(pth, lockId)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"path":  pth,
+				"error": e,
+			}).Error("data: Failed to evict image cache")
+			continue
+		}
+
+		evicted += 1
+
+		free, _, err = utils.DiskUsage(cacheDir)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,421 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"time"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	minio "github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/credentials"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/capture"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/datacenter"
+	"github.com/pritunl/pritunl-cloud/disk"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/event"
+	"github.com/pritunl/pritunl-cloud/image"
+	"github.com/pritunl/pritunl-cloud/instance"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/paths"
+	"github.com/pritunl/pritunl-cloud/qga"
+	"github.com/pritunl/pritunl-cloud/qmp"
+	"github.com/pritunl/pritunl-cloud/settings"
+	"github.com/pritunl/pritunl-cloud/storage"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/pritunl/pritunl-cloud/vm"
+	"github.com/pritunl/pritunl-cloud/zone"
+	"github.com/sirupsen/logrus"
+)
+
+const generalizeScript = `if command -v cloud-init > /dev/null 2>&1; ` +
+	`then cloud-init clean --logs; fi`
+
+// Generalizes the captured image copy offline, the source instance is
+// never modified
+func generalizeImage(cpt *capture.Capture, imgPath string) (err error) {
+	logrus.WithFields(logrus.Fields{
+		"capture_id":  cpt.Id.Hex(),
+		"instance_id": cpt.Instance.Hex(),
+	}).Info("data: Generalizing captured image")
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"virt-sysprep",
+		"--format", "qcow2",
+		"-a", imgPath,
+		"--operations", "ssh-hostkeys,machine-id,bash-history,"+
+			"dhcp-client-state,net-hwaddr,udev-persistent-net,"+
+			"logfiles,tmp-files",
+		"--run-command", generalizeScript,
+	)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func waitInstanceStopped(db *database.Database,
+	instId primitive.ObjectID) (err error) {
+
+	timeout := settings.Hypervisor.StopTimeout + 60
+	for i := 0; i < timeout; i++ {
+		inst, e := instance.Get(db, instId)
+		if e != nil {
+			err = e
+			return
+		}
+
+		if inst.VmState == vm.Stopped || inst.VmState == vm.Failed {
+			return
+		}
+
+		time.Sleep(1 * time.Second)
+	}
+
+	err = &errortypes.TimeoutError{
+		errors.New("data: Timeout waiting for instance to stop"),
+	}
+
+	return
+}
+
+func captureFrozen(virt *vm.VirtualMachine, dsk *disk.Disk,
+	tmpPath string) (err error) {
+
+	guestPath := paths.GetGuestPath(virt.Id)
+
+	err = qga.FsFreeze(guestPath)
+	if err != nil {
+		return
+	}
+
+	thawed := false
+	thaw := func() {
+		if thawed {
+			return
+		}
+		thawed = true
+
+		e := qga.FsThaw(guestPath)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"instance_id": virt.Id.Hex(),
+				"error":       e,
+			}).Error("data: Failed to thaw instance filesystems")
+		}
+	}
+	defer thaw()
+
+	err = qmp.BackupDiskStarted(virt.Id, dsk, tmpPath, thaw)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func captureDisk(db *database.Database, cpt *capture.Capture,
+	dsk *disk.Disk, virt *vm.VirtualMachine, tmpPath string) (err error) {
+
+	if cpt.Generalize {
+		_, err = exec.LookPath("virt-sysprep")
+		if err != nil {
+			err = &errortypes.NotFoundError{
+				errors.Wrap(err, "data: Generalizing capture requires "+
+					"virt-sysprep, install guestfs-tools on the node"),
+			}
+			return
+		}
+	}
+
+	running := virt != nil && virt.State == vm.Running
+
+	if running && cpt.Mode == capture.Stop {
+		inst, e := instance.Get(db, cpt.Instance)
+		if e != nil {
+			err = e
+			return
+		}
+		prevState := inst.State
+
+		logrus.WithFields(logrus.Fields{
+			"capture_id":  cpt.Id.Hex(),
+			"instance_id": cpt.Instance.Hex(),
+		}).Info("data: Stopping instance for capture")
+
+		err = instance.SetState(db, cpt.Instance, instance.Stop)
+		if err != nil {
+			return
+		}
+		event.PublishDispatch(db, "instance.change")
+
+		defer func() {
+			if prevState != instance.Start {
+				return
+			}
+
+			logrus.WithFields(logrus.Fields{
+				"capture_id":  cpt.Id.Hex(),
+				"instance_id": cpt.Instance.Hex(),
+			}).Info("data: Starting instance after capture")
+
+			e := instance.SetState(db, cpt.Instance, prevState)
+			if e != nil {
+				logrus.WithFields(logrus.Fields{
+					"capture_id":  cpt.Id.Hex(),
+					"instance_id": cpt.Instance.Hex(),
+					"error":       e,
+				}).Error("data: Failed to restore instance state")
+				return
+			}
+			event.PublishDispatch(db, "instance.change")
+		}()
+
+		err = waitInstanceStopped(db, cpt.Instance)
+		if err != nil {
+			return
+		}
+
+		running = false
+	}
+
+	if running {
+		err = captureFrozen(virt, dsk, tmpPath)
+		if err != nil {
+			if _, ok := err.(*qmp.DiskNotFound); ok {
+				err = nil
+				running = false
+			} else {
+				return
+			}
+		}
+	}
+
+	if !running {
+		_, err = utils.ExecCombinedOutputLogged(nil, "qemu-img", "convert",
+			"-f", "qcow2", "-O", "qcow2", paths.GetDiskPath(dsk.Id), tmpPath)
+		if err != nil {
+			return
+		}
+	}
+
+	err = utils.Chmod(tmpPath, 0600)
+	if err != nil {
+		return
+	}
+
+	if cpt.Generalize {
+		err = generalizeImage(cpt, tmpPath)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func uploadCapture(db *database.Database, dc *datacenter.Datacenter,
+	store *storage.Storage, img *image.Image, tmpPath string) (err error) {
+
+	logrus.WithFields(logrus.Fields{
+		"image_id":   img.Id.Hex(),
+		"storage_id": store.Id.Hex(),
+		"object_key": img.Key,
+	}).Info("data: Uploading captured image")
+
+	client, err := minio.New(store.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(store.AccessKey, store.SecretKey, ""),
+		Secure: !store.Insecure,
+	})
+	if err != nil {
+		err = &errortypes.ConnectionError{
+			errors.Wrap(err, "data: Failed to connect to storage"),
+		}
+		return
+	}
+
+	putOpts := minio.PutObjectOptions{}
+	storageClass := storage.FormatStorageClass(dc.PrivateStorageClass)
+	if storageClass != "" {
+		putOpts.StorageClass = storageClass
+	}
+
+	_, err = client.FPutObject(context.Background(),
+		store.Bucket, img.Key, tmpPath, putOpts)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "data: Failed to write object"),
+		}
+		return
+	}
+
+	obj, err := client.StatObject(context.Background(),
+		store.Bucket, img.Key, minio.StatObjectOptions{})
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to stat object"),
+		}
+		return
+	}
+
+	img.Etag = image.GetEtag(obj)
+	img.LastModified = obj.LastModified
+
+	if store.IsOracle() {
+		img.StorageClass = storage.ParseStorageClass(obj)
+	} else {
+		img.StorageClass = dc.PrivateStorageClass
+	}
+
+	return
+}
+
+func runCapture(db *database.Database, cpt *capture.Capture,
+	dsk *disk.Disk, virt *vm.VirtualMachine) (err error) {
+
+	inst, err := instance.Get(db, cpt.Instance)
+	if err != nil {
+		return
+	}
+
+	nde, err := node.Get(db, dsk.Node)
+	if err != nil {
+		return
+	}
+
+	zne, err := zone.Get(db, nde.Zone)
+	if err != nil {
+		return
+	}
+
+	dc, err := datacenter.Get(db, zne.Datacenter)
+	if err != nil {
+		return
+	}
+
+	if dc.PrivateStorage.IsZero() {
+		err = &errortypes.NotFoundError{
+			errors.New("data: Cannot capture disk without private storage"),
+		}
+		return
+	}
+
+	store, err := storage.Get(db, dc.PrivateStorage)
+	if err != nil {
+		return
+	}
+
+	imgId := primitive.NewObjectID()
+	tmpPath := path.Join(node.Self.GetCachePath(),
+		fmt.Sprintf("capture-%s", imgId.Hex()))
+	defer utils.Remove(tmpPath)
+
+	logrus.WithFields(logrus.Fields{
+		"capture_id":  cpt.Id.Hex(),
+		"instance_id": inst.Id.Hex(),
+		"disk_id":     dsk.Id.Hex(),
+		"mode":        cpt.Mode,
+		"generalize":  cpt.Generalize,
+	}).Info("data: Capturing instance image")
+
+	err = captureDisk(db, cpt, dsk, virt, tmpPath)
+	if err != nil {
+		return
+	}
+
+	checksum, _, err := getFileChecksum(tmpPath)
+	if err != nil {
+		return
+	}
+
+	version, err := image.GetNextVersion(db, cpt.Organization, cpt.Name)
+	if err != nil {
+		return
+	}
+
+	firmware := image.Bios
+	if inst.Uefi {
+		firmware = image.Uefi
+	}
+
+	img := &image.Image{
+		Id:           imgId,
+		Name:         cpt.Name,
+		Comment:      cpt.Comment,
+		Organization: cpt.Organization,
+		Type:         storage.Private,
+		Firmware:     firmware,
+		Storage:      store.Id,
+		Key:          fmt.Sprintf("capture/%s.qcow2", imgId.Hex()),
+		Checksum:     checksum,
+		Version:      version,
+	}
+	if cpt.Metadata != nil {
+		img.SetMetadata(cpt.Metadata)
+	}
+
+	errData, err := img.Validate(db)
+	if err != nil {
+		return
+	}
+	if errData != nil {
+		err = &errortypes.ParseError{
+			errors.Newf("data: Invalid image metadata %s", errData.Message),
+		}
+		return
+	}
+
+	err = uploadCapture(db, dc, store, img, tmpPath)
+	if err != nil {
+		return
+	}
+
+	err = img.Insert(db)
+	if err != nil {
+		return
+	}
+
+	cpt.Image = img.Id
+	cpt.Version = img.Version
+
+	event.PublishDispatch(db, "image.change")
+
+	return
+}
+
+func CaptureImage(db *database.Database, cpt *capture.Capture,
+	dsk *disk.Disk, virt *vm.VirtualMachine) (err error) {
+
+	cpt.State = capture.Capturing
+	err = cpt.CommitFields(db, set.NewSet("state"))
+	if err != nil {
+		return
+	}
+	event.PublishDispatch(db, "capture.change")
+
+	captureErr := runCapture(db, cpt, dsk, virt)
+	if captureErr != nil {
+		cpt.State = capture.Failed
+		cpt.Error = captureErr.Error()
+	} else {
+		cpt.State = capture.Completed
+		cpt.Error = ""
+	}
+
+	err = cpt.CommitFields(db, set.NewSet("state", "error", "image",
+		"version"))
+	if err != nil {
+		return
+	}
+	event.PublishDispatch(db, "capture.change")
+
+	err = captureErr
+
+	return
+}
@@ -2,11 +2,24 @@ package data
 
 import (
 	"fmt"
+	"os"
+	"time"
 
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
 	"github.com/pritunl/pritunl-cloud/database"
 	"github.com/pritunl/pritunl-cloud/disk"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/event"
+	"github.com/pritunl/pritunl-cloud/instance"
 	"github.com/pritunl/pritunl-cloud/paths"
 	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/pritunl/pritunl-cloud/vm"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	flattenLock = utils.NewMultiTimeoutLock(3 * time.Hour)
 )
 
 func CreateDisk(db *database.Database, dsk *disk.Disk) (
@@ -35,3 +48,86 @@ func CreateDisk(db *database.Database, dsk *disk.Disk) (
 
 	return
 }
+
+func diskStopped(db *database.Database, dsk *disk.Disk) (
+	stopped bool, err error) {
+
+	if dsk.Instance.IsZero() {
+		stopped = true
+		return
+	}
+
+	inst, err := instance.Get(db, dsk.Instance)
+	if err != nil {
+		return
+	}
+
+	if inst.State == instance.Stop && inst.VmState == vm.Stopped {
+		stopped = true
+	}
+
+	return
+}
+
+func FlattenDisk(db *database.Database, dsk *disk.Disk) (
+	flattened bool, err error) {
+
+	if dsk.State != disk.Available || dsk.BackingImage == "" {
+		return
+	}
+
+	acquired, lockId := flattenLock.LockOpen(dsk.Id.Hex())
+	if !acquired {
+		return
+	}
+	defer flattenLock.Unlock(dsk.Id.Hex(), lockId)
+
+	stopped, err := diskStopped(db, dsk)
+	if err != nil || !stopped {
+		return
+	}
+
+	diskPath := paths.GetDiskPath(dsk.Id)
+	tempPath := diskPath + ".flatten"
+	defer utils.Remove(tempPath)
+
+	logrus.WithFields(logrus.Fields{
+		"disk_id":       dsk.Id.Hex(),
+		"backing_image": dsk.BackingImage,
+	}).Info("data: Flattening disk backing image")
+
+	_, err = utils.ExecCombinedOutputLogged(nil, "qemu-img", "convert",
+		"-f", "qcow2", "-O", "qcow2", diskPath, tempPath)
+	if err != nil {
+		return
+	}
+
+	err = utils.Chmod(tempPath, 0600)
+	if err != nil {
+		return
+	}
+
+	stopped, err = diskStopped(db, dsk)
+	if err != nil || !stopped {
+		return
+	}
+
+	err = os.Rename(tempPath, diskPath)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "data: Failed to replace flattened disk"),
+		}
+		return
+	}
+
+	dsk.BackingImage = ""
+	err = dsk.CommitFields(db, set.NewSet("backing_image"))
+	if err != nil {
+		return
+	}
+
+	flattened = true
+	event.PublishDispatch(db, "disk.change")
+
+	return
+}
@@ -0,0 +1,355 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	minio "github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/credentials"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/disk"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/event"
+	"github.com/pritunl/pritunl-cloud/export"
+	"github.com/pritunl/pritunl-cloud/image"
+	"github.com/pritunl/pritunl-cloud/instance"
+	"github.com/pritunl/pritunl-cloud/paths"
+	"github.com/pritunl/pritunl-cloud/qmp"
+	"github.com/pritunl/pritunl-cloud/storage"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/pritunl/pritunl-cloud/vm"
+	"github.com/pritunl/pritunl-cloud/vmdk"
+	"github.com/sirupsen/logrus"
+)
+
+func getExportClient(store *storage.Storage) (
+	client *minio.Client, err error) {
+
+	client, err = minio.New(store.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(store.AccessKey, store.SecretKey, ""),
+		Secure: !store.Insecure,
+	})
+	if err != nil {
+		err = &errortypes.ConnectionError{
+			errors.Wrap(err, "data: Failed to connect to storage"),
+		}
+		return
+	}
+
+	return
+}
+
+func convertExport(exp *export.Export, srcPth, dstPth string,
+	conf *vmdk.OvaConfig) (err error) {
+
+	switch exp.Format {
+	case export.Qcow2:
+		_, err = utils.ExecCombinedOutputLogged(nil, "qemu-img", "convert",
+			"-f", "qcow2", "-O", "qcow2", srcPth, dstPth)
+		if err != nil {
+			return
+		}
+	case export.Raw:
+		_, err = utils.ExecCombinedOutputLogged(nil, "qemu-img", "convert",
+			"-f", "qcow2", "-O", "raw", srcPth, dstPth)
+		if err != nil {
+			return
+		}
+	case export.Vmdk:
+		err = vmdk.Convert(srcPth, dstPth, false)
+		if err != nil {
+			return
+		}
+	case export.Ova:
+		err = vmdk.WriteOva(srcPth, dstPth, conf)
+		if err != nil {
+			return
+		}
+	default:
+		err = &errortypes.ParseError{
+			errors.Newf("data: Unknown export format '%s'", exp.Format),
+		}
+		return
+	}
+
+	return
+}
+
+func uploadExport(db *database.Database, exp *export.Export,
+	srcPth string, conf *vmdk.OvaConfig) (err error) {
+
+	store, err := storage.Get(db, exp.Storage)
+	if err != nil {
+		return
+	}
+
+	exportPth := srcPth + ".export"
+	defer utils.Remove(exportPth)
+
+	logrus.WithFields(logrus.Fields{
+		"export_id": exp.Id.Hex(),
+		"format":    exp.Format,
+	}).Info("data: Converting export")
+
+	err = convertExport(exp, srcPth, exportPth, conf)
+	if err != nil {
+		return
+	}
+
+	info, err := os.Stat(exportPth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to stat export"),
+		}
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"export_id":  exp.Id.Hex(),
+		"storage_id": store.Id.Hex(),
+		"object_key": exp.Key,
+		"size":       info.Size(),
+	}).Info("data: Uploading export")
+
+	client, err := getExportClient(store)
+	if err != nil {
+		return
+	}
+
+	_, err = client.FPutObject(context.Background(), store.Bucket,
+		exp.Key, exportPth, minio.PutObjectOptions{
+			ContentType: "application/octet-stream",
+		})
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "data: Failed to write object"),
+		}
+		return
+	}
+
+	exp.Size = info.Size()
+
+	return
+}
+
+func runExport(db *database.Database, exp *export.Export,
+	handler func(tmpPath string) (conf *vmdk.OvaConfig, err error)) (
+	err error) {
+
+	tempDir := paths.GetTempDir()
+	defer utils.RemoveAll(tempDir)
+
+	exp.State = export.Exporting
+	err = exp.CommitFields(db, set.NewSet("state"))
+	if err != nil {
+		return
+	}
+	event.PublishDispatch(db, "export.change")
+
+	exportErr := func() (err error) {
+		err = utils.ExistsMkdir(tempDir, 0700)
+		if err != nil {
+			return
+		}
+
+		tmpPath := path.Join(tempDir, "source.qcow2")
+
+		conf, err := handler(tmpPath)
+		if err != nil {
+			return
+		}
+
+		err = uploadExport(db, exp, tmpPath, conf)
+		if err != nil {
+			return
+		}
+
+		return
+	}()
+
+	// Expiration starts when the export is available for download
+	exp.Expires = time.Now().Add(exp.Expires.Sub(exp.Timestamp))
+	if exportErr != nil {
+		exp.State = export.Failed
+		exp.Error = exportErr.Error()
+	} else {
+		exp.State = export.Completed
+		exp.Error = ""
+	}
+
+	err = exp.CommitFields(db, set.NewSet(
+		"state", "error", "size", "expires"))
+	if err != nil {
+		return
+	}
+	event.PublishDispatch(db, "export.change")
+
+	err = exportErr
+
+	return
+}
+
+func ExportImage(db *database.Database, exp *export.Export) (err error) {
+	img, err := image.Get(db, exp.Image)
+	if err != nil {
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"export_id": exp.Id.Hex(),
+		"image_id":  img.Id.Hex(),
+		"format":    exp.Format,
+	}).Info("data: Exporting image")
+
+	err = runExport(db, exp, func(tmpPath string) (
+		conf *vmdk.OvaConfig, err error) {
+
+		err = getImage(db, img, tmpPath)
+		if err != nil {
+			return
+		}
+
+		conf = &vmdk.OvaConfig{
+			Name: exp.Name,
+		}
+
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func ExportDisk(db *database.Database, exp *export.Export,
+	dsk *disk.Disk, virt *vm.VirtualMachine) (err error) {
+
+	dskPth := paths.GetDiskPath(dsk.Id)
+
+	logrus.WithFields(logrus.Fields{
+		"export_id": exp.Id.Hex(),
+		"disk_id":   dsk.Id.Hex(),
+		"disk_path": dskPth,
+		"format":    exp.Format,
+	}).Info("data: Exporting disk")
+
+	err = runExport(db, exp, func(tmpPath string) (
+		conf *vmdk.OvaConfig, err error) {
+
+		available := false
+		if virt != nil {
+			err = qmp.BackupDisk(virt.Id, dsk, tmpPath)
+			if err != nil {
+				if _, ok := err.(*qmp.DiskNotFound); ok {
+					err = nil
+				} else {
+					return
+				}
+			} else {
+				available = true
+			}
+		}
+
+		if !available {
+			err = utils.Exec("", "cp", dskPth, tmpPath)
+			if err != nil {
+				return
+			}
+		}
+
+		conf = &vmdk.OvaConfig{
+			Name: exp.Name,
+		}
+
+		if !dsk.Instance.IsZero() {
+			inst, e := instance.Get(db, dsk.Instance)
+			if e == nil {
+				conf.Processors = inst.Processors
+				conf.Memory = inst.Memory
+			}
+		}
+
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func GetExportUrl(db *database.Database, exp *export.Export) (
+	err error) {
+
+	if exp.State != export.Completed || time.Now().After(exp.Expires) {
+		return
+	}
+
+	store, err := storage.Get(db, exp.Storage)
+	if err != nil {
+		return
+	}
+
+	client, err := getExportClient(store)
+	if err != nil {
+		return
+	}
+
+	params := url.Values{}
+	params.Set("response-content-disposition",
+		fmt.Sprintf("attachment; filename=\"%s\"", exp.Filename()))
+
+	u, err := client.PresignedGetObject(context.Background(), store.Bucket,
+		exp.Key, time.Until(exp.Expires), params)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "data: Failed to sign export url"),
+		}
+		return
+	}
+
+	exp.Url = u.String()
+
+	return
+}
+
+func DeleteExport(db *database.Database, exp *export.Export) (err error) {
+	if exp.State == export.Completed || exp.State == export.Failed {
+		store, e := storage.Get(db, exp.Storage)
+		if e != nil {
+			if _, ok := e.(*database.NotFoundError); !ok {
+				err = e
+				return
+			}
+		} else {
+			client, e := getExportClient(store)
+			if e != nil {
+				err = e
+				return
+			}
+
+			err = client.RemoveObject(context.Background(), store.Bucket,
+				exp.Key, minio.RemoveObjectOptions{})
+			if err != nil {
+				err = &errortypes.WriteError{
+					errors.Wrap(err, "data: Failed to remove export"),
+				}
+				return
+			}
+		}
+	}
+
+	err = export.Remove(db, exp.Id)
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -109,59 +109,69 @@ func getImage(db *database.Database, img *image.Image,
 			return
 		}
 
-		signature, e := os.Open(sigPth)
-		if e != nil {
+		err = checkSignature(constants.PritunlKeyring, tmpPth, sigPth)
+		if err != nil {
 			os.Remove(tmpPth)
-
-			err = &errortypes.ReadError{
-				errors.Wrap(e, "data: Failed to open image signature"),
-			}
 			return
 		}
-		defer signature.Close()
 
-		tmpImg, e := os.Open(tmpPth)
-		if e != nil {
-			os.Remove(tmpPth)
-
-			err = &errortypes.ReadError{
-				errors.Wrap(e, "data: Failed to open image"),
-			}
-			return
-		}
-		defer tmpImg.Close()
+		logrus.WithFields(logrus.Fields{
+			"id":         img.Id.Hex(),
+			"storage_id": store.Id.Hex(),
+			"key":        img.Key,
+		}).Info("data: Image signature successfully validated")
+	}
 
-		keyring, e := openpgp.ReadArmoredKeyRing(
-			strings.NewReader(constants.PritunlKeyring))
-		if e != nil {
+	if img.Encrypted || img.Checksum != "" {
+		err = decryptImage(db, img, tmpPth)
+		if err != nil {
 			os.Remove(tmpPth)
-
-			err = &errortypes.ParseError{
-				errors.Wrap(e, "data: Failed to parse Pritunl keyring"),
-			}
 			return
 		}
+	}
 
-		entity, e := openpgp.CheckArmoredDetachedSignature(
-			keyring, tmpImg, signature)
-		if e != nil || entity == nil {
-			os.Remove(tmpPth)
+	err = utils.Exec("", "mv", tmpPth, pth)
+	if err != nil {
+		return
+	}
 
-			err = &errortypes.VerificationError{
-				errors.Wrap(e, "data: Image signature verification failed"),
-			}
-			return
+	return
+}
+
+func checkSignature(armoredKeyring, pth, sigPth string) (err error) {
+	signature, err := os.Open(sigPth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to open image signature"),
 		}
+		return
+	}
+	defer signature.Close()
 
-		logrus.WithFields(logrus.Fields{
-			"id":         img.Id.Hex(),
-			"storage_id": store.Id.Hex(),
-			"key":        img.Key,
-		}).Info("data: Image signature successfully validated")
+	img, err := os.Open(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to open image"),
+		}
+		return
 	}
+	defer img.Close()
 
-	err = utils.Exec("", "mv", tmpPth, pth)
+	keyring, err := openpgp.ReadArmoredKeyRing(
+		strings.NewReader(armoredKeyring))
 	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "data: Failed to parse keyring"),
+		}
+		return
+	}
+
+	entity, err := openpgp.CheckArmoredDetachedSignature(
+		keyring, img, signature)
+	if err != nil || entity == nil {
+		err = &errortypes.VerificationError{
+			errors.Wrap(err, "data: Image signature verification failed"),
+		}
 		return
 	}
 
@@ -189,6 +199,41 @@ func copyBackingImage(imagePth, backingImagePth string) (err error) {
 	return
 }
 
+func copyImageCache(img *image.Image, diskTempPath,
+	backingImagePth string, backingImage bool) (cached bool, err error) {
+
+	imagePth := GetImageCachePath(img)
+
+	lockId := imageLock.Lock(imagePth)
+	defer imageLock.Unlock(imagePth, lockId)
+
+	cached, err = utils.Exists(imagePth)
+	if err != nil || !cached {
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"image_id": img.Id.Hex(),
+		"path":     imagePth,
+	}).Info("data: Using prefetched image")
+
+	if backingImage {
+		err = copyBackingImage(imagePth, backingImagePth)
+		if err != nil {
+			return
+		}
+	} else {
+		err = utils.Exec("", "cp", imagePth, diskTempPath)
+		if err != nil {
+			return
+		}
+	}
+
+	utils.Exec("", "touch", imagePth)
+
+	return
+}
+
 func WriteImage(db *database.Database, imgId, dskId primitive.ObjectID,
 	size int, backingImage bool) (backingImageName string, err error) {
 
@@ -234,11 +279,7 @@ func WriteImage(db *database.Database, imgId, dskId primitive.ObjectID,
 
 	if img.Type == storage.Public {
 		cacheDir := node.Self.GetCachePath()
-
-		imagePth := path.Join(
-			cacheDir,
-			fmt.Sprintf("image-%s-%s", img.Id.Hex(), img.Etag),
-		)
+		imagePth := GetImageCachePath(img)
 
 		err = utils.ExistsMkdir(cacheDir, 0755)
 		if err != nil {
@@ -320,15 +361,24 @@ func WriteImage(db *database.Database, imgId, dskId primitive.ObjectID,
 			return
 		}
 	} else {
-		if backingImage {
-			err = getImage(db, img, backingImagePth)
-			if err != nil {
-				return
-			}
-		} else {
-			err = getImage(db, img, diskTempPath)
-			if err != nil {
-				return
+		cached, e := copyImageCache(img, diskTempPath, backingImagePth,
+			backingImage)
+		if e != nil {
+			err = e
+			return
+		}
+
+		if !cached {
+			if backingImage {
+				err = getImage(db, img, backingImagePth)
+				if err != nil {
+					return
+				}
+			} else {
+				err = getImage(db, img, diskTempPath)
+				if err != nil {
+					return
+				}
 			}
 		}
 
@@ -369,7 +419,13 @@ func WriteImage(db *database.Database, imgId, dskId primitive.ObjectID,
 				return
 			}
 		} else {
-			if size > 10 {
+			curSize, e := GetImageSize(diskTempPath)
+			if e != nil {
+				err = e
+				return
+			}
+
+			if size > 10 && size > curSize {
 				_, err = utils.ExecCombinedOutputLogged(nil, "qemu-img",
 					"resize", diskTempPath, fmt.Sprintf("%dG", size))
 				if err != nil {
@@ -419,6 +475,14 @@ func DeleteImage(db *database.Database, imgId primitive.ObjectID) (err error) {
 		return
 	}
 
+	if img.Checksum != "" {
+		err = client.RemoveObject(context.Background(), store.Bucket,
+			getManifestKey(img), minio.RemoveObjectOptions{})
+		if err != nil {
+			return
+		}
+	}
+
 	err = image.Remove(db, img.Id)
 	if err != nil {
 		return
@@ -474,6 +538,14 @@ func DeleteImageOrg(db *database.Database, orgId, imgId primitive.ObjectID) (
 		return
 	}
 
+	if img.Checksum != "" {
+		err = client.RemoveObject(context.Background(), store.Bucket,
+			getManifestKey(img), minio.RemoveObjectOptions{})
+		if err != nil {
+			return
+		}
+	}
+
 	err = image.Remove(db, img.Id)
 	if err != nil {
 		return
@@ -741,11 +813,46 @@ func CreateBackup(db *database.Database, dsk *disk.Disk,
 		return
 	}
 
+	manifest := &backupManifest{
+		Image:        img.Id,
+		Disk:         dsk.Id,
+		Organization: img.Organization,
+		Key:          img.Key,
+		Timestamp:    time.Now(),
+	}
+
+	if dc.BackupEncryption {
+		logrus.WithFields(logrus.Fields{
+			"disk_id":    dsk.Id.Hex(),
+			"storage_id": store.Id.Hex(),
+		}).Info("data: Encrypting disk backup")
+
+		fingerprint, e := encryptBackup(db, img, tmpPath)
+		if e != nil {
+			err = e
+			return
+		}
+
+		img.Encrypted = true
+		manifest.Encrypted = true
+		manifest.KeyFingerprint = fingerprint
+	}
+
+	checksum, size, err := getFileChecksum(tmpPath)
+	if err != nil {
+		return
+	}
+
+	img.Checksum = checksum
+	manifest.Checksum = checksum
+	manifest.Size = size
+
 	logrus.WithFields(logrus.Fields{
 		"disk_id":    dsk.Id.Hex(),
 		"disk_path":  dskPth,
 		"storage_id": store.Id.Hex(),
 		"object_key": img.Key,
+		"encrypted":  img.Encrypted,
 	}).Info("data: Uploading disk backup")
 
 	client, err := minio.New(store.Endpoint, &minio.Options{
@@ -775,6 +882,11 @@ func CreateBackup(db *database.Database, dsk *disk.Disk,
 		return
 	}
 
+	err = putManifest(client, store, img, manifest)
+	if err != nil {
+		return
+	}
+
 	time.Sleep(3 * time.Second)
 
 	obj, err := client.StatObject(context.Background(),
@@ -863,6 +975,13 @@ func RestoreBackup(db *database.Database, dsk *disk.Disk) (err error) {
 		return
 	}
 
+	if img.Encrypted || img.Checksum != "" {
+		err = decryptImage(db, img, tmpPath)
+		if err != nil {
+			return
+		}
+	}
+
 	err = utils.Exec("", "mv", "-f", tmpPath, dskPth)
 	if err != nil {
 		return
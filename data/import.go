@@ -0,0 +1,836 @@
+package data
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	minio "github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/credentials"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/datacenter"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/event"
+	"github.com/pritunl/pritunl-cloud/image"
+	"github.com/pritunl/pritunl-cloud/paths"
+	"github.com/pritunl/pritunl-cloud/settings"
+	"github.com/pritunl/pritunl-cloud/storage"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	Qcow2 = "qcow2"
+	Raw   = "raw"
+	Vmdk  = "vmdk"
+	Vhd   = "vhd"
+	Vhdx  = "vhdx"
+	Ova   = "ova"
+)
+
+var (
+	importClient = &http.Client{
+		Timeout: 12 * time.Hour,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+				Control:   importDialControl,
+			}).DialContext,
+			TLSHandshakeTimeout:   30 * time.Second,
+			ResponseHeaderTimeout: 60 * time.Second,
+		},
+		CheckRedirect: importCheckRedirect,
+	}
+	importBlockedNets = parseNetworks(
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.0.2.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"198.51.100.0/24",
+		"203.0.113.0/24",
+		"224.0.0.0/4",
+		"240.0.0.0/4",
+		"::/128",
+		"::1/128",
+		"64:ff9b::/96",
+		"100::/64",
+		"2001:db8::/32",
+		"fc00::/7",
+		"fe80::/10",
+		"ff00::/8",
+	)
+	qemuFormats = map[string]string{
+		Qcow2: "qcow2",
+		Raw:   "raw",
+		Vmdk:  "vmdk",
+		Vhd:   "vpc",
+		Vhdx:  "vhdx",
+	}
+	ovaDiskExts = []string{
+		".vmdk",
+		".qcow2",
+		".vhd",
+		".vhdx",
+		".img",
+		".raw",
+	}
+)
+
+func ValidImageFormat(format string) bool {
+	if format == Ova {
+		return true
+	}
+	_, ok := qemuFormats[format]
+	return ok
+}
+
+type ImportOptions struct {
+	Id           primitive.ObjectID
+	Name         string
+	Comment      string
+	Organization primitive.ObjectID
+	Firmware     string
+	Format       string
+	Checksum     string
+	Signature    string
+	SigningKey   string
+}
+
+type qemuImageExtent struct {
+	Filename string `json:"filename"`
+}
+
+type qemuImageSpecificData struct {
+	DataFile   string             `json:"data-file"`
+	CreateType string             `json:"create-type"`
+	Extents    []*qemuImageExtent `json:"extents"`
+}
+
+type qemuImageSpecific struct {
+	Type string                 `json:"type"`
+	Data *qemuImageSpecificData `json:"data"`
+}
+
+type qemuImageInfo struct {
+	Format          string             `json:"format"`
+	Filename        string             `json:"filename"`
+	BackingFilename string             `json:"backing-filename"`
+	FormatSpecific  *qemuImageSpecific `json:"format-specific"`
+}
+
+func parseNetworks(cidrs ...string) (networks []*net.IPNet) {
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return
+}
+
+// Returns true if the address is publicly routable
+func isPublicIp(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	for _, network := range importBlockedNets {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Checks the resolved address of every connection including redirects to
+// prevent requests to internal services
+func importDialControl(network, address string, c syscall.RawConn) (
+	err error) {
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "data: Failed to parse image url address"),
+		}
+		return
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIp(ip) {
+		err = &errortypes.RequestError{
+			errors.Newf("data: Image url address '%s' not allowed", host),
+		}
+		return
+	}
+
+	return
+}
+
+func importCheckRedirect(req *http.Request, via []*http.Request) (
+	err error) {
+
+	if len(via) >= 10 {
+		err = &errortypes.RequestError{
+			errors.New("data: Too many image url redirects"),
+		}
+		return
+	}
+
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		err = &errortypes.RequestError{
+			errors.Newf("data: Unsupported image url scheme '%s'",
+				req.URL.Scheme),
+		}
+		return
+	}
+
+	return
+}
+
+func DownloadImage(rawUrl, pth string) (err error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "data: Failed to parse image url"),
+		}
+		return
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		err = &errortypes.ParseError{
+			errors.Newf("data: Unsupported image url scheme '%s'", u.Scheme),
+		}
+		return
+	}
+
+	resp, err := importClient.Get(u.String())
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "data: Failed to request image"),
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		err = &errortypes.RequestError{
+			errors.Newf("data: Bad status %d from image url",
+				resp.StatusCode),
+		}
+		return
+	}
+
+	err = WriteImageFile(resp.Body, pth)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func WriteImageFile(src io.Reader, pth string) (err error) {
+	file, err := os.OpenFile(pth, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "data: Failed to create image file"),
+		}
+		return
+	}
+	defer file.Close()
+
+	maxSize := int64(settings.System.ImageImportMaxSize) << 30
+
+	n, err := io.Copy(file, io.LimitReader(src, maxSize+1))
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "data: Failed to write image file"),
+		}
+		return
+	}
+
+	if n > maxSize {
+		err = &errortypes.WriteError{
+			errors.Newf("data: Image exceeds maximum size of %dGB",
+				settings.System.ImageImportMaxSize),
+		}
+		return
+	}
+
+	return
+}
+
+func verifyChecksum(pth, checksum string) (err error) {
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+
+	algo := ""
+	if i := strings.Index(checksum, ":"); i != -1 {
+		algo = checksum[:i]
+		checksum = checksum[i+1:]
+	} else {
+		switch len(checksum) {
+		case 32:
+			algo = "md5"
+		case 40:
+			algo = "sha1"
+		case 64:
+			algo = "sha256"
+		case 128:
+			algo = "sha512"
+		}
+	}
+
+	var hsh hash.Hash
+	switch algo {
+	case "md5":
+		hsh = md5.New()
+	case "sha1":
+		hsh = sha1.New()
+	case "sha256":
+		hsh = sha256.New()
+	case "sha512":
+		hsh = sha512.New()
+	default:
+		err = &errortypes.ParseError{
+			errors.New("data: Unknown image checksum type"),
+		}
+		return
+	}
+
+	file, err := os.Open(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to open image"),
+		}
+		return
+	}
+	defer file.Close()
+
+	_, err = io.Copy(hsh, file)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to read image"),
+		}
+		return
+	}
+
+	if fmt.Sprintf("%x", hsh.Sum(nil)) != checksum {
+		err = &errortypes.VerificationError{
+			errors.New("data: Image checksum mismatch"),
+		}
+		return
+	}
+
+	return
+}
+
+func DetectImageFormat(pth string) (format string, err error) {
+	file, err := os.Open(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to open image"),
+		}
+		return
+	}
+	defer file.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to read image header"),
+		}
+		return
+	}
+	err = nil
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("QFI\xfb")):
+		format = Qcow2
+		return
+	case bytes.HasPrefix(header, []byte("KDMV")):
+		format = Vmdk
+		return
+	case bytes.HasPrefix(header, []byte("vhdxfile")):
+		format = Vhdx
+		return
+	case bytes.HasPrefix(header, []byte("conectix")):
+		format = Vhd
+		return
+	case len(header) >= 262 && bytes.Equal(header[257:262], []byte("ustar")):
+		format = Ova
+		return
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to stat image"),
+		}
+		return
+	}
+
+	if info.Size() >= 512 {
+		footer := make([]byte, 8)
+		_, err = file.ReadAt(footer, info.Size()-512)
+		if err != nil {
+			err = &errortypes.ReadError{
+				errors.Wrap(err, "data: Failed to read image footer"),
+			}
+			return
+		}
+
+		if bytes.Equal(footer, []byte("conectix")) {
+			format = Vhd
+			return
+		}
+	}
+
+	format = Raw
+
+	return
+}
+
+func extractOva(pth, dest string) (err error) {
+	file, err := os.Open(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to open ova"),
+		}
+		return
+	}
+	defer file.Close()
+
+	reader := tar.NewReader(file)
+	for {
+		header, e := reader.Next()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = &errortypes.ReadError{
+				errors.Wrap(e, "data: Failed to read ova"),
+			}
+			return
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		ext := strings.ToLower(path.Ext(header.Name))
+		for _, diskExt := range ovaDiskExts {
+			if ext != diskExt {
+				continue
+			}
+
+			logrus.WithFields(logrus.Fields{
+				"name": header.Name,
+				"size": header.Size,
+			}).Info("data: Extracting ova disk")
+
+			err = WriteImageFile(reader, dest)
+			if err != nil {
+				return
+			}
+
+			return
+		}
+	}
+
+	err = &errortypes.ParseError{
+		errors.New("data: Failed to find disk in ova"),
+	}
+
+	return
+}
+
+// Rejects images that reference files outside of the image, qemu-img
+// would otherwise read host files into the converted image
+func checkImageInfo(srcPth, qemuFormat string, info *qemuImageInfo) (
+	err error) {
+
+	if info.Format != qemuFormat {
+		err = &errortypes.VerificationError{
+			errors.Newf("data: Image format '%s' does not match '%s'",
+				info.Format, qemuFormat),
+		}
+		return
+	}
+
+	if info.BackingFilename != "" {
+		err = &errortypes.VerificationError{
+			errors.New("data: Image with backing file cannot be imported"),
+		}
+		return
+	}
+
+	var specific *qemuImageSpecificData
+	if info.FormatSpecific != nil {
+		specific = info.FormatSpecific.Data
+	}
+
+	switch qemuFormat {
+	case "qcow2":
+		if specific != nil && specific.DataFile != "" {
+			err = &errortypes.VerificationError{
+				errors.New("data: Image with data file cannot be imported"),
+			}
+			return
+		}
+	case "vmdk":
+		file, e := os.Open(srcPth)
+		if e != nil {
+			err = &errortypes.ReadError{
+				errors.Wrap(e, "data: Failed to open image"),
+			}
+			return
+		}
+
+		magic := make([]byte, 4)
+		_, e = io.ReadFull(file, magic)
+		file.Close()
+		if e != nil || !bytes.Equal(magic, []byte("KDMV")) {
+			err = &errortypes.VerificationError{
+				errors.New("data: VMDK descriptor files cannot be imported"),
+			}
+			return
+		}
+
+		if specific == nil || len(specific.Extents) != 1 ||
+			(specific.CreateType != "monolithicSparse" &&
+				specific.CreateType != "streamOptimized") {
+
+			err = &errortypes.VerificationError{
+				errors.New("data: Only monolithic VMDK images can be imported"),
+			}
+			return
+		}
+
+		if specific.Extents[0].Filename != info.Filename {
+			err = &errortypes.VerificationError{
+				errors.New("data: VMDK image with external extent " +
+					"cannot be imported"),
+			}
+			return
+		}
+	}
+
+	return
+}
+
+func convertImage(srcPth, dstPth, format string) (err error) {
+	qemuFormat := qemuFormats[format]
+	if qemuFormat == "" {
+		err = &errortypes.ParseError{
+			errors.Newf("data: Unsupported image format '%s'", format),
+		}
+		return
+	}
+
+	output, err := utils.ExecOutput("", "qemu-img", "info",
+		"-f", qemuFormat, "--output=json", srcPth)
+	if err != nil {
+		return
+	}
+
+	info := &qemuImageInfo{}
+	err = json.Unmarshal([]byte(output), info)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "data: Failed to parse image info"),
+		}
+		return
+	}
+
+	err = checkImageInfo(srcPth, qemuFormat, info)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(nil, "qemu-img", "convert",
+		"-f", qemuFormat, "-O", "qcow2", srcPth, dstPth)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func ImportImage(db *database.Database, dc *datacenter.Datacenter,
+	opts *ImportOptions, srcPth string) (img *image.Image, err error) {
+
+	if dc.PrivateStorage.IsZero() {
+		err = &errortypes.NotFoundError{
+			errors.New("data: Cannot import image without private storage"),
+		}
+		return
+	}
+
+	store, err := storage.Get(db, dc.PrivateStorage)
+	if err != nil {
+		return
+	}
+
+	tempDir := paths.GetTempDir()
+	defer utils.RemoveAll(tempDir)
+
+	err = utils.ExistsMkdir(tempDir, 0700)
+	if err != nil {
+		return
+	}
+
+	if opts.Checksum != "" {
+		err = verifyChecksum(srcPth, opts.Checksum)
+		if err != nil {
+			return
+		}
+	}
+
+	if opts.Signature != "" {
+		if opts.SigningKey == "" {
+			err = &errortypes.VerificationError{
+				errors.New("data: Image signature requires signing key"),
+			}
+			return
+		}
+
+		sigPth := path.Join(tempDir, "image.sig")
+		err = utils.CreateWrite(sigPth, opts.Signature, 0600)
+		if err != nil {
+			return
+		}
+
+		err = checkSignature(opts.SigningKey, srcPth, sigPth)
+		if err != nil {
+			return
+		}
+	}
+
+	format := opts.Format
+	if format == "" {
+		format, err = DetectImageFormat(srcPth)
+		if err != nil {
+			return
+		}
+	}
+
+	if format == Ova {
+		diskPth := path.Join(tempDir, "disk")
+
+		err = extractOva(srcPth, diskPth)
+		if err != nil {
+			return
+		}
+
+		srcPth = diskPth
+		format, err = DetectImageFormat(srcPth)
+		if err != nil {
+			return
+		}
+	}
+
+	imgId := opts.Id
+	if imgId.IsZero() {
+		imgId = primitive.NewObjectID()
+	}
+	imgPth := path.Join(tempDir, fmt.Sprintf("%s.qcow2", imgId.Hex()))
+
+	logrus.WithFields(logrus.Fields{
+		"image_id": imgId.Hex(),
+		"format":   format,
+	}).Info("data: Converting imported image")
+
+	err = convertImage(srcPth, imgPth, format)
+	if err != nil {
+		return
+	}
+
+	checksum, _, err := getFileChecksum(imgPth)
+	if err != nil {
+		return
+	}
+
+	firmware := opts.Firmware
+	if firmware == "" {
+		firmware = image.Unknown
+	}
+
+	img = &image.Image{
+		Id:           imgId,
+		Name:         opts.Name,
+		Comment:      opts.Comment,
+		Organization: opts.Organization,
+		Type:         storage.Private,
+		Firmware:     firmware,
+		Storage:      store.Id,
+		Key:          fmt.Sprintf("import/%s.qcow2", imgId.Hex()),
+		Checksum:     checksum,
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"image_id":   img.Id.Hex(),
+		"storage_id": store.Id.Hex(),
+		"object_key": img.Key,
+	}).Info("data: Uploading imported image")
+
+	client, err := minio.New(store.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(store.AccessKey, store.SecretKey, ""),
+		Secure: !store.Insecure,
+	})
+	if err != nil {
+		err = &errortypes.ConnectionError{
+			errors.Wrap(err, "data: Failed to connect to storage"),
+		}
+		return
+	}
+
+	putOpts := minio.PutObjectOptions{}
+	storageClass := storage.FormatStorageClass(dc.PrivateStorageClass)
+	if storageClass != "" {
+		putOpts.StorageClass = storageClass
+	}
+
+	_, err = client.FPutObject(context.Background(),
+		store.Bucket, img.Key, imgPth, putOpts)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "data: Failed to write object"),
+		}
+		return
+	}
+
+	obj, err := client.StatObject(context.Background(),
+		store.Bucket, img.Key, minio.StatObjectOptions{})
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to stat object"),
+		}
+		return
+	}
+
+	img.Etag = image.GetEtag(obj)
+	img.LastModified = obj.LastModified
+
+	if store.IsOracle() {
+		img.StorageClass = storage.ParseStorageClass(obj)
+	} else {
+		img.StorageClass = dc.PrivateStorageClass
+	}
+
+	err = img.Insert(db)
+	if err != nil {
+		return
+	}
+
+	event.PublishDispatch(db, "image.change")
+
+	return
+}
+
+type importEvent struct {
+	Image        primitive.ObjectID `json:"image"`
+	Organization primitive.ObjectID `json:"organization"`
+	Name         string             `json:"name"`
+	State        string             `json:"state"`
+	Error        string             `json:"error"`
+}
+
+func RunImport(dc *datacenter.Datacenter, opts *ImportOptions,
+	rawUrl, srcPth string) {
+
+	db := database.GetDatabase()
+	defer db.Close()
+
+	if srcPth == "" {
+		srcPth = paths.GetImageTempPath()
+	}
+	defer utils.Remove(srcPth)
+
+	err := utils.ExistsMkdir(paths.GetTempPath(), 0755)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"image_id": opts.Id.Hex(),
+			"error":    err,
+		}).Error("data: Failed to create temp directory")
+		return
+	}
+
+	evt := &importEvent{
+		Image:        opts.Id,
+		Organization: opts.Organization,
+		Name:         opts.Name,
+		State:        "completed",
+	}
+
+	err = func() (err error) {
+		if rawUrl != "" {
+			logrus.WithFields(logrus.Fields{
+				"image_id": opts.Id.Hex(),
+				"url":      rawUrl,
+			}).Info("data: Downloading imported image")
+
+			err = DownloadImage(rawUrl, srcPth)
+			if err != nil {
+				return
+			}
+		}
+
+		_, err = ImportImage(db, dc, opts, srcPth)
+		if err != nil {
+			return
+		}
+
+		return
+	}()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"image_id":      opts.Id.Hex(),
+			"datacenter_id": dc.Id.Hex(),
+			"error":         err,
+		}).Error("data: Failed to import image")
+
+		evt.State = "failed"
+		evt.Error = err.Error()
+	} else {
+		logrus.WithFields(logrus.Fields{
+			"image_id":      opts.Id.Hex(),
+			"datacenter_id": dc.Id.Hex(),
+		}).Info("data: Image imported")
+	}
+
+	err = event.Publish(db, "image.import", evt)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"image_id": opts.Id.Hex(),
+			"error":    err,
+		}).Error("data: Failed to publish image import event")
+	}
+}
@@ -0,0 +1,50 @@
+package data
+
+import (
+	"time"
+
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/disk"
+	"github.com/pritunl/pritunl-cloud/image"
+	"github.com/sirupsen/logrus"
+)
+
+func PruneBackups(db *database.Database, dskId primitive.ObjectID,
+	policy *disk.BackupPolicy) (pruned int, err error) {
+
+	if !policy.Retention() {
+		return
+	}
+
+	imgs, err := image.GetDiskBackups(db, dskId)
+	if err != nil {
+		return
+	}
+
+	timestamps := make([]time.Time, len(imgs))
+	for i, img := range imgs {
+		timestamps[i] = img.LastModified
+	}
+
+	for _, index := range policy.Expired(timestamps) {
+		img := imgs[index]
+
+		logrus.WithFields(logrus.Fields{
+			"disk_id":       dskId.Hex(),
+			"image_id":      img.Id.Hex(),
+			"storage_id":    img.Storage.Hex(),
+			"key":           img.Key,
+			"last_modified": img.LastModified,
+		}).Info("data: Removing expired disk backup")
+
+		err = DeleteImage(db, img.Id)
+		if err != nil {
+			return
+		}
+
+		pruned += 1
+	}
+
+	return
+}
@@ -21,10 +21,17 @@ type diskInfo struct {
 }
 
 func GetDiskSize(dsk *disk.Disk) (size int, err error) {
-	dskPth := paths.GetDiskPath(dsk.Id)
+	size, err = GetImageSize(paths.GetDiskPath(dsk.Id))
+	if err != nil {
+		return
+	}
+
+	return
+}
 
+func GetImageSize(pth string) (size int, err error) {
 	output, err := utils.ExecOutput("",
-		"qemu-img", "info", "--output=json", dskPth)
+		"qemu-img", "info", "--output=json", pth)
 	if err != nil {
 		return
 	}
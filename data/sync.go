@@ -2,6 +2,8 @@ package data
 
 import (
 	"context"
+	"io"
+	"io/ioutil"
 	"strings"
 	"time"
 
@@ -42,7 +44,9 @@ func Sync(db *database.Database, store *storage.Storage) (err error) {
 
 	images := []*image.Image{}
 	signedKeys := set.NewSet()
+	manifestKeys := set.NewSet()
 	remoteKeys := set.NewSet()
+	metadatas := map[string]*image.Metadata{}
 	for object := range client.ListObjects(
 		context.Background(),
 		store.Bucket, minio.ListObjectsOptions{
@@ -59,6 +63,8 @@ func Sync(db *database.Database, store *storage.Storage) (err error) {
 
 		if strings.HasSuffix(object.Key, ".qcow2.sig") {
 			signedKeys.Add(strings.TrimRight(object.Key, ".sig"))
+		} else if strings.HasSuffix(object.Key, ".qcow2.json") {
+			manifestKeys.Add(object.Key)
 		} else if strings.HasSuffix(object.Key, ".qcow2") {
 			etag := image.GetEtag(object)
 			remoteKeys.Add(object.Key)
@@ -72,20 +78,21 @@ func Sync(db *database.Database, store *storage.Storage) (err error) {
 				LastModified: object.LastModified,
 			}
 
-			if store.IsOracle() {
-				obj, e := client.StatObject(context.Background(),
-					store.Bucket, object.Key, minio.StatObjectOptions{})
-				if e != nil {
-					err = &errortypes.ReadError{
-						errors.Wrap(e, "storage: Failed to stat object"),
-					}
-					return
+			obj, e := client.StatObject(context.Background(),
+				store.Bucket, object.Key, minio.StatObjectOptions{})
+			if e != nil {
+				err = &errortypes.ReadError{
+					errors.Wrap(e, "storage: Failed to stat object"),
 				}
+				return
+			}
 
+			if store.IsOracle() {
 				img.StorageClass = storage.ParseStorageClass(obj)
 			} else {
 				img.StorageClass = storage.ParseStorageClass(object)
 			}
+			metadatas[object.Key] = image.ParseHeaders(obj.Metadata)
 
 			images = append(images, img)
 		}
@@ -111,10 +118,44 @@ func Sync(db *database.Database, store *storage.Storage) (err error) {
 					"bucket": store.Bucket,
 					"key":    img.Key,
 				}).Error("data: Ignoring lost image")
+				err = nil
+				continue
 			} else {
 				return
 			}
 		}
+
+		meta := metadatas[img.Key]
+		if manifestKeys.Contains(image.GetManifestKey(img.Key)) {
+			manifest, e := getImageManifest(client, store, img.Key)
+			if e != nil {
+				logrus.WithFields(logrus.Fields{
+					"bucket": store.Bucket,
+					"key":    img.Key,
+					"error":  e,
+				}).Error("data: Failed to read image manifest")
+				continue
+			}
+			meta = manifest
+		}
+
+		if meta == nil {
+			meta = &image.Metadata{}
+		}
+		img.SetMetadata(meta)
+
+		errData, e := img.SyncMetadata(db)
+		if e != nil {
+			err = e
+			return
+		}
+		if errData != nil {
+			logrus.WithFields(logrus.Fields{
+				"bucket": store.Bucket,
+				"key":    img.Key,
+				"error":  errData.Message,
+			}).Error("data: Ignoring invalid image metadata")
+		}
 	}
 
 	localKeys, err := image.Distinct(db, store.Id)
@@ -140,3 +181,32 @@ func Sync(db *database.Database, store *storage.Storage) (err error) {
 
 	return
 }
+
+func getImageManifest(client *minio.Client, store *storage.Storage,
+	key string) (meta *image.Metadata, err error) {
+
+	obj, err := client.GetObject(context.Background(), store.Bucket,
+		image.GetManifestKey(key), minio.GetObjectOptions{})
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to read image manifest"),
+		}
+		return
+	}
+	defer obj.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(obj, 1048576))
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "data: Failed to read image manifest"),
+		}
+		return
+	}
+
+	meta, err = image.ParseManifest(data)
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -151,6 +151,26 @@ func (d *Database) Images() (coll *Collection) {
 	return
 }
 
+func (d *Database) Exports() (coll *Collection) {
+	coll = d.getCollection("exports")
+	return
+}
+
+func (d *Database) Captures() (coll *Collection) {
+	coll = d.getCollection("captures")
+	return
+}
+
+func (d *Database) BackingReports() (coll *Collection) {
+	coll = d.getCollection("backing_reports")
+	return
+}
+
+func (d *Database) PrefetchStatus() (coll *Collection) {
+	coll = d.getCollection("prefetch_status")
+	return
+}
+
 func (d *Database) Datacenters() (coll *Collection) {
 	coll = d.getCollection("datacenters")
 	return
@@ -191,6 +211,16 @@ func (d *Database) Firewalls() (coll *Collection) {
 	return
 }
 
+func (d *Database) FirewallStats() (coll *Collection) {
+	coll = d.getCollection("firewall_stats")
+	return
+}
+
+func (d *Database) FirewallLogs() (coll *Collection) {
+	coll = d.getCollection("firewall_logs")
+	return
+}
+
 func (d *Database) Vpcs() (coll *Collection) {
 	coll = d.getCollection("vpcs")
 	return
@@ -201,6 +231,16 @@ func (d *Database) VpcsIp() (coll *Collection) {
 	return
 }
 
+func (d *Database) VpcPeerings() (coll *Collection) {
+	coll = d.getCollection("vpc_peerings")
+	return
+}
+
+func (d *Database) FloatingIps() (coll *Collection) {
+	coll = d.getCollection("floating_ips")
+	return
+}
+
 func (d *Database) Authorities() (coll *Collection) {
 	coll = d.getCollection("authorities")
 	return
@@ -590,6 +630,103 @@ func addIndexes() (err error) {
 	if err != nil {
 		return
 	}
+	index = &Index{
+		Collection: db.Images(),
+		Keys: &bson.D{
+			{"shares", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+	index = &Index{
+		Collection: db.Images(),
+		Keys: &bson.D{
+			{"published_datacenters", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+	index = &Index{
+		Collection: db.Images(),
+		Keys: &bson.D{
+			{"prefetch", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+
+	index = &Index{
+		Collection: db.Exports(),
+		Keys: &bson.D{
+			{"organization", 1},
+			{"timestamp", -1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+	index = &Index{
+		Collection: db.Exports(),
+		Keys: &bson.D{
+			{"disk", 1},
+			{"state", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+	index = &Index{
+		Collection: db.Exports(),
+		Keys: &bson.D{
+			{"datacenter", 1},
+			{"state", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+	index = &Index{
+		Collection: db.Exports(),
+		Keys: &bson.D{
+			{"expires", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+
+	index = &Index{
+		Collection: db.Captures(),
+		Keys: &bson.D{
+			{"organization", 1},
+			{"timestamp", -1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+	index = &Index{
+		Collection: db.Captures(),
+		Keys: &bson.D{
+			{"disk", 1},
+			{"state", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
 
 	index = &Index{
 		Collection: db.Disks(),
@@ -790,6 +927,89 @@ func addIndexes() (err error) {
 		return
 	}
 
+	index = &Index{
+		Collection: db.VpcPeerings(),
+		Keys: &bson.D{
+			{"vpc", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+	index = &Index{
+		Collection: db.VpcPeerings(),
+		Keys: &bson.D{
+			{"peer_vpc", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+	index = &Index{
+		Collection: db.VpcPeerings(),
+		Keys: &bson.D{
+			{"organization", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+	index = &Index{
+		Collection: db.VpcPeerings(),
+		Keys: &bson.D{
+			{"peer_organization", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+	index = &Index{
+		Collection: db.VpcPeerings(),
+		Keys: &bson.D{
+			{"datacenter", 1},
+			{"active", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+
+	index = &Index{
+		Collection: db.FloatingIps(),
+		Keys: &bson.D{
+			{"organization", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+	index = &Index{
+		Collection: db.FloatingIps(),
+		Keys: &bson.D{
+			{"datacenter", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+	index = &Index{
+		Collection: db.FloatingIps(),
+		Keys: &bson.D{
+			{"instance", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+
 	index = &Index{
 		Collection: db.Sessions(),
 		Keys: &bson.D{
@@ -844,6 +1064,40 @@ func addIndexes() (err error) {
 		return
 	}
 
+	index = &Index{
+		Collection: db.FirewallStats(),
+		Keys: &bson.D{
+			{"node", 1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+
+	index = &Index{
+		Collection: db.FirewallLogs(),
+		Keys: &bson.D{
+			{"instance", 1},
+			{"timestamp", -1},
+		},
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+	index = &Index{
+		Collection: db.FirewallLogs(),
+		Keys: &bson.D{
+			{"timestamp", 1},
+		},
+		Expire: 72 * time.Hour,
+	}
+	err = index.Create()
+	if err != nil {
+		return
+	}
+
 	index = &Index{
 		Collection: db.Zones(),
 		Keys: &bson.D{
@@ -19,6 +19,7 @@ type Datacenter struct {
 	PrivateStorageClass string               `bson:"private_storage_class" json:"private_storage_class"`
 	BackupStorage       primitive.ObjectID   `bson:"backup_storage,omitempty" json:"backup_storage"`
 	BackupStorageClass  string               `bson:"backup_storage_class" json:"backup_storage_class"`
+	BackupEncryption    bool                 `bson:"backup_encryption" json:"backup_encryption"`
 }
 
 func (d *Datacenter) Validate(db *database.Database) (
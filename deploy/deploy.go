@@ -11,19 +11,19 @@ func Deploy(stat *state.State) (err error) {
 		return
 	}
 
-	ipset := NewIpset(stat)
-	err = ipset.Deploy()
+	netfilter := NewNetfilter(stat)
+	err = netfilter.Deploy()
 	if err != nil {
 		return
 	}
 
-	iptables := NewIptables(stat)
-	err = iptables.Deploy()
+	err = netfilter.Clean()
 	if err != nil {
 		return
 	}
 
-	err = ipset.Clean()
+	nflog := NewNflog(stat)
+	err = nflog.Deploy()
 	if err != nil {
 		return
 	}
@@ -34,6 +34,12 @@ func Deploy(stat *state.State) (err error) {
 		return
 	}
 
+	resolvr := NewResolver(stat)
+	err = resolvr.Deploy()
+	if err != nil {
+		return
+	}
+
 	instances := NewInstances(stat)
 	err = instances.Deploy()
 	if err != nil {
@@ -4,13 +4,14 @@ import (
 	"time"
 
 	"github.com/dropbox/godropbox/container/set"
+	"github.com/pritunl/pritunl-cloud/capture"
 	"github.com/pritunl/pritunl-cloud/constants"
 	"github.com/pritunl/pritunl-cloud/data"
 	"github.com/pritunl/pritunl-cloud/database"
 	"github.com/pritunl/pritunl-cloud/disk"
 	"github.com/pritunl/pritunl-cloud/event"
+	"github.com/pritunl/pritunl-cloud/export"
 	"github.com/pritunl/pritunl-cloud/instance"
-	"github.com/pritunl/pritunl-cloud/settings"
 	"github.com/pritunl/pritunl-cloud/state"
 	"github.com/pritunl/pritunl-cloud/utils"
 	"github.com/pritunl/pritunl-cloud/vm"
@@ -292,6 +293,107 @@ func (d *Disks) restore(dsk *disk.Disk) {
 	}()
 }
 
+// Runs a disk task with the backup limiter and returns the disk to
+// available once the handler completes without error
+func (d *Disks) limitedTask(dsk *disk.Disk,
+	handler func(db *database.Database) (err error)) {
+
+	if !backupLimiter.Acquire() {
+		return
+	}
+
+	acquired, lockId := disksLock.LockOpen(dsk.Id.Hex())
+	if !acquired {
+		backupLimiter.Release()
+		return
+	}
+
+	go func() {
+		defer func() {
+			time.Sleep(1 * time.Second)
+			disksLock.Unlock(dsk.Id.Hex(), lockId)
+			backupLimiter.Release()
+		}()
+
+		db := database.GetDatabase()
+		defer db.Close()
+
+		if constants.Interrupt {
+			return
+		}
+
+		// Disk is returned to available on errors to allow retrying
+		_ = handler(db)
+
+		dsk.State = disk.Available
+		err := dsk.CommitFields(db, set.NewSet("state"))
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"disk_id": dsk.Id.Hex(),
+				"error":   err,
+			}).Error("deploy: Failed update disk state")
+			time.Sleep(5 * time.Second)
+			return
+		}
+
+		event.PublishDispatch(db, "disk.change")
+	}()
+}
+
+func (d *Disks) export(dsk *disk.Disk) {
+	d.limitedTask(dsk, func(db *database.Database) (err error) {
+		exps, err := export.GetDiskPending(db, dsk.Id)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"disk_id": dsk.Id.Hex(),
+				"error":   err,
+			}).Error("deploy: Failed to get disk exports")
+			return
+		}
+
+		virt := d.stat.GetVirt(dsk.Instance)
+		for _, exp := range exps {
+			e := data.ExportDisk(db, exp, dsk, virt)
+			if e != nil {
+				logrus.WithFields(logrus.Fields{
+					"disk_id":   dsk.Id.Hex(),
+					"export_id": exp.Id.Hex(),
+					"error":     e,
+				}).Error("deploy: Failed to export disk")
+			}
+		}
+
+		return
+	})
+}
+
+func (d *Disks) capture(dsk *disk.Disk) {
+	d.limitedTask(dsk, func(db *database.Database) (err error) {
+		cpts, err := capture.GetDiskPending(db, dsk.Id)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"disk_id": dsk.Id.Hex(),
+				"error":   err,
+			}).Error("deploy: Failed to get disk captures")
+			return
+		}
+
+		virt := d.stat.GetVirt(dsk.Instance)
+		for _, cpt := range cpts {
+			e := data.CaptureImage(db, cpt, dsk, virt)
+			if e != nil {
+				logrus.WithFields(logrus.Fields{
+					"disk_id":    dsk.Id.Hex(),
+					"capture_id": cpt.Id.Hex(),
+					"error":      e,
+				}).Error("deploy: Failed to capture disk")
+			}
+		}
+
+		return
+	})
+}
+
 func (d *Disks) destroy(dsk *disk.Disk) {
 	if dsk.DeleteProtection {
 		db := database.GetDatabase()
@@ -342,7 +444,7 @@ func (d *Disks) destroy(dsk *disk.Disk) {
 }
 
 func (d *Disks) scheduleBackup(dsk *disk.Disk) {
-	if time.Since(dsk.LastBackup) < 24*time.Hour {
+	if !dsk.GetBackupPolicy().Due(dsk.LastBackup) {
 		return
 	}
 
@@ -416,14 +518,7 @@ func (d *Disks) scheduleBackup(dsk *disk.Disk) {
 
 func (d *Disks) Deploy() (err error) {
 	disks := d.stat.Disks()
-
-	backupHour := settings.System.DiskBackupTime
-	backupWindow := settings.System.DiskBackupWindow
-	utcHour := time.Now().UTC().Hour()
-	backupActive := false
-	if utcHour >= backupHour && utcHour <= (backupHour+backupWindow) {
-		backupActive = true
-	}
+	now := time.Now()
 
 	for _, dsk := range disks {
 		switch dsk.State {
@@ -439,6 +534,12 @@ func (d *Disks) Deploy() (err error) {
 		case disk.Restore:
 			d.restore(dsk)
 			break
+		case disk.Export:
+			d.export(dsk)
+			break
+		case disk.Capture:
+			d.capture(dsk)
+			break
 		case disk.Expand:
 			d.expand(dsk)
 			break
@@ -446,7 +547,7 @@ func (d *Disks) Deploy() (err error) {
 			d.destroy(dsk)
 			break
 		case disk.Available:
-			if backupActive && dsk.Backup {
+			if dsk.Backup && dsk.GetBackupPolicy().Active(now) {
 				d.scheduleBackup(dsk)
 			}
 			break
@@ -15,18 +15,33 @@ type Domains struct {
 	stat *state.State
 }
 
-func (d *Domains) create(db *database.Database, inst *instance.Instance) {
-	pubAddr6 := ""
+func (d *Domains) getAddrs(inst *instance.Instance) (
+	pubAddr, pubAddr6 string) {
+
 	if inst.PublicIps6 != nil && len(inst.PublicIps6) > 0 {
 		pubAddr6 = inst.PublicIps6[0]
 	}
 
-	if pubAddr6 == "" {
+	// Floating ips are published since the address is kept when the
+	// instance is replaced
+	fip := d.stat.FloatingIp(inst.Id)
+	if fip != nil {
+		pubAddr = fip.Address
+	}
+
+	return
+}
+
+func (d *Domains) create(db *database.Database, inst *instance.Instance) {
+	pubAddr, pubAddr6 := d.getAddrs(inst)
+
+	if pubAddr == "" && pubAddr6 == "" {
 		return
 	}
 
 	logrus.WithFields(logrus.Fields{
 		"instance": inst.Id.Hex(),
+		"address":  pubAddr,
 		"address6": pubAddr6,
 	}).Info("deploy: Creating domain record")
 
@@ -39,7 +54,7 @@ func (d *Domains) create(db *database.Database, inst *instance.Instance) {
 		Timestamp:    time.Now(),
 	}
 
-	err := recrd.Upsert(db, "", pubAddr6)
+	err := recrd.Upsert(db, pubAddr, pubAddr6)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"instance": recrd.Instance.Hex(),
@@ -58,7 +73,9 @@ func (d *Domains) update(db *database.Database, recrd *domain.Record,
 	logrus.WithFields(logrus.Fields{
 		"record":       recrd.Id.Hex(),
 		"instance":     recrd.Instance.Hex(),
-		"cur_address6": recrd.Address,
+		"cur_address":  recrd.Address,
+		"cur_address6": recrd.Address6,
+		"new_address":  addr,
 		"new_address6": addr6,
 	}).Info("deploy: Updating domain record")
 
@@ -130,16 +147,15 @@ func (d *Domains) Deploy() (err error) {
 			}
 
 			if curRecrd != nil {
-				pubAddr6 := ""
-				if inst.PublicIps6 != nil && len(inst.PublicIps6) > 0 {
-					pubAddr6 = inst.PublicIps6[0]
-				}
+				pubAddr, pubAddr6 := d.getAddrs(inst)
 
-				if pubAddr6 == "" {
+				if pubAddr == "" && pubAddr6 == "" {
 					d.remove(db, curRecrd)
 					continue
-				} else if pubAddr6 != curRecrd.Address6 {
-					d.update(db, curRecrd, "", pubAddr6)
+				} else if pubAddr != curRecrd.Address ||
+					pubAddr6 != curRecrd.Address6 {
+
+					d.update(db, curRecrd, pubAddr, pubAddr6)
 					continue
 				}
 
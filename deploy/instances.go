@@ -1,6 +1,7 @@
 package deploy
 
 import (
+	"strconv"
 	"strings"
 	"time"
 
@@ -558,6 +559,269 @@ func (s *Instances) check(inst *instance.Instance, namespaces set.Set) (
 	return
 }
 
+func (s *Instances) peerAdd(inst *instance.Instance, namespace string,
+	peerVc *vpc.Vpc) (err error) {
+
+	ifaceInternal := vm.GetIfaceInternal(inst.Id, 0)
+	ifacePeer := vm.GetIfacePeer(inst.Id, peerVc.VpcId)
+
+	peerNet, err := peerVc.GetNetwork()
+	if err != nil {
+		return
+	}
+
+	peerNet6, err := peerVc.GetNetwork6()
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		[]string{"File exists"},
+		"ip", "netns", "exec", namespace,
+		"ip", "link",
+		"add", "link", ifaceInternal,
+		"name", ifacePeer,
+		"type", "vlan",
+		"id", strconv.Itoa(peerVc.VpcId),
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"ip", "netns", "exec", namespace,
+		"ip", "link",
+		"set", "dev", ifacePeer, "up",
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		[]string{"File exists"},
+		"ip", "netns", "exec", namespace,
+		"ip", "route",
+		"add", peerNet.String(),
+		"dev", ifacePeer,
+		"metric", "96",
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		[]string{"File exists"},
+		"ip", "netns", "exec", namespace,
+		"ip", "-6", "route",
+		"add", peerNet6.String(),
+		"dev", ifacePeer,
+		"metric", "96",
+	)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Peered vpcs are reached by attaching the peer vlan to the instance
+// namespace and routing the peer networks directly onto that link
+func (s *Instances) peers(inst *instance.Instance, vc *vpc.Vpc) {
+	namespace := vm.GetNamespace(inst.Id, 0)
+
+	var curVpcIds []int
+	peersStore, ok := store.GetPeers(inst.Id)
+	if !ok {
+		vpcIds, err := qemu.GetPeers(inst.Id)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("deploy: Failed to deploy instance peers")
+			return
+		}
+
+		if vpcIds == nil {
+			return
+		}
+
+		store.SetPeers(inst.Id, vpcIds)
+		curVpcIds = vpcIds
+	} else {
+		curVpcIds = peersStore.VpcIds
+	}
+
+	curPeers := set.NewSet()
+	for _, vpcId := range curVpcIds {
+		curPeers.Add(vpcId)
+	}
+
+	newPeers := map[int]*vpc.Vpc{}
+	for _, peerVc := range s.stat.VpcPeers(vc.Id) {
+		newPeers[peerVc.VpcId] = peerVc
+	}
+
+	changed := false
+
+	for vpcIdInf := range curPeers.Iter() {
+		vpcId := vpcIdInf.(int)
+		if _, ok := newPeers[vpcId]; ok {
+			continue
+		}
+		changed = true
+
+		utils.ExecCombinedOutputLogged(
+			[]string{
+				"Cannot find device",
+			},
+			"ip", "netns", "exec", namespace,
+			"ip", "link",
+			"del", vm.GetIfacePeer(inst.Id, vpcId),
+		)
+	}
+
+	for vpcId, peerVc := range newPeers {
+		if curPeers.Contains(vpcId) {
+			continue
+		}
+		changed = true
+
+		err := s.peerAdd(inst, namespace, peerVc)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"instance_id": inst.Id.Hex(),
+				"vpc_id":      vc.Id.Hex(),
+				"peer_vpc_id": peerVc.Id.Hex(),
+				"error":       err,
+			}).Error("deploy: Failed to add instance vpc peer")
+		}
+	}
+
+	if changed {
+		store.RemPeers(inst.Id)
+	}
+}
+
+// Moves the instance static public address to the attached floating ip,
+// floating ips are only attached to instances on static network nodes
+func (s *Instances) floating(inst *instance.Instance) {
+	if inst.NoPublicAddress || inst.RestartBlockIp ||
+		node.Self.NetworkMode != node.Static {
+
+		return
+	}
+
+	curAddr := ""
+	if inst.PublicIps != nil && len(inst.PublicIps) > 0 {
+		curAddr = inst.PublicIps[0]
+	}
+	if curAddr == "" {
+		return
+	}
+
+	fip := s.stat.FloatingIp(inst.Id)
+	if fip != nil {
+		if fip.Address == curAddr {
+			return
+		}
+	} else if !s.stat.IsFloatingAddr(curAddr) {
+		return
+	}
+
+	db := database.GetDatabase()
+	defer db.Close()
+
+	restart, err := qemu.UpdateStaticAddr(db, inst.Id, curAddr)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"instance_id": inst.Id.Hex(),
+			"error":       err,
+		}).Error("deploy: Failed to update instance floating ip")
+		return
+	}
+
+	if restart {
+		inst.RestartBlockIp = true
+		err = inst.CommitFields(db, set.NewSet("restart_block_ip"))
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("deploy: Failed to commit instance")
+			return
+		}
+
+		event.PublishDispatch(db, "instance.change")
+	}
+}
+
+// Instances without a public address use the vpc nat gateway as the
+// default route, falling back to the host network gateway
+func (s *Instances) natRoute(inst *instance.Instance, vc *vpc.Vpc) {
+	if !inst.NoPublicAddress && node.Self.NetworkMode != node.Internal {
+		return
+	}
+
+	namespace := vm.GetNamespace(inst.Id, 0)
+
+	gateway := ""
+	hostBlck := s.stat.NodeHostBlock()
+	if !inst.NoHostAddress && hostBlck != nil {
+		hostGateway := hostBlck.GetGateway()
+		if hostGateway != nil {
+			gateway = hostGateway.String()
+		}
+	}
+	if vc.NatGateway && vc.NatPrivate != "" && !vc.NatNode.IsZero() {
+		gateway = vc.NatPrivate
+	}
+
+	var curGateway string
+	natStore, ok := store.GetNat(inst.Id)
+	if !ok {
+		defaultGateway, exists, err := qemu.GetDefaultRoute(inst.Id)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("deploy: Failed to deploy instance nat route")
+			return
+		}
+
+		if !exists {
+			return
+		}
+
+		store.SetNat(inst.Id, defaultGateway)
+		curGateway = defaultGateway
+	} else {
+		curGateway = natStore.Gateway
+	}
+
+	if curGateway == gateway {
+		return
+	}
+
+	if gateway == "" {
+		utils.ExecCombinedOutputLogged(
+			[]string{
+				"No such process",
+			},
+			"ip", "netns", "exec", namespace,
+			"ip", "route",
+			"del", "default",
+		)
+	} else {
+		utils.ExecCombinedOutputLogged(
+			nil,
+			"ip", "netns", "exec", namespace,
+			"ip", "route",
+			"replace", "default",
+			"via", gateway,
+		)
+	}
+
+	store.RemNat(inst.Id)
+}
+
 func (s *Instances) routes(inst *instance.Instance) (err error) {
 	acquired, lockId := instancesLock.LockOpen(inst.Id.Hex())
 	if !acquired {
@@ -580,6 +844,10 @@ func (s *Instances) routes(inst *instance.Instance) (err error) {
 			return
 		}
 
+		s.floating(inst)
+		s.peers(inst, vc)
+		s.natRoute(inst, vc)
+
 		namespace := vm.GetNamespace(inst.Id, 0)
 
 		curRoutes := set.NewSet()
@@ -618,13 +886,13 @@ func (s *Instances) routes(inst *instance.Instance) (err error) {
 			curRoutes6.Add(route)
 		}
 
-		if vc.Routes != nil {
-			for _, route := range vc.Routes {
-				if !strings.Contains(route.Destination, ":") {
-					newRoutes.Add(*route)
-				} else {
-					newRoutes6.Add(*route)
-				}
+		vpcRoutes := vc.GetSubnetRoutes(
+			inst.Subnet, s.stat.VpcInstanceIps(vc.Id))
+		for _, route := range vpcRoutes {
+			if !strings.Contains(route.Destination, ":") {
+				newRoutes.Add(route)
+			} else {
+				newRoutes6.Add(route)
 			}
 		}
 
@@ -643,6 +911,17 @@ func (s *Instances) routes(inst *instance.Instance) (err error) {
 			route := routeInf.(vpc.Route)
 			changed = true
 
+			if route.Blackhole {
+				utils.ExecCombinedOutputLogged(
+					nil,
+					"ip", "netns", "exec", namespace,
+					"ip", "route",
+					"del", "blackhole", route.Destination,
+					"metric", "97",
+				)
+				continue
+			}
+
 			utils.ExecCombinedOutputLogged(
 				nil,
 				"ip", "netns", "exec", namespace,
@@ -657,6 +936,17 @@ func (s *Instances) routes(inst *instance.Instance) (err error) {
 			route := routeInf.(vpc.Route)
 			changed = true
 
+			if route.Blackhole {
+				utils.ExecCombinedOutputLogged(
+					nil,
+					"ip", "netns", "exec", namespace,
+					"ip", "-6", "route",
+					"del", "blackhole", route.Destination,
+					"metric", "97",
+				)
+				continue
+			}
+
 			utils.ExecCombinedOutputLogged(
 				nil,
 				"ip", "netns", "exec", namespace,
@@ -671,6 +961,19 @@ func (s *Instances) routes(inst *instance.Instance) (err error) {
 			route := routeInf.(vpc.Route)
 			changed = true
 
+			if route.Blackhole {
+				utils.ExecCombinedOutputLogged(
+					[]string{
+						"File exists",
+					},
+					"ip", "netns", "exec", namespace,
+					"ip", "route",
+					"add", "blackhole", route.Destination,
+					"metric", "97",
+				)
+				continue
+			}
+
 			utils.ExecCombinedOutputLogged(
 				[]string{
 					"File exists",
@@ -687,6 +990,19 @@ func (s *Instances) routes(inst *instance.Instance) (err error) {
 			route := routeInf.(vpc.Route)
 			changed = true
 
+			if route.Blackhole {
+				utils.ExecCombinedOutputLogged(
+					[]string{
+						"File exists",
+					},
+					"ip", "netns", "exec", namespace,
+					"ip", "-6", "route",
+					"add", "blackhole", route.Destination,
+					"metric", "97",
+				)
+				continue
+			}
+
 			utils.ExecCombinedOutputLogged(
 				[]string{
 					"File exists",
@@ -70,6 +70,10 @@ func (n *Namespace) Deploy() (err error) {
 		if hostNetwork {
 			curVirtIfaces.Add(vm.GetIfaceVirt(inst.Id, 2))
 		}
+		for i := 1; i < len(inst.Virt.NetworkAdapters); i++ {
+			curNamespaces.Add(vm.GetNamespace(inst.Id, i))
+			curVirtIfaces.Add(vm.GetIfaceVirt(inst.Id, 3+i))
+		}
 		if externalNetwork {
 			curExternalIfaces.Add(vm.GetIfaceExternal(inst.Id, 0))
 		}
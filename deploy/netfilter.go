@@ -0,0 +1,64 @@
+package deploy
+
+import (
+	"github.com/pritunl/pritunl-cloud/netfilter"
+	"github.com/pritunl/pritunl-cloud/state"
+	"github.com/sirupsen/logrus"
+)
+
+type Netfilter struct {
+	stat *state.State
+}
+
+func (t *Netfilter) Deploy() (err error) {
+	nodeSelf := t.stat.Node()
+	instaces := t.stat.Instances()
+	namespaces := t.stat.Namespaces()
+	nodeFirewall := t.stat.NodeFirewall()
+	firewalls := t.stat.Firewalls()
+	firewallsEgress := t.stat.FirewallsEgress()
+	logDropped := t.stat.LogDropped()
+
+	err = netfilter.Update(nodeSelf, instaces, namespaces,
+		nodeFirewall, firewalls, firewallsEgress, logDropped)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("deploy: Failed to update firewall, resetting state")
+		for {
+			err = netfilter.Recover()
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": err,
+				}).Error("deploy: Failed to recover firewall, retrying")
+				continue
+			}
+			break
+		}
+		err = nil
+		return
+	}
+
+	return
+}
+
+func (t *Netfilter) Clean() (err error) {
+	instaces := t.stat.Instances()
+	nodeFirewall := t.stat.NodeFirewall()
+	firewalls := t.stat.Firewalls()
+	firewallsEgress := t.stat.FirewallsEgress()
+
+	err = netfilter.Clean(instaces, nodeFirewall, firewalls,
+		firewallsEgress)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func NewNetfilter(stat *state.State) *Netfilter {
+	return &Netfilter{
+		stat: stat,
+	}
+}
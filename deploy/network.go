@@ -4,6 +4,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/pritunl/pritunl-cloud/hnetwork"
 	"github.com/pritunl/pritunl-cloud/interfaces"
+	"github.com/pritunl/pritunl-cloud/natgateway"
 	"github.com/pritunl/pritunl-cloud/networking"
 	"github.com/pritunl/pritunl-cloud/oracle"
 	"github.com/pritunl/pritunl-cloud/state"
@@ -40,6 +41,14 @@ func (d *Network) Deploy() (err error) {
 
 	interfaces.SyncIfaces(d.stat.VxLan())
 
+	err = natgateway.ApplyState(d.stat)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("deploy: Failed to apply nat gateway state")
+		err = nil
+	}
+
 	return
 }
 
@@ -0,0 +1,46 @@
+package deploy
+
+import (
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/pritunl/pritunl-cloud/firewall"
+	"github.com/pritunl/pritunl-cloud/nflog"
+	"github.com/pritunl/pritunl-cloud/state"
+)
+
+type Nflog struct {
+	stat *state.State
+}
+
+func (t *Nflog) Deploy() (err error) {
+	namespaces := set.NewSet()
+
+	logDropped := t.stat.LogDropped()
+	if logDropped != nil {
+		namespaces.Union(logDropped)
+	}
+
+	rulesMaps := []map[string][]*firewall.Rule{
+		t.stat.Firewalls(),
+		t.stat.FirewallsEgress(),
+	}
+	for _, rulesMap := range rulesMaps {
+		for namespace, rules := range rulesMap {
+			for _, rule := range rules {
+				if rule.Log {
+					namespaces.Add(namespace)
+					break
+				}
+			}
+		}
+	}
+
+	nflog.Update(t.stat.Instances(), namespaces)
+
+	return
+}
+
+func NewNflog(stat *state.State) *Nflog {
+	return &Nflog{
+		stat: stat,
+	}
+}
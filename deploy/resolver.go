@@ -0,0 +1,143 @@
+package deploy
+
+import (
+	"io/ioutil"
+
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/paths"
+	"github.com/pritunl/pritunl-cloud/qemu"
+	"github.com/pritunl/pritunl-cloud/resolver"
+	"github.com/pritunl/pritunl-cloud/settings"
+	"github.com/pritunl/pritunl-cloud/state"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/pritunl/pritunl-cloud/vpc"
+	"github.com/sirupsen/logrus"
+)
+
+type Resolver struct {
+	stat *state.State
+}
+
+func (r *Resolver) Deploy() (err error) {
+	instances := r.stat.Instances()
+
+	vcs := []*vpc.Vpc{}
+	vcsSet := map[primitive.ObjectID]bool{}
+	instVcs := map[primitive.ObjectID][]primitive.ObjectID{}
+
+	for _, inst := range instances {
+		if !inst.IsActive() || inst.Virt == nil {
+			continue
+		}
+
+		vcIds := []primitive.ObjectID{}
+		for _, adapter := range inst.Virt.NetworkAdapters {
+			vc := r.stat.Vpc(adapter.Vpc)
+			if vc == nil || !vc.InternalDns {
+				continue
+			}
+
+			vcIds = append(vcIds, vc.Id)
+			if !vcsSet[vc.Id] {
+				vcsSet[vc.Id] = true
+				vcs = append(vcs, vc)
+			}
+		}
+
+		instVcs[inst.Id] = vcIds
+	}
+
+	changed := resolver.Changed()
+	if !changed {
+		for _, vc := range vcs {
+			exists, e := utils.ExistsFile(paths.GetDnsHostsPath(vc.Id))
+			if e != nil {
+				err = e
+				return
+			}
+
+			if !exists {
+				changed = true
+				break
+			}
+		}
+	}
+
+	if !changed || len(vcs) == 0 {
+		return
+	}
+
+	db := database.GetDatabase()
+	defer db.Close()
+
+	hosts, err := resolver.GetHosts(db, vcs)
+	if err != nil {
+		resolver.SetChanged()
+		return
+	}
+
+	err = utils.ExistsMkdir(settings.Hypervisor.RunPath, 0755)
+	if err != nil {
+		resolver.SetChanged()
+		return
+	}
+
+	updated := map[primitive.ObjectID]bool{}
+	for vcId, data := range hosts {
+		hostsPath := paths.GetDnsHostsPath(vcId)
+
+		curData, _ := ioutil.ReadFile(hostsPath)
+		if curData != nil && string(curData) == data {
+			continue
+		}
+
+		err = utils.CreateWrite(hostsPath, data, 0644)
+		if err != nil {
+			resolver.SetChanged()
+			return
+		}
+
+		updated[vcId] = true
+	}
+
+	for _, vc := range vcs {
+		domainChanged, e := qemu.WriteDnsDomain(
+			vc.Id, resolver.GetDomain(vc))
+		if e != nil {
+			err = e
+			resolver.SetChanged()
+			return
+		}
+
+		if domainChanged {
+			updated[vc.Id] = true
+		}
+	}
+
+	if len(updated) == 0 {
+		return
+	}
+
+	for _, inst := range instances {
+		for _, vcId := range instVcs[inst.Id] {
+			if updated[vcId] {
+				logrus.WithFields(logrus.Fields{
+					"instance": inst.Id.Hex(),
+					"vpc":      vcId.Hex(),
+				}).Info("deploy: Reloading instance dns")
+
+				qemu.ReloadDns(inst.Virt)
+				break
+			}
+		}
+	}
+
+	return
+}
+
+func NewResolver(stat *state.State) *Resolver {
+	return &Resolver{
+		stat: stat,
+	}
+}
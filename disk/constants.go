@@ -7,5 +7,7 @@ const (
 	Backup    = "backup"
 	Expand    = "expand"
 	Restore   = "restore"
+	Export    = "export"
+	Capture   = "capture"
 	Destroy   = "destroy"
 )
@@ -35,6 +35,7 @@ type Disk struct {
 	NewSize          int                `bson:"new_size" json:"new_size"`
 	Backup           bool               `bson:"backup" json:"backup"`
 	LastBackup       time.Time          `bson:"last_backup" json:"last_backup"`
+	BackupPolicy     *BackupPolicy      `bson:"backup_policy" json:"backup_policy"`
 	curIndex         string             `bson:"-" json:"-"`
 	curInstance      primitive.ObjectID `bson:"-" json:"-"`
 }
@@ -79,6 +80,43 @@ func (d *Disk) Validate(db *database.Database) (
 		return
 	}
 
+	if d.BackupPolicy != nil {
+		if d.BackupPolicy.Frequency < 1 {
+			d.BackupPolicy.Frequency = 24
+		}
+
+		if d.BackupPolicy.WindowStart < 0 ||
+			d.BackupPolicy.WindowStart > 23 {
+
+			errData = &errortypes.ErrorData{
+				Error:   "backup_policy_window_invalid",
+				Message: "Backup policy window start hour invalid",
+			}
+			return
+		}
+
+		if d.BackupPolicy.WindowHours < 0 ||
+			d.BackupPolicy.WindowHours > 23 {
+
+			errData = &errortypes.ErrorData{
+				Error:   "backup_policy_window_invalid",
+				Message: "Backup policy window length invalid",
+			}
+			return
+		}
+
+		if d.BackupPolicy.KeepDaily < 0 ||
+			d.BackupPolicy.KeepWeekly < 0 ||
+			d.BackupPolicy.KeepMonthly < 0 {
+
+			errData = &errortypes.ErrorData{
+				Error:   "backup_policy_keep_invalid",
+				Message: "Backup policy retention count invalid",
+			}
+			return
+		}
+	}
+
 	if d.State == Restore && d.RestoreImage.IsZero() {
 		errData = &errortypes.ErrorData{
 			Error:   "restore_missing_image",
@@ -156,6 +194,13 @@ func (d *Disk) Validate(db *database.Database) (
 	return
 }
 
+func (d *Disk) GetBackupPolicy() *BackupPolicy {
+	if d.BackupPolicy != nil {
+		return d.BackupPolicy
+	}
+	return GetDefaultBackupPolicy()
+}
+
 func (d *Disk) PreCommit() {
 	d.curIndex = d.Index
 	d.curInstance = d.Instance
@@ -0,0 +1,115 @@
+package disk
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pritunl/pritunl-cloud/settings"
+)
+
+type BackupPolicy struct {
+	Frequency   int `bson:"frequency" json:"frequency"`
+	WindowStart int `bson:"window_start" json:"window_start"`
+	WindowHours int `bson:"window_hours" json:"window_hours"`
+	KeepDaily   int `bson:"keep_daily" json:"keep_daily"`
+	KeepWeekly  int `bson:"keep_weekly" json:"keep_weekly"`
+	KeepMonthly int `bson:"keep_monthly" json:"keep_monthly"`
+}
+
+func (p *BackupPolicy) Active(now time.Time) bool {
+	if p.WindowHours >= 23 {
+		return true
+	}
+
+	offset := (now.UTC().Hour() - p.WindowStart + 24) % 24
+	return offset <= p.WindowHours
+}
+
+func (p *BackupPolicy) Due(lastBackup time.Time) bool {
+	frequency := p.Frequency
+	if frequency < 1 {
+		frequency = 24
+	}
+
+	return time.Since(lastBackup) >= time.Duration(frequency)*time.Hour
+}
+
+func (p *BackupPolicy) Retention() bool {
+	return p.KeepDaily > 0 || p.KeepWeekly > 0 || p.KeepMonthly > 0
+}
+
+// Expired returns the indexes of the backup timestamps that fall outside
+// of the daily, weekly and monthly retention counts. The most recent backup
+// is always retained.
+func (p *BackupPolicy) Expired(timestamps []time.Time) (expired []int) {
+	expired = []int{}
+
+	if !p.Retention() || len(timestamps) == 0 {
+		return
+	}
+
+	indexes := make([]int, len(timestamps))
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return timestamps[indexes[i]].After(timestamps[indexes[j]])
+	})
+
+	keep := map[int]bool{
+		indexes[0]: true,
+	}
+
+	retain := func(count int, bucket func(time.Time) string) {
+		if count <= 0 {
+			return
+		}
+
+		buckets := map[string]bool{}
+		for _, index := range indexes {
+			key := bucket(timestamps[index].UTC())
+			if buckets[key] {
+				continue
+			}
+
+			if len(buckets) >= count {
+				break
+			}
+
+			buckets[key] = true
+			keep[index] = true
+		}
+	}
+
+	retain(p.KeepDaily, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+	retain(p.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-%d", year, week)
+	})
+	retain(p.KeepMonthly, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+
+	for i := range timestamps {
+		if !keep[i] {
+			expired = append(expired, i)
+		}
+	}
+
+	return
+}
+
+func GetDefaultBackupPolicy() *BackupPolicy {
+	return &BackupPolicy{
+		Frequency:   settings.System.DiskBackupFrequency,
+		WindowStart: settings.System.DiskBackupTime,
+		WindowHours: settings.System.DiskBackupWindow,
+		KeepDaily:   settings.System.DiskBackupKeepDaily,
+		KeepWeekly:  settings.System.DiskBackupKeepWeekly,
+		KeepMonthly: settings.System.DiskBackupKeepMonthly,
+	}
+}
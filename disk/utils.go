@@ -450,6 +450,54 @@ func GetAllKeys(db *database.Database, ndeId primitive.ObjectID) (
 	return
 }
 
+func GetAllBacking(db *database.Database, ndeId primitive.ObjectID) (
+	disks []*Disk, err error) {
+
+	coll := db.Disks()
+	disks = []*Disk{}
+
+	cursor, err := coll.Find(db, &bson.M{
+		"node": ndeId,
+		"backing_image": &bson.M{
+			"$exists": true,
+			"$ne":     "",
+		},
+	}, &options.FindOptions{
+		Projection: &bson.D{
+			{"node", 1},
+			{"state", 1},
+			{"instance", 1},
+			{"backing_image", 1},
+		},
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		dsk := &Disk{}
+		err = cursor.Decode(dsk)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		if dsk.BackingImage != "" {
+			disks = append(disks, dsk)
+		}
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
 func SetDeleteProtection(db *database.Database, instId primitive.ObjectID,
 	protection bool) (err error) {
 
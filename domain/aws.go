@@ -55,15 +55,22 @@ func awsGetSession(domain *Domain) (sess *session.Session, err error) {
 	return
 }
 
-func AwsUpsertDomain(domain *Domain, name, addr, addr6 string) (err error) {
-	sess, err := awsGetSession(domain)
+type dnsRoute53 struct {
+	servc  *route53.Route53
+	zoneId string
+	zones  map[string]string
+}
+
+func (d *dnsRoute53) Connect(domn *Domain) (err error) {
+	sess, err := awsGetSession(domn)
 	if err != nil {
 		return
 	}
 
-	servc := route53.New(sess)
+	d.servc = route53.New(sess)
+	d.zones = map[string]string{}
 
-	zones, err := servc.ListHostedZonesByName(nil)
+	zones, err := d.servc.ListHostedZonesByName(nil)
 	if err != nil {
 		err = &errortypes.RequestError{
 			errors.Wrap(err, "domain: Failed to list Route53 zones"),
@@ -71,29 +78,31 @@ func AwsUpsertDomain(domain *Domain, name, addr, addr6 string) (err error) {
 		return
 	}
 
-	zoneId := ""
-	zoneName := ""
 	for _, zone := range zones.HostedZones {
-		if strings.TrimRight(*zone.Name, ".") != domain.Name {
-			continue
-		}
-
-		zoneId = *zone.Id
-		zoneName = *zone.Name
+		d.zones[strings.TrimRight(*zone.Name, ".")] = *zone.Id
 	}
 
-	if zoneId == "" {
-		err = &errortypes.RequestError{
-			errors.Wrap(err, "domain: Failed to find Route53 zone"),
+	d.zoneId = d.zones[domn.Name]
+	if d.zoneId == "" {
+		err = &errortypes.NotFoundError{
+			errors.New("domain: Failed to find Route53 zone"),
 		}
 		return
 	}
 
-	recordName := name + "." + zoneName
+	return
+}
 
-	records, err := servc.ListResourceRecordSets(
+func (d *dnsRoute53) getRecordSet(zoneId, name, recordType string) (
+	recordSet *route53.ResourceRecordSet, err error) {
+
+	recordName := name + "."
+
+	records, err := d.servc.ListResourceRecordSets(
 		&route53.ListResourceRecordSetsInput{
-			HostedZoneId: &zoneId,
+			HostedZoneId:    &zoneId,
+			StartRecordName: &recordName,
+			StartRecordType: &recordType,
 		},
 	)
 	if err != nil {
@@ -103,145 +112,165 @@ func AwsUpsertDomain(domain *Domain, name, addr, addr6 string) (err error) {
 		return
 	}
 
-	curAddrs := []string{}
-	curAddrs6 := []string{}
 	for _, record := range records.ResourceRecordSets {
-		if (*record.Type != "A" && *record.Type != "AAAA") ||
-			*record.Name != recordName {
-
-			continue
+		if *record.Type == recordType && *record.Name == recordName {
+			recordSet = record
+			return
 		}
+	}
 
-		for _, resource := range record.ResourceRecords {
-			if *record.Type == "A" {
-				curAddrs = append(curAddrs, *resource.Value)
-			} else if *record.Type == "AAAA" {
-				curAddrs6 = append(curAddrs6, *resource.Value)
-			}
+	return
+}
+
+func (d *dnsRoute53) change(zoneId, action string,
+	recordSet *route53.ResourceRecordSet) (err error) {
+
+	_, err = d.servc.ChangeResourceRecordSets(
+		&route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: &zoneId,
+			ChangeBatch: &route53.ChangeBatch{
+				Changes: []*route53.Change{
+					&route53.Change{
+						Action:            &action,
+						ResourceRecordSet: recordSet,
+					},
+				},
+			},
+		},
+	)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "domain: Failed to change Route53 records"),
 		}
+		return
 	}
 
-	changes := []*route53.Change{}
-
-	if len(curAddrs) != 1 || curAddrs[0] != addr {
-		if addr == "" && len(curAddrs) > 0 {
-			action := "DELETE"
-			recordSetType := "A"
-			recordSetTtl := int64(60)
-			records := []*route53.ResourceRecord{}
-
-			for _, a := range curAddrs {
-				records = append(records, &route53.ResourceRecord{
-					Value: &a,
-				})
-			}
-
-			recordSet := &route53.ResourceRecordSet{
-				Name:            &recordName,
-				Type:            &recordSetType,
-				TTL:             &recordSetTtl,
-				ResourceRecords: records,
-			}
-
-			change := &route53.Change{
-				Action:            &action,
-				ResourceRecordSet: recordSet,
-			}
-
-			changes = append(changes, change)
-		} else if addr != "" {
-			action := "UPSERT"
-			recordSetType := "A"
-			recordSetTtl := int64(60)
-			records := []*route53.ResourceRecord{
-				&route53.ResourceRecord{
-					Value: &addr,
-				},
-			}
+	return
+}
 
-			recordSet := &route53.ResourceRecordSet{
-				Name:            &recordName,
-				Type:            &recordSetType,
-				TTL:             &recordSetTtl,
-				ResourceRecords: records,
-			}
+func (d *dnsRoute53) upsert(zoneId, name, recordType string, ttl int,
+	values []string) (err error) {
 
-			change := &route53.Change{
-				Action:            &action,
-				ResourceRecordSet: recordSet,
-			}
+	recordName := name + "."
+	recordTtl := int64(ttl)
+	records := []*route53.ResourceRecord{}
 
-			changes = append(changes, change)
-		}
+	for _, value := range values {
+		val := value
+		records = append(records, &route53.ResourceRecord{
+			Value: &val,
+		})
 	}
 
-	if len(curAddrs6) != 1 || curAddrs6[0] != addr6 {
-		if addr6 == "" && len(curAddrs6) > 0 {
-			action := "DELETE"
-			recordSetType := "AAAA"
-			recordSetTtl := int64(60)
-			records := []*route53.ResourceRecord{}
-
-			for _, a6 := range curAddrs6 {
-				records = append(records, &route53.ResourceRecord{
-					Value: &a6,
-				})
-			}
-
-			recordSet := &route53.ResourceRecordSet{
-				Name:            &recordName,
-				Type:            &recordSetType,
-				TTL:             &recordSetTtl,
-				ResourceRecords: records,
-			}
-
-			change := &route53.Change{
-				Action:            &action,
-				ResourceRecordSet: recordSet,
-			}
-
-			changes = append(changes, change)
-		} else if addr6 != "" {
-			action := "UPSERT"
-			recordSetType := "AAAA"
-			recordSetTtl := int64(60)
-			records := []*route53.ResourceRecord{
-				&route53.ResourceRecord{
-					Value: &addr6,
-				},
-			}
+	err = d.change(zoneId, "UPSERT", &route53.ResourceRecordSet{
+		Name:            &recordName,
+		Type:            &recordType,
+		TTL:             &recordTtl,
+		ResourceRecords: records,
+	})
+	if err != nil {
+		return
+	}
 
-			recordSet := &route53.ResourceRecordSet{
-				Name:            &recordName,
-				Type:            &recordSetType,
-				TTL:             &recordSetTtl,
-				ResourceRecords: records,
-			}
+	return
+}
 
-			change := &route53.Change{
-				Action:            &action,
-				ResourceRecordSet: recordSet,
-			}
+func (d *dnsRoute53) delete(zoneId, name, recordType string) (err error) {
+	recordSet, err := d.getRecordSet(zoneId, name, recordType)
+	if err != nil {
+		return
+	}
 
-			changes = append(changes, change)
-		}
+	if recordSet == nil {
+		return
 	}
 
-	if len(changes) > 0 {
-		_, err = servc.ChangeResourceRecordSets(
-			&route53.ChangeResourceRecordSetsInput{
-				HostedZoneId: &zoneId,
-				ChangeBatch: &route53.ChangeBatch{
-					Changes: changes,
-				},
-			},
-		)
-		if err != nil {
-			err = &errortypes.RequestError{
-				errors.Wrap(err, "domain: Failed to list Route53 records"),
-			}
-			return
-		}
+	err = d.change(zoneId, "DELETE", recordSet)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsRoute53) getReverseZone(addr string) (
+	zoneId, name string, err error) {
+
+	name, err = getReverseName(addr)
+	if err != nil {
+		return
+	}
+
+	zones := []string{}
+	for zone := range d.zones {
+		zones = append(zones, zone)
+	}
+
+	zone := matchZone(name, zones)
+	if zone != "" {
+		zoneId = d.zones[zone]
+	}
+
+	return
+}
+
+func (d *dnsRoute53) UpsertRecords(name, recordType string, ttl int,
+	values []string) (err error) {
+
+	err = d.upsert(d.zoneId, name, recordType, ttl, values)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsRoute53) DeleteRecords(name, recordType string) (err error) {
+	err = d.delete(d.zoneId, name, recordType)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsRoute53) UpsertReverse(addr, target string, ttl int) (
+	err error) {
+
+	zoneId, name, err := d.getReverseZone(addr)
+	if err != nil || zoneId == "" {
+		return
+	}
+
+	err = d.upsert(zoneId, name, "PTR", ttl, []string{target + "."})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsRoute53) DeleteReverse(addr, target string) (err error) {
+	zoneId, name, err := d.getReverseZone(addr)
+	if err != nil || zoneId == "" {
+		return
+	}
+
+	recordSet, err := d.getRecordSet(zoneId, name, "PTR")
+	if err != nil {
+		return
+	}
+
+	if recordSet == nil || len(recordSet.ResourceRecords) != 1 ||
+		!strings.EqualFold(*recordSet.ResourceRecords[0].Value,
+			target+".") {
+
+		return
+	}
+
+	err = d.change(zoneId, "DELETE", recordSet)
+	if err != nil {
+		return
 	}
 
 	return
@@ -0,0 +1,338 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/sirupsen/logrus"
+)
+
+const cloudflareApi = "https://api.cloudflare.com/client/v4"
+
+var (
+	cloudflareClient = &http.Client{
+		Timeout: 20 * time.Second,
+	}
+)
+
+type cloudflareError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type cloudflareResponse struct {
+	Success bool               `json:"success"`
+	Errors  []*cloudflareError `json:"errors"`
+	Result  json.RawMessage    `json:"result"`
+}
+
+type cloudflareZone struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type cloudflareRecord struct {
+	Id       string      `json:"id,omitempty"`
+	Type     string      `json:"type"`
+	Name     string      `json:"name"`
+	Content  string      `json:"content,omitempty"`
+	Priority *int        `json:"priority,omitempty"`
+	Data     interface{} `json:"data,omitempty"`
+	Ttl      int         `json:"ttl"`
+}
+
+type cloudflareSrvData struct {
+	Priority int    `json:"priority"`
+	Weight   int    `json:"weight"`
+	Port     int    `json:"port"`
+	Target   string `json:"target"`
+}
+
+type cloudflareCaaData struct {
+	Flags int    `json:"flags"`
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+// Records with structured data are not compared and always replaced
+func (r *cloudflareRecord) key() string {
+	if r.Data != nil {
+		return ""
+	}
+
+	if r.Priority != nil {
+		return fmt.Sprintf("%d %s", *r.Priority, r.Content)
+	}
+
+	return r.Content
+}
+
+func newCloudflareRecord(name, recordType string, ttl int,
+	value string) (record *cloudflareRecord, err error) {
+
+	record = &cloudflareRecord{
+		Type: recordType,
+		Name: name,
+		Ttl:  ttl,
+	}
+
+	data, err := parseRrData(recordType, value, ".")
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "domain: Failed to parse Cloudflare record"),
+		}
+		return
+	}
+
+	switch recordType {
+	case "CNAME":
+		record.Content = strings.TrimRight(data.Target, ".")
+	case "TXT":
+		record.Content = strings.Join(data.Txt, "")
+	case "MX":
+		priority := data.Priority
+		record.Priority = &priority
+		record.Content = strings.TrimRight(data.Target, ".")
+	case "SRV":
+		record.Data = &cloudflareSrvData{
+			Priority: data.Priority,
+			Weight:   data.Weight,
+			Port:     data.Port,
+			Target:   strings.TrimRight(data.Target, "."),
+		}
+	case "CAA":
+		record.Data = &cloudflareCaaData{
+			Flags: data.Flag,
+			Tag:   data.Tag,
+			Value: data.Value,
+		}
+	default:
+		record.Content = value
+	}
+
+	return
+}
+
+type dnsCloudflare struct {
+	token  string
+	zoneId string
+}
+
+func (d *dnsCloudflare) request(method, path string, query url.Values,
+	input, output interface{}) (err error) {
+
+	reqUrl := cloudflareApi + path
+	if query != nil {
+		reqUrl += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if input != nil {
+		data, e := json.Marshal(input)
+		if e != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(e, "domain: Failed to marshal Cloudflare request"),
+			}
+			return
+		}
+		body = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequest(method, reqUrl, body)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "domain: Cloudflare request failed"),
+		}
+		return
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+d.token)
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := cloudflareClient.Do(req)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "domain: Cloudflare request failed"),
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	respData := &cloudflareResponse{}
+	err = json.NewDecoder(resp.Body).Decode(respData)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrapf(err, "domain: Cloudflare response parse failed %d",
+				resp.StatusCode),
+		}
+		return
+	}
+
+	if resp.StatusCode != 200 || !respData.Success {
+		errMsg := ""
+		for _, e := range respData.Errors {
+			errMsg += fmt.Sprintf("%d: %s ", e.Code, e.Message)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"method":      method,
+			"path":        path,
+			"status_code": resp.StatusCode,
+			"errors":      errMsg,
+		}).Error("domain: Cloudflare request bad status")
+
+		err = &errortypes.RequestError{
+			errors.Newf("domain: Cloudflare request bad status %d",
+				resp.StatusCode),
+		}
+		return
+	}
+
+	if output != nil {
+		err = json.Unmarshal(respData.Result, output)
+		if err != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(err, "domain: Cloudflare result parse failed"),
+			}
+			return
+		}
+	}
+
+	return
+}
+
+func (d *dnsCloudflare) Connect(domn *Domain) (err error) {
+	d.token = domn.CloudflareToken
+
+	zones := []*cloudflareZone{}
+	err = d.request("GET", "/zones", url.Values{
+		"name": []string{domn.Name},
+	}, nil, &zones)
+	if err != nil {
+		return
+	}
+
+	for _, zone := range zones {
+		if zone.Name == domn.Name {
+			d.zoneId = zone.Id
+			break
+		}
+	}
+
+	if d.zoneId == "" {
+		err = &errortypes.NotFoundError{
+			errors.New("domain: Failed to find Cloudflare zone"),
+		}
+		return
+	}
+
+	return
+}
+
+func (d *dnsCloudflare) getRecords(name, recordType string) (
+	records []*cloudflareRecord, err error) {
+
+	records = []*cloudflareRecord{}
+	err = d.request("GET", "/zones/"+d.zoneId+"/dns_records", url.Values{
+		"name":     []string{name},
+		"type":     []string{recordType},
+		"per_page": []string{"100"},
+	}, nil, &records)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsCloudflare) UpsertRecords(name, recordType string, ttl int,
+	values []string) (err error) {
+
+	records, err := d.getRecords(name, recordType)
+	if err != nil {
+		return
+	}
+
+	curValues := map[string]*cloudflareRecord{}
+	for _, record := range records {
+		key := record.key()
+		if key == "" || curValues[key] != nil || record.Ttl != ttl {
+			err = d.request("DELETE", fmt.Sprintf(
+				"/zones/%s/dns_records/%s", d.zoneId, record.Id),
+				nil, nil, nil)
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		curValues[key] = record
+	}
+
+	newValues := map[string]bool{}
+	for _, value := range values {
+		record, e := newCloudflareRecord(name, recordType, ttl, value)
+		if e != nil {
+			err = e
+			return
+		}
+
+		key := record.key()
+		if key != "" {
+			newValues[key] = true
+			if curValues[key] != nil {
+				continue
+			}
+		}
+
+		err = d.request("POST", "/zones/"+d.zoneId+"/dns_records", nil,
+			record, nil)
+		if err != nil {
+			return
+		}
+	}
+
+	for key, record := range curValues {
+		if newValues[key] {
+			continue
+		}
+
+		err = d.request("DELETE", fmt.Sprintf(
+			"/zones/%s/dns_records/%s", d.zoneId, record.Id),
+			nil, nil, nil)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (d *dnsCloudflare) DeleteRecords(name, recordType string) (err error) {
+	records, err := d.getRecords(name, recordType)
+	if err != nil {
+		return
+	}
+
+	for _, record := range records {
+		err = d.request("DELETE", fmt.Sprintf(
+			"/zones/%s/dns_records/%s", d.zoneId, record.Id),
+			nil, nil, nil)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -1,5 +1,39 @@
 package domain
 
+import (
+	"github.com/dropbox/godropbox/container/set"
+)
+
 const (
-	Route53 = "route_53"
+	Route53    = "route_53"
+	Cloudflare = "cloudflare"
+	Rfc2136    = "rfc2136"
+	PowerDns   = "powerdns"
+
+	HmacMd5    = "hmac-md5"
+	HmacSha1   = "hmac-sha1"
+	HmacSha256 = "hmac-sha256"
+	HmacSha512 = "hmac-sha512"
+
+	DefaultTtl       = 60
+	DefaultRecordTtl = 300
+	MaxRecordTtl     = 604800
+)
+
+var (
+	RecordTypes = set.NewSet(
+		"A",
+		"AAAA",
+		"CNAME",
+		"TXT",
+		"MX",
+		"SRV",
+		"CAA",
+	)
+	Rfc2136Algorithms = set.NewSet(
+		HmacMd5,
+		HmacSha1,
+		HmacSha256,
+		HmacSha512,
+	)
 )
@@ -1,6 +1,10 @@
 package domain
 
 import (
+	"encoding/base64"
+	"net"
+	"strings"
+
 	"github.com/dropbox/godropbox/container/set"
 	"github.com/dropbox/godropbox/errors"
 	"github.com/pritunl/mongo-go-driver/bson/primitive"
@@ -9,13 +13,37 @@ import (
 )
 
 type Domain struct {
-	Id           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name         string             `bson:"name" json:"name"`
-	Comment      string             `bson:"comment" json:"comment"`
-	Organization primitive.ObjectID `bson:"organization,omitempty" json:"organization"`
-	Type         string             `bson:"type" json:"type"`
-	AwsId        string             `bson:"aws_id" json:"aws_id"`
-	AwsSecret    string             `bson:"aws_secret" json:"aws_secret"`
+	Id               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name             string             `bson:"name" json:"name"`
+	Comment          string             `bson:"comment" json:"comment"`
+	Organization     primitive.ObjectID `bson:"organization,omitempty" json:"organization"`
+	Type             string             `bson:"type" json:"type"`
+	AwsId            string             `bson:"aws_id" json:"aws_id"`
+	AwsSecret        string             `bson:"aws_secret" json:"aws_secret"`
+	CloudflareToken  string             `bson:"cloudflare_token" json:"cloudflare_token"`
+	Rfc2136Server    string             `bson:"rfc2136_server" json:"rfc2136_server"`
+	Rfc2136KeyName   string             `bson:"rfc2136_key_name" json:"rfc2136_key_name"`
+	Rfc2136Algorithm string             `bson:"rfc2136_algorithm" json:"rfc2136_algorithm"`
+	Rfc2136Secret    string             `bson:"rfc2136_secret" json:"rfc2136_secret"`
+	PowerDnsUrl      string             `bson:"powerdns_url" json:"powerdns_url"`
+	PowerDnsServer   string             `bson:"powerdns_server" json:"powerdns_server"`
+	PowerDnsApiKey   string             `bson:"powerdns_api_key" json:"powerdns_api_key"`
+	Records          []*RecordSet       `bson:"records" json:"records"`
+	AppliedRecords   []*RecordSet       `bson:"applied_records" json:"-"`
+	curDomain        *Domain
+}
+
+// Returns the fully qualified name of a record in the domain without the
+// trailing dot, an empty name refers to the domain apex
+func (d *Domain) GetFqdn(name string) string {
+	domainName := strings.Trim(d.Name, ".")
+	name = strings.Trim(name, ".")
+
+	if name == "" || name == "@" {
+		return domainName
+	}
+
+	return name + "." + domainName
 }
 
 func (d *Domain) Validate(db *database.Database) (
@@ -29,10 +57,134 @@ func (d *Domain) Validate(db *database.Database) (
 		return
 	}
 
-	if d.Type != Route53 {
+	d.Name = strings.Trim(strings.ToLower(strings.TrimSpace(d.Name)), ".")
+	if d.Name == "" {
+		errData = &errortypes.ErrorData{
+			Error:   "domain_name_invalid",
+			Message: "Domain name invalid",
+		}
+		return
+	}
+
+	if d.Type == "" {
 		d.Type = Route53
 	}
 
+	switch d.Type {
+	case Route53:
+		break
+	case Cloudflare:
+		if d.CloudflareToken == "" {
+			errData = &errortypes.ErrorData{
+				Error:   "cloudflare_token_required",
+				Message: "Missing required Cloudflare API token",
+			}
+			return
+		}
+	case Rfc2136:
+		if d.Rfc2136Server == "" {
+			errData = &errortypes.ErrorData{
+				Error:   "rfc2136_server_required",
+				Message: "Missing required RFC2136 server",
+			}
+			return
+		}
+
+		if _, _, e := net.SplitHostPort(d.Rfc2136Server); e != nil {
+			d.Rfc2136Server = net.JoinHostPort(
+				strings.Trim(d.Rfc2136Server, "[]"), "53")
+		}
+
+		if d.Rfc2136KeyName != "" || d.Rfc2136Secret != "" {
+			if d.Rfc2136KeyName == "" || d.Rfc2136Secret == "" {
+				errData = &errortypes.ErrorData{
+					Error:   "rfc2136_key_invalid",
+					Message: "RFC2136 TSIG key name and secret required",
+				}
+				return
+			}
+
+			if d.Rfc2136Algorithm == "" {
+				d.Rfc2136Algorithm = HmacSha256
+			}
+
+			if !Rfc2136Algorithms.Contains(d.Rfc2136Algorithm) {
+				errData = &errortypes.ErrorData{
+					Error:   "rfc2136_algorithm_invalid",
+					Message: "RFC2136 TSIG algorithm invalid",
+				}
+				return
+			}
+
+			_, e := base64.StdEncoding.DecodeString(d.Rfc2136Secret)
+			if e != nil {
+				errData = &errortypes.ErrorData{
+					Error:   "rfc2136_secret_invalid",
+					Message: "RFC2136 TSIG secret must be base64 encoded",
+				}
+				return
+			}
+		} else {
+			d.Rfc2136Algorithm = ""
+		}
+	case PowerDns:
+		if d.PowerDnsUrl == "" || d.PowerDnsApiKey == "" {
+			errData = &errortypes.ErrorData{
+				Error:   "powerdns_api_required",
+				Message: "Missing required PowerDNS API URL and key",
+			}
+			return
+		}
+
+		d.PowerDnsUrl = strings.TrimRight(d.PowerDnsUrl, "/")
+		if d.PowerDnsServer == "" {
+			d.PowerDnsServer = "localhost"
+		}
+	default:
+		errData = &errortypes.ErrorData{
+			Error:   "domain_type_invalid",
+			Message: "Domain type invalid",
+		}
+		return
+	}
+
+	errData, err = d.validateRecords(db)
+	if err != nil || errData != nil {
+		return
+	}
+
+	return
+}
+
+func (d *Domain) PreCommit() {
+	curDomain := *d
+	d.curDomain = &curDomain
+}
+
+// Removes the applied records from the previous zone when the domain name
+// or provider changes, the records are recreated by the next record sync
+func (d *Domain) PostCommit(db *database.Database) (err error) {
+	curDomain := d.curDomain
+	if curDomain == nil {
+		return
+	}
+
+	if curDomain.Name == d.Name && curDomain.Type == d.Type &&
+		curDomain.AwsId == d.AwsId &&
+		curDomain.Rfc2136Server == d.Rfc2136Server &&
+		curDomain.PowerDnsUrl == d.PowerDnsUrl &&
+		curDomain.PowerDnsServer == d.PowerDnsServer {
+
+		return
+	}
+
+	err = curDomain.ClearRecords(db)
+	if err != nil {
+		return
+	}
+
+	d.AppliedRecords = curDomain.AppliedRecords
+
 	return
 }
 
@@ -0,0 +1,310 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	powerDnsClient = &http.Client{
+		Timeout: 20 * time.Second,
+	}
+)
+
+type powerDnsRecord struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type powerDnsRrset struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Ttl        int               `json:"ttl,omitempty"`
+	ChangeType string            `json:"changetype"`
+	Records    []*powerDnsRecord `json:"records"`
+}
+
+type powerDnsPatch struct {
+	Rrsets []*powerDnsRrset `json:"rrsets"`
+}
+
+type powerDnsZone struct {
+	Id     string           `json:"id"`
+	Name   string           `json:"name"`
+	Rrsets []*powerDnsRrset `json:"rrsets"`
+}
+
+type dnsPowerDns struct {
+	serverUrl string
+	zoneId    string
+	apiKey    string
+	zones     []*powerDnsZone
+}
+
+func (d *dnsPowerDns) Connect(domn *Domain) (err error) {
+	d.apiKey = domn.PowerDnsApiKey
+	d.zoneId = strings.Replace(domn.Name+".", "/", "=2F", -1)
+	d.serverUrl = strings.TrimRight(domn.PowerDnsUrl, "/") +
+		"/api/v1/servers/" + url.PathEscape(domn.PowerDnsServer)
+
+	return
+}
+
+func (d *dnsPowerDns) request(method, pth string, input,
+	output interface{}) (err error) {
+
+	var body io.Reader
+	if input != nil {
+		data, e := json.Marshal(input)
+		if e != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(e, "domain: Failed to marshal PowerDNS request"),
+			}
+			return
+		}
+		body = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequest(
+		method,
+		d.serverUrl+pth,
+		body,
+	)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "domain: PowerDNS request failed"),
+		}
+		return
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-API-Key", d.apiKey)
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := powerDnsClient.Do(req)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "domain: PowerDNS request failed"),
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 204 {
+		body := ""
+		data, _ := ioutil.ReadAll(resp.Body)
+		if data != nil {
+			body = string(data)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"method":      method,
+			"path":        pth,
+			"status_code": resp.StatusCode,
+			"body":        body,
+		}).Error("domain: PowerDNS request bad status")
+
+		err = &errortypes.RequestError{
+			errors.Newf("domain: PowerDNS request bad status %d",
+				resp.StatusCode),
+		}
+		return
+	}
+
+	if output != nil {
+		err = json.NewDecoder(resp.Body).Decode(output)
+		if err != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(err, "domain: PowerDNS response parse failed"),
+			}
+			return
+		}
+	}
+
+	return
+}
+
+func (d *dnsPowerDns) patch(zoneId string, rrset *powerDnsRrset) (
+	err error) {
+
+	err = d.request("PATCH", "/zones/"+url.PathEscape(zoneId),
+		&powerDnsPatch{
+			Rrsets: []*powerDnsRrset{rrset},
+		}, nil)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsPowerDns) getRrset(zoneId, name, recordType string) (
+	rrset *powerDnsRrset, err error) {
+
+	zone := &powerDnsZone{}
+	err = d.request("GET", "/zones/"+url.PathEscape(zoneId)+
+		"?rrset_name="+url.QueryEscape(name+".")+
+		"&rrset_type="+url.QueryEscape(recordType), nil, zone)
+	if err != nil {
+		return
+	}
+
+	for _, zoneRrset := range zone.Rrsets {
+		if strings.EqualFold(zoneRrset.Name, name+".") &&
+			zoneRrset.Type == recordType {
+
+			rrset = zoneRrset
+			return
+		}
+	}
+
+	return
+}
+
+func (d *dnsPowerDns) getReverseZone(addr string) (
+	zoneId, name string, err error) {
+
+	name, err = getReverseName(addr)
+	if err != nil {
+		return
+	}
+
+	if d.zones == nil {
+		zones := []*powerDnsZone{}
+		err = d.request("GET", "/zones", nil, &zones)
+		if err != nil {
+			return
+		}
+		d.zones = zones
+	}
+
+	zoneNames := []string{}
+	for _, zone := range d.zones {
+		zoneNames = append(zoneNames, strings.TrimRight(zone.Name, "."))
+	}
+
+	zoneName := matchZone(name, zoneNames)
+	if zoneName == "" {
+		return
+	}
+
+	for _, zone := range d.zones {
+		if strings.TrimRight(zone.Name, ".") == zoneName {
+			zoneId = zone.Id
+			break
+		}
+	}
+
+	return
+}
+
+func (d *dnsPowerDns) replace(zoneId, name, recordType string, ttl int,
+	values []string) (err error) {
+
+	records := []*powerDnsRecord{}
+	for _, value := range values {
+		records = append(records, &powerDnsRecord{
+			Content: value,
+		})
+	}
+
+	err = d.patch(zoneId, &powerDnsRrset{
+		Name:       name + ".",
+		Type:       recordType,
+		Ttl:        ttl,
+		ChangeType: "REPLACE",
+		Records:    records,
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsPowerDns) delete(zoneId, name, recordType string) (err error) {
+	err = d.patch(zoneId, &powerDnsRrset{
+		Name:       name + ".",
+		Type:       recordType,
+		ChangeType: "DELETE",
+		Records:    []*powerDnsRecord{},
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsPowerDns) UpsertRecords(name, recordType string, ttl int,
+	values []string) (err error) {
+
+	err = d.replace(d.zoneId, name, recordType, ttl, values)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsPowerDns) DeleteRecords(name, recordType string) (err error) {
+	err = d.delete(d.zoneId, name, recordType)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsPowerDns) UpsertReverse(addr, target string, ttl int) (
+	err error) {
+
+	zoneId, name, err := d.getReverseZone(addr)
+	if err != nil || zoneId == "" {
+		return
+	}
+
+	err = d.replace(zoneId, name, "PTR", ttl, []string{target + "."})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsPowerDns) DeleteReverse(addr, target string) (err error) {
+	zoneId, name, err := d.getReverseZone(addr)
+	if err != nil || zoneId == "" {
+		return
+	}
+
+	rrset, err := d.getRrset(zoneId, name, "PTR")
+	if err != nil {
+		return
+	}
+
+	if rrset == nil || len(rrset.Records) != 1 ||
+		!strings.EqualFold(rrset.Records[0].Content, target+".") {
+
+		return
+	}
+
+	err = d.delete(zoneId, name, "PTR")
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -0,0 +1,135 @@
+package domain
+
+import (
+	"net"
+	"strings"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+)
+
+// DNS provider for a domain, record names are fully qualified without the
+// trailing dot. Upserts replace all values of the record type.
+type dnsProvider interface {
+	Connect(domn *Domain) (err error)
+	UpsertRecords(name, recordType string, ttl int,
+		values []string) (err error)
+	DeleteRecords(name, recordType string) (err error)
+}
+
+// Providers that can also manage PTR records, reverse records are skipped
+// when the provider does not host the reverse zone of the address. Deletes
+// only remove the record if it still points to the target.
+type dnsReverseProvider interface {
+	UpsertReverse(addr, target string, ttl int) (err error)
+	DeleteReverse(addr, target string) (err error)
+}
+
+func getProvider(domn *Domain) (prov dnsProvider, err error) {
+	switch domn.Type {
+	case Route53:
+		prov = &dnsRoute53{}
+	case Cloudflare:
+		prov = &dnsCloudflare{}
+	case Rfc2136:
+		prov = &dnsRfc2136{}
+	case PowerDns:
+		prov = &dnsPowerDns{}
+	default:
+		err = &errortypes.UnknownError{
+			errors.New("domain: Unknown domain type"),
+		}
+		return
+	}
+
+	err = prov.Connect(domn)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func upsertAddr(prov dnsProvider, name, recordType, addr string) (
+	err error) {
+
+	if addr == "" {
+		err = prov.DeleteRecords(name, recordType)
+	} else {
+		err = prov.UpsertRecords(name, recordType, DefaultTtl,
+			[]string{addr})
+	}
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Updates the reverse record of an address if supported by the provider,
+// the reverse record of the previous address is removed
+func upsertReverse(prov dnsProvider, name, curAddr, addr string,
+	ttl int) (err error) {
+
+	revProv, ok := prov.(dnsReverseProvider)
+	if !ok {
+		return
+	}
+
+	if curAddr != "" && curAddr != addr {
+		err = revProv.DeleteReverse(curAddr, name)
+		if err != nil {
+			return
+		}
+	}
+
+	if addr != "" {
+		err = revProv.UpsertReverse(addr, name, ttl)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func deleteReverse(prov dnsProvider, addr, target string) (err error) {
+	revProv, ok := prov.(dnsReverseProvider)
+	if !ok || addr == "" {
+		return
+	}
+
+	err = revProv.DeleteReverse(addr, target)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func getReverseName(addr string) (name string, err error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		err = &errortypes.ParseError{
+			errors.New("domain: Failed to parse reverse address"),
+		}
+		return
+	}
+
+	name = getReverseAddr(ip)
+
+	return
+}
+
+// Returns the longest zone containing the name
+func matchZone(name string, zones []string) (zone string) {
+	for _, zne := range zones {
+		if (name == zne || strings.HasSuffix(name, "."+zne)) &&
+			len(zne) > len(zone) {
+
+			zone = zne
+		}
+	}
+
+	return
+}
@@ -0,0 +1,412 @@
+package domain
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+)
+
+var (
+	rrTypes = map[string]uint16{
+		"A":     1,
+		"NS":    2,
+		"CNAME": 5,
+		"SOA":   6,
+		"PTR":   12,
+		"MX":    15,
+		"TXT":   16,
+		"AAAA":  28,
+		"SRV":   33,
+		"CAA":   257,
+	}
+)
+
+// Record data of a single record value, names are fully qualified with
+// the trailing dot
+type rrData struct {
+	Type     string
+	Addr     net.IP
+	Target   string
+	Priority int
+	Weight   int
+	Port     int
+	Txt      []string
+	Flag     int
+	Tag      string
+	Value    string
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func isDomainName(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func getReverseAddr(ip net.IP) (name string) {
+	ip4 := ip.To4()
+	if ip4 != nil {
+		name = fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa",
+			ip4[3], ip4[2], ip4[1], ip4[0])
+		return
+	}
+
+	ip6 := ip.To16()
+	labels := []string{}
+	for i := len(ip6) - 1; i >= 0; i-- {
+		labels = append(labels, fmt.Sprintf("%x.%x",
+			ip6[i]&0xf, ip6[i]>>4))
+	}
+	name = strings.Join(labels, ".") + ".ip6.arpa"
+
+	return
+}
+
+// Splits a presentation format value into fields, quoted fields keep
+// whitespace and escapes are decoded
+func splitRrFields(value string) (fields []string, err error) {
+	fields = []string{}
+	field := []byte{}
+	inField := false
+	quoted := false
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+
+		switch {
+		case c == '\\':
+			if i+3 < len(value) && isDigits(value[i+1:i+4]) {
+				n, _ := strconv.Atoi(value[i+1 : i+4])
+				if n > 255 {
+					err = &errortypes.ParseError{
+						errors.New("domain: Invalid record value escape"),
+					}
+					return
+				}
+				field = append(field, byte(n))
+				i += 3
+			} else if i+1 < len(value) {
+				field = append(field, value[i+1])
+				i += 1
+			} else {
+				err = &errortypes.ParseError{
+					errors.New("domain: Invalid record value escape"),
+				}
+				return
+			}
+			inField = true
+		case c == '"':
+			if quoted {
+				fields = append(fields, string(field))
+				field = []byte{}
+				inField = false
+				quoted = false
+			} else if !inField {
+				quoted = true
+				inField = true
+			} else {
+				err = &errortypes.ParseError{
+					errors.New("domain: Invalid record value quote"),
+				}
+				return
+			}
+		case (c == ' ' || c == '\t') && !quoted:
+			if inField {
+				fields = append(fields, string(field))
+				field = []byte{}
+				inField = false
+			}
+		default:
+			field = append(field, c)
+			inField = true
+		}
+	}
+
+	if quoted {
+		err = &errortypes.ParseError{
+			errors.New("domain: Unterminated record value quote"),
+		}
+		return
+	}
+
+	if inField {
+		fields = append(fields, string(field))
+	}
+
+	return
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+func quoteRrString(s string) string {
+	quoted := []byte{'"'}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case c == '"' || c == '\\':
+			quoted = append(quoted, '\\', c)
+		case c < ' ' || c > '~':
+			quoted = append(quoted, fmt.Sprintf("\\%03d", c)...)
+		default:
+			quoted = append(quoted, c)
+		}
+	}
+
+	return string(append(quoted, '"'))
+}
+
+func parseRrName(name, origin string) (fqdnName string, err error) {
+	if name == "@" {
+		fqdnName = fqdn(origin)
+	} else if strings.HasSuffix(name, ".") {
+		fqdnName = name
+	} else if origin == "" || origin == "." {
+		fqdnName = fqdn(name)
+	} else {
+		fqdnName = name + "." + fqdn(origin)
+	}
+
+	if fqdnName != "." && !isDomainName(fqdnName) {
+		err = &errortypes.ParseError{
+			errors.Newf("domain: Invalid record name %s", name),
+		}
+		return
+	}
+
+	return
+}
+
+func parseRrUint(value string, max int) (n int, err error) {
+	n, err = strconv.Atoi(value)
+	if err != nil || n < 0 || n > max {
+		err = &errortypes.ParseError{
+			errors.Newf("domain: Invalid record number %s", value),
+		}
+		return
+	}
+
+	return
+}
+
+// Parses a presentation format record value, relative names are
+// qualified with the origin
+func parseRrData(recordType, value, origin string) (
+	data *rrData, err error) {
+
+	fields, err := splitRrFields(strings.TrimSpace(value))
+	if err != nil {
+		return
+	}
+
+	data = &rrData{
+		Type: recordType,
+	}
+
+	count := 0
+	switch recordType {
+	case "A", "AAAA", "CNAME", "PTR":
+		count = 1
+	case "MX":
+		count = 2
+	case "CAA":
+		count = 3
+	case "SRV":
+		count = 4
+	case "TXT":
+		if len(fields) == 0 {
+			err = &errortypes.ParseError{
+				errors.New("domain: Empty record value"),
+			}
+			return
+		}
+		for _, field := range fields {
+			if len(field) > 255 {
+				err = &errortypes.ParseError{
+					errors.New("domain: Record text string too long"),
+				}
+				return
+			}
+		}
+		data.Txt = fields
+		return
+	default:
+		err = &errortypes.ParseError{
+			errors.Newf("domain: Unknown record type %s", recordType),
+		}
+		return
+	}
+
+	if len(fields) != count {
+		err = &errortypes.ParseError{
+			errors.Newf("domain: Invalid %s record value", recordType),
+		}
+		return
+	}
+
+	switch recordType {
+	case "A", "AAAA":
+		data.Addr = net.ParseIP(fields[0])
+		if data.Addr == nil || (data.Addr.To4() != nil) !=
+			(recordType == "A") {
+
+			err = &errortypes.ParseError{
+				errors.Newf("domain: Invalid %s record address",
+					recordType),
+			}
+			return
+		}
+	case "CNAME", "PTR":
+		data.Target, err = parseRrName(fields[0], origin)
+		if err != nil {
+			return
+		}
+	case "MX":
+		data.Priority, err = parseRrUint(fields[0], 65535)
+		if err != nil {
+			return
+		}
+		data.Target, err = parseRrName(fields[1], origin)
+		if err != nil {
+			return
+		}
+	case "SRV":
+		data.Priority, err = parseRrUint(fields[0], 65535)
+		if err != nil {
+			return
+		}
+		data.Weight, err = parseRrUint(fields[1], 65535)
+		if err != nil {
+			return
+		}
+		data.Port, err = parseRrUint(fields[2], 65535)
+		if err != nil {
+			return
+		}
+		data.Target, err = parseRrName(fields[3], origin)
+		if err != nil {
+			return
+		}
+	case "CAA":
+		data.Flag, err = parseRrUint(fields[0], 255)
+		if err != nil {
+			return
+		}
+		data.Tag = fields[1]
+		if data.Tag == "" || len(data.Tag) > 255 || strings.Trim(
+			strings.ToLower(data.Tag),
+			"abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+
+			err = &errortypes.ParseError{
+				errors.New("domain: Invalid CAA record tag"),
+			}
+			return
+		}
+		data.Value = fields[2]
+	}
+
+	return
+}
+
+// Returns the record value in the presentation format
+func (d *rrData) String() string {
+	switch d.Type {
+	case "A", "AAAA":
+		return d.Addr.String()
+	case "CNAME", "PTR":
+		return d.Target
+	case "MX":
+		return fmt.Sprintf("%d %s", d.Priority, d.Target)
+	case "SRV":
+		return fmt.Sprintf("%d %d %d %s", d.Priority, d.Weight, d.Port,
+			d.Target)
+	case "TXT":
+		values := []string{}
+		for _, txt := range d.Txt {
+			values = append(values, quoteRrString(txt))
+		}
+		return strings.Join(values, " ")
+	case "CAA":
+		return fmt.Sprintf("%d %s %s", d.Flag, d.Tag,
+			quoteRrString(d.Value))
+	}
+
+	return ""
+}
+
+func packName(buf []byte, name string) []byte {
+	name = strings.TrimSuffix(fqdn(name), ".")
+
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			buf = append(buf, byte(len(label)))
+			buf = append(buf, label...)
+		}
+	}
+
+	return append(buf, 0)
+}
+
+func packUint16(buf []byte, n int) []byte {
+	return append(buf, byte(n>>8), byte(n))
+}
+
+// Returns the record data in the wire format
+func (d *rrData) Pack() (buf []byte) {
+	buf = []byte{}
+
+	switch d.Type {
+	case "A":
+		buf = append(buf, d.Addr.To4()...)
+	case "AAAA":
+		buf = append(buf, d.Addr.To16()...)
+	case "CNAME", "PTR":
+		buf = packName(buf, d.Target)
+	case "MX":
+		buf = packUint16(buf, d.Priority)
+		buf = packName(buf, d.Target)
+	case "SRV":
+		buf = packUint16(buf, d.Priority)
+		buf = packUint16(buf, d.Weight)
+		buf = packUint16(buf, d.Port)
+		buf = packName(buf, d.Target)
+	case "TXT":
+		for _, txt := range d.Txt {
+			buf = append(buf, byte(len(txt)))
+			buf = append(buf, txt...)
+		}
+	case "CAA":
+		buf = append(buf, byte(d.Flag), byte(len(d.Tag)))
+		buf = append(buf, d.Tag...)
+		buf = append(buf, d.Value...)
+	}
+
+	return
+}
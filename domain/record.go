@@ -8,6 +8,7 @@ import (
 	"github.com/pritunl/mongo-go-driver/bson/primitive"
 	"github.com/pritunl/pritunl-cloud/database"
 	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/sirupsen/logrus"
 )
 
 type Record struct {
@@ -28,15 +29,65 @@ func (r *Record) Remove(db *database.Database) (err error) {
 		return
 	}
 
-	if domn.Type == Route53 {
-		err = AwsUpsertDomain(domn, r.Name, "", "")
-		if err != nil {
-			return
-		}
-	} else {
-		err = &errortypes.UnknownError{
-			errors.New("domain: Unknown domain type"),
-		}
+	if domn.hasManagedRecord(r.Name) {
+		return
+	}
+
+	prov, err := getProvider(domn)
+	if err != nil {
+		return
+	}
+
+	name := domn.GetFqdn(r.Name)
+
+	err = prov.DeleteRecords(name, "A")
+	if err != nil {
+		return
+	}
+
+	err = prov.DeleteRecords(name, "AAAA")
+	if err != nil {
+		return
+	}
+
+	err = deleteReverse(prov, r.Address, name)
+	if err != nil {
+		return
+	}
+
+	err = deleteReverse(prov, r.Address6, name)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (r *Record) publish(domn *Domain, addr, addr6 string) (err error) {
+	prov, err := getProvider(domn)
+	if err != nil {
+		return
+	}
+
+	name := domn.GetFqdn(r.Name)
+
+	err = upsertAddr(prov, name, "A", addr)
+	if err != nil {
+		return
+	}
+
+	err = upsertAddr(prov, name, "AAAA", addr6)
+	if err != nil {
+		return
+	}
+
+	err = upsertReverse(prov, name, r.Address, addr, DefaultTtl)
+	if err != nil {
+		return
+	}
+
+	err = upsertReverse(prov, name, r.Address6, addr6, DefaultTtl)
+	if err != nil {
 		return
 	}
 
@@ -60,16 +111,16 @@ func (r *Record) Upsert(db *database.Database, addr, addr6 string) (
 		}
 	}
 
-	if domn.Type == Route53 {
-		err = AwsUpsertDomain(domn, r.Name, addr, addr6)
+	if domn.hasManagedRecord(r.Name) {
+		logrus.WithFields(logrus.Fields{
+			"domain": domn.Name,
+			"name":   r.Name,
+		}).Warn("domain: Instance record replaced by domain record")
+	} else {
+		err = r.publish(domn, addr, addr6)
 		if err != nil {
 			return
 		}
-	} else {
-		err = &errortypes.UnknownError{
-			errors.New("domain: Unknown domain type"),
-		}
-		return
 	}
 
 	r.Address = addr
@@ -0,0 +1,477 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/sirupsen/logrus"
+)
+
+// Record set managed by users, values are stored in the zone file
+// presentation format
+type RecordSet struct {
+	Name   string   `bson:"name" json:"name"`
+	Type   string   `bson:"type" json:"type"`
+	Ttl    int      `bson:"ttl" json:"ttl"`
+	Values []string `bson:"values" json:"values"`
+}
+
+func (r *RecordSet) Key() string {
+	return r.Type + ":" + r.Name
+}
+
+func (r *RecordSet) Equal(recordSet *RecordSet) bool {
+	if r.Name != recordSet.Name || r.Type != recordSet.Type ||
+		r.Ttl != recordSet.Ttl || len(r.Values) != len(recordSet.Values) {
+
+		return false
+	}
+
+	for i, value := range r.Values {
+		if value != recordSet.Values[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *RecordSet) normalize(domn *Domain, value string) (
+	val string, err error) {
+
+	value = strings.TrimSpace(value)
+
+	if r.Type == "TXT" && !strings.HasPrefix(value, "\"") {
+		value = "\"" + strings.Replace(strings.Replace(
+			value, "\\", "\\\\", -1), "\"", "\\\"", -1) + "\""
+	}
+
+	data, err := parseRrData(r.Type, value, domn.Name)
+	if err != nil {
+		return
+	}
+
+	val = data.String()
+
+	return
+}
+
+func (r *RecordSet) Validate(domn *Domain) (
+	errData *errortypes.ErrorData, err error) {
+
+	r.Type = strings.ToUpper(strings.TrimSpace(r.Type))
+	if !RecordTypes.Contains(r.Type) {
+		errData = &errortypes.ErrorData{
+			Error:   "domain_record_type_invalid",
+			Message: "Domain record type invalid",
+		}
+		return
+	}
+
+	r.Name = strings.Trim(strings.ToLower(strings.TrimSpace(r.Name)), ".")
+	if r.Name == "@" {
+		r.Name = ""
+	}
+
+	if !isDomainName(domn.GetFqdn(r.Name)) {
+		errData = &errortypes.ErrorData{
+			Error:   "domain_record_name_invalid",
+			Message: "Domain record name invalid",
+		}
+		return
+	}
+
+	if r.Ttl == 0 {
+		r.Ttl = DefaultRecordTtl
+	}
+
+	if r.Ttl < 0 || r.Ttl > MaxRecordTtl {
+		errData = &errortypes.ErrorData{
+			Error:   "domain_record_ttl_invalid",
+			Message: "Domain record TTL invalid",
+		}
+		return
+	}
+
+	if len(r.Values) == 0 {
+		errData = &errortypes.ErrorData{
+			Error:   "domain_record_values_required",
+			Message: "Domain record missing required values",
+		}
+		return
+	}
+
+	if r.Type == "CNAME" && (len(r.Values) != 1 || r.Name == "") {
+		errData = &errortypes.ErrorData{
+			Error:   "domain_record_cname_invalid",
+			Message: "Domain CNAME record must have one non apex value",
+		}
+		return
+	}
+
+	values := []string{}
+	valuesSet := set.NewSet()
+	for _, value := range r.Values {
+		val, e := r.normalize(domn, value)
+		if e != nil {
+			errData = &errortypes.ErrorData{
+				Error:   "domain_record_value_invalid",
+				Message: "Domain record value invalid",
+			}
+			return
+		}
+
+		if valuesSet.Contains(val) {
+			continue
+		}
+		valuesSet.Add(val)
+
+		values = append(values, val)
+	}
+	r.Values = values
+
+	return
+}
+
+func isAddrRecord(recordSet *RecordSet) bool {
+	return recordSet.Type == "A" || recordSet.Type == "AAAA" ||
+		recordSet.Type == "CNAME"
+}
+
+// Applied managed address records take precedence over instance records
+// with the same name, instance records are not published to the provider
+func (d *Domain) hasManagedRecord(name string) bool {
+	name = strings.Trim(strings.ToLower(name), ".")
+
+	for _, recordSet := range d.AppliedRecords {
+		if recordSet.Name == name && isAddrRecord(recordSet) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Clears the published addresses of the instance records with the names
+// to publish the instance records again on the next deploy
+func (d *Domain) resetInstanceRecords(db *database.Database,
+	names set.Set) (err error) {
+
+	if names.Len() == 0 {
+		return
+	}
+
+	recrds, err := GetRecordAll(db, &bson.M{
+		"domain": d.Id,
+	})
+	if err != nil {
+		return
+	}
+
+	for _, recrd := range recrds {
+		if !names.Contains(strings.ToLower(recrd.Name)) {
+			continue
+		}
+
+		recrd.Address = ""
+		recrd.Address6 = ""
+
+		err = recrd.CommitFields(db, set.NewSet("address", "address6"))
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (d *Domain) validateRecords(db *database.Database) (
+	errData *errortypes.ErrorData, err error) {
+
+	if d.Records == nil {
+		d.Records = []*RecordSet{}
+	}
+
+	appliedKeys := set.NewSet()
+	for _, recordSet := range d.AppliedRecords {
+		appliedKeys.Add(recordSet.Key())
+	}
+
+	keys := set.NewSet()
+	cnames := set.NewSet()
+	names := set.NewSet()
+	instNames := set.NewSet()
+
+	if !d.Id.IsZero() && len(d.Records) > 0 {
+		recrds, e := GetRecordAll(db, &bson.M{
+			"domain": d.Id,
+		})
+		if e != nil {
+			err = e
+			return
+		}
+
+		for _, recrd := range recrds {
+			instNames.Add(strings.ToLower(recrd.Name))
+		}
+	}
+
+	for _, recordSet := range d.Records {
+		errData, err = recordSet.Validate(d)
+		if err != nil || errData != nil {
+			return
+		}
+
+		if keys.Contains(recordSet.Key()) {
+			errData = &errortypes.ErrorData{
+				Error:   "domain_record_duplicate",
+				Message: "Duplicate domain record name and type",
+			}
+			return
+		}
+		keys.Add(recordSet.Key())
+
+		if cnames.Contains(recordSet.Name) ||
+			(recordSet.Type == "CNAME" && names.Contains(recordSet.Name)) {
+
+			errData = &errortypes.ErrorData{
+				Error:   "domain_record_cname_conflict",
+				Message: "Domain CNAME record conflicts with other records",
+			}
+			return
+		}
+
+		if instNames.Contains(recordSet.Name) && isAddrRecord(recordSet) &&
+			!appliedKeys.Contains(recordSet.Key()) {
+
+			errData = &errortypes.ErrorData{
+				Error:   "domain_record_instance_conflict",
+				Message: "Domain record conflicts with instance record",
+			}
+			return
+		}
+
+		names.Add(recordSet.Name)
+		if recordSet.Type == "CNAME" {
+			cnames.Add(recordSet.Name)
+		}
+	}
+
+	return
+}
+
+func (d *Domain) syncReverse(prov dnsProvider, name string,
+	curRecordSet, recordSet *RecordSet, inUse set.Set) (err error) {
+
+	if recordSet != nil && recordSet.Type != "A" &&
+		recordSet.Type != "AAAA" {
+
+		return
+	}
+
+	values := set.NewSet()
+	if recordSet != nil {
+		for _, value := range recordSet.Values {
+			values.Add(value)
+
+			err = upsertReverse(prov, name, "", value, recordSet.Ttl)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	if curRecordSet != nil && (curRecordSet.Type == "A" ||
+		curRecordSet.Type == "AAAA") {
+
+		for _, value := range curRecordSet.Values {
+			if values.Contains(value) || inUse.Contains(value) {
+				continue
+			}
+
+			err = deleteReverse(prov, value, name)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// Returns the addresses of the managed address records and instance
+// records, reverse records of these addresses are not removed
+func (d *Domain) getAddrsInUse(db *database.Database) (
+	addrs set.Set, err error) {
+
+	addrs = set.NewSet()
+
+	for _, recordSet := range d.Records {
+		if recordSet.Type != "A" && recordSet.Type != "AAAA" {
+			continue
+		}
+
+		for _, value := range recordSet.Values {
+			addrs.Add(value)
+		}
+	}
+
+	recrds, err := GetRecordAll(db, &bson.M{
+		"domain": d.Id,
+	})
+	if err != nil {
+		return
+	}
+
+	for _, recrd := range recrds {
+		if recrd.Address != "" {
+			addrs.Add(recrd.Address)
+		}
+		if recrd.Address6 != "" {
+			addrs.Add(recrd.Address6)
+		}
+	}
+
+	return
+}
+
+// Reconciles the managed records with the domain provider, the applied
+// records are used to remove records that are no longer managed
+func (d *Domain) SyncRecords(db *database.Database) (err error) {
+	curRecords := map[string]*RecordSet{}
+	for _, recordSet := range d.AppliedRecords {
+		curRecords[recordSet.Key()] = recordSet
+	}
+
+	newRecords := map[string]*RecordSet{}
+	for _, recordSet := range d.Records {
+		newRecords[recordSet.Key()] = recordSet
+	}
+
+	changed := len(curRecords) != len(newRecords)
+	for key, recordSet := range newRecords {
+		curRecordSet := curRecords[key]
+		if curRecordSet == nil || !curRecordSet.Equal(recordSet) {
+			changed = true
+			break
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	prov, err := getProvider(d)
+	if err != nil {
+		return
+	}
+
+	inUse, err := d.getAddrsInUse(db)
+	if err != nil {
+		return
+	}
+
+	resetNames := set.NewSet()
+	for key, curRecordSet := range curRecords {
+		if newRecords[key] != nil {
+			continue
+		}
+
+		if isAddrRecord(curRecordSet) {
+			resetNames.Add(curRecordSet.Name)
+		}
+
+		name := d.GetFqdn(curRecordSet.Name)
+
+		logrus.WithFields(logrus.Fields{
+			"domain": d.Name,
+			"name":   name,
+			"type":   curRecordSet.Type,
+		}).Info("domain: Removing domain record")
+
+		err = prov.DeleteRecords(name, curRecordSet.Type)
+		if err != nil {
+			return
+		}
+
+		err = d.syncReverse(prov, name, curRecordSet, nil, inUse)
+		if err != nil {
+			return
+		}
+	}
+
+	for key, recordSet := range newRecords {
+		curRecordSet := curRecords[key]
+		if curRecordSet != nil && curRecordSet.Equal(recordSet) {
+			continue
+		}
+
+		name := d.GetFqdn(recordSet.Name)
+
+		logrus.WithFields(logrus.Fields{
+			"domain": d.Name,
+			"name":   name,
+			"type":   recordSet.Type,
+		}).Info("domain: Updating domain record")
+
+		err = prov.UpsertRecords(name, recordSet.Type, recordSet.Ttl,
+			recordSet.Values)
+		if err != nil {
+			return
+		}
+
+		err = d.syncReverse(prov, name, curRecordSet, recordSet, inUse)
+		if err != nil {
+			return
+		}
+	}
+
+	d.AppliedRecords = d.Records
+
+	err = d.CommitFields(db, set.NewSet("applied_records"))
+	if err != nil {
+		return
+	}
+
+	err = d.resetInstanceRecords(db, resetNames)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Removes the applied records from the domain provider, used before the
+// domain is removed or moved to another zone or provider. A zone that no
+// longer exists has no records to remove.
+func (d *Domain) ClearRecords(db *database.Database) (err error) {
+	if len(d.AppliedRecords) == 0 {
+		return
+	}
+
+	records := d.Records
+	d.Records = []*RecordSet{}
+
+	err = d.SyncRecords(db)
+	d.Records = records
+	if err != nil {
+		if _, ok := err.(*errortypes.NotFoundError); !ok {
+			return
+		}
+		err = nil
+
+		d.AppliedRecords = []*RecordSet{}
+
+		err = d.CommitFields(db, set.NewSet("applied_records"))
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,549 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"hash"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+)
+
+const (
+	dnsClassInet = 1
+	dnsClassNone = 254
+	dnsClassAny  = 255
+
+	dnsTypeTsig = 250
+
+	dnsOpcodeQuery  = 0
+	dnsOpcodeUpdate = 5
+
+	dnsSectionQuestion = 0
+	dnsSectionUpdate   = 2
+	dnsSectionExtra    = 3
+
+	dnsTimeout = 20 * time.Second
+	tsigFudge  = 300
+)
+
+var (
+	rfc2136Algorithms = map[string]string{
+		HmacMd5:    "hmac-md5.sig-alg.reg.int.",
+		HmacSha1:   "hmac-sha1.",
+		HmacSha256: "hmac-sha256.",
+		HmacSha512: "hmac-sha512.",
+	}
+	rfc2136Hashes = map[string]func() hash.Hash{
+		HmacMd5:    md5.New,
+		HmacSha1:   sha1.New,
+		HmacSha256: sha256.New,
+		HmacSha512: sha512.New,
+	}
+	dnsRcodes = map[int]string{
+		1:  "FORMERR",
+		2:  "SERVFAIL",
+		3:  "NXDOMAIN",
+		4:  "NOTIMP",
+		5:  "REFUSED",
+		6:  "YXDOMAIN",
+		7:  "YXRRSET",
+		8:  "NXRRSET",
+		9:  "NOTAUTH",
+		10: "NOTZONE",
+	}
+)
+
+// DNS message in the wire format, names are not compressed. For update
+// messages the sections are the zone, prerequisite, update and additional
+// sections.
+type dnsMsg struct {
+	id     uint16
+	flags  uint16
+	counts [4]int
+	body   []byte
+}
+
+func newDnsMsg(opcode int) (msg *dnsMsg, err error) {
+	id := make([]byte, 2)
+	_, err = io.ReadFull(rand.Reader, id)
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "domain: Failed to generate message id"),
+		}
+		return
+	}
+
+	msg = &dnsMsg{
+		id:    binary.BigEndian.Uint16(id),
+		flags: uint16(opcode << 11),
+		body:  []byte{},
+	}
+
+	if opcode == dnsOpcodeQuery {
+		msg.flags |= 0x0100
+	}
+
+	return
+}
+
+func (m *dnsMsg) addQuestion(name string, rrType uint16) {
+	m.body = packName(m.body, name)
+	m.body = packUint16(m.body, int(rrType))
+	m.body = packUint16(m.body, dnsClassInet)
+	m.counts[dnsSectionQuestion] += 1
+}
+
+func (m *dnsMsg) addRr(section int, name string, rrType uint16,
+	class int, ttl int, rdata []byte) {
+
+	m.body = packName(m.body, name)
+	m.body = packUint16(m.body, int(rrType))
+	m.body = packUint16(m.body, class)
+	m.body = append(m.body, byte(ttl>>24), byte(ttl>>16),
+		byte(ttl>>8), byte(ttl))
+	m.body = packUint16(m.body, len(rdata))
+	m.body = append(m.body, rdata...)
+	m.counts[section] += 1
+}
+
+func (m *dnsMsg) pack() (buf []byte) {
+	buf = packUint16([]byte{}, int(m.id))
+	buf = packUint16(buf, int(m.flags))
+	for _, count := range m.counts {
+		buf = packUint16(buf, count)
+	}
+	buf = append(buf, m.body...)
+
+	return
+}
+
+// Parsed DNS response, only the record owner names and types are read
+type dnsResp struct {
+	id            uint16
+	rcode         int
+	authoritative bool
+	records       []*dnsRespRecord
+}
+
+type dnsRespRecord struct {
+	Name string
+	Type uint16
+}
+
+func readName(buf []byte, off int) (name string, next int, err error) {
+	labels := []string{}
+	next = -1
+
+	for jumps := 0; ; {
+		if off >= len(buf) {
+			err = &errortypes.ParseError{
+				errors.New("domain: DNS response name truncated"),
+			}
+			return
+		}
+
+		n := int(buf[off])
+		if n == 0 {
+			off += 1
+			break
+		}
+
+		if n&0xc0 == 0xc0 {
+			if off+1 >= len(buf) || jumps > 32 {
+				err = &errortypes.ParseError{
+					errors.New("domain: DNS response name invalid"),
+				}
+				return
+			}
+			if next == -1 {
+				next = off + 2
+			}
+			off = (n&0x3f)<<8 | int(buf[off+1])
+			jumps += 1
+			continue
+		}
+
+		if off+1+n > len(buf) {
+			err = &errortypes.ParseError{
+				errors.New("domain: DNS response name truncated"),
+			}
+			return
+		}
+
+		labels = append(labels, string(buf[off+1:off+1+n]))
+		off += 1 + n
+	}
+
+	if next == -1 {
+		next = off
+	}
+	name = fqdn(strings.Join(labels, "."))
+
+	return
+}
+
+func parseDnsResp(buf []byte) (resp *dnsResp, err error) {
+	if len(buf) < 12 {
+		err = &errortypes.ParseError{
+			errors.New("domain: DNS response truncated"),
+		}
+		return
+	}
+
+	flags := binary.BigEndian.Uint16(buf[2:4])
+	resp = &dnsResp{
+		id:            binary.BigEndian.Uint16(buf[0:2]),
+		rcode:         int(flags & 0xf),
+		authoritative: flags&0x0400 != 0,
+		records:       []*dnsRespRecord{},
+	}
+
+	qdCount := int(binary.BigEndian.Uint16(buf[4:6]))
+	rrCount := int(binary.BigEndian.Uint16(buf[6:8])) +
+		int(binary.BigEndian.Uint16(buf[8:10]))
+	off := 12
+
+	for i := 0; i < qdCount; i++ {
+		_, off, err = readName(buf, off)
+		if err != nil {
+			return
+		}
+		off += 4
+	}
+
+	for i := 0; i < rrCount; i++ {
+		name, next, e := readName(buf, off)
+		if e != nil {
+			err = e
+			return
+		}
+		off = next
+
+		if off+10 > len(buf) {
+			err = &errortypes.ParseError{
+				errors.New("domain: DNS response record truncated"),
+			}
+			return
+		}
+
+		resp.records = append(resp.records, &dnsRespRecord{
+			Name: name,
+			Type: binary.BigEndian.Uint16(buf[off : off+2]),
+		})
+
+		off += 10 + int(binary.BigEndian.Uint16(buf[off+8:off+10]))
+	}
+
+	return
+}
+
+type dnsRfc2136 struct {
+	server    string
+	zone      string
+	keyName   string
+	algorithm string
+	hash      func() hash.Hash
+	secret    []byte
+}
+
+func (d *dnsRfc2136) Connect(domn *Domain) (err error) {
+	d.server = domn.Rfc2136Server
+	d.zone = fqdn(domn.Name)
+
+	if domn.Rfc2136KeyName != "" {
+		d.keyName = strings.ToLower(fqdn(domn.Rfc2136KeyName))
+		d.algorithm = rfc2136Algorithms[domn.Rfc2136Algorithm]
+		d.hash = rfc2136Hashes[domn.Rfc2136Algorithm]
+		if d.algorithm == "" || d.hash == nil {
+			err = &errortypes.ParseError{
+				errors.New("domain: Unknown RFC2136 TSIG algorithm"),
+			}
+			return
+		}
+
+		d.secret, err = base64.StdEncoding.DecodeString(
+			domn.Rfc2136Secret)
+		if err != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(err, "domain: Failed to decode RFC2136 secret"),
+			}
+			return
+		}
+	}
+
+	return
+}
+
+// Adds the TSIG record to the message, the signature of the response is
+// not verified
+func (d *dnsRfc2136) sign(msg *dnsMsg) {
+	timeSigned := time.Now().Unix()
+	timeData := []byte{
+		byte(timeSigned >> 40), byte(timeSigned >> 32),
+		byte(timeSigned >> 24), byte(timeSigned >> 16),
+		byte(timeSigned >> 8), byte(timeSigned),
+	}
+
+	vars := packName([]byte{}, d.keyName)
+	vars = packUint16(vars, dnsClassAny)
+	vars = append(vars, 0, 0, 0, 0)
+	vars = packName(vars, d.algorithm)
+	vars = append(vars, timeData...)
+	vars = packUint16(vars, tsigFudge)
+	vars = packUint16(vars, 0)
+	vars = packUint16(vars, 0)
+
+	mac := hmac.New(d.hash, d.secret)
+	mac.Write(msg.pack())
+	mac.Write(vars)
+	sum := mac.Sum(nil)
+
+	rdata := packName([]byte{}, d.algorithm)
+	rdata = append(rdata, timeData...)
+	rdata = packUint16(rdata, tsigFudge)
+	rdata = packUint16(rdata, len(sum))
+	rdata = append(rdata, sum...)
+	rdata = packUint16(rdata, int(msg.id))
+	rdata = packUint16(rdata, 0)
+	rdata = packUint16(rdata, 0)
+
+	msg.addRr(dnsSectionExtra, d.keyName, dnsTypeTsig, dnsClassAny,
+		0, rdata)
+}
+
+func (d *dnsRfc2136) exchange(msg *dnsMsg) (resp *dnsResp, err error) {
+	conn, err := net.DialTimeout("tcp", d.server, dnsTimeout)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "domain: RFC2136 connection failed"),
+		}
+		return
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(dnsTimeout))
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "domain: RFC2136 connection failed"),
+		}
+		return
+	}
+
+	data := msg.pack()
+	_, err = conn.Write(append(packUint16([]byte{}, len(data)), data...))
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "domain: RFC2136 request failed"),
+		}
+		return
+	}
+
+	size := make([]byte, 2)
+	_, err = io.ReadFull(conn, size)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "domain: RFC2136 response failed"),
+		}
+		return
+	}
+
+	data = make([]byte, binary.BigEndian.Uint16(size))
+	_, err = io.ReadFull(conn, data)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "domain: RFC2136 response failed"),
+		}
+		return
+	}
+
+	resp, err = parseDnsResp(data)
+	if err != nil {
+		return
+	}
+
+	if resp.id != msg.id {
+		err = &errortypes.RequestError{
+			errors.New("domain: RFC2136 response id mismatch"),
+		}
+		return
+	}
+
+	return
+}
+
+func (d *dnsRfc2136) send(msg *dnsMsg) (err error) {
+	if d.keyName != "" {
+		d.sign(msg)
+	}
+
+	resp, err := d.exchange(msg)
+	if err != nil {
+		return
+	}
+
+	if resp.rcode != 0 {
+		rcode := dnsRcodes[resp.rcode]
+		if rcode == "" {
+			rcode = strconv.Itoa(resp.rcode)
+		}
+
+		err = &errortypes.RequestError{
+			errors.Newf("domain: RFC2136 update request bad rcode %s",
+				rcode),
+		}
+		return
+	}
+
+	return
+}
+
+func (d *dnsRfc2136) getZone(name string) (zone string, err error) {
+	msg, err := newDnsMsg(dnsOpcodeQuery)
+	if err != nil {
+		return
+	}
+	msg.addQuestion(fqdn(name), rrTypes["SOA"])
+
+	resp, err := d.exchange(msg)
+	if err != nil {
+		return
+	}
+
+	if !resp.authoritative {
+		return
+	}
+
+	for _, record := range resp.records {
+		if record.Type == rrTypes["SOA"] {
+			zone = record.Name
+			break
+		}
+	}
+
+	return
+}
+
+func (d *dnsRfc2136) update(zone, name, recordType string, ttl int,
+	values []string) (err error) {
+
+	rrType, ok := rrTypes[recordType]
+	if !ok {
+		err = &errortypes.ParseError{
+			errors.Newf("domain: Unknown record type %s", recordType),
+		}
+		return
+	}
+
+	rdatas := [][]byte{}
+	for _, value := range values {
+		data, e := parseRrData(recordType, value, ".")
+		if e != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(e, "domain: Failed to parse RFC2136 record"),
+			}
+			return
+		}
+
+		rdatas = append(rdatas, data.Pack())
+	}
+
+	msg, err := newDnsMsg(dnsOpcodeUpdate)
+	if err != nil {
+		return
+	}
+
+	msg.addQuestion(zone, rrTypes["SOA"])
+	msg.addRr(dnsSectionUpdate, fqdn(name), rrType, dnsClassAny, 0, nil)
+	for _, rdata := range rdatas {
+		msg.addRr(dnsSectionUpdate, fqdn(name), rrType, dnsClassInet,
+			ttl, rdata)
+	}
+
+	err = d.send(msg)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsRfc2136) UpsertRecords(name, recordType string, ttl int,
+	values []string) (err error) {
+
+	err = d.update(d.zone, name, recordType, ttl, values)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsRfc2136) DeleteRecords(name, recordType string) (err error) {
+	err = d.update(d.zone, name, recordType, 0, nil)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsRfc2136) UpsertReverse(addr, target string, ttl int) (
+	err error) {
+
+	name, err := getReverseName(addr)
+	if err != nil {
+		return
+	}
+
+	zone, err := d.getZone(name)
+	if err != nil || !strings.HasSuffix(zone, ".arpa.") {
+		return
+	}
+
+	err = d.update(zone, name, "PTR", ttl, []string{fqdn(target)})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (d *dnsRfc2136) DeleteReverse(addr, target string) (err error) {
+	name, err := getReverseName(addr)
+	if err != nil {
+		return
+	}
+
+	zone, err := d.getZone(name)
+	if err != nil || !strings.HasSuffix(zone, ".arpa.") {
+		return
+	}
+
+	msg, err := newDnsMsg(dnsOpcodeUpdate)
+	if err != nil {
+		return
+	}
+
+	msg.addQuestion(zone, rrTypes["SOA"])
+	msg.addRr(dnsSectionUpdate, fqdn(name), rrTypes["PTR"], dnsClassNone,
+		0, packName([]byte{}, fqdn(target)))
+
+	err = d.send(msg)
+	if err != nil {
+		return
+	}
+
+	return
+}
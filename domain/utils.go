@@ -184,9 +184,32 @@ func GetAllName(db *database.Database, query *bson.M) (
 	return
 }
 
+func clearRecords(db *database.Database, query *bson.M) (err error) {
+	domns, err := GetAll(db, query)
+	if err != nil {
+		return
+	}
+
+	for _, domn := range domns {
+		err = domn.ClearRecords(db)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
 func Remove(db *database.Database, domnId primitive.ObjectID) (err error) {
 	coll := db.Domains()
 
+	err = clearRecords(db, &bson.M{
+		"_id": domnId,
+	})
+	if err != nil {
+		return
+	}
+
 	_, err = coll.DeleteOne(db, &bson.M{
 		"_id": domnId,
 	})
@@ -208,6 +231,14 @@ func RemoveOrg(db *database.Database, orgId, domnId primitive.ObjectID) (
 
 	coll := db.Domains()
 
+	err = clearRecords(db, &bson.M{
+		"_id":          domnId,
+		"organization": orgId,
+	})
+	if err != nil {
+		return
+	}
+
 	_, err = coll.DeleteOne(db, &bson.M{
 		"_id":          domnId,
 		"organization": orgId,
@@ -228,6 +259,15 @@ func RemoveOrg(db *database.Database, orgId, domnId primitive.ObjectID) (
 func RemoveMulti(db *database.Database, domnIds []primitive.ObjectID) (err error) {
 	coll := db.Domains()
 
+	err = clearRecords(db, &bson.M{
+		"_id": &bson.M{
+			"$in": domnIds,
+		},
+	})
+	if err != nil {
+		return
+	}
+
 	_, err = coll.DeleteMany(db, &bson.M{
 		"_id": &bson.M{
 			"$in": domnIds,
@@ -246,6 +286,16 @@ func RemoveMultiOrg(db *database.Database, orgId primitive.ObjectID,
 
 	coll := db.Domains()
 
+	err = clearRecords(db, &bson.M{
+		"_id": &bson.M{
+			"$in": domnIds,
+		},
+		"organization": orgId,
+	})
+	if err != nil {
+		return
+	}
+
 	_, err = coll.DeleteMany(db, &bson.M{
 		"_id": &bson.M{
 			"$in": domnIds,
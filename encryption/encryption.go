@@ -0,0 +1,213 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/organization"
+	"github.com/pritunl/pritunl-cloud/requires"
+	"github.com/pritunl/pritunl-cloud/settings"
+	"github.com/pritunl/pritunl-cloud/utils"
+)
+
+const (
+	keySize   = 32
+	nonceSize = 12
+)
+
+func wrapKey(kek, key []byte) (wrapped []byte, err error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "encryption: Failed to load cipher"),
+		}
+		return
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "encryption: Failed to load gcm"),
+		}
+		return
+	}
+
+	nonce, err := utils.RandBytes(nonceSize)
+	if err != nil {
+		return
+	}
+
+	wrapped = gcm.Seal(nonce, nonce, key, nil)
+
+	return
+}
+
+func unwrapKey(kek, wrapped []byte) (key []byte, err error) {
+	if len(wrapped) < nonceSize {
+		err = &errortypes.ParseError{
+			errors.New("encryption: Wrapped key too short"),
+		}
+		return
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "encryption: Failed to load cipher"),
+		}
+		return
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "encryption: Failed to load gcm"),
+		}
+		return
+	}
+
+	key, err = gcm.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], nil)
+	if err != nil {
+		err = &errortypes.VerificationError{
+			errors.Wrap(err, "encryption: Failed to unwrap key"),
+		}
+		return
+	}
+
+	return
+}
+
+// Fingerprint returns a short identifier for a key that is safe to store
+// alongside encrypted data.
+func Fingerprint(key []byte) string {
+	hash := sha256.Sum256(key)
+	return fmt.Sprintf("%x", hash[:8])
+}
+
+func GetOrgKey(db *database.Database, orgId primitive.ObjectID) (
+	key []byte, err error) {
+
+	masterKey := settings.System.BackupMasterKey
+	if len(masterKey) != keySize {
+		err = &errortypes.ReadError{
+			errors.New("encryption: Missing backup master key"),
+		}
+		return
+	}
+
+	org, err := organization.Get(db, orgId)
+	if err != nil {
+		return
+	}
+
+	if len(org.BackupKey) == 0 {
+		newKey, e := utils.RandBytes(keySize)
+		if e != nil {
+			err = e
+			return
+		}
+
+		wrapped, e := wrapKey(masterKey, newKey)
+		if e != nil {
+			err = e
+			return
+		}
+
+		coll := db.Organizations()
+		_, err = coll.UpdateOne(db, &bson.M{
+			"_id": org.Id,
+			"backup_key": &bson.M{
+				"$exists": false,
+			},
+		}, &bson.M{
+			"$set": &bson.M{
+				"backup_key": wrapped,
+			},
+		})
+		if err != nil {
+			err = database.ParseError(err)
+			if _, ok := err.(*database.NotFoundError); ok {
+				err = nil
+			} else {
+				return
+			}
+		}
+
+		org, err = organization.Get(db, orgId)
+		if err != nil {
+			return
+		}
+	}
+
+	key, err = unwrapKey(masterKey, org.BackupKey)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// The master key is stored in the system settings document and the wrapped
+// organization keys in the organizations collection of the same database.
+// Access to the database allows decrypting backups, the wrapping protects
+// backups at rest in storage and allows rotating organization keys.
+func init() {
+	module := requires.New("encryption")
+	module.After("settings")
+
+	module.Handler = func() (err error) {
+		db := database.GetDatabase()
+		defer db.Close()
+
+		if len(settings.System.BackupMasterKey) == 0 {
+			masterKey, e := utils.RandBytes(keySize)
+			if e != nil {
+				err = e
+				return
+			}
+
+			// Only set the key if no other node has set it, then reload
+			// to use the key that was stored
+			coll := db.Settings()
+			_, err = coll.UpdateOne(db, &bson.M{
+				"_id": settings.System.Id,
+				"backup_master_key": &bson.M{
+					"$exists": false,
+				},
+			}, &bson.M{
+				"$set": &bson.M{
+					"backup_master_key": masterKey,
+				},
+			})
+			if err != nil {
+				err = database.ParseError(err)
+				if _, ok := err.(*database.NotFoundError); ok {
+					err = nil
+				} else {
+					return
+				}
+			}
+
+			err = settings.Update("system")
+			if err != nil {
+				return
+			}
+
+			if len(settings.System.BackupMasterKey) != keySize {
+				err = &errortypes.ReadError{
+					errors.New("encryption: Invalid backup master key"),
+				}
+				return
+			}
+		}
+
+		return
+	}
+}
@@ -0,0 +1,311 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/utils"
+)
+
+// Encrypted files begin with a header holding a random file key wrapped by
+// the organization key followed by the file contents split into chunks
+// that are individually sealed with AES-GCM. The chunk counter is used as
+// the nonce and the header is bound to every chunk as additional data with
+// a trailing flag marking the final chunk to detect truncation.
+
+const (
+	version   = 1
+	chunkSize = 1048576
+	tagSize   = 16
+)
+
+var magic = []byte("PCBK")
+
+func newGcm(key []byte) (gcm cipher.AEAD, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "encryption: Failed to load cipher"),
+		}
+		return
+	}
+
+	gcm, err = cipher.NewGCM(block)
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "encryption: Failed to load gcm"),
+		}
+		return
+	}
+
+	return
+}
+
+func chunkNonce(counter uint64) []byte {
+	nonce := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(nonce[nonceSize-8:], counter)
+	return nonce
+}
+
+func chunkAad(header []byte, final bool) []byte {
+	aad := make([]byte, len(header)+1)
+	copy(aad, header)
+	if final {
+		aad[len(header)] = 1
+	}
+	return aad
+}
+
+func isFinal(reader *bufio.Reader) (final bool, err error) {
+	_, err = reader.Peek(1)
+	if err == io.EOF {
+		err = nil
+		final = true
+	} else if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "encryption: Failed to read data"),
+		}
+	}
+	return
+}
+
+func Encrypt(key []byte, dst io.Writer, src io.Reader) (err error) {
+	fileKey, err := utils.RandBytes(keySize)
+	if err != nil {
+		return
+	}
+
+	wrapped, err := wrapKey(key, fileKey)
+	if err != nil {
+		return
+	}
+
+	header := &bytes.Buffer{}
+	header.Write(magic)
+	header.WriteByte(version)
+	binary.Write(header, binary.BigEndian, uint32(chunkSize))
+	binary.Write(header, binary.BigEndian, uint16(len(wrapped)))
+	header.Write(wrapped)
+	headerBytes := header.Bytes()
+
+	_, err = dst.Write(headerBytes)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "encryption: Failed to write header"),
+		}
+		return
+	}
+
+	gcm, err := newGcm(fileKey)
+	if err != nil {
+		return
+	}
+
+	reader := bufio.NewReaderSize(src, chunkSize)
+	buf := make([]byte, chunkSize)
+	sealed := make([]byte, 0, chunkSize+tagSize)
+
+	for counter := uint64(0); ; counter++ {
+		n, e := io.ReadFull(reader, buf)
+		if e != nil && e != io.EOF && e != io.ErrUnexpectedEOF {
+			err = &errortypes.ReadError{
+				errors.Wrap(e, "encryption: Failed to read data"),
+			}
+			return
+		}
+
+		final, e := isFinal(reader)
+		if e != nil {
+			err = e
+			return
+		}
+
+		sealed = gcm.Seal(sealed[:0], chunkNonce(counter), buf[:n],
+			chunkAad(headerBytes, final))
+
+		_, err = dst.Write(sealed)
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "encryption: Failed to write data"),
+			}
+			return
+		}
+
+		if final {
+			break
+		}
+	}
+
+	return
+}
+
+func Decrypt(key []byte, dst io.Writer, src io.Reader) (err error) {
+	reader := bufio.NewReaderSize(src, chunkSize+tagSize)
+
+	prefix := make([]byte, len(magic)+7)
+	_, err = io.ReadFull(reader, prefix)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "encryption: Failed to read header"),
+		}
+		return
+	}
+
+	if !bytes.Equal(prefix[:len(magic)], magic) ||
+		prefix[len(magic)] != version {
+
+		err = &errortypes.ParseError{
+			errors.New("encryption: Unknown encrypted file format"),
+		}
+		return
+	}
+
+	size := int(binary.BigEndian.Uint32(prefix[len(magic)+1:]))
+	wrappedLen := int(binary.BigEndian.Uint16(prefix[len(magic)+5:]))
+	if size <= 0 || size > 64*chunkSize {
+		err = &errortypes.ParseError{
+			errors.New("encryption: Invalid encrypted chunk size"),
+		}
+		return
+	}
+
+	wrapped := make([]byte, wrappedLen)
+	_, err = io.ReadFull(reader, wrapped)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "encryption: Failed to read header"),
+		}
+		return
+	}
+
+	headerBytes := append(prefix, wrapped...)
+
+	fileKey, err := unwrapKey(key, wrapped)
+	if err != nil {
+		return
+	}
+
+	gcm, err := newGcm(fileKey)
+	if err != nil {
+		return
+	}
+
+	buf := make([]byte, size+tagSize)
+	opened := make([]byte, 0, size)
+
+	for counter := uint64(0); ; counter++ {
+		n, e := io.ReadFull(reader, buf)
+		if e != nil && e != io.ErrUnexpectedEOF {
+			err = &errortypes.VerificationError{
+				errors.Wrap(e, "encryption: Encrypted data truncated"),
+			}
+			return
+		}
+
+		final, e := isFinal(reader)
+		if e != nil {
+			err = e
+			return
+		}
+
+		opened, e = gcm.Open(opened[:0], chunkNonce(counter), buf[:n],
+			chunkAad(headerBytes, final))
+		if e != nil {
+			err = &errortypes.VerificationError{
+				errors.Wrap(e, "encryption: Encrypted data verification failed"),
+			}
+			return
+		}
+
+		_, err = dst.Write(opened)
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "encryption: Failed to write data"),
+			}
+			return
+		}
+
+		if final {
+			break
+		}
+	}
+
+	return
+}
+
+func EncryptFile(key []byte, srcPth, dstPth string) (err error) {
+	src, err := os.Open(srcPth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "encryption: Failed to open file"),
+		}
+		return
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPth, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "encryption: Failed to create file"),
+		}
+		return
+	}
+	defer dst.Close()
+
+	err = Encrypt(key, dst, src)
+	if err != nil {
+		return
+	}
+
+	err = dst.Sync()
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "encryption: Failed to sync file"),
+		}
+		return
+	}
+
+	return
+}
+
+func DecryptFile(key []byte, srcPth, dstPth string) (err error) {
+	src, err := os.Open(srcPth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "encryption: Failed to open file"),
+		}
+		return
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPth, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "encryption: Failed to create file"),
+		}
+		return
+	}
+	defer dst.Close()
+
+	err = Decrypt(key, dst, src)
+	if err != nil {
+		return
+	}
+
+	err = dst.Sync()
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "encryption: Failed to sync file"),
+		}
+		return
+	}
+
+	return
+}
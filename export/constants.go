@@ -0,0 +1,27 @@
+package export
+
+import (
+	"time"
+)
+
+const (
+	Qcow2 = "qcow2"
+	Raw   = "raw"
+	Vmdk  = "vmdk"
+	Ova   = "ova"
+
+	Pending   = "pending"
+	Exporting = "exporting"
+	Completed = "completed"
+	Failed    = "failed"
+
+	DefaultExpire = 24 * time.Hour
+	MaxExpire     = 7 * 24 * time.Hour
+)
+
+var Extensions = map[string]string{
+	Qcow2: "qcow2",
+	Raw:   "img",
+	Vmdk:  "vmdk",
+	Ova:   "ova",
+}
@@ -0,0 +1,135 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+)
+
+type Export struct {
+	Id           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name         string             `bson:"name" json:"name"`
+	Organization primitive.ObjectID `bson:"organization" json:"organization"`
+	Image        primitive.ObjectID `bson:"image,omitempty" json:"image"`
+	Disk         primitive.ObjectID `bson:"disk,omitempty" json:"disk"`
+	Datacenter   primitive.ObjectID `bson:"datacenter,omitempty" json:"datacenter"`
+	Node         primitive.ObjectID `bson:"node,omitempty" json:"node"`
+	Format       string             `bson:"format" json:"format"`
+	State        string             `bson:"state" json:"state"`
+	Error        string             `bson:"error" json:"error"`
+	Storage      primitive.ObjectID `bson:"storage" json:"storage"`
+	Key          string             `bson:"key" json:"-"`
+	Size         int64              `bson:"size" json:"size"`
+	Timestamp    time.Time          `bson:"timestamp" json:"timestamp"`
+	Expires      time.Time          `bson:"expires" json:"expires"`
+	Url          string             `bson:"-" json:"url"`
+}
+
+func (e *Export) Filename() string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.' {
+
+			return r
+		}
+		return '_'
+	}, e.Name)
+
+	return fmt.Sprintf("%s.%s", name, Extensions[e.Format])
+}
+
+func (e *Export) Validate(db *database.Database) (
+	errData *errortypes.ErrorData, err error) {
+
+	if _, ok := Extensions[e.Format]; !ok {
+		errData = &errortypes.ErrorData{
+			Error:   "export_format_invalid",
+			Message: "Export format is invalid",
+		}
+		return
+	}
+
+	if e.Image.IsZero() && e.Disk.IsZero() {
+		errData = &errortypes.ErrorData{
+			Error:   "export_source_required",
+			Message: "Missing export image or disk",
+		}
+		return
+	}
+
+	if e.Storage.IsZero() {
+		errData = &errortypes.ErrorData{
+			Error:   "private_storage_required",
+			Message: "Datacenter does not have private storage",
+		}
+		return
+	}
+
+	if e.State == "" {
+		e.State = Pending
+	}
+
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	if e.Expires.IsZero() {
+		e.Expires = e.Timestamp.Add(DefaultExpire)
+	} else if e.Expires.Sub(e.Timestamp) > MaxExpire {
+		e.Expires = e.Timestamp.Add(MaxExpire)
+	}
+
+	if e.Key == "" {
+		e.Key = fmt.Sprintf("export/%s", e.Id.Hex())
+	}
+
+	return
+}
+
+func (e *Export) Commit(db *database.Database) (err error) {
+	coll := db.Exports()
+
+	err = coll.Commit(e.Id, e)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (e *Export) CommitFields(db *database.Database, fields set.Set) (
+	err error) {
+
+	coll := db.Exports()
+
+	err = coll.CommitFields(e.Id, e, fields)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (e *Export) Insert(db *database.Database) (err error) {
+	coll := db.Exports()
+
+	_, err = coll.InsertOne(db, e)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func NewExport() *Export {
+	return &Export{
+		Id: primitive.NewObjectID(),
+	}
+}
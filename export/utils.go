@@ -0,0 +1,172 @@
+package export
+
+import (
+	"time"
+
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/mongo-go-driver/mongo/options"
+	"github.com/pritunl/pritunl-cloud/database"
+)
+
+func Get(db *database.Database, exportId primitive.ObjectID) (
+	exp *Export, err error) {
+
+	coll := db.Exports()
+	exp = &Export{}
+
+	err = coll.FindOneId(exportId, exp)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func GetOrg(db *database.Database, orgId, exportId primitive.ObjectID) (
+	exp *Export, err error) {
+
+	coll := db.Exports()
+	exp = &Export{}
+
+	err = coll.FindOne(db, &bson.M{
+		"_id":          exportId,
+		"organization": orgId,
+	}).Decode(exp)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func GetAll(db *database.Database, query *bson.M) (
+	exps []*Export, err error) {
+
+	coll := db.Exports()
+	exps = []*Export{}
+
+	cursor, err := coll.Find(
+		db,
+		query,
+		&options.FindOptions{
+			Sort: &bson.D{
+				{"timestamp", -1},
+			},
+		},
+	)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		exp := &Export{}
+		err = cursor.Decode(exp)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		exps = append(exps, exp)
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func GetDiskPending(db *database.Database, diskId primitive.ObjectID) (
+	exps []*Export, err error) {
+
+	exps, err = GetAll(db, &bson.M{
+		"disk":  diskId,
+		"state": Pending,
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Claims a pending image export in the datacenter for the node, image
+// exports are run by the hypervisor nodes of the export datacenter
+func ClaimImage(db *database.Database, dcId, nodeId primitive.ObjectID) (
+	exp *Export, err error) {
+
+	coll := db.Exports()
+	exp = &Export{}
+
+	opts := &options.FindOneAndUpdateOptions{}
+	opts.SetReturnDocument(options.After)
+	opts.SetSort(&bson.D{
+		{"timestamp", 1},
+	})
+
+	err = coll.FindOneAndUpdate(
+		db,
+		&bson.M{
+			"image": &bson.M{
+				"$exists": true,
+			},
+			"datacenter": dcId,
+			"state":      Pending,
+		},
+		&bson.M{
+			"$set": &bson.M{
+				"node":  nodeId,
+				"state": Exporting,
+			},
+		},
+		opts,
+	).Decode(exp)
+	if err != nil {
+		err = database.ParseError(err)
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+			exp = nil
+		}
+		return
+	}
+
+	return
+}
+
+func GetExpired(db *database.Database) (exps []*Export, err error) {
+	exps, err = GetAll(db, &bson.M{
+		"expires": &bson.M{
+			"$lt": time.Now(),
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func Remove(db *database.Database, exportId primitive.ObjectID) (err error) {
+	coll := db.Exports()
+
+	_, err = coll.DeleteOne(db, &bson.M{
+		"_id": exportId,
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+		default:
+			return
+		}
+	}
+
+	return
+}
@@ -5,4 +5,29 @@ const (
 	Icmp = "icmp"
 	Tcp  = "tcp"
 	Udp  = "udp"
+	Sctp = "sctp"
+	Gre  = "gre"
+	Esp  = "esp"
+)
+
+const (
+	StateNew = "new"
+	StateAny = "any"
+)
+
+const (
+	Ingress = "ingress"
+	Egress  = "egress"
+)
+
+const (
+	Accept = "accept"
+	Drop   = "drop"
+)
+
+const (
+	NflogIngressAccept = 60
+	NflogIngressDrop   = 61
+	NflogEgressAccept  = 62
+	NflogEgressDrop    = 63
 )
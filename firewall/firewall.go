@@ -1,6 +1,7 @@
 package firewall
 
 import (
+	"crypto/md5"
 	"fmt"
 	"net"
 	"strconv"
@@ -8,51 +9,317 @@ import (
 
 	"github.com/dropbox/godropbox/container/set"
 	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson"
 	"github.com/pritunl/mongo-go-driver/bson/primitive"
 	"github.com/pritunl/pritunl-cloud/database"
 	"github.com/pritunl/pritunl-cloud/errortypes"
 )
 
 type Rule struct {
-	SourceIps []string `bson:"source_ips" json:"source_ips"`
-	Protocol  string   `bson:"protocol" json:"protocol"`
-	Port      string   `bson:"port" json:"port"`
+	SourceIps    []string             `bson:"source_ips" json:"source_ips"`
+	DestIps      []string             `bson:"dest_ips" json:"dest_ips"`
+	Firewalls    []primitive.ObjectID `bson:"firewalls" json:"firewalls"`
+	NetworkRoles []string             `bson:"network_roles" json:"network_roles"`
+	Protocol     string               `bson:"protocol" json:"protocol"`
+	Port         string               `bson:"port" json:"port"`
+	IcmpTypes    []string             `bson:"icmp_types" json:"icmp_types"`
+	ConnState    string               `bson:"conn_state" json:"conn_state"`
+	Log          bool                 `bson:"log" json:"log"`
 }
 
-func (r *Rule) SetName(ipv6 bool) (name string) {
+func (r *Rule) HasPorts() bool {
+	switch r.Protocol {
+	case Tcp, Udp, Sctp:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *Rule) GetPorts() []string {
+	if r.Port == "" {
+		return []string{}
+	}
+	return strings.Split(r.Port, ",")
+}
+
+func (r *Rule) GetConnState() string {
+	if r.ConnState != "" {
+		return r.ConnState
+	}
+
+	if r.HasPorts() {
+		return StateNew
+	}
+	return StateAny
+}
+
+func (r *Rule) Key() string {
+	return fmt.Sprintf("%s-%s-%s-%s", r.Protocol, r.Port,
+		strings.Join(r.IcmpTypes, ","), r.GetConnState())
+}
+
+func (r *Rule) isSimple() bool {
+	if len(r.IcmpTypes) > 0 || strings.Contains(r.Port, ",") {
+		return false
+	}
+
+	if r.HasPorts() {
+		return r.GetConnState() == StateNew
+	}
+	return r.GetConnState() == StateAny
+}
+
+func (r *Rule) setName(prefix string, ipv6 bool) (name string) {
+	family := "4"
+	if ipv6 {
+		family = "6"
+	}
+
 	switch r.Protocol {
-	case All:
-		if ipv6 {
-			name = "pr6_all"
-		} else {
-			name = "pr4_all"
+	case All, Icmp, Tcp, Udp, Sctp, Gre, Esp:
+		break
+	default:
+		return
+	}
+
+	// Set names are limited to 31 characters, rules with port lists,
+	// icmp types or a non default state use a hash of the rule key
+	if !r.isSimple() {
+		hash := md5.Sum([]byte(r.Key()))
+		name = fmt.Sprintf("%s%s_%s_%x", prefix, family, r.Protocol,
+			hash[:4])
+		return
+	}
+
+	if r.HasPorts() {
+		name = fmt.Sprintf(
+			"%s%s_%s_%s",
+			prefix,
+			family,
+			r.Protocol,
+			strings.Replace(r.Port, "-", "_", 1),
+		)
+	} else {
+		name = fmt.Sprintf("%s%s_%s", prefix, family, r.Protocol)
+	}
+
+	return
+}
+
+func (r *Rule) SetName(ipv6 bool) (name string) {
+	return r.setName("pr", ipv6)
+}
+
+func (r *Rule) EgressSetName(ipv6 bool) (name string) {
+	return r.setName("pe", ipv6)
+}
+
+func (r *Rule) LogPrefix(egress bool) (prefix string) {
+	name := ""
+	if egress {
+		name = r.EgressSetName(false)
+	} else {
+		name = r.SetName(false)
+	}
+
+	if name == "" {
+		return
+	}
+
+	prefix = "pc_" + name[:2] + name[3:]
+	return
+}
+
+func (r *Rule) HasReferences() bool {
+	return len(r.Firewalls) > 0 || len(r.NetworkRoles) > 0
+}
+
+func parsePort(port string) (parsed string, count int, ok bool) {
+	ports := strings.Split(strings.TrimSpace(port), "-")
+	if len(ports) > 2 {
+		return
+	}
+
+	portInt, e := strconv.Atoi(strings.TrimSpace(ports[0]))
+	if e != nil || portInt < 1 || portInt > 65535 {
+		return
+	}
+
+	parsed = strconv.Itoa(portInt)
+	count = 1
+
+	if len(ports) > 1 {
+		portInt2, e := strconv.Atoi(strings.TrimSpace(ports[1]))
+		if e != nil || portInt2 > 65535 || portInt2 <= portInt {
+			return
 		}
+
+		parsed += "-" + strconv.Itoa(portInt2)
+		count = 2
+	}
+
+	ok = true
+	return
+}
+
+func (r *Rule) validate(direction string) (errData *errortypes.ErrorData) {
+	if r.IcmpTypes == nil || r.Protocol != Icmp {
+		r.IcmpTypes = []string{}
+	}
+
+	switch r.Protocol {
+	case All, Gre, Esp:
+		r.Port = ""
 		break
 	case Icmp:
-		if ipv6 {
-			name = "pr6_icmp"
-		} else {
-			name = "pr4_icmp"
+		r.Port = ""
+
+		types := []string{}
+		typesSet := set.NewSet()
+		for _, icmpType := range r.IcmpTypes {
+			icmpType = strings.TrimSpace(icmpType)
+			if typesSet.Contains(icmpType) {
+				continue
+			}
+
+			if icmpTypes[icmpType] == nil {
+				errData = &errortypes.ErrorData{
+					Error: fmt.Sprintf("invalid_%s_rule_icmp_type",
+						direction),
+					Message: fmt.Sprintf("Invalid %s rule ICMP type",
+						direction),
+				}
+				return
+			}
+
+			typesSet.Add(icmpType)
+			types = append(types, icmpType)
 		}
+		r.IcmpTypes = types
+
 		break
-	case Tcp, Udp:
-		if ipv6 {
-			name = fmt.Sprintf(
-				"pr6_%s_%s",
-				r.Protocol,
-				strings.Replace(r.Port, "-", "_", 1),
-			)
-		} else {
-			name = fmt.Sprintf(
-				"pr4_%s_%s",
-				r.Protocol,
-				strings.Replace(r.Port, "-", "_", 1),
-			)
+	case Tcp, Udp, Sctp:
+		ports := []string{}
+		portsSet := set.NewSet()
+		portsCount := 0
+
+		for _, port := range strings.Split(r.Port, ",") {
+			parsedPort, count, ok := parsePort(port)
+			if !ok {
+				errData = &errortypes.ErrorData{
+					Error:   fmt.Sprintf("invalid_%s_rule_port", direction),
+					Message: fmt.Sprintf("Invalid %s rule port", direction),
+				}
+				return
+			}
+
+			if portsSet.Contains(parsedPort) {
+				continue
+			}
+			portsSet.Add(parsedPort)
+			ports = append(ports, parsedPort)
+			portsCount += count
+		}
+
+		if portsCount > 15 {
+			errData = &errortypes.ErrorData{
+				Error:   fmt.Sprintf("invalid_%s_rule_port", direction),
+				Message: fmt.Sprintf("Too many %s rule ports", direction),
+			}
+			return
 		}
+
+		r.Port = strings.Join(ports, ",")
+
 		break
 	default:
+		errData = &errortypes.ErrorData{
+			Error:   fmt.Sprintf("invalid_%s_rule_protocol", direction),
+			Message: fmt.Sprintf("Invalid %s rule protocol", direction),
+		}
+		return
+	}
+
+	switch r.ConnState {
+	case StateNew, StateAny:
 		break
+	case "":
+		r.ConnState = r.GetConnState()
+		break
+	default:
+		errData = &errortypes.ErrorData{
+			Error: fmt.Sprintf("invalid_%s_rule_conn_state", direction),
+			Message: fmt.Sprintf("Invalid %s rule connection state",
+				direction),
+		}
+		return
+	}
+
+	ips := r.SourceIps
+	ipName := "source"
+	ipLabel := "source"
+	if direction == Egress {
+		ips = r.DestIps
+		ipName = "dest"
+		ipLabel = "destination"
+	}
+
+	for i, ip := range ips {
+		if ip == "" {
+			errData = &errortypes.ErrorData{
+				Error: fmt.Sprintf("invalid_%s_rule_%s_ip",
+					direction, ipName),
+				Message: fmt.Sprintf("Empty %s rule %s IP",
+					direction, ipLabel),
+			}
+			return
+		}
+
+		if !strings.Contains(ip, "/") {
+			if strings.Contains(ip, ":") {
+				ip += "/128"
+			} else {
+				ip += "/32"
+			}
+		}
+
+		_, cidr, e := net.ParseCIDR(ip)
+		if e != nil {
+			errData = &errortypes.ErrorData{
+				Error: fmt.Sprintf("invalid_%s_rule_%s_ip",
+					direction, ipName),
+				Message: fmt.Sprintf("Invalid %s rule %s IP",
+					direction, ipLabel),
+			}
+			return
+		}
+
+		ips[i] = cidr.String()
+	}
+
+	roles := []string{}
+	rolesSet := set.NewSet()
+	for _, role := range r.NetworkRoles {
+		role = strings.TrimSpace(role)
+		if role == "" || rolesSet.Contains(role) {
+			continue
+		}
+		rolesSet.Add(role)
+		roles = append(roles, role)
+	}
+	r.NetworkRoles = roles
+
+	fireIds := []primitive.ObjectID{}
+	fireIdsSet := set.NewSet()
+	for _, fireId := range r.Firewalls {
+		if fireId.IsZero() || fireIdsSet.Contains(fireId) {
+			continue
+		}
+		fireIdsSet.Add(fireId)
+		fireIds = append(fireIds, fireId)
 	}
+	r.Firewalls = fireIds
 
 	return
 }
@@ -64,6 +331,8 @@ type Firewall struct {
 	Organization primitive.ObjectID `bson:"organization,omitempty" json:"organization"`
 	NetworkRoles []string           `bson:"network_roles" json:"network_roles"`
 	Ingress      []*Rule            `bson:"ingress" json:"ingress"`
+	Egress       []*Rule            `bson:"egress" json:"egress"`
+	LogDropped   bool               `bson:"log_dropped" json:"log_dropped"`
 }
 
 func (f *Firewall) Validate(db *database.Database) (
@@ -77,94 +346,103 @@ func (f *Firewall) Validate(db *database.Database) (
 		f.Ingress = []*Rule{}
 	}
 
-	for _, rule := range f.Ingress {
-		switch rule.Protocol {
-		case All:
-			rule.Port = ""
-			break
-		case Icmp:
-			rule.Port = ""
-			break
-		case Tcp, Udp:
-			ports := strings.Split(rule.Port, "-")
-
-			portInt, e := strconv.Atoi(ports[0])
-			if e != nil {
-				errData = &errortypes.ErrorData{
-					Error:   "invalid_ingress_rule_port",
-					Message: "Invalid ingress rule port",
-				}
-				return
-			}
+	if f.Egress == nil {
+		f.Egress = []*Rule{}
+	}
 
-			if portInt < 1 || portInt > 65535 {
-				errData = &errortypes.ErrorData{
-					Error:   "invalid_ingress_rule_port",
-					Message: "Invalid ingress rule port",
-				}
-				return
-			}
+	if f.Organization.IsZero() && len(f.Egress) > 0 {
+		errData = &errortypes.ErrorData{
+			Error:   "egress_unsupported",
+			Message: "Egress rules are not supported on node firewalls",
+		}
+		return
+	}
 
-			parsedPort := strconv.Itoa(portInt)
-			if len(ports) > 1 {
-				portInt2, e := strconv.Atoi(ports[1])
-				if e != nil {
-					errData = &errortypes.ErrorData{
-						Error:   "invalid_ingress_rule_port",
-						Message: "Invalid ingress rule port",
-					}
-					return
-				}
+	hasRefs := false
+	refIds := set.NewSet()
 
-				if portInt < 1 || portInt > 65535 || portInt2 <= portInt {
-					errData = &errortypes.ErrorData{
-						Error:   "invalid_ingress_rule_port",
-						Message: "Invalid ingress rule port",
-					}
-					return
-				}
+	for _, rule := range f.Ingress {
+		rule.DestIps = []string{}
+		if rule.SourceIps == nil {
+			rule.SourceIps = []string{}
+		}
+		if rule.Firewalls == nil {
+			rule.Firewalls = []primitive.ObjectID{}
+		}
+		if rule.NetworkRoles == nil {
+			rule.NetworkRoles = []string{}
+		}
 
-				parsedPort += "-" + strconv.Itoa(portInt2)
-			}
+		errData = rule.validate(Ingress)
+		if errData != nil {
+			return
+		}
 
-			rule.Port = parsedPort
+		if rule.HasReferences() {
+			hasRefs = true
+		}
+		for _, fireId := range rule.Firewalls {
+			refIds.Add(fireId)
+		}
+	}
 
-			break
-		default:
-			errData = &errortypes.ErrorData{
-				Error:   "invalid_ingress_rule_protocol",
-				Message: "Invalid ingress rule protocol",
-			}
+	for _, rule := range f.Egress {
+		rule.SourceIps = []string{}
+		if rule.DestIps == nil {
+			rule.DestIps = []string{}
+		}
+		if rule.Firewalls == nil {
+			rule.Firewalls = []primitive.ObjectID{}
+		}
+		if rule.NetworkRoles == nil {
+			rule.NetworkRoles = []string{}
+		}
+
+		errData = rule.validate(Egress)
+		if errData != nil {
 			return
 		}
 
-		for i, sourceIp := range rule.SourceIps {
-			if sourceIp == "" {
-				errData = &errortypes.ErrorData{
-					Error:   "invalid_ingress_rule_source_ip",
-					Message: "Empty ingress rule source IP",
-				}
-				return
-			}
+		if rule.HasReferences() {
+			hasRefs = true
+		}
+		for _, fireId := range rule.Firewalls {
+			refIds.Add(fireId)
+		}
+	}
 
-			if !strings.Contains(sourceIp, "/") {
-				if strings.Contains(sourceIp, ":") {
-					sourceIp += "/128"
-				} else {
-					sourceIp += "/32"
-				}
-			}
+	if hasRefs && f.Organization.IsZero() {
+		errData = &errortypes.ErrorData{
+			Error:   "invalid_rule_reference",
+			Message: "Firewall references require an organization",
+		}
+		return
+	}
 
-			_, sourceCidr, e := net.ParseCIDR(sourceIp)
-			if e != nil {
-				errData = &errortypes.ErrorData{
-					Error:   "invalid_ingress_rule_source_ip",
-					Message: "Invalid ingress rule source IP",
-				}
-				return
-			}
+	if refIds.Len() > 0 {
+		fireIds := []primitive.ObjectID{}
+		for fireIdInf := range refIds.Iter() {
+			fireIds = append(fireIds, fireIdInf.(primitive.ObjectID))
+		}
+
+		coll := db.Firewalls()
+		count, e := coll.CountDocuments(db, &bson.M{
+			"_id": &bson.M{
+				"$in": fireIds,
+			},
+			"organization": f.Organization,
+		})
+		if e != nil {
+			err = database.ParseError(e)
+			return
+		}
 
-			rule.SourceIps[i] = sourceCidr.String()
+		if count != int64(len(fireIds)) {
+			errData = &errortypes.ErrorData{
+				Error:   "invalid_rule_reference",
+				Message: "Referenced firewall does not exist",
+			}
+			return
 		}
 	}
 
@@ -0,0 +1,40 @@
+package firewall
+
+type icmpType struct {
+	Type  int
+	Type6 int
+}
+
+// Named types are shared between ICMP and ICMPv6, types without an
+// equivalent in one family are set to -1
+var icmpTypes = map[string]*icmpType{
+	"echo-reply":              {0, 129},
+	"destination-unreachable": {3, 1},
+	"redirect":                {5, 137},
+	"echo-request":            {8, 128},
+	"router-advertisement":    {9, 134},
+	"router-solicitation":     {10, 133},
+	"time-exceeded":           {11, 3},
+	"parameter-problem":       {12, 4},
+	"timestamp-request":       {13, -1},
+	"timestamp-reply":         {14, -1},
+	"packet-too-big":          {-1, 2},
+	"neighbor-solicitation":   {-1, 135},
+	"neighbor-advertisement":  {-1, 136},
+}
+
+func GetIcmpType(name string, ipv6 bool) (typ int, ok bool) {
+	icmpTyp := icmpTypes[name]
+	if icmpTyp == nil {
+		return
+	}
+
+	if ipv6 {
+		typ = icmpTyp.Type6
+	} else {
+		typ = icmpTyp.Type
+	}
+
+	ok = typ != -1
+	return
+}
@@ -0,0 +1,89 @@
+package firewall
+
+import (
+	"time"
+
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/mongo-go-driver/mongo/options"
+	"github.com/pritunl/pritunl-cloud/database"
+)
+
+type LogEntry struct {
+	Id           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Instance     primitive.ObjectID `bson:"instance" json:"instance"`
+	Organization primitive.ObjectID `bson:"organization" json:"organization"`
+	Node         primitive.ObjectID `bson:"node" json:"node"`
+	Direction    string             `bson:"direction" json:"direction"`
+	Action       string             `bson:"action" json:"action"`
+	Protocol     string             `bson:"protocol" json:"protocol"`
+	Source       string             `bson:"source" json:"source"`
+	Destination  string             `bson:"destination" json:"destination"`
+	Summary      string             `bson:"summary" json:"summary"`
+	Timestamp    time.Time          `bson:"timestamp" json:"timestamp"`
+}
+
+func InsertLogs(db *database.Database, entries []*LogEntry) (err error) {
+	coll := db.FirewallLogs()
+
+	if len(entries) == 0 {
+		return
+	}
+
+	docs := []interface{}{}
+	for _, entry := range entries {
+		docs = append(docs, entry)
+	}
+
+	_, err = coll.InsertMany(db, docs)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func GetLogs(db *database.Database, instId primitive.ObjectID,
+	limit int64) (entries []*LogEntry, err error) {
+
+	coll := db.FirewallLogs()
+	entries = []*LogEntry{}
+
+	cursor, err := coll.Find(
+		db,
+		&bson.M{
+			"instance": instId,
+		},
+		&options.FindOptions{
+			Sort: &bson.D{
+				{"timestamp", -1},
+			},
+			Limit: &limit,
+		},
+	)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		entry := &LogEntry{}
+		err = cursor.Decode(entry)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
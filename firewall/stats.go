@@ -0,0 +1,229 @@
+package firewall
+
+import (
+	"time"
+
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/mongo-go-driver/mongo/options"
+	"github.com/pritunl/pritunl-cloud/database"
+)
+
+type RuleStats struct {
+	Direction string `bson:"direction" json:"direction"`
+	Action    string `bson:"action" json:"action"`
+	Protocol  string `bson:"protocol" json:"protocol"`
+	Port      string `bson:"port" json:"port"`
+	Packets   int64  `bson:"packets" json:"packets"`
+	Bytes     int64  `bson:"bytes" json:"bytes"`
+}
+
+func (r *RuleStats) Key() string {
+	return r.Direction + "-" + r.Action + "-" + r.Protocol + "-" + r.Port
+}
+
+type Stats struct {
+	Id           primitive.ObjectID `bson:"_id" json:"id"`
+	Organization primitive.ObjectID `bson:"organization" json:"organization"`
+	Node         primitive.ObjectID `bson:"node" json:"node"`
+	Timestamp    time.Time          `bson:"timestamp" json:"timestamp"`
+	Rules        []*RuleStats       `bson:"rules" json:"rules"`
+}
+
+func (s *Stats) Commit(db *database.Database) (err error) {
+	coll := db.FirewallStats()
+
+	opts := &options.UpdateOptions{}
+	opts.SetUpsert(true)
+
+	_, err = coll.UpdateOne(db, &bson.M{
+		"_id": s.Id,
+	}, &bson.M{
+		"$set": s,
+	}, opts)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+// Counters are instance totals for the protocol and port of each rule
+// summed across the instances using the firewall. Rules of all firewalls
+// on an instance are merged, traffic matching a rule that is shared with
+// another firewall is included in the totals of both firewalls.
+type StatsSummary struct {
+	Id        primitive.ObjectID `json:"id"`
+	Timestamp time.Time          `json:"timestamp"`
+	Instances int                `json:"instances"`
+	Ingress   []*RuleStats       `json:"ingress"`
+	Egress    []*RuleStats       `json:"egress"`
+	Dropped   []*RuleStats       `json:"dropped"`
+}
+
+func GetStats(db *database.Database, instIds []primitive.ObjectID) (
+	stats []*Stats, err error) {
+
+	coll := db.FirewallStats()
+	stats = []*Stats{}
+
+	if len(instIds) == 0 {
+		return
+	}
+
+	cursor, err := coll.Find(db, &bson.M{
+		"_id": &bson.M{
+			"$in": instIds,
+		},
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		stat := &Stats{}
+		err = cursor.Decode(stat)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		stats = append(stats, stat)
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func (f *Firewall) GetInstanceStats(db *database.Database) (
+	summary *StatsSummary, err error) {
+
+	summary = &StatsSummary{
+		Id:      f.Id,
+		Ingress: []*RuleStats{},
+		Egress:  []*RuleStats{},
+		Dropped: []*RuleStats{},
+	}
+
+	if f.Organization.IsZero() || len(f.NetworkRoles) == 0 {
+		return
+	}
+
+	coll := db.Instances()
+	instIds := []primitive.ObjectID{}
+
+	cursor, err := coll.Find(
+		db,
+		&bson.M{
+			"organization": f.Organization,
+			"network_roles": &bson.M{
+				"$in": f.NetworkRoles,
+			},
+		},
+		&options.FindOptions{
+			Projection: &bson.D{
+				{"_id", 1},
+			},
+		},
+	)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		item := &struct {
+			Id primitive.ObjectID `bson:"_id"`
+		}{}
+		err = cursor.Decode(item)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		instIds = append(instIds, item.Id)
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	stats, err := GetStats(db, instIds)
+	if err != nil {
+		return
+	}
+
+	counters := map[string]*RuleStats{}
+	for _, stat := range stats {
+		summary.Instances += 1
+		if stat.Timestamp.After(summary.Timestamp) {
+			summary.Timestamp = stat.Timestamp
+		}
+
+		for _, ruleStat := range stat.Rules {
+			key := ruleStat.Key()
+			counter := counters[key]
+			if counter == nil {
+				counter = &RuleStats{
+					Direction: ruleStat.Direction,
+					Action:    ruleStat.Action,
+					Protocol:  ruleStat.Protocol,
+					Port:      ruleStat.Port,
+				}
+				counters[key] = counter
+			}
+
+			counter.Packets += ruleStat.Packets
+			counter.Bytes += ruleStat.Bytes
+		}
+	}
+
+	getCounter := func(direction, action, protocol,
+		port string) (counter *RuleStats) {
+
+		counter = &RuleStats{
+			Direction: direction,
+			Action:    action,
+			Protocol:  protocol,
+			Port:      port,
+		}
+
+		cur := counters[counter.Key()]
+		if cur != nil {
+			counter.Packets = cur.Packets
+			counter.Bytes = cur.Bytes
+		}
+
+		return
+	}
+
+	for _, rule := range f.Ingress {
+		summary.Ingress = append(summary.Ingress,
+			getCounter(Ingress, Accept, rule.Protocol, rule.Port))
+	}
+
+	for _, rule := range f.Egress {
+		summary.Egress = append(summary.Egress,
+			getCounter(Egress, Accept, rule.Protocol, rule.Port))
+	}
+
+	summary.Dropped = append(summary.Dropped,
+		getCounter(Ingress, Drop, All, ""))
+	if len(f.Egress) > 0 {
+		summary.Dropped = append(summary.Dropped,
+			getCounter(Egress, Drop, All, ""))
+	}
+
+	return
+}
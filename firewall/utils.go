@@ -1,8 +1,8 @@
 package firewall
 
 import (
-	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/dropbox/godropbox/container/set"
 	"github.com/dropbox/godropbox/errors"
@@ -355,37 +355,81 @@ func RemoveMultiOrg(db *database.Database, orgId primitive.ObjectID,
 	return
 }
 
-func MergeIngress(fires []*Firewall) (rules []*Rule) {
+func mergeRules(fires []*Firewall, egress bool) (rules []*Rule) {
 	rules = []*Rule{}
 	rulesMap := map[string]*Rule{}
+	rulesIps := map[string]set.Set{}
+	rulesFires := map[string]set.Set{}
+	rulesRoles := map[string]set.Set{}
 	rulesKey := []string{}
 
 	for _, fire := range fires {
-		for _, ingress := range fire.Ingress {
-			key := fmt.Sprintf("%s-%s", ingress.Protocol, ingress.Port)
+		fireRules := fire.Ingress
+		if egress {
+			fireRules = fire.Egress
+		}
+
+		for _, fireRule := range fireRules {
+			key := fireRule.Key()
 			rule := rulesMap[key]
 			if rule == nil {
 				rule = &Rule{
-					Protocol:  ingress.Protocol,
-					Port:      ingress.Port,
-					SourceIps: ingress.SourceIps,
+					Protocol:     fireRule.Protocol,
+					Port:         fireRule.Port,
+					IcmpTypes:    fireRule.IcmpTypes,
+					ConnState:    fireRule.GetConnState(),
+					SourceIps:    []string{},
+					DestIps:      []string{},
+					Firewalls:    []primitive.ObjectID{},
+					NetworkRoles: []string{},
 				}
 				rulesMap[key] = rule
+				rulesIps[key] = set.NewSet()
+				rulesFires[key] = set.NewSet()
+				rulesRoles[key] = set.NewSet()
 				rulesKey = append(rulesKey, key)
-			} else {
-				sourceIps := set.NewSet()
-				for _, sourceIp := range rule.SourceIps {
-					sourceIps.Add(sourceIp)
-				}
+			}
+
+			if fireRule.Log {
+				rule.Log = true
+			}
 
-				for _, sourceIp := range ingress.SourceIps {
-					if sourceIps.Contains(sourceIp) {
+			ips := rulesIps[key]
+			if egress {
+				for _, destIp := range fireRule.DestIps {
+					if ips.Contains(destIp) {
 						continue
 					}
-					sourceIps.Add(sourceIp)
+					ips.Add(destIp)
+					rule.DestIps = append(rule.DestIps, destIp)
+				}
+			} else {
+				for _, sourceIp := range fireRule.SourceIps {
+					if ips.Contains(sourceIp) {
+						continue
+					}
+					ips.Add(sourceIp)
 					rule.SourceIps = append(rule.SourceIps, sourceIp)
 				}
 			}
+
+			fireIds := rulesFires[key]
+			for _, fireId := range fireRule.Firewalls {
+				if fireIds.Contains(fireId) {
+					continue
+				}
+				fireIds.Add(fireId)
+				rule.Firewalls = append(rule.Firewalls, fireId)
+			}
+
+			roles := rulesRoles[key]
+			for _, role := range fireRule.NetworkRoles {
+				if roles.Contains(role) {
+					continue
+				}
+				roles.Add(role)
+				rule.NetworkRoles = append(rule.NetworkRoles, role)
+			}
 		}
 	}
 
@@ -397,9 +441,228 @@ func MergeIngress(fires []*Firewall) (rules []*Rule) {
 	return
 }
 
-func GetAllIngress(db *database.Database, nodeSelf *node.Node,
+func MergeIngress(fires []*Firewall) (rules []*Rule) {
+	rules = mergeRules(fires, false)
+	return
+}
+
+func MergeEgress(fires []*Firewall) (rules []*Rule) {
+	rules = mergeRules(fires, true)
+	return
+}
+
+type memberResolver struct {
+	db      *database.Database
+	fires   map[primitive.ObjectID]*Firewall
+	members map[string][]string
+}
+
+func (m *memberResolver) getFirewall(orgId, fireId primitive.ObjectID) (
+	fire *Firewall, err error) {
+
+	fire, ok := m.fires[fireId]
+	if ok {
+		return
+	}
+
+	fire, err = GetOrg(m.db, orgId, fireId)
+	if err != nil {
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+			fire = nil
+		} else {
+			return
+		}
+	}
+
+	m.fires[fireId] = fire
+
+	return
+}
+
+// Returns the addresses of the instance adapters with a matching role,
+// private addresses are stored in the order of the adapter index
+func getInstanceMembers(inst *instance.Instance, roles set.Set) (
+	members []string) {
+
+	members = []string{}
+
+	count := len(inst.PrivateIps)
+	if len(inst.PrivateIps6) > count {
+		count = len(inst.PrivateIps6)
+	}
+
+	for i := 0; i < count; i++ {
+		matched := false
+		for _, role := range inst.GetNetworkRoles(i) {
+			if roles.Contains(role) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		if i < len(inst.PrivateIps) && inst.PrivateIps[i] != "" {
+			members = append(members, inst.PrivateIps[i]+"/32")
+		}
+		if i < len(inst.PrivateIps6) && inst.PrivateIps6[i] != "" {
+			members = append(members, inst.PrivateIps6[i]+"/128")
+		}
+	}
+
+	return
+}
+
+func (m *memberResolver) getMembers(orgId primitive.ObjectID,
+	roles []string) (members []string, err error) {
+
+	sort.Strings(roles)
+	key := orgId.Hex() + ":" + strings.Join(roles, ",")
+
+	members, ok := m.members[key]
+	if ok {
+		return
+	}
+
+	members = []string{}
+	rolesSet := set.NewSet()
+	for _, role := range roles {
+		rolesSet.Add(role)
+	}
+	coll := m.db.Instances()
+
+	cursor, err := coll.Find(
+		m.db,
+		&bson.M{
+			"organization": orgId,
+			"$or": []*bson.M{
+				&bson.M{
+					"network_roles": &bson.M{
+						"$in": roles,
+					},
+				},
+				&bson.M{
+					"network_adapters.network_roles": &bson.M{
+						"$in": roles,
+					},
+				},
+			},
+		},
+		&options.FindOptions{
+			Projection: &bson.D{
+				{"network_roles", 1},
+				{"network_adapters", 1},
+				{"private_ips", 1},
+				{"private_ips6", 1},
+			},
+		},
+	)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(m.db)
+
+	for cursor.Next(m.db) {
+		inst := &instance.Instance{}
+		err = cursor.Decode(inst)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		members = append(members, getInstanceMembers(inst, rolesSet)...)
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	m.members[key] = members
+
+	return
+}
+
+func (m *memberResolver) Resolve(orgId primitive.ObjectID,
+	rules []*Rule, egress bool) (err error) {
+
+	for _, rule := range rules {
+		if !rule.HasReferences() {
+			continue
+		}
+
+		rolesSet := set.NewSet()
+		for _, role := range rule.NetworkRoles {
+			rolesSet.Add(role)
+		}
+
+		for _, fireId := range rule.Firewalls {
+			fire, e := m.getFirewall(orgId, fireId)
+			if e != nil {
+				err = e
+				return
+			}
+
+			if fire == nil {
+				continue
+			}
+
+			for _, role := range fire.NetworkRoles {
+				rolesSet.Add(role)
+			}
+		}
+
+		if rolesSet.Len() == 0 {
+			continue
+		}
+
+		roles := []string{}
+		for roleInf := range rolesSet.Iter() {
+			roles = append(roles, roleInf.(string))
+		}
+
+		members, e := m.getMembers(orgId, roles)
+		if e != nil {
+			err = e
+			return
+		}
+
+		ips := rule.SourceIps
+		if egress {
+			ips = rule.DestIps
+		}
+
+		ipsSet := set.NewSet()
+		for _, ip := range ips {
+			ipsSet.Add(ip)
+		}
+
+		for _, member := range members {
+			if ipsSet.Contains(member) {
+				continue
+			}
+			ipsSet.Add(member)
+			ips = append(ips, member)
+		}
+
+		if egress {
+			rule.DestIps = ips
+		} else {
+			rule.SourceIps = ips
+		}
+	}
+
+	return
+}
+
+func GetAllRules(db *database.Database, nodeSelf *node.Node,
 	instances []*instance.Instance) (nodeFirewall []*Rule,
-	firewalls map[string][]*Rule, err error) {
+	firewalls map[string][]*Rule, firewallsEgress map[string][]*Rule,
+	logDropped set.Set, err error) {
 
 	if nodeSelf.Firewall {
 		fires, e := GetRoles(db, nodeSelf.NetworkRoles)
@@ -412,7 +675,15 @@ func GetAllIngress(db *database.Database, nodeSelf *node.Node,
 		nodeFirewall = ingress
 	}
 
+	resolver := &memberResolver{
+		db:      db,
+		fires:   map[primitive.ObjectID]*Firewall{},
+		members: map[string][]string{},
+	}
+
 	firewalls = map[string][]*Rule{}
+	firewallsEgress = map[string][]*Rule{}
+	logDropped = set.NewSet()
 	for _, inst := range instances {
 		if !inst.IsActive() {
 			continue
@@ -422,7 +693,7 @@ func GetAllIngress(db *database.Database, nodeSelf *node.Node,
 			namespace := vm.GetNamespace(inst.Id, i)
 
 			fires, e := GetOrgRoles(db,
-				inst.Organization, inst.NetworkRoles)
+				inst.Organization, inst.GetNetworkRoles(i))
 			if e != nil {
 				err = e
 				return
@@ -443,7 +714,25 @@ func GetAllIngress(db *database.Database, nodeSelf *node.Node,
 			}
 
 			ingress := MergeIngress(fires)
+			err = resolver.Resolve(inst.Organization, ingress, false)
+			if err != nil {
+				return
+			}
 			firewalls[namespace] = ingress
+
+			egress := MergeEgress(fires)
+			err = resolver.Resolve(inst.Organization, egress, true)
+			if err != nil {
+				return
+			}
+			firewallsEgress[namespace] = egress
+
+			for _, fire := range fires {
+				if fire.LogDropped {
+					logDropped.Add(namespace)
+					break
+				}
+			}
 		}
 	}
 
@@ -0,0 +1,40 @@
+package firewall
+
+import (
+	"testing"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/pritunl/pritunl-cloud/instance"
+)
+
+func TestGetInstanceMembersSecondaryAdapter(t *testing.T) {
+	inst := &instance.Instance{
+		NetworkRoles: []string{"web"},
+		NetworkAdapters: []*instance.NetworkAdapter{
+			&instance.NetworkAdapter{
+				NetworkRoles: []string{"db"},
+			},
+		},
+		PrivateIps:  []string{"10.0.0.2", "10.1.0.2"},
+		PrivateIps6: []string{"fd00::2", "fd01::2"},
+	}
+
+	members := getInstanceMembers(inst, set.NewSet("db"))
+	if len(members) != 2 || members[0] != "10.1.0.2/32" ||
+		members[1] != "fd01::2/128" {
+
+		t.Errorf("Bad secondary adapter members %v", members)
+	}
+
+	members = getInstanceMembers(inst, set.NewSet("web"))
+	if len(members) != 2 || members[0] != "10.0.0.2/32" ||
+		members[1] != "fd00::2/128" {
+
+		t.Errorf("Bad primary adapter members %v", members)
+	}
+
+	members = getInstanceMembers(inst, set.NewSet("other"))
+	if len(members) != 0 {
+		t.Errorf("Unexpected members %v", members)
+	}
+}
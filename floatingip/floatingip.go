@@ -0,0 +1,218 @@
+package floatingip
+
+import (
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/block"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/instance"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/zone"
+)
+
+type FloatingIp struct {
+	Id           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name         string             `bson:"name" json:"name"`
+	Comment      string             `bson:"comment" json:"comment"`
+	Organization primitive.ObjectID `bson:"organization" json:"organization"`
+	Datacenter   primitive.ObjectID `bson:"datacenter" json:"datacenter"`
+	Block        primitive.ObjectID `bson:"block" json:"block"`
+	Address      string             `bson:"address" json:"address"`
+	Instance     primitive.ObjectID `bson:"instance,omitempty" json:"instance"`
+}
+
+func (f *FloatingIp) Validate(db *database.Database) (
+	errData *errortypes.ErrorData, err error) {
+
+	if f.Organization.IsZero() {
+		errData = &errortypes.ErrorData{
+			Error:   "organization_required",
+			Message: "Missing required organization",
+		}
+		return
+	}
+
+	if f.Datacenter.IsZero() {
+		errData = &errortypes.ErrorData{
+			Error:   "datacenter_required",
+			Message: "Missing required datacenter",
+		}
+		return
+	}
+
+	if f.Block.IsZero() {
+		errData = &errortypes.ErrorData{
+			Error:   "block_required",
+			Message: "Missing required block",
+		}
+		return
+	}
+
+	blck, err := block.Get(db, f.Block)
+	if err != nil {
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+			errData = &errortypes.ErrorData{
+				Error:   "block_invalid",
+				Message: "Block invalid",
+			}
+		}
+		return
+	}
+
+	if blck.Type == block.IPv6 {
+		errData = &errortypes.ErrorData{
+			Error:   "block_invalid",
+			Message: "Floating IP block must be IPv4",
+		}
+		return
+	}
+
+	if f.Instance.IsZero() {
+		return
+	}
+
+	inst, err := instance.GetOrg(db, f.Organization, f.Instance)
+	if err != nil {
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+			errData = &errortypes.ErrorData{
+				Error:   "instance_invalid",
+				Message: "Instance invalid",
+			}
+		}
+		return
+	}
+
+	if inst.NoPublicAddress {
+		errData = &errortypes.ErrorData{
+			Error:   "instance_no_public_address",
+			Message: "Instance public address is disabled",
+		}
+		return
+	}
+
+	zne, err := zone.Get(db, inst.Zone)
+	if err != nil {
+		return
+	}
+
+	if zne.Datacenter != f.Datacenter {
+		errData = &errortypes.ErrorData{
+			Error:   "instance_invalid",
+			Message: "Instance must be in floating IP datacenter",
+		}
+		return
+	}
+
+	nde, err := node.Get(db, inst.Node)
+	if err != nil {
+		return
+	}
+
+	if nde.NetworkMode != node.Static {
+		errData = &errortypes.ErrorData{
+			Error:   "instance_network_mode_invalid",
+			Message: "Instance node must use static network mode",
+		}
+		return
+	}
+
+	exists, err := ExistsInstance(db, f.Instance, f.Id)
+	if err != nil {
+		return
+	}
+
+	if exists {
+		errData = &errortypes.ErrorData{
+			Error:   "instance_floating_ip_exists",
+			Message: "Instance already has a floating IP",
+		}
+		return
+	}
+
+	return
+}
+
+// Reserves the block address, the address is held by the floating ip
+// rather than the instance and is kept when the instance is removed
+func (f *FloatingIp) Reserve(db *database.Database) (
+	errData *errortypes.ErrorData, err error) {
+
+	if f.Address != "" {
+		return
+	}
+
+	blck, err := block.Get(db, f.Block)
+	if err != nil {
+		return
+	}
+
+	ip, err := blck.GetIp(db, f.Id, block.Floating)
+	if err != nil {
+		if _, ok := err.(*block.BlockFull); ok {
+			err = nil
+			errData = &errortypes.ErrorData{
+				Error:   "block_full",
+				Message: "Block has no available addresses",
+			}
+		}
+		return
+	}
+
+	f.Address = ip.String()
+
+	err = f.CommitFields(db, set.NewSet("address"))
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (f *FloatingIp) Commit(db *database.Database) (err error) {
+	coll := db.FloatingIps()
+
+	err = coll.Commit(f.Id, f)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (f *FloatingIp) CommitFields(db *database.Database, fields set.Set) (
+	err error) {
+
+	coll := db.FloatingIps()
+
+	err = coll.CommitFields(f.Id, f, fields)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (f *FloatingIp) Insert(db *database.Database) (err error) {
+	coll := db.FloatingIps()
+
+	if !f.Id.IsZero() {
+		err = &errortypes.DatabaseError{
+			errors.New("floatingip: Floating IP already exists"),
+		}
+		return
+	}
+
+	f.Id = primitive.NewObjectID()
+
+	_, err = coll.InsertOne(db, f)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
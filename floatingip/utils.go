@@ -0,0 +1,313 @@
+package floatingip
+
+import (
+	"net"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/mongo-go-driver/mongo/options"
+	"github.com/pritunl/pritunl-cloud/block"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/utils"
+)
+
+func Get(db *database.Database, fipId primitive.ObjectID) (
+	fip *FloatingIp, err error) {
+
+	coll := db.FloatingIps()
+	fip = &FloatingIp{}
+
+	err = coll.FindOneId(fipId, fip)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func GetOrg(db *database.Database, orgId, fipId primitive.ObjectID) (
+	fip *FloatingIp, err error) {
+
+	coll := db.FloatingIps()
+	fip = &FloatingIp{}
+
+	err = coll.FindOne(db, &bson.M{
+		"_id":          fipId,
+		"organization": orgId,
+	}).Decode(fip)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func GetInstance(db *database.Database, instId primitive.ObjectID) (
+	fip *FloatingIp, err error) {
+
+	coll := db.FloatingIps()
+	fip = &FloatingIp{}
+
+	err = coll.FindOne(db, &bson.M{
+		"instance": instId,
+	}).Decode(fip)
+	if err != nil {
+		err = database.ParseError(err)
+		fip = nil
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+		}
+		return
+	}
+
+	return
+}
+
+func GetAll(db *database.Database, query *bson.M) (
+	fips []*FloatingIp, err error) {
+
+	coll := db.FloatingIps()
+	fips = []*FloatingIp{}
+
+	cursor, err := coll.Find(db, query)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		fip := &FloatingIp{}
+		err = cursor.Decode(fip)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		fips = append(fips, fip)
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func GetAllPaged(db *database.Database, query *bson.M,
+	page, pageCount int64) (fips []*FloatingIp, count int64, err error) {
+
+	coll := db.FloatingIps()
+	fips = []*FloatingIp{}
+
+	count, err = coll.CountDocuments(db, query)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	page = utils.Min64(page, count/pageCount)
+	skip := utils.Min64(page*pageCount, count)
+
+	cursor, err := coll.Find(
+		db,
+		query,
+		&options.FindOptions{
+			Sort: &bson.D{
+				{"name", 1},
+			},
+			Skip:  &skip,
+			Limit: &pageCount,
+		},
+	)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		fip := &FloatingIp{}
+		err = cursor.Decode(fip)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		fips = append(fips, fip)
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func ExistsInstance(db *database.Database,
+	instId, excludeId primitive.ObjectID) (exists bool, err error) {
+
+	coll := db.FloatingIps()
+
+	query := bson.M{
+		"instance": instId,
+	}
+	if !excludeId.IsZero() {
+		query["_id"] = &bson.M{
+			"$ne": excludeId,
+		}
+	}
+
+	n, err := coll.CountDocuments(db, query)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	if n > 0 {
+		exists = true
+	}
+
+	return
+}
+
+// Returns the floating ip attached to the instance if the block is
+// available on the node, otherwise falls back to an instance block address
+func GetStaticAddr(db *database.Database, nde *node.Node,
+	instId primitive.ObjectID) (blck *block.Block, ip net.IP, iface string,
+	err error) {
+
+	fip, err := GetInstance(db, instId)
+	if err != nil {
+		return
+	}
+
+	if fip != nil && fip.Address != "" {
+		for _, blckAttch := range nde.Blocks {
+			if blckAttch.Block != fip.Block {
+				continue
+			}
+
+			blck, err = block.Get(db, fip.Block)
+			if err != nil {
+				return
+			}
+
+			ip = net.ParseIP(fip.Address)
+			if ip == nil {
+				err = &errortypes.ParseError{
+					errors.New("floatingip: Failed to parse address"),
+				}
+				return
+			}
+			iface = blckAttch.Interface
+
+			err = block.RemoveInstanceIpsType(db, instId, block.External)
+			if err != nil {
+				return
+			}
+
+			return
+		}
+	}
+
+	blck, ip, iface, err = nde.GetStaticAddr(db, instId)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func Remove(db *database.Database, fipId primitive.ObjectID) (err error) {
+	coll := db.FloatingIps()
+
+	err = block.RemoveInstanceIps(db, fipId)
+	if err != nil {
+		return
+	}
+
+	_, err = coll.DeleteOne(db, &bson.M{
+		"_id": fipId,
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+		default:
+			return
+		}
+	}
+
+	return
+}
+
+func RemoveOrg(db *database.Database, orgId, fipId primitive.ObjectID) (
+	err error) {
+
+	coll := db.FloatingIps()
+
+	_, err = GetOrg(db, orgId, fipId)
+	if err != nil {
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+		}
+		return
+	}
+
+	err = block.RemoveInstanceIps(db, fipId)
+	if err != nil {
+		return
+	}
+
+	_, err = coll.DeleteOne(db, &bson.M{
+		"_id":          fipId,
+		"organization": orgId,
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+		default:
+			return
+		}
+	}
+
+	return
+}
+
+func RemoveMulti(db *database.Database, fipIds []primitive.ObjectID) (
+	err error) {
+
+	for _, fipId := range fipIds {
+		err = Remove(db, fipId)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func RemoveMultiOrg(db *database.Database, orgId primitive.ObjectID,
+	fipIds []primitive.ObjectID) (err error) {
+
+	for _, fipId := range fipIds {
+		err = RemoveOrg(db, orgId, fipId)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
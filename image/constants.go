@@ -5,3 +5,27 @@ const (
 	Bios    = "bios"
 	Unknown = "unknown"
 )
+
+const (
+	Verified      = "verified"
+	VerifyFailed  = "verify_failed"
+	VerifySkipped = "verify_skipped"
+)
+
+const (
+	Active     = "active"
+	Deprecated = "deprecated"
+	Obsolete   = "obsolete"
+)
+
+const (
+	Linux   = "linux"
+	Windows = "windows"
+	Bsd     = "bsd"
+	Other   = "other"
+)
+
+const (
+	X86_64  = "x86_64"
+	Aarch64 = "aarch64"
+)
@@ -14,19 +14,36 @@ import (
 )
 
 type Image struct {
-	Id           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Disk         primitive.ObjectID `bson:"disk,omitempty" json:"disk"`
-	Name         string             `bson:"name" json:"name"`
-	Comment      string             `bson:"comment" json:"comment"`
-	Organization primitive.ObjectID `bson:"organization" json:"organization"`
-	Signed       bool               `bson:"signed" json:"signed"`
-	Type         string             `bson:"type" json:"type"`
-	Firmware     string             `bson:"firmware" json:"firmware"`
-	Storage      primitive.ObjectID `bson:"storage" json:"storage"`
-	Key          string             `bson:"key" json:"key"`
-	LastModified time.Time          `bson:"last_modified" json:"last_modified"`
-	StorageClass string             `bson:"storage_class" json:"storage_class"`
-	Etag         string             `bson:"etag" json:"etag"`
+	Id                   primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Disk                 primitive.ObjectID   `bson:"disk,omitempty" json:"disk"`
+	Name                 string               `bson:"name" json:"name"`
+	Comment              string               `bson:"comment" json:"comment"`
+	Organization         primitive.ObjectID   `bson:"organization" json:"organization"`
+	Signed               bool                 `bson:"signed" json:"signed"`
+	Type                 string               `bson:"type" json:"type"`
+	Firmware             string               `bson:"firmware" json:"firmware"`
+	Storage              primitive.ObjectID   `bson:"storage" json:"storage"`
+	Key                  string               `bson:"key" json:"key"`
+	LastModified         time.Time            `bson:"last_modified" json:"last_modified"`
+	StorageClass         string               `bson:"storage_class" json:"storage_class"`
+	Etag                 string               `bson:"etag" json:"etag"`
+	Encrypted            bool                 `bson:"encrypted" json:"encrypted"`
+	Checksum             string               `bson:"checksum" json:"checksum"`
+	VerifyState          string               `bson:"verify_state" json:"verify_state"`
+	LastVerified         time.Time            `bson:"last_verified" json:"last_verified"`
+	OsFamily             string               `bson:"os_family" json:"os_family"`
+	OsVersion            string               `bson:"os_version" json:"os_version"`
+	Architecture         string               `bson:"architecture" json:"architecture"`
+	MinDisk              int                  `bson:"min_disk" json:"min_disk"`
+	MinMemory            int                  `bson:"min_memory" json:"min_memory"`
+	DefaultUser          string               `bson:"default_user" json:"default_user"`
+	CloudInit            bool                 `bson:"cloud_init" json:"cloud_init"`
+	Tags                 []string             `bson:"tags" json:"tags"`
+	Lifecycle            string               `bson:"lifecycle" json:"lifecycle"`
+	Shares               []primitive.ObjectID `bson:"shares" json:"shares"`
+	PublishedDatacenters []primitive.ObjectID `bson:"published_datacenters" json:"published_datacenters"`
+	Version              int                  `bson:"version" json:"version"`
+	Prefetch             []primitive.ObjectID `bson:"prefetch" json:"prefetch"`
 }
 
 func (i *Image) Validate(db *database.Database) (
@@ -36,6 +53,98 @@ func (i *Image) Validate(db *database.Database) (
 		i.Firmware = Unknown
 	}
 
+	if i.Lifecycle == "" {
+		i.Lifecycle = Active
+	}
+
+	switch i.Lifecycle {
+	case Active, Deprecated, Obsolete:
+	default:
+		errData = &errortypes.ErrorData{
+			Error:   "image_lifecycle_invalid",
+			Message: "Image lifecycle is invalid",
+		}
+		return
+	}
+
+	switch i.OsFamily {
+	case "", Linux, Windows, Bsd, Other:
+	default:
+		errData = &errortypes.ErrorData{
+			Error:   "image_os_family_invalid",
+			Message: "Image OS family is invalid",
+		}
+		return
+	}
+
+	switch i.Architecture {
+	case "", X86_64, Aarch64:
+	default:
+		errData = &errortypes.ErrorData{
+			Error:   "image_architecture_invalid",
+			Message: "Image architecture is invalid",
+		}
+		return
+	}
+
+	if i.MinDisk < 0 || i.MinMemory < 0 {
+		errData = &errortypes.ErrorData{
+			Error:   "image_minimum_invalid",
+			Message: "Image minimum requirements are invalid",
+		}
+		return
+	}
+
+	if i.Tags == nil {
+		i.Tags = []string{}
+	}
+
+	if i.Shares == nil {
+		i.Shares = []primitive.ObjectID{}
+	}
+
+	if i.Prefetch == nil {
+		i.Prefetch = []primitive.ObjectID{}
+	}
+
+	if i.PublishedDatacenters == nil {
+		i.PublishedDatacenters = []primitive.ObjectID{}
+	}
+
+	if i.Organization.IsZero() && (len(i.Shares) > 0 ||
+		len(i.PublishedDatacenters) > 0) {
+
+		errData = &errortypes.ErrorData{
+			Error:   "image_share_invalid",
+			Message: "Cannot share image without organization",
+		}
+		return
+	}
+
+	shares := []primitive.ObjectID{}
+	sharesSet := set.NewSet()
+	for _, orgId := range i.Shares {
+		if orgId.IsZero() || orgId == i.Organization ||
+			sharesSet.Contains(orgId) {
+
+			continue
+		}
+		sharesSet.Add(orgId)
+		shares = append(shares, orgId)
+	}
+	i.Shares = shares
+
+	dcIds := []primitive.ObjectID{}
+	dcIdsSet := set.NewSet()
+	for _, dcId := range i.PublishedDatacenters {
+		if dcId.IsZero() || dcIdsSet.Contains(dcId) {
+			continue
+		}
+		dcIdsSet.Add(dcId)
+		dcIds = append(dcIds, dcId)
+	}
+	i.PublishedDatacenters = dcIds
+
 	return
 }
 
@@ -43,6 +152,54 @@ func (i *Image) Json() {
 	if i.Name == "" {
 		i.Name = i.Key
 	}
+	if i.Lifecycle == "" {
+		i.Lifecycle = Active
+	}
+	if i.Tags == nil {
+		i.Tags = []string{}
+	}
+	if i.Shares == nil {
+		i.Shares = []primitive.ObjectID{}
+	}
+	if i.PublishedDatacenters == nil {
+		i.PublishedDatacenters = []primitive.ObjectID{}
+	}
+	if i.Prefetch == nil {
+		i.Prefetch = []primitive.ObjectID{}
+	}
+}
+
+func (i *Image) CanAccess(orgId, dcId primitive.ObjectID) bool {
+	if i.Organization.IsZero() || i.Organization == orgId {
+		return true
+	}
+
+	for _, shareId := range i.Shares {
+		if shareId == orgId {
+			return true
+		}
+	}
+
+	for _, publishId := range i.PublishedDatacenters {
+		if publishId == dcId {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (i *Image) Restorable() bool {
+	return strings.HasPrefix(i.Key, "backup/") ||
+		strings.HasPrefix(i.Key, "snapshot/")
+}
+
+func (i *Image) Imported() bool {
+	return strings.HasPrefix(i.Key, "import/")
+}
+
+func (i *Image) Captured() bool {
+	return strings.HasPrefix(i.Key, "capture/")
 }
 
 func (i *Image) Commit(db *database.Database) (err error) {
@@ -105,6 +262,8 @@ func (i *Image) Upsert(db *database.Database) (err error) {
 				"last_modified": i.LastModified,
 				"storage_class": i.StorageClass,
 				"etag":          i.Etag,
+				"encrypted":     i.Encrypted,
+				"checksum":      i.Checksum,
 			},
 		},
 		opts,
@@ -120,9 +279,7 @@ func (i *Image) Upsert(db *database.Database) (err error) {
 func (i *Image) Sync(db *database.Database) (err error) {
 	coll := db.Images()
 
-	if strings.HasPrefix(i.Key, "backup/") ||
-		strings.HasPrefix(i.Key, "snapshot/") {
-
+	if i.Restorable() || i.Imported() || i.Captured() {
 		_, err = coll.UpdateOne(
 			db,
 			&bson.M{
@@ -135,7 +292,6 @@ func (i *Image) Sync(db *database.Database) (err error) {
 					"key":           i.Key,
 					"signed":        i.Signed,
 					"type":          i.Type,
-					"firmware":      i.Firmware,
 					"etag":          i.Etag,
 					"last_modified": i.LastModified,
 					"storage_class": i.StorageClass,
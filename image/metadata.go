@@ -0,0 +1,135 @@
+package image
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+)
+
+type Metadata struct {
+	OsFamily     string   `bson:"os_family" json:"os_family"`
+	OsVersion    string   `bson:"os_version" json:"os_version"`
+	Architecture string   `bson:"architecture" json:"architecture"`
+	MinDisk      int      `bson:"min_disk" json:"min_disk"`
+	MinMemory    int      `bson:"min_memory" json:"min_memory"`
+	DefaultUser  string   `bson:"default_user" json:"default_user"`
+	CloudInit    bool     `bson:"cloud_init" json:"cloud_init"`
+	Tags         []string `bson:"tags" json:"tags"`
+	Lifecycle    string   `bson:"lifecycle" json:"lifecycle"`
+}
+
+func GetManifestKey(key string) string {
+	return key + ".json"
+}
+
+func ParseManifest(data []byte) (meta *Metadata, err error) {
+	meta = &Metadata{}
+
+	err = json.Unmarshal(data, meta)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "image: Failed to parse image manifest"),
+		}
+		return
+	}
+
+	return
+}
+
+func ParseHeaders(header http.Header) (meta *Metadata) {
+	if header == nil {
+		return
+	}
+
+	get := func(name string) string {
+		return strings.TrimSpace(header.Get("X-Amz-Meta-" + name))
+	}
+
+	osFamily := get("Os-Family")
+	lifecycle := get("Lifecycle")
+	if osFamily == "" && lifecycle == "" && get("Min-Disk") == "" &&
+		get("Min-Memory") == "" {
+
+		return
+	}
+
+	meta = &Metadata{
+		OsFamily:     osFamily,
+		OsVersion:    get("Os-Version"),
+		Architecture: get("Architecture"),
+		DefaultUser:  get("Default-User"),
+		Lifecycle:    lifecycle,
+	}
+
+	meta.MinDisk, _ = strconv.Atoi(get("Min-Disk"))
+	meta.MinMemory, _ = strconv.Atoi(get("Min-Memory"))
+	meta.CloudInit, _ = strconv.ParseBool(get("Cloud-Init"))
+
+	tags := get("Tags")
+	if tags != "" {
+		for _, tag := range strings.Split(tags, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag != "" {
+				meta.Tags = append(meta.Tags, tag)
+			}
+		}
+	}
+
+	return
+}
+
+func (i *Image) SetMetadata(meta *Metadata) {
+	i.OsFamily = strings.ToLower(meta.OsFamily)
+	i.OsVersion = meta.OsVersion
+	i.Architecture = strings.ToLower(meta.Architecture)
+	i.MinDisk = meta.MinDisk
+	i.MinMemory = meta.MinMemory
+	i.DefaultUser = meta.DefaultUser
+	i.CloudInit = meta.CloudInit
+	i.Tags = meta.Tags
+	i.Lifecycle = strings.ToLower(meta.Lifecycle)
+}
+
+func (i *Image) SyncMetadata(db *database.Database) (
+	errData *errortypes.ErrorData, err error) {
+
+	coll := db.Images()
+
+	errData, err = i.Validate(db)
+	if err != nil || errData != nil {
+		return
+	}
+
+	_, err = coll.UpdateOne(
+		db,
+		&bson.M{
+			"storage": i.Storage,
+			"key":     i.Key,
+		},
+		&bson.M{
+			"$set": &bson.M{
+				"os_family":    i.OsFamily,
+				"os_version":   i.OsVersion,
+				"architecture": i.Architecture,
+				"min_disk":     i.MinDisk,
+				"min_memory":   i.MinMemory,
+				"default_user": i.DefaultUser,
+				"cloud_init":   i.CloudInit,
+				"tags":         i.Tags,
+				"lifecycle":    i.Lifecycle,
+			},
+		},
+	)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/pritunl/mongo-go-driver/bson/primitive"
 	"github.com/pritunl/mongo-go-driver/mongo/options"
 	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/datacenter"
 	"github.com/pritunl/pritunl-cloud/utils"
 )
 
@@ -62,25 +63,111 @@ func GetOrg(db *database.Database, orgId, imgId primitive.ObjectID) (
 	return
 }
 
+func OrgAccessQuery(orgId primitive.ObjectID,
+	dcIds []primitive.ObjectID) []*bson.M {
+
+	return []*bson.M{
+		&bson.M{
+			"organization": orgId,
+		},
+		&bson.M{
+			"organization": &bson.M{
+				"$exists": false,
+			},
+		},
+		&bson.M{
+			"shares": orgId,
+		},
+		&bson.M{
+			"published_datacenters": &bson.M{
+				"$in": dcIds,
+			},
+		},
+	}
+}
+
 func GetOrgPublic(db *database.Database, orgId, imgId primitive.ObjectID) (
 	img *Image, err error) {
 
+	dcIds, err := datacenter.DistinctOrg(db, orgId)
+	if err != nil {
+		return
+	}
+
 	coll := db.Images()
 	img = &Image{}
 
 	err = coll.FindOne(db, &bson.M{
 		"_id": imgId,
-		"$or": []*bson.M{
-			&bson.M{
-				"organization": orgId,
-			},
-			&bson.M{
-				"organization": &bson.M{
-					"$exists": false,
-				},
+		"$or": OrgAccessQuery(orgId, dcIds),
+	}).Decode(img)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func GetNextVersion(db *database.Database, orgId primitive.ObjectID,
+	name string) (version int, err error) {
+
+	coll := db.Images()
+	img := &Image{}
+
+	err = coll.FindOne(
+		db,
+		&bson.M{
+			"organization": orgId,
+			"name":         name,
+		},
+		&options.FindOneOptions{
+			Sort: &bson.D{
+				{"version", -1},
 			},
 		},
-	}).Decode(img)
+	).Decode(img)
+	if err != nil {
+		err = database.ParseError(err)
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+		} else {
+			return
+		}
+	}
+
+	version = img.Version + 1
+
+	return
+}
+
+func GetPrefetch(db *database.Database, zoneId primitive.ObjectID) (
+	imgs []*Image, err error) {
+
+	coll := db.Images()
+	imgs = []*Image{}
+
+	cursor, err := coll.Find(db, &bson.M{
+		"prefetch": zoneId,
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		img := &Image{}
+		err = cursor.Decode(img)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		imgs = append(imgs, img)
+	}
+
+	err = cursor.Err()
 	if err != nil {
 		err = database.ParseError(err)
 		return
@@ -115,20 +202,16 @@ func Distinct(db *database.Database, storeId primitive.ObjectID) (
 func ExistsOrg(db *database.Database, orgId, imgId primitive.ObjectID) (
 	exists bool, err error) {
 
+	dcIds, err := datacenter.DistinctOrg(db, orgId)
+	if err != nil {
+		return
+	}
+
 	coll := db.Images()
 
 	n, err := coll.CountDocuments(db, &bson.M{
 		"_id": imgId,
-		"$or": []*bson.M{
-			&bson.M{
-				"organization": orgId,
-			},
-			&bson.M{
-				"organization": &bson.M{
-					"$exists": false,
-				},
-			},
-		},
+		"$or": OrgAccessQuery(orgId, dcIds),
 	})
 	if err != nil {
 		err = database.ParseError(err)
@@ -208,6 +291,12 @@ func GetAllNames(db *database.Database, query *bson.M) (
 				{"name", 1},
 				{"key", 1},
 				{"firmware", 1},
+				{"os_family", 1},
+				{"min_disk", 1},
+				{"min_memory", 1},
+				{"default_user", 1},
+				{"lifecycle", 1},
+				{"version", 1},
 			},
 		},
 	)
@@ -237,6 +326,126 @@ func GetAllNames(db *database.Database, query *bson.M) (
 	return
 }
 
+func GetDiskBackups(db *database.Database, dskId primitive.ObjectID) (
+	imgs []*Image, err error) {
+
+	coll := db.Images()
+	imgs = []*Image{}
+
+	cursor, err := coll.Find(
+		db,
+		&bson.M{
+			"disk": dskId,
+			"key": &bson.M{
+				"$regex": "^backup/",
+			},
+		},
+		&options.FindOptions{
+			Sort: &bson.D{
+				{"last_modified", -1},
+			},
+		},
+	)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		img := &Image{}
+		err = cursor.Decode(img)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		imgs = append(imgs, img)
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func GetVerifySample(db *database.Database, count int64) (
+	imgs []*Image, err error) {
+
+	coll := db.Images()
+	imgs = []*Image{}
+
+	cursor, err := coll.Find(
+		db,
+		&bson.M{
+			"key": &bson.M{
+				"$regex": "^backup/",
+			},
+			"checksum": &bson.M{
+				"$nin": []interface{}{"", nil},
+			},
+		},
+		&options.FindOptions{
+			Sort: &bson.D{
+				{"last_verified", 1},
+			},
+			Limit: &count,
+		},
+	)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		img := &Image{}
+		err = cursor.Decode(img)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		imgs = append(imgs, img)
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func DistinctDisks(db *database.Database) (
+	dskIds []primitive.ObjectID, err error) {
+
+	coll := db.Images()
+	dskIds = []primitive.ObjectID{}
+
+	dskIdsInf, err := coll.Distinct(db, "disk", &bson.M{
+		"disk": &bson.M{
+			"$exists": true,
+		},
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	for _, dskIdInf := range dskIdsInf {
+		if dskId, ok := dskIdInf.(primitive.ObjectID); ok {
+			dskIds = append(dskIds, dskId)
+		}
+	}
+
+	return
+}
+
 func GetAllKeys(db *database.Database) (keys set.Set, err error) {
 	coll := db.Images()
 	keys = set.NewSet()
@@ -0,0 +1,167 @@
+package instance
+
+import (
+	"net"
+
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/vpc"
+)
+
+// Additional network adapter, the primary adapter is configured with the
+// instance vpc and subnet
+type NetworkAdapter struct {
+	Vpc             primitive.ObjectID `bson:"vpc" json:"vpc"`
+	Subnet          primitive.ObjectID `bson:"subnet" json:"subnet"`
+	StaticPrivateIp string             `bson:"static_private_ip" json:"static_private_ip"`
+	NetworkRoles    []string           `bson:"network_roles" json:"network_roles"`
+}
+
+func (i *Instance) validateAdapters(db *database.Database,
+	vc *vpc.Vpc) (errData *errortypes.ErrorData, err error) {
+
+	if i.NetworkAdapters == nil {
+		i.NetworkAdapters = []*NetworkAdapter{}
+	}
+
+	if len(i.NetworkAdapters) > MaxNetworkAdapters {
+		errData = &errortypes.ErrorData{
+			Error:   "network_adapters_limit",
+			Message: "Too many network adapters",
+		}
+		return
+	}
+
+	vpcIds := map[primitive.ObjectID]bool{
+		i.Vpc: true,
+	}
+
+	for _, adapter := range i.NetworkAdapters {
+		if adapter.Vpc.IsZero() {
+			errData = &errortypes.ErrorData{
+				Error:   "network_adapter_vpc_required",
+				Message: "Missing required network adapter VPC",
+			}
+			return
+		}
+
+		// Addresses are allocated per instance and vpc
+		if vpcIds[adapter.Vpc] {
+			errData = &errortypes.ErrorData{
+				Error:   "network_adapter_vpc_duplicate",
+				Message: "Each network adapter must be in a different VPC",
+			}
+			return
+		}
+		vpcIds[adapter.Vpc] = true
+
+		adapterVc, e := vpc.Get(db, adapter.Vpc)
+		if e != nil {
+			err = e
+			if _, ok := err.(*database.NotFoundError); ok {
+				err = nil
+				errData = &errortypes.ErrorData{
+					Error:   "network_adapter_vpc_invalid",
+					Message: "Network adapter VPC does not exist",
+				}
+			}
+			return
+		}
+
+		if adapterVc.Organization != i.Organization ||
+			adapterVc.Datacenter != vc.Datacenter {
+
+			errData = &errortypes.ErrorData{
+				Error:   "network_adapter_vpc_invalid",
+				Message: "Network adapter VPC must be in instance datacenter",
+			}
+			return
+		}
+
+		if adapter.Subnet.IsZero() {
+			errData = &errortypes.ErrorData{
+				Error:   "network_adapter_subnet_required",
+				Message: "Missing required network adapter VPC subnet",
+			}
+			return
+		}
+
+		if adapterVc.GetSubnet(adapter.Subnet) == nil {
+			errData = &errortypes.ErrorData{
+				Error:   "network_adapter_subnet_missing",
+				Message: "Network adapter VPC subnet does not exist",
+			}
+			return
+		}
+
+		if adapter.StaticPrivateIp != "" {
+			errData, err = adapterVc.ValidateStaticIp(
+				db, adapter.Subnet, i.Id, adapter.StaticPrivateIp)
+			if err != nil || errData != nil {
+				return
+			}
+
+			adapter.StaticPrivateIp = net.ParseIP(
+				adapter.StaticPrivateIp).To4().String()
+		}
+
+		if adapter.NetworkRoles == nil {
+			adapter.NetworkRoles = []string{}
+		}
+	}
+
+	return
+}
+
+// Returns the network roles for the adapter index, index zero is the
+// primary adapter
+func (i *Instance) GetNetworkRoles(index int) []string {
+	if index == 0 {
+		return i.NetworkRoles
+	}
+
+	index -= 1
+	if index < len(i.NetworkAdapters) {
+		return i.NetworkAdapters[index].NetworkRoles
+	}
+
+	return []string{}
+}
+
+// Assigns the requested static private addresses, adapters without a
+// static address are allocated when the instance network is configured
+func (i *Instance) SetStaticIps(db *database.Database) (err error) {
+	if i.StaticPrivateIp != "" {
+		vc, e := vpc.Get(db, i.Vpc)
+		if e != nil {
+			err = e
+			return
+		}
+
+		err = vc.SetStaticIp(db, i.Subnet, i.Id, i.StaticPrivateIp)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, adapter := range i.NetworkAdapters {
+		if adapter.StaticPrivateIp == "" {
+			continue
+		}
+
+		vc, e := vpc.Get(db, adapter.Vpc)
+		if e != nil {
+			err = e
+			return
+		}
+
+		err = vc.SetStaticIp(db, adapter.Subnet, i.Id,
+			adapter.StaticPrivateIp)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
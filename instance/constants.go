@@ -11,6 +11,8 @@ const (
 	Cleanup   = "cleanup"
 	Restart   = "restart"
 	Destroy   = "destroy"
+
+	MaxNetworkAdapters = 5
 )
 
 var (
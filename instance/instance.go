@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -18,6 +19,7 @@ import (
 	"github.com/pritunl/pritunl-cloud/disk"
 	"github.com/pritunl/pritunl-cloud/drive"
 	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/image"
 	"github.com/pritunl/pritunl-cloud/iscsi"
 	"github.com/pritunl/pritunl-cloud/node"
 	"github.com/pritunl/pritunl-cloud/paths"
@@ -37,6 +39,7 @@ type Instance struct {
 	Zone                primitive.ObjectID `bson:"zone" json:"zone"`
 	Vpc                 primitive.ObjectID `bson:"vpc" json:"vpc"`
 	Subnet              primitive.ObjectID `bson:"subnet" json:"subnet"`
+	StaticPrivateIp     string             `bson:"static_private_ip" json:"static_private_ip"`
 	Image               primitive.ObjectID `bson:"image" json:"image"`
 	ImageBacking        bool               `bson:"image_backing" json:"image_backing"`
 	Status              string             `bson:"-" json:"status"`
@@ -57,6 +60,7 @@ type Instance struct {
 	NetworkNamespace    string             `bson:"network_namespace" json:"network_namespace"`
 	NoPublicAddress     bool               `bson:"no_public_address" json:"no_public_address"`
 	NoHostAddress       bool               `bson:"no_host_address" json:"no_host_address"`
+	DhcpServer          bool               `bson:"dhcp_server" json:"dhcp_server"`
 	Node                primitive.ObjectID `bson:"node" json:"node"`
 	Domain              primitive.ObjectID `bson:"domain,omitempty" json:"domain"`
 	Name                string             `bson:"name" json:"name"`
@@ -65,6 +69,7 @@ type Instance struct {
 	Memory              int                `bson:"memory" json:"memory"`
 	Processors          int                `bson:"processors" json:"processors"`
 	NetworkRoles        []string           `bson:"network_roles" json:"network_roles"`
+	NetworkAdapters     []*NetworkAdapter  `bson:"network_adapters" json:"network_adapters"`
 	UsbDevices          []*usb.Device      `bson:"usb_devices" json:"usb_devices"`
 	PciDevices          []*pci.Device      `bson:"pci_devices" json:"pci_devices"`
 	DriveDevices        []*drive.Device    `bson:"drive_devices" json:"drive_devices"`
@@ -79,6 +84,7 @@ type Instance struct {
 	curState            string             `bson:"-" json:"-"`
 	curNoPublicAddress  bool               `bson:"-" json:"-"`
 	curNoHostAddress    bool               `bson:"-" json:"-"`
+	curAdapters         []*NetworkAdapter  `bson:"-" json:"-"`
 }
 
 func (i *Instance) Validate(db *database.Database) (
@@ -163,6 +169,16 @@ func (i *Instance) Validate(db *database.Database) (
 		return
 	}
 
+	if i.StaticPrivateIp != "" {
+		errData, err = vc.ValidateStaticIp(
+			db, i.Subnet, i.Id, i.StaticPrivateIp)
+		if err != nil || errData != nil {
+			return
+		}
+
+		i.StaticPrivateIp = net.ParseIP(i.StaticPrivateIp).To4().String()
+	}
+
 	if i.InitDiskSize != 0 && i.InitDiskSize < 10 {
 		errData = &errortypes.ErrorData{
 			Error:   "init_disk_size_invalid",
@@ -179,10 +195,69 @@ func (i *Instance) Validate(db *database.Database) (
 		i.Processors = 1
 	}
 
+	img, err := image.Get(db, i.Image)
+	if err != nil {
+		if _, ok := err.(*database.NotFoundError); ok {
+			img = nil
+			err = nil
+		} else {
+			return
+		}
+	}
+
+	if img != nil {
+		if i.Id.IsZero() && !img.CanAccess(i.Organization, vc.Datacenter) {
+			errData = &errortypes.ErrorData{
+				Error:   "image_not_shared",
+				Message: "Image is not shared with organization",
+			}
+			return
+		}
+
+		if i.Id.IsZero() && img.Lifecycle == image.Obsolete {
+			errData = &errortypes.ErrorData{
+				Error:   "image_obsolete",
+				Message: "Image is obsolete and cannot be launched",
+			}
+			return
+		}
+
+		// Default size keeps the image size unless a backing image is used
+		diskSize := i.InitDiskSize
+		if diskSize == 0 && i.ImageBacking {
+			diskSize = 10
+		}
+
+		if i.Id.IsZero() && img.MinDisk > 0 && diskSize != 0 &&
+			diskSize < img.MinDisk {
+
+			errData = &errortypes.ErrorData{
+				Error: "init_disk_size_below_image_minimum",
+				Message: fmt.Sprintf(
+					"Disk size below image minimum of %dGB", img.MinDisk),
+			}
+			return
+		}
+
+		if i.Id.IsZero() && img.MinMemory > 0 && i.Memory < img.MinMemory {
+			errData = &errortypes.ErrorData{
+				Error: "memory_below_image_minimum",
+				Message: fmt.Sprintf(
+					"Memory below image minimum of %dMB", img.MinMemory),
+			}
+			return
+		}
+	}
+
 	if i.NetworkRoles == nil {
 		i.NetworkRoles = []string{}
 	}
 
+	errData, err = i.validateAdapters(db, vc)
+	if err != nil || errData != nil {
+		return
+	}
+
 	if i.PublicIps == nil {
 		i.PublicIps = []string{}
 	}
@@ -419,6 +494,14 @@ func (i *Instance) PreCommit() {
 	i.curState = i.State
 	i.curNoPublicAddress = i.NoPublicAddress
 	i.curNoHostAddress = i.NoHostAddress
+
+	i.curAdapters = []*NetworkAdapter{}
+	for _, adapter := range i.NetworkAdapters {
+		i.curAdapters = append(i.curAdapters, &NetworkAdapter{
+			Vpc:    adapter.Vpc,
+			Subnet: adapter.Subnet,
+		})
+	}
 }
 
 func (i *Instance) PostCommit(db *database.Database) (
@@ -433,6 +516,31 @@ func (i *Instance) PostCommit(db *database.Database) (
 		}
 	}
 
+	if i.curAdapters != nil {
+		newAdapters := map[primitive.ObjectID]primitive.ObjectID{
+			i.Vpc: i.Subnet,
+		}
+		for _, adapter := range i.NetworkAdapters {
+			newAdapters[adapter.Vpc] = adapter.Subnet
+		}
+
+		for _, adapter := range i.curAdapters {
+			if newAdapters[adapter.Vpc] == adapter.Subnet {
+				continue
+			}
+
+			err = vpc.RemoveInstanceIp(db, i.Id, adapter.Vpc)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	err = i.SetStaticIps(db)
+	if err != nil {
+		return
+	}
+
 	if i.curDeleteProtection != i.DeleteProtection {
 		dskChange = true
 
@@ -500,9 +608,18 @@ func (i *Instance) Insert(db *database.Database) (err error) {
 		return
 	}
 
+	i.Id = primitive.NewObjectID()
+
+	err = i.SetStaticIps(db)
+	if err != nil {
+		_ = vpc.RemoveInstanceIps(db, i.Id)
+		return
+	}
+
 	_, err = coll.InsertOne(db, i)
 	if err != nil {
 		err = database.ParseError(err)
+		_ = vpc.RemoveInstanceIps(db, i.Id)
 		return
 	}
 
@@ -524,17 +641,32 @@ func (i *Instance) LoadVirt(disks []*disk.Disk) {
 				MacAddress: vm.GetMacAddr(i.Id, i.Vpc),
 				Vpc:        i.Vpc,
 				Subnet:     i.Subnet,
+				StaticIp:   i.StaticPrivateIp,
 			},
 		},
 		Uefi:            i.Uefi,
 		NoPublicAddress: i.NoPublicAddress,
 		NoHostAddress:   i.NoHostAddress,
+		DhcpServer:      i.DhcpServer,
 		UsbDevices:      []*vm.UsbDevice{},
 		PciDevices:      []*vm.PciDevice{},
 		DriveDevices:    []*vm.DriveDevice{},
 		IscsiDevices:    []*vm.IscsiDevice{},
 	}
 
+	for _, adapter := range i.NetworkAdapters {
+		i.Virt.NetworkAdapters = append(
+			i.Virt.NetworkAdapters,
+			&vm.NetworkAdapter{
+				Type:       vm.Bridge,
+				MacAddress: vm.GetMacAddr(i.Id, adapter.Vpc),
+				Vpc:        adapter.Vpc,
+				Subnet:     adapter.Subnet,
+				StaticIp:   adapter.StaticPrivateIp,
+			},
+		)
+	}
+
 	if disks != nil {
 		for _, dsk := range disks {
 			index, err := strconv.Atoi(dsk.Index)
@@ -611,8 +743,13 @@ func (i *Instance) Changed(curVirt *vm.VirtualMachine) bool {
 		i.Virt.VncDisplay != curVirt.VncDisplay ||
 		i.Virt.Uefi != curVirt.Uefi ||
 		i.Virt.NoPublicAddress != curVirt.NoPublicAddress ||
-		i.Virt.NoHostAddress != curVirt.NoHostAddress {
+		i.Virt.NoHostAddress != curVirt.NoHostAddress ||
+		i.Virt.DhcpServer != curVirt.DhcpServer {
+
+		return true
+	}
 
+	if len(i.Virt.NetworkAdapters) != len(curVirt.NetworkAdapters) {
 		return true
 	}
 
@@ -628,6 +765,10 @@ func (i *Instance) Changed(curVirt *vm.VirtualMachine) bool {
 		if adapter.Subnet != curVirt.NetworkAdapters[i].Subnet {
 			return true
 		}
+
+		if adapter.StaticIp != curVirt.NetworkAdapters[i].StaticIp {
+			return true
+		}
 	}
 
 	if i.Virt.PciDevices != nil {
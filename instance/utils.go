@@ -111,6 +111,8 @@ func GetAllVirt(db *database.Database, query *bson.M, disks []*disk.Disk) (
 			dsk.State != disk.Snapshot &&
 			dsk.State != disk.Backup &&
 			dsk.State != disk.Restore &&
+			dsk.State != disk.Export &&
+			dsk.State != disk.Capture &&
 			dsk.State != disk.Expand {
 
 			continue
@@ -189,6 +191,8 @@ func GetAllVirtMapped(db *database.Database, query *bson.M,
 					dsk.State != disk.Snapshot &&
 					dsk.State != disk.Backup &&
 					dsk.State != disk.Restore &&
+					dsk.State != disk.Export &&
+					dsk.State != disk.Capture &&
 					dsk.State != disk.Expand {
 
 					continue
@@ -325,6 +329,32 @@ func Remove(db *database.Database, instId primitive.ObjectID) (err error) {
 		return
 	}
 
+	// Floating ips are kept when the instance is removed
+	_, err = db.FloatingIps().UpdateMany(db, &bson.M{
+		"instance": instId,
+	}, &bson.M{
+		"$unset": &bson.M{
+			"instance": "",
+		},
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	_, err = db.FirewallStats().DeleteOne(db, &bson.M{
+		"_id": instId,
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+		default:
+			return
+		}
+	}
+
 	_, err = coll.DeleteOne(db, &bson.M{
 		"_id": instId,
 	})
@@ -11,7 +11,9 @@ type State struct {
 	Namespaces map[string]*Sets
 }
 
-func (s *State) AddIngress(namespace string, ingress []*firewall.Rule) {
+func (s *State) addRules(namespace string, rules []*firewall.Rule,
+	egress bool) {
+
 	sets := s.Namespaces[namespace]
 	if sets == nil {
 		sets = &Sets{
@@ -21,26 +23,35 @@ func (s *State) AddIngress(namespace string, ingress []*firewall.Rule) {
 		s.Namespaces[namespace] = sets
 	}
 
-	for _, rule := range ingress {
-		name := rule.SetName(false)
-		name6 := rule.SetName(true)
+	for _, rule := range rules {
+		var name, name6 string
+		var ips []string
+		if egress {
+			name = rule.EgressSetName(false)
+			name6 = rule.EgressSetName(true)
+			ips = rule.DestIps
+		} else {
+			name = rule.SetName(false)
+			name6 = rule.SetName(true)
+			ips = rule.SourceIps
+		}
 
 		if name == "" || name6 == "" {
 			continue
 		}
 
-		for _, sourceIp := range rule.SourceIps {
-			if sourceIp == "0.0.0.0/0" || sourceIp == "::/0" {
+		for _, ip := range ips {
+			if ip == "0.0.0.0/0" || ip == "::/0" {
 				continue
 			}
 
 			ruleName := ""
-			ipv6 := strings.Contains(sourceIp, ":")
+			ipv6 := strings.Contains(ip, ":")
 			if ipv6 {
-				sourceIp = strings.Replace(sourceIp, "/128", "", 1)
+				ip = strings.Replace(ip, "/128", "", 1)
 				ruleName = name6
 			} else {
-				sourceIp = strings.Replace(sourceIp, "/32", "", 1)
+				ip = strings.Replace(ip, "/32", "", 1)
 				ruleName = name
 			}
 
@@ -50,11 +61,19 @@ func (s *State) AddIngress(namespace string, ingress []*firewall.Rule) {
 				sets.Sets[ruleName] = ruleSet
 			}
 
-			ruleSet.Add(sourceIp)
+			ruleSet.Add(ip)
 		}
 	}
 }
 
+func (s *State) AddIngress(namespace string, ingress []*firewall.Rule) {
+	s.addRules(namespace, ingress, false)
+}
+
+func (s *State) AddEgress(namespace string, egress []*firewall.Rule) {
+	s.addRules(namespace, egress, true)
+}
+
 func (s *State) AddMember(namespace string, ruleName, member string) {
 	sets := s.Namespaces[namespace]
 	if sets == nil {
@@ -78,7 +97,9 @@ type NamesState struct {
 	Namespaces map[string]*Names
 }
 
-func (n *NamesState) AddIngress(namespace string, ingress []*firewall.Rule) {
+func (n *NamesState) addRules(namespace string, rules []*firewall.Rule,
+	egress bool) {
+
 	sets := n.Namespaces[namespace]
 	if sets == nil {
 		sets = &Names{
@@ -88,30 +109,46 @@ func (n *NamesState) AddIngress(namespace string, ingress []*firewall.Rule) {
 		n.Namespaces[namespace] = sets
 	}
 
-	for _, rule := range ingress {
-		name := rule.SetName(false)
-		name6 := rule.SetName(true)
+	for _, rule := range rules {
+		var name, name6 string
+		var ips []string
+		if egress {
+			name = rule.EgressSetName(false)
+			name6 = rule.EgressSetName(true)
+			ips = rule.DestIps
+		} else {
+			name = rule.SetName(false)
+			name6 = rule.SetName(true)
+			ips = rule.SourceIps
+		}
 
 		if name == "" || name6 == "" {
 			continue
 		}
 
-		for _, sourceIp := range rule.SourceIps {
-			if sourceIp == "0.0.0.0/0" || sourceIp == "::/0" {
+		for _, ip := range ips {
+			if ip == "0.0.0.0/0" || ip == "::/0" {
 				continue
 			}
 
-			ipv6 := strings.Contains(sourceIp, ":")
+			ipv6 := strings.Contains(ip, ":")
 			if ipv6 {
 				sets.Sets.Add(name6)
 			} else {
 				sets.Sets.Add(name)
 			}
-
 		}
 	}
 }
 
+func (n *NamesState) AddIngress(namespace string, ingress []*firewall.Rule) {
+	n.addRules(namespace, ingress, false)
+}
+
+func (n *NamesState) AddEgress(namespace string, egress []*firewall.Rule) {
+	n.addRules(namespace, egress, true)
+}
+
 func (n *NamesState) AddName(namespace string, ruleName string) {
 	sets := n.Namespaces[namespace]
 	if sets == nil {
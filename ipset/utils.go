@@ -19,8 +19,8 @@ var (
 )
 
 func UpdateState(instances []*instance.Instance, namespaces []string,
-	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule) (
-	err error) {
+	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule) (err error) {
 
 	lockId := stateLock.Lock()
 	defer stateLock.Unlock(lockId)
@@ -51,6 +51,7 @@ func UpdateState(instances []*instance.Instance, namespaces []string,
 			}
 
 			newState.AddIngress(namespace, ingress)
+			newState.AddEgress(namespace, firewallsEgress[namespace])
 		}
 	}
 
@@ -96,8 +97,8 @@ func applyState(oldState, newState *State, namespaces []string) (err error) {
 }
 
 func UpdateNamesState(instances []*instance.Instance,
-	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule) (
-	err error) {
+	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule) (err error) {
 
 	lockId := stateLock.Lock()
 	defer stateLock.Unlock(lockId)
@@ -128,6 +129,7 @@ func UpdateNamesState(instances []*instance.Instance,
 			}
 
 			newNamesState.AddIngress(namespace, ingress)
+			newNamesState.AddEgress(namespace, firewallsEgress[namespace])
 		}
 	}
 
@@ -193,9 +195,66 @@ func loadIpset(namespace string, state *State, namesState *NamesState) (
 	return
 }
 
+func Reset(namespaces []string) (err error) {
+	lockId := stateLock.Lock()
+	defer stateLock.Unlock(lockId)
+
+	state := &State{
+		Namespaces: map[string]*Sets{},
+	}
+	namesState := &NamesState{
+		Namespaces: map[string]*Names{},
+	}
+
+	err = loadIpset("0", state, namesState)
+	if err != nil {
+		return
+	}
+
+	for _, namespace := range namespaces {
+		err = loadIpset(namespace, state, namesState)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, names := range namesState.Namespaces {
+		curNames := &Names{
+			Namespace: names.Namespace,
+			Sets:      set.NewSet(),
+		}
+
+		for nameInf := range names.Sets.Iter() {
+			name := nameInf.(string)
+			if strings.HasPrefix(name, "pr4_") ||
+				strings.HasPrefix(name, "pr6_") ||
+				strings.HasPrefix(name, "pe4_") ||
+				strings.HasPrefix(name, "pe6_") {
+
+				curNames.Sets.Add(name)
+			}
+		}
+
+		newNames := &Names{
+			Namespace: names.Namespace,
+			Sets:      set.NewSet(),
+		}
+
+		err = newNames.Apply(curNames)
+		if err != nil {
+			return
+		}
+	}
+
+	curState = nil
+	curNamesState = nil
+
+	return
+}
+
 func Init(namespaces []string, instances []*instance.Instance,
-	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule) (
-	err error) {
+	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule) (err error) {
 
 	state := &State{
 		Namespaces: map[string]*Sets{},
@@ -219,7 +278,8 @@ func Init(namespaces []string, instances []*instance.Instance,
 	curState = state
 	curNamesState = namesState
 
-	err = UpdateState(instances, namespaces, nodeFirewall, firewalls)
+	err = UpdateState(instances, namespaces, nodeFirewall, firewalls,
+		firewallsEgress)
 	if err != nil {
 		return
 	}
@@ -228,10 +288,11 @@ func Init(namespaces []string, instances []*instance.Instance,
 }
 
 func InitNames(namespaces []string, instances []*instance.Instance,
-	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule) (
-	err error) {
+	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule) (err error) {
 
-	err = UpdateNamesState(instances, nodeFirewall, firewalls)
+	err = UpdateNamesState(instances, nodeFirewall, firewalls,
+		firewallsEgress)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,78 @@
+package iptables
+
+import (
+	"github.com/pritunl/pritunl-cloud/utils"
+)
+
+const chainDhcp = "pritunl_cloud_dhcp"
+
+// Locally generated bridge traffic is filtered with ebtables in a separate
+// chain that is flushed on each configure
+func ApplyDhcpFilter(namespace, vlan string) (err error) {
+	_, err = utils.ExecCombinedOutputLogged(
+		[]string{"already exists"},
+		"ip", "netns", "exec", namespace,
+		"ebtables", "-t", "filter", "-N", chainDhcp,
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"ip", "netns", "exec", namespace,
+		"ebtables", "-t", "filter", "-F", chainDhcp,
+	)
+	if err != nil {
+		return
+	}
+
+	rules := [][]string{
+		{"-p", "IPv4", "--ip-proto", "udp", "--ip-sport", "67"},
+		{"-p", "IPv6", "--ip6-proto", "udp", "--ip6-sport", "547"},
+		{"-p", "IPv6", "--ip6-proto", "ipv6-icmp",
+			"--ip6-icmp-type", "router-advertisement"},
+	}
+
+	for _, rule := range rules {
+		args := []string{
+			"netns", "exec", namespace,
+			"ebtables", "-t", "filter", "-A", chainDhcp,
+			"-o", vlan,
+		}
+		args = append(args, rule...)
+		args = append(args, "-j", "DROP")
+
+		_, err = utils.ExecCombinedOutputLogged(nil, "ip", args...)
+		if err != nil {
+			return
+		}
+	}
+
+	_, _ = utils.ExecCombinedOutput("",
+		"ip", "netns", "exec", namespace,
+		"ebtables", "-t", "filter", "-D", "OUTPUT", "-j", chainDhcp)
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"ip", "netns", "exec", namespace,
+		"ebtables", "-t", "filter", "-A", "OUTPUT", "-j", chainDhcp,
+	)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func RemoveDhcpFilter(namespace string) {
+	_, _ = utils.ExecCombinedOutput("",
+		"ip", "netns", "exec", namespace,
+		"ebtables", "-t", "filter", "-D", "OUTPUT", "-j", chainDhcp)
+	_, _ = utils.ExecCombinedOutput("",
+		"ip", "netns", "exec", namespace,
+		"ebtables", "-t", "filter", "-F", chainDhcp)
+	_, _ = utils.ExecCombinedOutput("",
+		"ip", "netns", "exec", namespace,
+		"ebtables", "-t", "filter", "-X", chainDhcp)
+}
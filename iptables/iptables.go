@@ -1,6 +1,7 @@
 package iptables
 
 import (
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,6 +31,7 @@ type Rules struct {
 	Ingress6    [][]string
 	Holds       [][]string
 	Holds6      [][]string
+	stats       map[string]*firewall.RuleStats
 }
 
 type State struct {
@@ -70,6 +72,49 @@ func (r *Rules) commentCommand(inCmd []string, hold bool) (cmd []string) {
 	return
 }
 
+func (r *Rules) logCommand(inCmd []string, prefix string, group int) (
+	cmd []string) {
+
+	cmd = append([]string{}, inCmd...)
+	cmd = append(cmd,
+		"-m", "limit",
+		"--limit", "10/min",
+		"--limit-burst", "20",
+	)
+	cmd = r.commentCommand(cmd, false)
+	cmd = append(cmd,
+		"-j", "NFLOG",
+		"--nflog-prefix", prefix,
+		"--nflog-group", strconv.Itoa(group),
+	)
+
+	return
+}
+
+func (r *Rules) addStats(cmd []string, direction, action, protocol,
+	port string) {
+
+	if r.stats == nil {
+		r.stats = map[string]*firewall.RuleStats{}
+	}
+
+	r.stats[strings.Join(cmd, " ")] = &firewall.RuleStats{
+		Direction: direction,
+		Action:    action,
+		Protocol:  protocol,
+		Port:      port,
+	}
+}
+
+func isLogCommand(cmd []string) bool {
+	for _, item := range cmd {
+		if item == "NFLOG" {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Rules) run(cmds [][]string, ipCmd string, ipv6 bool) (err error) {
 	iptablesCmd := getIptablesCmd(ipv6)
 
@@ -107,7 +152,9 @@ func (r *Rules) run(cmds [][]string, ipCmd string, ipv6 bool) (err error) {
 					err = nil
 					time.Sleep(250 * time.Millisecond)
 					continue
-				} else if cmd[len(cmd)-1] == "ACCEPT" {
+				} else if cmd[len(cmd)-1] == "ACCEPT" ||
+					isLogCommand(cmd) {
+
 					err = nil
 					logrus.WithFields(logrus.Fields{
 						"ipv6":    ipv6,
@@ -431,8 +478,105 @@ func (r *Rules) RemoveNat() (err error) {
 	return
 }
 
-func generateVirt(namespace, iface string, ingress []*firewall.Rule) (
-	rules *Rules) {
+func protocolCommand(inCmd []string, rule *firewall.Rule,
+	ipv6 bool) (cmd []string) {
+
+	switch rule.Protocol {
+	case firewall.All:
+		cmd = inCmd
+		break
+	case firewall.Icmp:
+		if ipv6 {
+			cmd = append(inCmd,
+				"-p", "ipv6-icmp",
+			)
+		} else {
+			cmd = append(inCmd,
+				"-p", "icmp",
+			)
+		}
+		break
+	case firewall.Tcp, firewall.Udp, firewall.Sctp,
+		firewall.Gre, firewall.Esp:
+
+		cmd = append(inCmd,
+			"-p", rule.Protocol,
+		)
+		break
+	}
+
+	return
+}
+
+func matchCommands(inCmd []string, rule *firewall.Rule, ipv6 bool) (
+	cmds [][]string) {
+
+	matches := [][]string{}
+
+	switch rule.Protocol {
+	case firewall.Icmp:
+		if len(rule.IcmpTypes) == 0 {
+			matches = append(matches, []string{})
+		}
+
+		for _, name := range rule.IcmpTypes {
+			icmpType, ok := firewall.GetIcmpType(name, ipv6)
+			if !ok {
+				continue
+			}
+
+			if ipv6 {
+				matches = append(matches, []string{
+					"-m", "icmp6",
+					"--icmpv6-type", strconv.Itoa(icmpType),
+				})
+			} else {
+				matches = append(matches, []string{
+					"-m", "icmp",
+					"--icmp-type", strconv.Itoa(icmpType),
+				})
+			}
+		}
+		break
+	case firewall.Tcp, firewall.Udp, firewall.Sctp:
+		ports := rule.GetPorts()
+		if len(ports) > 1 {
+			matches = append(matches, []string{
+				"-m", "multiport",
+				"--dports", strings.Replace(
+					strings.Join(ports, ","), "-", ":", -1),
+			})
+		} else {
+			matches = append(matches, []string{
+				"-m", rule.Protocol,
+				"--dport", strings.Replace(rule.Port, "-", ":", 1),
+			})
+		}
+		break
+	default:
+		matches = append(matches, []string{})
+		break
+	}
+
+	for _, match := range matches {
+		cmd := append([]string{}, inCmd...)
+		cmd = append(cmd, match...)
+
+		if rule.GetConnState() == firewall.StateNew {
+			cmd = append(cmd,
+				"-m", "conntrack",
+				"--ctstate", "NEW",
+			)
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	return
+}
+
+func generateVirt(namespace, iface string, ingress,
+	egress []*firewall.Rule, logDropped bool) (rules *Rules) {
 
 	rules = &Rules{
 		Namespace: namespace,
@@ -592,26 +736,8 @@ func generateVirt(namespace, iface string, ingress []*firewall.Rule) (
 
 			cmd = rules.newCommand()
 
-			switch rule.Protocol {
-			case firewall.All:
-				break
-			case firewall.Icmp:
-				if ipv6 {
-					cmd = append(cmd,
-						"-p", "ipv6-icmp",
-					)
-				} else {
-					cmd = append(cmd,
-						"-p", "icmp",
-					)
-				}
-				break
-			case firewall.Tcp, firewall.Udp:
-				cmd = append(cmd,
-					"-p", rule.Protocol,
-				)
-				break
-			default:
+			cmd = protocolCommand(cmd, rule, ipv6)
+			if cmd == nil {
 				continue
 			}
 
@@ -637,26 +763,29 @@ func generateVirt(namespace, iface string, ingress []*firewall.Rule) (
 				)
 			}
 
-			switch rule.Protocol {
-			case firewall.Tcp, firewall.Udp:
-				cmd = append(cmd,
-					"-m", rule.Protocol,
-					"--dport", strings.Replace(rule.Port, "-", ":", 1),
-					"-m", "conntrack",
-					"--ctstate", "NEW",
-				)
-				break
-			}
+			for _, matchCmd := range matchCommands(cmd, rule, ipv6) {
+				if rule.Log {
+					logCmd := rules.logCommand(matchCmd,
+						rule.LogPrefix(false), firewall.NflogIngressAccept)
+					if ipv6 {
+						rules.Ingress6 = append(rules.Ingress6, logCmd)
+					} else {
+						rules.Ingress = append(rules.Ingress, logCmd)
+					}
+				}
 
-			cmd = rules.commentCommand(cmd, false)
-			cmd = append(cmd,
-				"-j", "ACCEPT",
-			)
+				matchCmd = rules.commentCommand(matchCmd, false)
+				matchCmd = append(matchCmd,
+					"-j", "ACCEPT",
+				)
+				rules.addStats(matchCmd, firewall.Ingress, firewall.Accept,
+					rule.Protocol, rule.Port)
 
-			if ipv6 {
-				rules.Ingress6 = append(rules.Ingress6, cmd)
-			} else {
-				rules.Ingress = append(rules.Ingress, cmd)
+				if ipv6 {
+					rules.Ingress6 = append(rules.Ingress6, matchCmd)
+				} else {
+					rules.Ingress = append(rules.Ingress, matchCmd)
+				}
 			}
 		}
 	}
@@ -705,10 +834,15 @@ func generateVirt(namespace, iface string, ingress []*firewall.Rule) (
 			"--physdev-is-bridged",
 		)
 	}
+	if logDropped {
+		rules.Ingress = append(rules.Ingress, rules.logCommand(
+			cmd, "pc_drop", firewall.NflogIngressDrop))
+	}
 	cmd = rules.commentCommand(cmd, false)
 	cmd = append(cmd,
 		"-j", "DROP",
 	)
+	rules.addStats(cmd, firewall.Ingress, firewall.Drop, firewall.All, "")
 	rules.Ingress = append(rules.Ingress, cmd)
 
 	cmd = rules.newCommand()
@@ -719,15 +853,268 @@ func generateVirt(namespace, iface string, ingress []*firewall.Rule) (
 			"--physdev-is-bridged",
 		)
 	}
+	if logDropped {
+		rules.Ingress6 = append(rules.Ingress6, rules.logCommand(
+			cmd, "pc_drop", firewall.NflogIngressDrop))
+	}
 	cmd = rules.commentCommand(cmd, false)
 	cmd = append(cmd,
 		"-j", "DROP",
 	)
+	rules.addStats(cmd, firewall.Ingress, firewall.Drop, firewall.All, "")
 	rules.Ingress6 = append(rules.Ingress6, cmd)
 
+	if len(egress) > 0 {
+		generateEgress(rules, egress, logDropped)
+	}
+
 	return
 }
 
+func generateEgress(rules *Rules, egress []*firewall.Rule,
+	logDropped bool) {
+
+	cmd := rules.newCommand()
+	cmd = append(cmd,
+		"-m", "physdev",
+		"--physdev-in", rules.Interface,
+		"--physdev-is-bridged",
+		"-m", "conntrack",
+		"--ctstate", "RELATED,ESTABLISHED",
+	)
+	cmd = rules.commentCommand(cmd, false)
+	cmd = append(cmd,
+		"-j", "ACCEPT",
+	)
+	rules.Ingress = append(rules.Ingress, cmd)
+
+	cmd = rules.newCommand()
+	cmd = append(cmd,
+		"-m", "physdev",
+		"--physdev-in", rules.Interface,
+		"--physdev-is-bridged",
+		"-m", "conntrack",
+		"--ctstate", "RELATED,ESTABLISHED",
+	)
+	cmd = rules.commentCommand(cmd, false)
+	cmd = append(cmd,
+		"-j", "ACCEPT",
+	)
+	rules.Ingress6 = append(rules.Ingress6, cmd)
+
+	cmd = rules.newCommand()
+	cmd = append(cmd,
+		"-m", "physdev",
+		"--physdev-in", rules.Interface,
+		"--physdev-is-bridged",
+		"-m", "pkttype",
+		"--pkt-type", "broadcast",
+	)
+	cmd = rules.commentCommand(cmd, false)
+	cmd = append(cmd,
+		"-j", "ACCEPT",
+	)
+	rules.Ingress = append(rules.Ingress, cmd)
+
+	cmd = rules.newCommand()
+	cmd = append(cmd,
+		"-p", "udp",
+		"-m", "physdev",
+		"--physdev-in", rules.Interface,
+		"--physdev-is-bridged",
+		"-m", "udp",
+		"--dport", "67",
+	)
+	cmd = rules.commentCommand(cmd, false)
+	cmd = append(cmd,
+		"-j", "ACCEPT",
+	)
+	rules.Ingress = append(rules.Ingress, cmd)
+
+	cmd = rules.newCommand()
+	cmd = append(cmd,
+		"-p", "ipv6-icmp",
+		"-m", "physdev",
+		"--physdev-in", rules.Interface,
+		"--physdev-is-bridged",
+	)
+	cmd = rules.commentCommand(cmd, false)
+	cmd = append(cmd,
+		"-j", "ACCEPT",
+	)
+	rules.Ingress6 = append(rules.Ingress6, cmd)
+
+	cmd = rules.newCommand()
+	cmd = append(cmd,
+		"-p", "udp",
+		"-m", "physdev",
+		"--physdev-in", rules.Interface,
+		"--physdev-is-bridged",
+		"-m", "udp",
+		"--dport", "547",
+	)
+	cmd = rules.commentCommand(cmd, false)
+	cmd = append(cmd,
+		"-j", "ACCEPT",
+	)
+	rules.Ingress6 = append(rules.Ingress6, cmd)
+
+	for _, rule := range egress {
+		all4 := false
+		all6 := false
+		set4 := false
+		set6 := false
+		setName := rule.EgressSetName(false)
+		setName6 := rule.EgressSetName(true)
+
+		if setName == "" || setName6 == "" {
+			continue
+		}
+
+		for _, destIp := range rule.DestIps {
+			ipv6 := strings.Contains(destIp, ":")
+
+			if destIp == "0.0.0.0/0" {
+				if all4 {
+					continue
+				}
+				all4 = true
+			} else if destIp == "::/0" {
+				if all6 {
+					continue
+				}
+				all6 = true
+			} else {
+				if ipv6 {
+					if set6 {
+						continue
+					}
+					set6 = true
+				} else {
+					if set4 {
+						continue
+					}
+					set4 = true
+				}
+			}
+
+			cmd = rules.newCommand()
+
+			cmd = protocolCommand(cmd, rule, ipv6)
+			if cmd == nil {
+				continue
+			}
+
+			if destIp != "0.0.0.0/0" && destIp != "::/0" {
+				if ipv6 {
+					cmd = append(cmd,
+						"-m", "set",
+						"--match-set", setName6, "dst",
+					)
+				} else {
+					cmd = append(cmd,
+						"-m", "set",
+						"--match-set", setName, "dst",
+					)
+				}
+			}
+
+			cmd = append(cmd,
+				"-m", "physdev",
+				"--physdev-in", rules.Interface,
+				"--physdev-is-bridged",
+			)
+
+			for _, matchCmd := range matchCommands(cmd, rule, ipv6) {
+				if rule.Log {
+					logCmd := rules.logCommand(matchCmd,
+						rule.LogPrefix(true), firewall.NflogEgressAccept)
+					if ipv6 {
+						rules.Ingress6 = append(rules.Ingress6, logCmd)
+					} else {
+						rules.Ingress = append(rules.Ingress, logCmd)
+					}
+				}
+
+				matchCmd = rules.commentCommand(matchCmd, false)
+				matchCmd = append(matchCmd,
+					"-j", "ACCEPT",
+				)
+				rules.addStats(matchCmd, firewall.Egress, firewall.Accept,
+					rule.Protocol, rule.Port)
+
+				if ipv6 {
+					rules.Ingress6 = append(rules.Ingress6, matchCmd)
+				} else {
+					rules.Ingress = append(rules.Ingress, matchCmd)
+				}
+			}
+		}
+	}
+
+	cmd = rules.newCommand()
+	cmd = append(cmd,
+		"-m", "physdev",
+		"--physdev-in", rules.Interface,
+		"--physdev-is-bridged",
+		"-m", "conntrack",
+		"--ctstate", "INVALID",
+	)
+	cmd = rules.commentCommand(cmd, false)
+	cmd = append(cmd,
+		"-j", "DROP",
+	)
+	rules.Ingress = append(rules.Ingress, cmd)
+
+	cmd = rules.newCommand()
+	cmd = append(cmd,
+		"-m", "physdev",
+		"--physdev-in", rules.Interface,
+		"--physdev-is-bridged",
+		"-m", "conntrack",
+		"--ctstate", "INVALID",
+	)
+	cmd = rules.commentCommand(cmd, false)
+	cmd = append(cmd,
+		"-j", "DROP",
+	)
+	rules.Ingress6 = append(rules.Ingress6, cmd)
+
+	cmd = rules.newCommand()
+	cmd = append(cmd,
+		"-m", "physdev",
+		"--physdev-in", rules.Interface,
+		"--physdev-is-bridged",
+	)
+	if logDropped {
+		rules.Ingress = append(rules.Ingress, rules.logCommand(
+			cmd, "pc_drop", firewall.NflogEgressDrop))
+	}
+	cmd = rules.commentCommand(cmd, false)
+	cmd = append(cmd,
+		"-j", "DROP",
+	)
+	rules.addStats(cmd, firewall.Egress, firewall.Drop, firewall.All, "")
+	rules.Ingress = append(rules.Ingress, cmd)
+
+	cmd = rules.newCommand()
+	cmd = append(cmd,
+		"-m", "physdev",
+		"--physdev-in", rules.Interface,
+		"--physdev-is-bridged",
+	)
+	if logDropped {
+		rules.Ingress6 = append(rules.Ingress6, rules.logCommand(
+			cmd, "pc_drop", firewall.NflogEgressDrop))
+	}
+	cmd = rules.commentCommand(cmd, false)
+	cmd = append(cmd,
+		"-j", "DROP",
+	)
+	rules.addStats(cmd, firewall.Egress, firewall.Drop, firewall.All, "")
+	rules.Ingress6 = append(rules.Ingress6, cmd)
+}
+
 func generateInternal(namespace, iface string, nat bool,
 	natAddr, natPubAddr, natAddr6, natPubAddr6 string,
 	ingress []*firewall.Rule) (rules *Rules) {
@@ -898,26 +1285,8 @@ func generateInternal(namespace, iface string, nat bool,
 				)
 			}
 
-			switch rule.Protocol {
-			case firewall.All:
-				break
-			case firewall.Icmp:
-				if ipv6 {
-					cmd = append(cmd,
-						"-p", "ipv6-icmp",
-					)
-				} else {
-					cmd = append(cmd,
-						"-p", "icmp",
-					)
-				}
-				break
-			case firewall.Tcp, firewall.Udp:
-				cmd = append(cmd,
-					"-p", rule.Protocol,
-				)
-				break
-			default:
+			cmd = protocolCommand(cmd, rule, ipv6)
+			if cmd == nil {
 				continue
 			}
 
@@ -935,26 +1304,17 @@ func generateInternal(namespace, iface string, nat bool,
 				}
 			}
 
-			switch rule.Protocol {
-			case firewall.Tcp, firewall.Udp:
-				cmd = append(cmd,
-					"-m", rule.Protocol,
-					"--dport", strings.Replace(rule.Port, "-", ":", 1),
-					"-m", "conntrack",
-					"--ctstate", "NEW",
+			for _, matchCmd := range matchCommands(cmd, rule, ipv6) {
+				matchCmd = rules.commentCommand(matchCmd, false)
+				matchCmd = append(matchCmd,
+					"-j", "ACCEPT",
 				)
-				break
-			}
 
-			cmd = rules.commentCommand(cmd, false)
-			cmd = append(cmd,
-				"-j", "ACCEPT",
-			)
-
-			if ipv6 {
-				rules.Ingress6 = append(rules.Ingress6, cmd)
-			} else {
-				rules.Ingress = append(rules.Ingress, cmd)
+				if ipv6 {
+					rules.Ingress6 = append(rules.Ingress6, matchCmd)
+				} else {
+					rules.Ingress = append(rules.Ingress, matchCmd)
+				}
 			}
 		}
 	}
@@ -1197,26 +1557,8 @@ func generate(namespace, iface string, ingress []*firewall.Rule) (
 				)
 			}
 
-			switch rule.Protocol {
-			case firewall.All:
-				break
-			case firewall.Icmp:
-				if ipv6 {
-					cmd = append(cmd,
-						"-p", "ipv6-icmp",
-					)
-				} else {
-					cmd = append(cmd,
-						"-p", "icmp",
-					)
-				}
-				break
-			case firewall.Tcp, firewall.Udp:
-				cmd = append(cmd,
-					"-p", rule.Protocol,
-				)
-				break
-			default:
+			cmd = protocolCommand(cmd, rule, ipv6)
+			if cmd == nil {
 				continue
 			}
 
@@ -1234,26 +1576,17 @@ func generate(namespace, iface string, ingress []*firewall.Rule) (
 				}
 			}
 
-			switch rule.Protocol {
-			case firewall.Tcp, firewall.Udp:
-				cmd = append(cmd,
-					"-m", rule.Protocol,
-					"--dport", strings.Replace(rule.Port, "-", ":", 1),
-					"-m", "conntrack",
-					"--ctstate", "NEW",
+			for _, matchCmd := range matchCommands(cmd, rule, ipv6) {
+				matchCmd = rules.commentCommand(matchCmd, false)
+				matchCmd = append(matchCmd,
+					"-j", "ACCEPT",
 				)
-				break
-			}
 
-			cmd = rules.commentCommand(cmd, false)
-			cmd = append(cmd,
-				"-j", "ACCEPT",
-			)
-
-			if ipv6 {
-				rules.Ingress6 = append(rules.Ingress6, cmd)
-			} else {
-				rules.Ingress = append(rules.Ingress, cmd)
+				if ipv6 {
+					rules.Ingress6 = append(rules.Ingress6, matchCmd)
+				} else {
+					rules.Ingress = append(rules.Ingress, matchCmd)
+				}
 			}
 		}
 	}
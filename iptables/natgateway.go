@@ -0,0 +1,87 @@
+package iptables
+
+// Uses a separate comment to keep the rules out of the instance state
+// loaded from namespaces
+func natGatewayComment(inCmd []string) []string {
+	return append(inCmd,
+		"-m", "comment",
+		"--comment", "pritunl_cloud_nat_gateway",
+	)
+}
+
+// Rules for a vpc nat gateway namespace, the namespace is recreated when
+// the gateway changes so the rules are only appended
+func generateNatGateway(namespace, iface, network, pubAddr string) (
+	rules *Rules) {
+
+	rules = &Rules{
+		Namespace: namespace,
+		Interface: iface,
+		Ingress:   [][]string{},
+		Ingress6:  [][]string{},
+		Holds:     [][]string{},
+		Holds6:    [][]string{},
+	}
+
+	cmd := []string{
+		"POSTROUTING",
+		"-t", "nat",
+		"-s", network,
+		"-o", iface,
+	}
+	cmd = natGatewayComment(cmd)
+	cmd = append(cmd,
+		"-j", "SNAT",
+		"--to-source", pubAddr,
+	)
+	rules.Ingress = append(rules.Ingress, cmd)
+
+	for _, chain := range []string{"INPUT", "FORWARD"} {
+		cmd = []string{
+			chain,
+			"-i", iface,
+			"-m", "conntrack",
+			"--ctstate", "RELATED,ESTABLISHED",
+		}
+		cmd = natGatewayComment(cmd)
+		cmd = append(cmd,
+			"-j", "ACCEPT",
+		)
+		rules.Ingress = append(rules.Ingress, cmd)
+
+		cmd = []string{
+			chain,
+			"-i", iface,
+		}
+		cmd = natGatewayComment(cmd)
+		cmd = append(cmd,
+			"-j", "DROP",
+		)
+		rules.Ingress = append(rules.Ingress, cmd)
+
+		cmd = []string{
+			chain,
+			"-i", iface,
+		}
+		cmd = natGatewayComment(cmd)
+		cmd = append(cmd,
+			"-j", "DROP",
+		)
+		rules.Ingress6 = append(rules.Ingress6, cmd)
+	}
+
+	return
+}
+
+func ApplyNatGateway(namespace, iface, network, pubAddr string) (
+	err error) {
+
+	rules := generateNatGateway(namespace, iface, network, pubAddr)
+
+	err = rules.Apply()
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -0,0 +1,147 @@
+package iptables
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pritunl/pritunl-cloud/firewall"
+	"github.com/pritunl/pritunl-cloud/utils"
+)
+
+type counter struct {
+	Packets int64
+	Bytes   int64
+}
+
+func loadCounters(namespace string, ipv6 bool) (
+	counters map[string]*counter, err error) {
+
+	counters = map[string]*counter{}
+
+	saveCmd := "iptables-save"
+	if ipv6 {
+		saveCmd = "ip6tables-save"
+	}
+
+	Lock()
+	output, err := utils.ExecOutput("",
+		"ip", "netns", "exec", namespace, saveCmd, "-c", "-t", "filter")
+	Unlock()
+	if err != nil {
+		return
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, "[") ||
+			!strings.Contains(line, "pritunl_cloud_rule") {
+
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[1] != "-A" {
+			continue
+		}
+
+		counts := strings.Split(strings.Trim(fields[0], "[]"), ":")
+		if len(counts) != 2 {
+			continue
+		}
+
+		packets, e := strconv.ParseInt(counts[0], 10, 64)
+		if e != nil {
+			continue
+		}
+		bytes, e := strconv.ParseInt(counts[1], 10, 64)
+		if e != nil {
+			continue
+		}
+
+		key := strings.Join(fields[2:], " ")
+		cnt := counters[key]
+		if cnt == nil {
+			cnt = &counter{}
+			counters[key] = cnt
+		}
+		cnt.Packets += packets
+		cnt.Bytes += bytes
+	}
+
+	return
+}
+
+func GetStats() (stats map[string][]*firewall.RuleStats, err error) {
+	stats = map[string][]*firewall.RuleStats{}
+
+	// Copy the rule stats to release the state lock before reading the
+	// counters of each namespace
+	namespaceStats := map[string][]map[string]*firewall.RuleStats{}
+
+	lockId := stateLock.Lock()
+	if curState != nil {
+		for _, rules := range curState.Interfaces {
+			if rules.Namespace == "0" || len(rules.stats) == 0 {
+				continue
+			}
+
+			rulesStats := map[string]*firewall.RuleStats{}
+			for cmdKey, stat := range rules.stats {
+				rulesStats[cmdKey] = stat
+			}
+
+			namespaceStats[rules.Namespace] = append(
+				namespaceStats[rules.Namespace], rulesStats)
+		}
+	}
+	stateLock.Unlock(lockId)
+
+	for namespace, nsStats := range namespaceStats {
+		counters4, e := loadCounters(namespace, false)
+		if e != nil {
+			err = e
+			return
+		}
+
+		counters6, e := loadCounters(namespace, true)
+		if e != nil {
+			err = e
+			return
+		}
+
+		ruleStats := []*firewall.RuleStats{}
+		ruleStatsMap := map[string]*firewall.RuleStats{}
+
+		for _, rulesStats := range nsStats {
+			for cmdKey, stat := range rulesStats {
+				key := stat.Key()
+				ruleStat := ruleStatsMap[key]
+				if ruleStat == nil {
+					ruleStat = &firewall.RuleStats{
+						Direction: stat.Direction,
+						Action:    stat.Action,
+						Protocol:  stat.Protocol,
+						Port:      stat.Port,
+					}
+					ruleStatsMap[key] = ruleStat
+					ruleStats = append(ruleStats, ruleStat)
+				}
+
+				cnt := counters4[cmdKey]
+				if cnt != nil {
+					ruleStat.Packets += cnt.Packets
+					ruleStat.Bytes += cnt.Bytes
+				}
+
+				cnt = counters6[cmdKey]
+				if cnt != nil {
+					ruleStat.Packets += cnt.Packets
+					ruleStat.Bytes += cnt.Bytes
+				}
+			}
+		}
+
+		stats[namespace] = ruleStats
+	}
+
+	return
+}
@@ -212,7 +212,9 @@ func loadIptables(namespace string, state *State, ipv6 bool) (err error) {
 			}
 
 			for i, item := range cmd {
-				if item == "--physdev-out" || item == "-o" || item == "-i" {
+				if item == "--physdev-out" || item == "--physdev-in" ||
+					item == "-o" || item == "-i" {
+
 					if len(cmd) < i+2 {
 						logrus.WithFields(logrus.Fields{
 							"iptables_rule": line,
@@ -616,7 +618,9 @@ func applyState(oldState, newState *State, namespaces []string) (err error) {
 
 func UpdateState(nodeSelf *node.Node, instances []*instance.Instance,
 	namespaces []string, nodeFirewall []*firewall.Rule,
-	firewalls map[string][]*firewall.Rule) (err error) {
+	firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule, logDropped set.Set) (
+	err error) {
 
 	lockId := stateLock.Lock()
 	defer stateLock.Unlock(lockId)
@@ -734,8 +738,28 @@ func UpdateState(nodeSelf *node.Node, instances []*instance.Instance,
 			newState.Interfaces[namespace+"-"+ifaceHost] = rules
 		}
 
-		rules := generateVirt(namespace, iface, ingress)
+		rules := generateVirt(namespace, iface, ingress,
+			firewallsEgress[namespace], logDropped.Contains(namespace))
 		newState.Interfaces[namespace+"-"+iface] = rules
+
+		for i := 1; i < len(inst.Virt.NetworkAdapters); i++ {
+			adapterNamespace := vm.GetNamespace(inst.Id, i)
+			adapterIface := vm.GetIface(inst.Id, i)
+
+			adapterIngress := firewalls[adapterNamespace]
+			if adapterIngress == nil {
+				logrus.WithFields(logrus.Fields{
+					"instance_id": inst.Id.Hex(),
+					"namespace":   adapterNamespace,
+				}).Warn("iptables: Failed to load instance firewall rules")
+				continue
+			}
+
+			rules := generateVirt(adapterNamespace, adapterIface,
+				adapterIngress, firewallsEgress[adapterNamespace],
+				logDropped.Contains(adapterNamespace))
+			newState.Interfaces[adapterNamespace+"-"+adapterIface] = rules
+		}
 	}
 
 	err = applyState(curState, newState, namespaces)
@@ -748,6 +772,74 @@ func UpdateState(nodeSelf *node.Node, instances []*instance.Instance,
 	return
 }
 
+func loadState(namespaces []string) (state *State, err error) {
+	state = &State{
+		Interfaces: map[string]*Rules{},
+	}
+
+	err = loadIptablesNat(state)
+	if err != nil {
+		return
+	}
+
+	err = loadIptables("0", state, false)
+	if err != nil {
+		return
+	}
+
+	err = loadIptables("0", state, true)
+	if err != nil {
+		return
+	}
+
+	for _, namespace := range namespaces {
+		err = loadIptables(namespace, state, false)
+		if err != nil {
+			return
+		}
+
+		err = loadIptables(namespace, state, true)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func Reset(namespaces []string) (err error) {
+	lockId := stateLock.Lock()
+	defer stateLock.Unlock(lockId)
+
+	state, err := loadState(namespaces)
+	if err != nil {
+		return
+	}
+
+	for _, rules := range state.Interfaces {
+		if rules.Nat || rules.Nat6 {
+			err = rules.RemoveNat()
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	newState := &State{
+		HostNatExcludes: set.NewSet(),
+		Interfaces:      map[string]*Rules{},
+	}
+
+	err = applyState(state, newState, namespaces)
+	if err != nil {
+		return
+	}
+
+	curState = nil
+
+	return
+}
+
 func Recover() (err error) {
 	cmds := [][]string{}
 
@@ -829,13 +921,14 @@ func Recover() (err error) {
 		return
 	}
 
-	nodeFirewall, firewalls, err := firewall.GetAllIngress(
-		db, node.Self, instances)
+	nodeFirewall, firewalls, firewallsEgress, logDropped, err :=
+		firewall.GetAllRules(db, node.Self, instances)
 	if err != nil {
 		return
 	}
 
-	err = Init(namespaces, instances, nodeFirewall, firewalls)
+	err = Init(namespaces, instances, nodeFirewall, firewalls,
+		firewallsEgress, logDropped)
 	if err != nil {
 		return
 	}
@@ -844,7 +937,8 @@ func Recover() (err error) {
 }
 
 func Init(namespaces []string, instances []*instance.Instance,
-	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule) (
+	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule, logDropped set.Set) (
 	err error) {
 
 	_, err = utils.ExecCombinedOutputLogged(
@@ -900,41 +994,15 @@ func Init(namespaces []string, instances []*instance.Instance,
 		return
 	}
 
-	state := &State{
-		Interfaces: map[string]*Rules{},
-	}
-
-	err = loadIptablesNat(state)
-	if err != nil {
-		return
-	}
-
-	err = loadIptables("0", state, false)
-	if err != nil {
-		return
-	}
-
-	err = loadIptables("0", state, true)
+	state, err := loadState(namespaces)
 	if err != nil {
 		return
 	}
 
-	for _, namespace := range namespaces {
-		err = loadIptables(namespace, state, false)
-		if err != nil {
-			return
-		}
-
-		err = loadIptables(namespace, state, true)
-		if err != nil {
-			return
-		}
-	}
-
 	curState = state
 
 	err = UpdateState(node.Self, instances, namespaces,
-		nodeFirewall, firewalls)
+		nodeFirewall, firewalls, firewallsEgress, logDropped)
 	if err != nil {
 		return
 	}
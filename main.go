@@ -24,7 +24,8 @@ Commands:
   default-password  Get default administrator password
   reset-password    Reset administrator password
   disable-policies  Disable all policies
-  backup            Backup local data
+  backup            Backup local data to path or S3 storage, see
+                    pritunl-cloud backup --help
 `
 
 func Init() {
@@ -0,0 +1,464 @@
+package natgateway
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/block"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/interfaces"
+	"github.com/pritunl/pritunl-cloud/netfilter"
+	"github.com/pritunl/pritunl-cloud/settings"
+	"github.com/pritunl/pritunl-cloud/state"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/pritunl/pritunl-cloud/vm"
+	"github.com/pritunl/pritunl-cloud/vpc"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	curState = map[primitive.ObjectID]string{}
+)
+
+type gateway struct {
+	Vpc           *vpc.Vpc
+	ExternalIface string
+	Key           string
+}
+
+// Firewall backend is included to redeploy the gateway rules when the
+// backend changes
+func newGateway(vc *vpc.Vpc, externalIface,
+	firewallBackend string) *gateway {
+
+	return &gateway{
+		Vpc:           vc,
+		ExternalIface: externalIface,
+		Key: strings.Join([]string{
+			strconv.Itoa(vc.VpcId),
+			vc.Network,
+			vc.NatPrivate,
+			vc.NatAddress,
+			vc.NatBlock.Hex(),
+			externalIface,
+			firewallBackend,
+		}, "-"),
+	}
+}
+
+func remove(namespace string, vcId primitive.ObjectID) (err error) {
+	ifaceInternalVirt := vm.GetIfaceNatVirt(vcId, 0)
+	ifaceExternalVirt := vm.GetIfaceNatVirt(vcId, 1)
+
+	_, err = utils.ExecCombinedOutputLogged(
+		[]string{
+			"No such file",
+		},
+		"ip", "netns", "del", namespace,
+	)
+	if err != nil {
+		return
+	}
+
+	_, _ = utils.ExecCombinedOutput(
+		"", "ip", "link", "del", ifaceInternalVirt)
+	_, _ = utils.ExecCombinedOutput(
+		"", "ip", "link", "del", ifaceExternalVirt)
+
+	interfaces.RemoveVirtIface(ifaceInternalVirt)
+
+	return
+}
+
+func getMtu(jumboFrames, vxlan bool) (mtuInternal, mtuExternal string) {
+	if !jumboFrames && !vxlan {
+		return
+	}
+
+	mtuSize := 0
+	if jumboFrames {
+		mtuSize = settings.Hypervisor.JumboMtu
+	} else {
+		mtuSize = settings.Hypervisor.NormalMtu
+	}
+
+	mtuExternal = strconv.Itoa(mtuSize)
+
+	if vxlan {
+		mtuSize -= 50
+	}
+
+	mtuInternal = strconv.Itoa(mtuSize)
+
+	return
+}
+
+func (g *gateway) deploy(db *database.Database, stat *state.State) (
+	err error) {
+
+	vc := g.Vpc
+	namespace := vm.GetNamespaceNat(vc.Id)
+	ifaceInternalVirt := vm.GetIfaceNatVirt(vc.Id, 0)
+	ifaceExternalVirt := vm.GetIfaceNatVirt(vc.Id, 1)
+	ifaceInternal := vm.GetIfaceNat(vc.Id, 0)
+	ifaceExternal := vm.GetIfaceNat(vc.Id, 1)
+	ifaceVlan := vm.GetIfaceNat(vc.Id, 2)
+
+	// Addresses are the same on every node to allow failover without
+	// waiting for arp caches to expire
+	macAddrInternal := vm.GetMacAddrInternal(vc.Id, vc.Id)
+	macAddrExternal := vm.GetMacAddrExternal(vc.Id, vc.NatBlock)
+
+	err = remove(namespace, vc.Id)
+	if err != nil {
+		return
+	}
+
+	blck, err := block.Get(db, vc.NatBlock)
+	if err != nil {
+		return
+	}
+
+	blckGateway := blck.GetGateway()
+	blckMask := blck.GetMask()
+	if blckGateway == nil || blckMask == nil {
+		err = &errortypes.ParseError{
+			errors.New("natgateway: Invalid block gateway cidr"),
+		}
+		return
+	}
+	blckSize, _ := blckMask.Size()
+
+	vcNet, err := vc.GetNetwork()
+	if err != nil {
+		return
+	}
+	vcSize, _ := vcNet.Mask.Size()
+
+	mtuInternal, mtuExternal := getMtu(stat.Node().JumboFrames,
+		stat.VxLan())
+
+	_, err = utils.ExecCombinedOutputLogged(
+		[]string{"File exists"},
+		"ip", "netns",
+		"add", namespace,
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"ip", "link",
+		"add", ifaceInternalVirt,
+		"type", "veth",
+		"peer", "name", ifaceInternal,
+		"addr", macAddrInternal,
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"ip", "link",
+		"add", ifaceExternalVirt,
+		"type", "veth",
+		"peer", "name", ifaceExternal,
+		"addr", macAddrExternal,
+	)
+	if err != nil {
+		return
+	}
+
+	if mtuInternal != "" {
+		for _, iface := range []string{ifaceInternalVirt, ifaceInternal} {
+			_, err = utils.ExecCombinedOutputLogged(
+				nil,
+				"ip", "link",
+				"set", "dev", iface,
+				"mtu", mtuInternal,
+			)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	if mtuExternal != "" {
+		for _, iface := range []string{ifaceExternalVirt, ifaceExternal} {
+			_, err = utils.ExecCombinedOutputLogged(
+				nil,
+				"ip", "link",
+				"set", "dev", iface,
+				"mtu", mtuExternal,
+			)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	internalIface := interfaces.GetInternal(ifaceInternalVirt, stat.VxLan())
+	if internalIface == "" {
+		err = &errortypes.NotFoundError{
+			errors.New("natgateway: Failed to get internal interface"),
+		}
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"ip", "link", "set",
+		ifaceInternalVirt, "master", internalIface,
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"ip", "link", "set",
+		ifaceExternalVirt, "master", g.ExternalIface,
+	)
+	if err != nil {
+		return
+	}
+
+	for _, iface := range []string{ifaceInternalVirt, ifaceExternalVirt} {
+		_, err = utils.ExecCombinedOutputLogged(
+			nil,
+			"ip", "link",
+			"set", "dev", iface, "up",
+		)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, iface := range []string{ifaceInternal, ifaceExternal} {
+		_, err = utils.ExecCombinedOutputLogged(
+			[]string{"File exists"},
+			"ip", "link",
+			"set", "dev", iface,
+			"netns", namespace,
+		)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"ip", "netns", "exec", namespace,
+		"sysctl", "-w", "net.ipv4.ip_forward=1",
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"ip", "netns", "exec", namespace,
+		"sysctl", "-w", "net.ipv6.conf.all.accept_ra=0",
+	)
+	if err != nil {
+		return
+	}
+
+	for _, iface := range []string{ifaceInternal, ifaceExternal} {
+		_, err = utils.ExecCombinedOutputLogged(
+			nil,
+			"ip", "netns", "exec", namespace,
+			"ip", "link",
+			"set", "dev", iface, "up",
+		)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		[]string{"File exists"},
+		"ip", "netns", "exec", namespace,
+		"ip", "link",
+		"add", "link", ifaceInternal,
+		"name", ifaceVlan,
+		"type", "vlan",
+		"id", strconv.Itoa(vc.VpcId),
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"ip", "netns", "exec", namespace,
+		"ip", "link",
+		"set", "dev", ifaceVlan, "up",
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		[]string{"File exists"},
+		"ip", "netns", "exec", namespace,
+		"ip", "addr",
+		"add", fmt.Sprintf("%s/%d", vc.NatPrivate, vcSize),
+		"dev", ifaceVlan,
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		[]string{"File exists"},
+		"ip", "netns", "exec", namespace,
+		"ip", "addr",
+		"add", fmt.Sprintf("%s/%d", vc.NatAddress, blckSize),
+		"dev", ifaceExternal,
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		[]string{"File exists"},
+		"ip", "netns", "exec", namespace,
+		"ip", "route",
+		"add", "default",
+		"via", blckGateway.String(),
+	)
+	if err != nil {
+		return
+	}
+
+	err = netfilter.ApplyNatGateway(stat.Node(), namespace, ifaceExternal,
+		vcNet.String(), vc.NatAddress)
+	if err != nil {
+		return
+	}
+
+	// Announce the new location of the addresses after a failover
+	_, _ = utils.ExecCombinedOutput(
+		"", "ip", "netns", "exec", namespace,
+		"arping", "-c", "1", "-U", "-I", ifaceExternal, vc.NatAddress)
+	_, _ = utils.ExecCombinedOutput(
+		"", "ip", "netns", "exec", namespace,
+		"arping", "-c", "1", "-U", "-I", ifaceVlan, vc.NatPrivate)
+
+	return
+}
+
+func ApplyState(stat *state.State) (err error) {
+	db := database.GetDatabase()
+	defer db.Close()
+
+	nodeSelf := stat.Node()
+	newState := map[primitive.ObjectID]*gateway{}
+	newNamespaces := set.NewSet()
+
+	for _, vc := range stat.Vpcs() {
+		if !vc.NatGateway || vc.NatZone != nodeSelf.Zone ||
+			vc.NatAddress == "" || vc.NatPrivate == "" {
+
+			continue
+		}
+
+		externalIface := ""
+		for _, blckAttch := range nodeSelf.Blocks {
+			if blckAttch.Block == vc.NatBlock {
+				externalIface = blckAttch.Interface
+				break
+			}
+		}
+		if externalIface == "" {
+			continue
+		}
+
+		acquired, e := vc.NatLease(db, nodeSelf.Id)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"vpc_id": vc.Id.Hex(),
+				"error":  e,
+			}).Error("natgateway: Failed to update nat gateway lease")
+			continue
+		}
+
+		if !acquired {
+			continue
+		}
+
+		newState[vc.Id] = newGateway(vc, externalIface,
+			nodeSelf.FirewallBackend)
+		newNamespaces.Add(vm.GetNamespaceNat(vc.Id))
+	}
+
+	curNamespaces := set.NewSet()
+	for _, namespace := range stat.Namespaces() {
+		if len(namespace) != 14 || !strings.HasPrefix(namespace, "g") {
+			continue
+		}
+		curNamespaces.Add(namespace)
+
+		if newNamespaces.Contains(namespace) {
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"namespace": namespace,
+		}).Info("natgateway: Removing nat gateway")
+
+		_, err = utils.ExecCombinedOutputLogged(
+			[]string{
+				"No such file",
+			},
+			"ip", "netns", "del", namespace,
+		)
+		if err != nil {
+			return
+		}
+	}
+
+	for vcId := range curState {
+		if _, ok := newState[vcId]; !ok {
+			delete(curState, vcId)
+		}
+	}
+
+	for vcId, gate := range newState {
+		if curState[vcId] == gate.Key &&
+			curNamespaces.Contains(vm.GetNamespaceNat(vcId)) {
+
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"vpc_id":      vcId.Hex(),
+			"nat_address": gate.Vpc.NatAddress,
+			"nat_private": gate.Vpc.NatPrivate,
+		}).Info("natgateway: Deploying nat gateway")
+
+		e := gate.deploy(db, stat)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"vpc_id": vcId.Hex(),
+				"error":  e,
+			}).Error("natgateway: Failed to deploy nat gateway")
+
+			_ = remove(vm.GetNamespaceNat(vcId), vcId)
+			delete(curState, vcId)
+			continue
+		}
+
+		curState[vcId] = gate.Key
+	}
+
+	return
+}
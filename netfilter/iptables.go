@@ -0,0 +1,131 @@
+package netfilter
+
+import (
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/pritunl/pritunl-cloud/firewall"
+	"github.com/pritunl/pritunl-cloud/instance"
+	"github.com/pritunl/pritunl-cloud/ipset"
+	"github.com/pritunl/pritunl-cloud/iptables"
+	"github.com/pritunl/pritunl-cloud/node"
+)
+
+type iptablesBackend struct{}
+
+func (b *iptablesBackend) Init(namespaces []string,
+	instances []*instance.Instance, nodeFirewall []*firewall.Rule,
+	firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule, logDropped set.Set) (
+	err error) {
+
+	err = ipset.Init(namespaces, instances, nodeFirewall, firewalls,
+		firewallsEgress)
+	if err != nil {
+		return
+	}
+
+	err = iptables.Init(namespaces, instances, nodeFirewall, firewalls,
+		firewallsEgress, logDropped)
+	if err != nil {
+		return
+	}
+
+	err = ipset.InitNames(namespaces, instances, nodeFirewall, firewalls,
+		firewallsEgress)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *iptablesBackend) Update(nodeSelf *node.Node,
+	instances []*instance.Instance, namespaces []string,
+	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule, logDropped set.Set) (
+	err error) {
+
+	err = ipset.UpdateState(instances, namespaces, nodeFirewall, firewalls,
+		firewallsEgress)
+	if err != nil {
+		return
+	}
+
+	err = iptables.UpdateState(nodeSelf, instances, namespaces,
+		nodeFirewall, firewalls, firewallsEgress, logDropped)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *iptablesBackend) Clean(instances []*instance.Instance,
+	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule) (err error) {
+
+	err = ipset.UpdateNamesState(instances, nodeFirewall, firewalls,
+		firewallsEgress)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *iptablesBackend) Reset(namespaces []string) (err error) {
+	err = iptables.Reset(namespaces)
+	if err != nil {
+		return
+	}
+
+	err = ipset.Reset(namespaces)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *iptablesBackend) Recover() (err error) {
+	err = iptables.Recover()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *iptablesBackend) GetStats() (
+	stats map[string][]*firewall.RuleStats, err error) {
+
+	stats, err = iptables.GetStats()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *iptablesBackend) ApplyNatGateway(namespace, iface, network,
+	pubAddr string) (err error) {
+
+	err = iptables.ApplyNatGateway(namespace, iface, network, pubAddr)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *iptablesBackend) ApplyDhcpFilter(namespace, vlan string) (err error) {
+	err = iptables.ApplyDhcpFilter(namespace, vlan)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *iptablesBackend) RemoveDhcpFilter(namespace string) {
+	iptables.RemoveDhcpFilter(namespace)
+}
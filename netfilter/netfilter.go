@@ -0,0 +1,213 @@
+package netfilter
+
+import (
+	"sync"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/pritunl/pritunl-cloud/firewall"
+	"github.com/pritunl/pritunl-cloud/instance"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	curBackend     Backend
+	curBackendName string
+	backendLock    = sync.Mutex{}
+)
+
+type Backend interface {
+	Init(namespaces []string, instances []*instance.Instance,
+		nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule,
+		firewallsEgress map[string][]*firewall.Rule, logDropped set.Set) error
+	Update(nodeSelf *node.Node, instances []*instance.Instance,
+		namespaces []string, nodeFirewall []*firewall.Rule,
+		firewalls map[string][]*firewall.Rule,
+		firewallsEgress map[string][]*firewall.Rule, logDropped set.Set) error
+	Clean(instances []*instance.Instance, nodeFirewall []*firewall.Rule,
+		firewalls map[string][]*firewall.Rule,
+		firewallsEgress map[string][]*firewall.Rule) error
+	Reset(namespaces []string) error
+	Recover() error
+	GetStats() (map[string][]*firewall.RuleStats, error)
+	ApplyNatGateway(namespace, iface, network, pubAddr string) error
+	ApplyDhcpFilter(namespace, vlan string) error
+	RemoveDhcpFilter(namespace string)
+}
+
+func getBackendName(nodeSelf *node.Node) string {
+	if nodeSelf.FirewallBackend == node.Nftables {
+		return node.Nftables
+	}
+	return node.Iptables
+}
+
+func getBackend(name string) Backend {
+	if name == node.Nftables {
+		return &nftablesBackend{}
+	}
+	return &iptablesBackend{}
+}
+
+func getOtherBackend(name string) Backend {
+	if name == node.Nftables {
+		return &iptablesBackend{}
+	}
+	return &nftablesBackend{}
+}
+
+func getCurrent() Backend {
+	backendLock.Lock()
+	backend := curBackend
+	backendLock.Unlock()
+
+	if backend == nil {
+		backend = getBackend(getBackendName(node.Self))
+	}
+
+	return backend
+}
+
+func Init(namespaces []string, instances []*instance.Instance,
+	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule, logDropped set.Set) (
+	err error) {
+
+	backendLock.Lock()
+	defer backendLock.Unlock()
+
+	name := getBackendName(node.Self)
+
+	err = getOtherBackend(name).Reset(namespaces)
+	if err != nil {
+		return
+	}
+
+	backend := getBackend(name)
+	err = backend.Init(namespaces, instances, nodeFirewall, firewalls,
+		firewallsEgress, logDropped)
+	if err != nil {
+		return
+	}
+
+	curBackend = backend
+	curBackendName = name
+
+	return
+}
+
+func Update(nodeSelf *node.Node, instances []*instance.Instance,
+	namespaces []string, nodeFirewall []*firewall.Rule,
+	firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule, logDropped set.Set) (
+	err error) {
+
+	backendLock.Lock()
+	defer backendLock.Unlock()
+
+	name := getBackendName(nodeSelf)
+	if curBackend != nil && curBackendName == name {
+		err = curBackend.Update(nodeSelf, instances, namespaces,
+			nodeFirewall, firewalls, firewallsEgress, logDropped)
+		if err != nil {
+			return
+		}
+
+		return
+	}
+
+	if curBackend != nil {
+		logrus.WithFields(logrus.Fields{
+			"backend": name,
+		}).Info("netfilter: Switching firewall backend")
+
+		err = curBackend.Reset(namespaces)
+		if err != nil {
+			return
+		}
+		curBackend = nil
+	}
+
+	backend := getBackend(name)
+	err = backend.Init(namespaces, instances, nodeFirewall, firewalls,
+		firewallsEgress, logDropped)
+	if err != nil {
+		return
+	}
+
+	curBackend = backend
+	curBackendName = name
+
+	return
+}
+
+func Clean(instances []*instance.Instance, nodeFirewall []*firewall.Rule,
+	firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule) (err error) {
+
+	backendLock.Lock()
+	defer backendLock.Unlock()
+
+	if curBackend == nil {
+		return
+	}
+
+	err = curBackend.Clean(instances, nodeFirewall, firewalls,
+		firewallsEgress)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func Recover() (err error) {
+	err = getCurrent().Recover()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func GetStats() (stats map[string][]*firewall.RuleStats, err error) {
+	stats, err = getCurrent().GetStats()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Nat gateway namespaces are recreated on each deploy and use the
+// configured backend directly
+func ApplyNatGateway(nodeSelf *node.Node, namespace, iface, network,
+	pubAddr string) (err error) {
+
+	err = getBackend(getBackendName(nodeSelf)).ApplyNatGateway(
+		namespace, iface, network, pubAddr)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func ApplyDhcpFilter(nodeSelf *node.Node, namespace, vlan string) (
+	err error) {
+
+	err = getBackend(getBackendName(nodeSelf)).ApplyDhcpFilter(
+		namespace, vlan)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Filters of both backends are removed in case the backend changed since
+// the filter was applied
+func RemoveDhcpFilter(namespace string) {
+	(&iptablesBackend{}).RemoveDhcpFilter(namespace)
+	(&nftablesBackend{}).RemoveDhcpFilter(namespace)
+}
@@ -0,0 +1,101 @@
+package netfilter
+
+import (
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/pritunl/pritunl-cloud/firewall"
+	"github.com/pritunl/pritunl-cloud/instance"
+	"github.com/pritunl/pritunl-cloud/nftables"
+	"github.com/pritunl/pritunl-cloud/node"
+)
+
+type nftablesBackend struct{}
+
+func (b *nftablesBackend) Init(namespaces []string,
+	instances []*instance.Instance, nodeFirewall []*firewall.Rule,
+	firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule, logDropped set.Set) (
+	err error) {
+
+	err = nftables.Init(namespaces, instances, nodeFirewall, firewalls,
+		firewallsEgress, logDropped)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *nftablesBackend) Update(nodeSelf *node.Node,
+	instances []*instance.Instance, namespaces []string,
+	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule, logDropped set.Set) (
+	err error) {
+
+	err = nftables.UpdateState(nodeSelf, instances, namespaces,
+		nodeFirewall, firewalls, firewallsEgress, logDropped)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *nftablesBackend) Clean(instances []*instance.Instance,
+	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule) (err error) {
+
+	return
+}
+
+func (b *nftablesBackend) Reset(namespaces []string) (err error) {
+	err = nftables.Reset(namespaces)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *nftablesBackend) Recover() (err error) {
+	err = nftables.Recover()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *nftablesBackend) GetStats() (
+	stats map[string][]*firewall.RuleStats, err error) {
+
+	stats, err = nftables.GetStats()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *nftablesBackend) ApplyNatGateway(namespace, iface, network,
+	pubAddr string) (err error) {
+
+	err = nftables.ApplyNatGateway(namespace, iface, network, pubAddr)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *nftablesBackend) ApplyDhcpFilter(namespace, vlan string) (err error) {
+	err = nftables.ApplyDhcpFilter(namespace, vlan)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (b *nftablesBackend) RemoveDhcpFilter(namespace string) {
+	nftables.RemoveDhcpFilter(namespace)
+}
@@ -0,0 +1,317 @@
+package nflog
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/constants"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/event"
+	"github.com/pritunl/pritunl-cloud/firewall"
+	"github.com/pritunl/pritunl-cloud/instance"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/vm"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	collectors     = map[string]*collector{}
+	collectorsLock = sync.Mutex{}
+	resourceReg    = regexp.MustCompile(`resource ID ([0-9]+)`)
+	tcpdumpMissing = false
+)
+
+type collector struct {
+	instance     primitive.ObjectID
+	organization primitive.ObjectID
+	namespace    string
+	cmd          *exec.Cmd
+	entries      []*firewall.LogEntry
+	lock         sync.Mutex
+	stop         bool
+}
+
+func (c *collector) parse(line string) (entry *firewall.LogEntry) {
+	match := resourceReg.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+
+	group, err := strconv.Atoi(match[1])
+	if err != nil {
+		return
+	}
+
+	entry = &firewall.LogEntry{
+		Instance:     c.instance,
+		Organization: c.organization,
+		Node:         node.Self.Id,
+		Timestamp:    time.Now(),
+	}
+
+	switch group {
+	case firewall.NflogIngressAccept:
+		entry.Direction = firewall.Ingress
+		entry.Action = firewall.Accept
+		break
+	case firewall.NflogIngressDrop:
+		entry.Direction = firewall.Ingress
+		entry.Action = firewall.Drop
+		break
+	case firewall.NflogEgressAccept:
+		entry.Direction = firewall.Egress
+		entry.Action = firewall.Accept
+		break
+	case firewall.NflogEgressDrop:
+		entry.Direction = firewall.Egress
+		entry.Action = firewall.Drop
+		break
+	default:
+		entry = nil
+		return
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) > 0 {
+		timestamp, e := strconv.ParseFloat(fields[0], 64)
+		if e == nil {
+			sec := int64(timestamp)
+			nsec := int64((timestamp - float64(sec)) * 1e9)
+			entry.Timestamp = time.Unix(sec, nsec)
+		}
+	}
+
+	index := strings.Index(line, ": IP")
+	if index == -1 {
+		entry.Protocol = firewall.All
+		entry.Summary = line
+		return
+	}
+
+	summary := line[index+2:]
+	entry.Summary = summary
+
+	fields = strings.Fields(summary)
+	if len(fields) >= 4 && fields[2] == ">" {
+		entry.Source = fields[1]
+		entry.Destination = strings.TrimSuffix(fields[3], ":")
+	}
+
+	if strings.Contains(summary, "Flags [") {
+		entry.Protocol = firewall.Tcp
+	} else if strings.Contains(summary, "UDP") {
+		entry.Protocol = firewall.Udp
+	} else if strings.Contains(summary, "ICMP") {
+		entry.Protocol = firewall.Icmp
+	} else if strings.Contains(summary, "sctp") {
+		entry.Protocol = firewall.Sctp
+	} else if strings.Contains(summary, "GRE") {
+		entry.Protocol = firewall.Gre
+	} else if strings.Contains(summary, "ESP") {
+		entry.Protocol = firewall.Esp
+	} else {
+		entry.Protocol = firewall.All
+	}
+
+	return
+}
+
+func (c *collector) flush() {
+	c.lock.Lock()
+	entries := c.entries
+	c.entries = []*firewall.LogEntry{}
+	c.lock.Unlock()
+
+	if len(entries) == 0 {
+		return
+	}
+
+	db := database.GetDatabase()
+	defer db.Close()
+
+	err := firewall.InsertLogs(db, entries)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"instance_id": c.instance.Hex(),
+			"error":       err,
+		}).Error("nflog: Failed to write firewall logs")
+		return
+	}
+
+	event.PublishDispatch(db, "firewall_log.change")
+}
+
+func (c *collector) stopped() bool {
+	c.lock.Lock()
+	stop := c.stop
+	c.lock.Unlock()
+
+	return stop || constants.Shutdown
+}
+
+func (c *collector) sender() {
+	for {
+		time.Sleep(3 * time.Second)
+
+		c.flush()
+
+		if c.stopped() {
+			return
+		}
+	}
+}
+
+func (c *collector) exec() (err error) {
+	cmd := exec.Command(
+		"ip", "netns", "exec", c.namespace,
+		"tcpdump", "-l", "-nn", "-tt", "-e",
+		"-i", fmt.Sprintf("nflog:%d,%d,%d,%d",
+			firewall.NflogIngressAccept, firewall.NflogIngressDrop,
+			firewall.NflogEgressAccept, firewall.NflogEgressDrop),
+	)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return
+	}
+
+	c.lock.Lock()
+	c.cmd = cmd
+	stop := c.stop
+	c.lock.Unlock()
+
+	if stop {
+		cmd.Process.Kill()
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		entry := c.parse(scanner.Text())
+		if entry == nil {
+			continue
+		}
+
+		c.lock.Lock()
+		if len(c.entries) < 1000 {
+			c.entries = append(c.entries, entry)
+		}
+		c.lock.Unlock()
+	}
+
+	err = cmd.Wait()
+
+	return
+}
+
+func (c *collector) run() {
+	go c.sender()
+
+	for {
+		if c.stopped() {
+			return
+		}
+
+		err := c.exec()
+		if c.stopped() {
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"instance_id": c.instance.Hex(),
+			"namespace":   c.namespace,
+			"error":       err,
+		}).Warn("nflog: Firewall log collector stopped, restarting")
+
+		time.Sleep(10 * time.Second)
+	}
+}
+
+func (c *collector) Stop() {
+	c.lock.Lock()
+	c.stop = true
+	cmd := c.cmd
+	c.lock.Unlock()
+
+	if cmd != nil && cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+}
+
+func Update(instances []*instance.Instance, namespaces set.Set) {
+	collectorsLock.Lock()
+	defer collectorsLock.Unlock()
+
+	// Firewall logs are read from the nflog groups with tcpdump
+	_, err := exec.LookPath("tcpdump")
+	if err != nil {
+		if !tcpdumpMissing {
+			tcpdumpMissing = true
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("nflog: Firewall logging requires tcpdump, " +
+				"install tcpdump to collect firewall logs")
+		}
+		return
+	}
+	tcpdumpMissing = false
+
+	active := set.NewSet()
+
+	for _, inst := range instances {
+		if !inst.IsActive() {
+			continue
+		}
+
+		namespace := vm.GetNamespace(inst.Id, 0)
+		if !namespaces.Contains(namespace) {
+			continue
+		}
+		active.Add(namespace)
+
+		if collectors[namespace] != nil {
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"instance_id": inst.Id.Hex(),
+			"namespace":   namespace,
+		}).Info("nflog: Starting firewall log collector")
+
+		coll := &collector{
+			instance:     inst.Id,
+			organization: inst.Organization,
+			namespace:    namespace,
+			entries:      []*firewall.LogEntry{},
+		}
+		collectors[namespace] = coll
+
+		go coll.run()
+	}
+
+	for namespace, coll := range collectors {
+		if active.Contains(namespace) {
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"instance_id": coll.instance.Hex(),
+			"namespace":   namespace,
+		}).Info("nflog: Stopping firewall log collector")
+
+		coll.Stop()
+		delete(collectors, namespace)
+	}
+}
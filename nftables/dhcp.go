@@ -0,0 +1,39 @@
+package nftables
+
+import (
+	"fmt"
+
+	"github.com/pritunl/pritunl-cloud/utils"
+)
+
+const tableDhcp = "pritunl_cloud_dhcp"
+
+// Locally generated bridge traffic is filtered in a separate bridge table
+// that is replaced on each configure
+func ApplyDhcpFilter(namespace, vlan string) (err error) {
+	script := fmt.Sprintf(`table bridge %s
+delete table bridge %s
+table bridge %s {
+	chain output {
+		type filter hook output priority 0; policy accept;
+		oifname "%s" udp sport 67 drop
+		oifname "%s" udp sport 547 drop
+		oifname "%s" icmpv6 type nd-router-advert drop
+	}
+}
+`, tableDhcp, tableDhcp, tableDhcp, vlan, vlan, vlan)
+
+	err = utils.ExecInput("", script,
+		"ip", "netns", "exec", namespace, "nft", "-f", "-")
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func RemoveDhcpFilter(namespace string) {
+	_, _ = utils.ExecCombinedOutput("",
+		"ip", "netns", "exec", namespace,
+		"nft", "delete", "table", "bridge", tableDhcp)
+}
@@ -0,0 +1,42 @@
+package nftables
+
+import (
+	"fmt"
+)
+
+// Rules for a vpc nat gateway namespace, the namespace is not part of the
+// instance state and is recreated when the gateway changes
+func generateNatGateway(namespace, iface, network, pubAddr string) (
+	ruleset *Ruleset) {
+
+	ruleset = newRuleset(namespace)
+	ifaceIn := fmt.Sprintf("iifname \"%s\"", iface)
+
+	ruleset.Postrouting = append(ruleset.Postrouting,
+		fmt.Sprintf("ip saddr %s oifname \"%s\" snat to %s",
+			network, iface, pubAddr))
+
+	rules := []string{
+		joinRule(ifaceIn, "meta nfproto ipv4",
+			"ct state established,related accept"),
+		joinRule(ifaceIn, "drop"),
+	}
+
+	ruleset.Input = append(ruleset.Input, rules...)
+	ruleset.Forward = append(ruleset.Forward, rules...)
+
+	return
+}
+
+func ApplyNatGateway(namespace, iface, network, pubAddr string) (
+	err error) {
+
+	ruleset := generateNatGateway(namespace, iface, network, pubAddr)
+
+	err = ruleset.Apply()
+	if err != nil {
+		return
+	}
+
+	return
+}
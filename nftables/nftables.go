@@ -0,0 +1,570 @@
+package nftables
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/pritunl/pritunl-cloud/firewall"
+	"github.com/pritunl/pritunl-cloud/utils"
+)
+
+const (
+	tableFilter = "pritunl_cloud"
+	tableNat    = "pritunl_cloud_nat"
+)
+
+var (
+	curState  *State
+	stateLock = utils.NewTimeoutLock(3 * time.Minute)
+	tables    = [][]string{
+		{"inet", tableFilter},
+		{"bridge", tableFilter},
+		{"ip", tableNat},
+		{"ip6", tableNat},
+	}
+)
+
+type Ruleset struct {
+	Namespace    string
+	Sets         map[string]set.Set
+	Input        []string
+	Forward      []string
+	Bridge       []string
+	Prerouting   []string
+	Postrouting  []string
+	Prerouting6  []string
+	Postrouting6 []string
+	script       string
+	stats        map[string]*firewall.RuleStats
+}
+
+type State struct {
+	Namespaces map[string]*Ruleset
+}
+
+func newRuleset(namespace string) *Ruleset {
+	return &Ruleset{
+		Namespace:    namespace,
+		Sets:         map[string]set.Set{},
+		Input:        []string{},
+		Forward:      []string{},
+		Bridge:       []string{},
+		Prerouting:   []string{},
+		Postrouting:  []string{},
+		Prerouting6:  []string{},
+		Postrouting6: []string{},
+	}
+}
+
+func (r *Ruleset) addSet(name, member string) {
+	members := r.Sets[name]
+	if members == nil {
+		members = set.NewSet()
+		r.Sets[name] = members
+	}
+
+	if member != "" {
+		members.Add(member)
+	}
+}
+
+func (r *Ruleset) addStats(direction, action, protocol,
+	port string) (comment string) {
+
+	if r.stats == nil {
+		r.stats = map[string]*firewall.RuleStats{}
+	}
+
+	stat := &firewall.RuleStats{
+		Direction: direction,
+		Action:    action,
+		Protocol:  protocol,
+		Port:      port,
+	}
+	comment = stat.Key()
+	r.stats[comment] = stat
+
+	return
+}
+
+func addUnique(rules []string, rule string) []string {
+	for _, item := range rules {
+		if item == rule {
+			return rules
+		}
+	}
+	return append(rules, rule)
+}
+
+func joinRule(items ...string) string {
+	rule := []string{}
+	for _, item := range items {
+		if item != "" {
+			rule = append(rule, item)
+		}
+	}
+	return strings.Join(rule, " ")
+}
+
+func logStatement(prefix string, group int) string {
+	return fmt.Sprintf(
+		"limit rate 10/minute burst 20 packets log prefix \"%s\" group %d",
+		prefix, group)
+}
+
+func writeSets(builder *strings.Builder, sets map[string]set.Set) {
+	names := []string{}
+	for name := range sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		typ := "ipv4_addr"
+		if len(name) > 2 && name[2] == '6' {
+			typ = "ipv6_addr"
+		}
+
+		members := []string{}
+		for memberInf := range sets[name].Iter() {
+			members = append(members, memberInf.(string))
+		}
+		sort.Strings(members)
+
+		builder.WriteString(fmt.Sprintf("\tset %s {\n", name))
+		builder.WriteString(fmt.Sprintf("\t\ttype %s\n", typ))
+		builder.WriteString("\t\tflags interval\n")
+		builder.WriteString("\t\tauto-merge\n")
+		if len(members) > 0 {
+			builder.WriteString(fmt.Sprintf("\t\telements = { %s }\n",
+				strings.Join(members, ", ")))
+		}
+		builder.WriteString("\t}\n")
+	}
+}
+
+func writeChain(builder *strings.Builder, name, hook string,
+	rules []string) {
+
+	builder.WriteString(fmt.Sprintf("\tchain %s {\n", name))
+	builder.WriteString(fmt.Sprintf("\t\t%s; policy accept;\n", hook))
+	for _, rule := range rules {
+		builder.WriteString("\t\t" + rule + "\n")
+	}
+	builder.WriteString("\t}\n")
+}
+
+// Each table is created and deleted before being redefined to replace
+// the namespace ruleset in a single atomic transaction
+func (r *Ruleset) Script() string {
+	if r.script != "" {
+		return r.script
+	}
+
+	builder := &strings.Builder{}
+
+	for _, table := range tables {
+		builder.WriteString(fmt.Sprintf(
+			"table %s %s\n", table[0], table[1]))
+		builder.WriteString(fmt.Sprintf(
+			"delete table %s %s\n", table[0], table[1]))
+	}
+
+	if len(r.Input) > 0 || len(r.Forward) > 0 {
+		builder.WriteString(fmt.Sprintf("table inet %s {\n", tableFilter))
+		writeSets(builder, r.Sets)
+		if len(r.Input) > 0 {
+			writeChain(builder, "input",
+				"type filter hook input priority 0", r.Input)
+		}
+		if len(r.Forward) > 0 {
+			writeChain(builder, "forward",
+				"type filter hook forward priority 0", r.Forward)
+		}
+		builder.WriteString("}\n")
+	}
+
+	if len(r.Bridge) > 0 {
+		builder.WriteString(fmt.Sprintf("table bridge %s {\n", tableFilter))
+		writeSets(builder, r.Sets)
+		writeChain(builder, "forward",
+			"type filter hook forward priority 0", r.Bridge)
+		builder.WriteString("}\n")
+	}
+
+	if len(r.Prerouting) > 0 || len(r.Postrouting) > 0 {
+		builder.WriteString(fmt.Sprintf("table ip %s {\n", tableNat))
+		writeChain(builder, "prerouting",
+			"type nat hook prerouting priority -100", r.Prerouting)
+		writeChain(builder, "postrouting",
+			"type nat hook postrouting priority 100", r.Postrouting)
+		builder.WriteString("}\n")
+	}
+
+	if len(r.Prerouting6) > 0 || len(r.Postrouting6) > 0 {
+		builder.WriteString(fmt.Sprintf("table ip6 %s {\n", tableNat))
+		writeChain(builder, "prerouting",
+			"type nat hook prerouting priority -100", r.Prerouting6)
+		writeChain(builder, "postrouting",
+			"type nat hook postrouting priority 100", r.Postrouting6)
+		builder.WriteString("}\n")
+	}
+
+	r.script = builder.String()
+
+	return r.script
+}
+
+type family struct {
+	bridge bool
+}
+
+func (f family) match(ipv6 bool) string {
+	if f.bridge {
+		if ipv6 {
+			return "ether type ip6"
+		}
+		return "ether type ip"
+	}
+
+	if ipv6 {
+		return "meta nfproto ipv6"
+	}
+	return "meta nfproto ipv4"
+}
+
+func (f family) protocol(protocol string, ipv6 bool) string {
+	if protocol == firewall.Icmp {
+		if ipv6 {
+			protocol = "ipv6-icmp"
+		} else {
+			protocol = "icmp"
+		}
+	}
+
+	if f.bridge {
+		if ipv6 {
+			return "ip6 nexthdr " + protocol
+		}
+		return "ip protocol " + protocol
+	}
+
+	return "meta l4proto " + protocol
+}
+
+func (f family) address(ipv6 bool, dest bool) string {
+	match := "saddr"
+	if dest {
+		match = "daddr"
+	}
+
+	if ipv6 {
+		return "ip6 " + match
+	}
+	return "ip " + match
+}
+
+func matchValues(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return "{ " + strings.Join(values, ", ") + " }"
+}
+
+func matchType(rule *firewall.Rule, ipv6 bool) (match string, ok bool) {
+	switch rule.Protocol {
+	case firewall.Icmp:
+		if len(rule.IcmpTypes) == 0 {
+			break
+		}
+
+		types := []string{}
+		for _, name := range rule.IcmpTypes {
+			icmpType, valid := firewall.GetIcmpType(name, ipv6)
+			if valid {
+				types = append(types, strconv.Itoa(icmpType))
+			}
+		}
+
+		if len(types) == 0 {
+			return
+		}
+
+		if ipv6 {
+			match = "icmpv6 type " + matchValues(types)
+		} else {
+			match = "icmp type " + matchValues(types)
+		}
+		break
+	case firewall.Tcp, firewall.Udp, firewall.Sctp:
+		match = rule.Protocol + " dport " + matchValues(rule.GetPorts())
+		break
+	}
+
+	ok = true
+	return
+}
+
+func generateRules(ruleset *Ruleset, fam family, iface string,
+	rules []*firewall.Rule, egress bool) (rulesOut []string) {
+
+	rulesOut = []string{}
+
+	for _, rule := range rules {
+		all4 := false
+		all6 := false
+		set4 := false
+		set6 := false
+		var setName, setName6 string
+		var ips []string
+		if egress {
+			setName = rule.EgressSetName(false)
+			setName6 = rule.EgressSetName(true)
+			ips = rule.DestIps
+		} else {
+			setName = rule.SetName(false)
+			setName6 = rule.SetName(true)
+			ips = rule.SourceIps
+		}
+
+		if setName == "" || setName6 == "" {
+			continue
+		}
+
+		switch rule.Protocol {
+		case firewall.All, firewall.Icmp, firewall.Tcp, firewall.Udp,
+			firewall.Sctp, firewall.Gre, firewall.Esp:
+
+			break
+		default:
+			continue
+		}
+
+		for _, ip := range ips {
+			ipv6 := strings.Contains(ip, ":")
+			all := ip == "0.0.0.0/0" || ip == "::/0"
+
+			if ip == "0.0.0.0/0" {
+				if all4 {
+					continue
+				}
+				all4 = true
+			} else if ip == "::/0" {
+				if all6 {
+					continue
+				}
+				all6 = true
+			} else {
+				if ipv6 {
+					ip = strings.Replace(ip, "/128", "", 1)
+					ruleset.addSet(setName6, ip)
+					if set6 {
+						continue
+					}
+					set6 = true
+				} else {
+					ip = strings.Replace(ip, "/32", "", 1)
+					ruleset.addSet(setName, ip)
+					if set4 {
+						continue
+					}
+					set4 = true
+				}
+			}
+
+			addrMatch := ""
+			if all {
+				addrMatch = fam.match(ipv6)
+			} else if ipv6 {
+				addrMatch = fam.address(ipv6, egress) + " @" + setName6
+			} else {
+				addrMatch = fam.address(ipv6, egress) + " @" + setName
+			}
+
+			protoMatch := ""
+			if rule.Protocol != firewall.All {
+				protoMatch = fam.protocol(rule.Protocol, ipv6)
+			}
+
+			typeMatch, ok := matchType(rule, ipv6)
+			if !ok {
+				continue
+			}
+
+			stateMatch := ""
+			if rule.GetConnState() == firewall.StateNew {
+				stateMatch = "ct state new"
+			}
+
+			match := joinRule(iface, addrMatch, protoMatch, typeMatch,
+				stateMatch)
+
+			if fam.bridge {
+				if rule.Log {
+					group := firewall.NflogIngressAccept
+					if egress {
+						group = firewall.NflogEgressAccept
+					}
+					rulesOut = append(rulesOut, joinRule(match,
+						logStatement(rule.LogPrefix(egress), group)))
+				}
+
+				direction := firewall.Ingress
+				if egress {
+					direction = firewall.Egress
+				}
+				comment := ruleset.addStats(direction, firewall.Accept,
+					rule.Protocol, rule.Port)
+
+				rulesOut = append(rulesOut, joinRule(match,
+					"counter accept comment \""+comment+"\""))
+			} else {
+				rulesOut = append(rulesOut, joinRule(match, "accept"))
+			}
+		}
+	}
+
+	return
+}
+
+func generateVirt(ruleset *Ruleset, iface string, ingress,
+	egress []*firewall.Rule, logDropped bool) {
+
+	fam := family{
+		bridge: true,
+	}
+	ifaceOut := fmt.Sprintf("oifname \"%s\"", iface)
+	ifaceIn := fmt.Sprintf("iifname \"%s\"", iface)
+
+	rules := []string{
+		joinRule(ifaceOut, "meta pkttype multicast accept"),
+		joinRule(ifaceOut, "meta pkttype broadcast accept"),
+		joinRule(ifaceOut, "ct state established,related accept"),
+	}
+
+	rules = append(rules, generateRules(
+		ruleset, fam, ifaceOut, ingress, false)...)
+
+	rules = append(rules, joinRule(ifaceOut, "ct state invalid drop"))
+	if logDropped {
+		rules = append(rules, joinRule(ifaceOut,
+			logStatement("pc_drop", firewall.NflogIngressDrop)))
+	}
+	comment := ruleset.addStats(firewall.Ingress, firewall.Drop,
+		firewall.All, "")
+	rules = append(rules, joinRule(ifaceOut,
+		"counter drop comment \""+comment+"\""))
+
+	if len(egress) > 0 {
+		rules = append(rules,
+			joinRule(ifaceIn, "ct state established,related accept"),
+			joinRule(ifaceIn, "meta pkttype broadcast accept"),
+			joinRule(ifaceIn, "ip protocol udp udp dport 67 accept"),
+			joinRule(ifaceIn, "ip6 nexthdr ipv6-icmp accept"),
+			joinRule(ifaceIn, "ip6 nexthdr udp udp dport 547 accept"),
+		)
+
+		rules = append(rules, generateRules(
+			ruleset, fam, ifaceIn, egress, true)...)
+
+		rules = append(rules, joinRule(ifaceIn, "ct state invalid drop"))
+		if logDropped {
+			rules = append(rules, joinRule(ifaceIn,
+				logStatement("pc_drop", firewall.NflogEgressDrop)))
+		}
+		comment = ruleset.addStats(firewall.Egress, firewall.Drop,
+			firewall.All, "")
+		rules = append(rules, joinRule(ifaceIn,
+			"counter drop comment \""+comment+"\""))
+	}
+
+	ruleset.Bridge = append(ruleset.Bridge, rules...)
+}
+
+func generateInternal(ruleset *Ruleset, iface string, nat bool,
+	natAddr, natPubAddr, natAddr6, natPubAddr6 string,
+	ingress []*firewall.Rule) {
+
+	fam := family{}
+	ifaceIn := fmt.Sprintf("iifname \"%s\"", iface)
+
+	if nat {
+		if natAddr != "" && natPubAddr != "" {
+			ruleset.Prerouting = addUnique(ruleset.Prerouting,
+				fmt.Sprintf("ip daddr %s dnat to %s", natPubAddr, natAddr))
+			ruleset.Postrouting = addUnique(ruleset.Postrouting,
+				fmt.Sprintf("ip saddr %s oifname \"%s\" masquerade",
+					natAddr, iface))
+		}
+
+		if natAddr6 != "" && natPubAddr6 != "" {
+			ruleset.Prerouting6 = addUnique(ruleset.Prerouting6,
+				fmt.Sprintf("ip6 daddr %s dnat to %s",
+					natPubAddr6, natAddr6))
+			ruleset.Postrouting6 = addUnique(ruleset.Postrouting6,
+				fmt.Sprintf("ip6 saddr %s oifname \"%s\" masquerade",
+					natAddr6, iface))
+		}
+	}
+
+	rules := []string{
+		joinRule(ifaceIn, "meta pkttype multicast accept"),
+		joinRule(ifaceIn, "meta pkttype broadcast accept"),
+		joinRule(ifaceIn, "ct state established,related accept"),
+	}
+
+	rules = append(rules, generateRules(
+		ruleset, fam, ifaceIn, ingress, false)...)
+
+	rules = append(rules,
+		joinRule(ifaceIn, "ct state invalid drop"),
+		joinRule(ifaceIn, "drop"),
+	)
+
+	ruleset.Forward = append(ruleset.Forward, rules...)
+}
+
+func generateHost(ruleset *Ruleset, ingress []*firewall.Rule) {
+	fam := family{}
+
+	rules := []string{
+		"iifname \"lo\" accept",
+		"meta pkttype multicast accept",
+		"meta pkttype broadcast accept",
+		"ct state established,related accept",
+	}
+
+	rules = append(rules, generateRules(
+		ruleset, fam, "", ingress, false)...)
+
+	rules = append(rules,
+		"ct state invalid drop",
+		"drop",
+	)
+
+	ruleset.Input = append(ruleset.Input, rules...)
+}
+
+func generateHostNat(ruleset *Ruleset, iface string, excludes set.Set) {
+	natExcludes := []string{}
+	for excludeInf := range excludes.Iter() {
+		natExcludes = append(natExcludes, excludeInf.(string))
+	}
+	sort.Strings(natExcludes)
+
+	for _, exclude := range natExcludes {
+		if strings.Contains(exclude, ":") {
+			continue
+		}
+
+		ruleset.Postrouting = append(ruleset.Postrouting,
+			fmt.Sprintf("ip daddr %s accept", exclude))
+	}
+
+	ruleset.Postrouting = append(ruleset.Postrouting,
+		fmt.Sprintf("oifname \"%s\" masquerade", iface))
+}
@@ -0,0 +1,102 @@
+package nftables
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pritunl/pritunl-cloud/firewall"
+	"github.com/pritunl/pritunl-cloud/utils"
+)
+
+var counterReg = regexp.MustCompile(
+	`counter packets ([0-9]+) bytes ([0-9]+).*comment "([^"]+)"`)
+
+type counter struct {
+	Packets int64
+	Bytes   int64
+}
+
+func loadCounters(namespace string) (
+	counters map[string]*counter, err error) {
+
+	counters = map[string]*counter{}
+
+	output, err := utils.ExecOutput("",
+		"ip", "netns", "exec", namespace,
+		"nft", "list", "table", "bridge", tableFilter)
+	if err != nil {
+		return
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		match := counterReg.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		packets, e := strconv.ParseInt(match[1], 10, 64)
+		if e != nil {
+			continue
+		}
+		bytes, e := strconv.ParseInt(match[2], 10, 64)
+		if e != nil {
+			continue
+		}
+
+		cnt := counters[match[3]]
+		if cnt == nil {
+			cnt = &counter{}
+			counters[match[3]] = cnt
+		}
+		cnt.Packets += packets
+		cnt.Bytes += bytes
+	}
+
+	return
+}
+
+func GetStats() (stats map[string][]*firewall.RuleStats, err error) {
+	lockId := stateLock.Lock()
+	defer stateLock.Unlock(lockId)
+
+	stats = map[string][]*firewall.RuleStats{}
+
+	if curState == nil {
+		return
+	}
+
+	for namespace, ruleset := range curState.Namespaces {
+		if namespace == "0" || len(ruleset.stats) == 0 {
+			continue
+		}
+
+		counters, e := loadCounters(namespace)
+		if e != nil {
+			err = e
+			return
+		}
+
+		ruleStats := []*firewall.RuleStats{}
+		for key, stat := range ruleset.stats {
+			ruleStat := &firewall.RuleStats{
+				Direction: stat.Direction,
+				Action:    stat.Action,
+				Protocol:  stat.Protocol,
+				Port:      stat.Port,
+			}
+
+			cnt := counters[key]
+			if cnt != nil {
+				ruleStat.Packets = cnt.Packets
+				ruleStat.Bytes = cnt.Bytes
+			}
+
+			ruleStats = append(ruleStats, ruleStat)
+		}
+
+		stats[namespace] = ruleStats
+	}
+
+	return
+}
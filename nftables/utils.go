@@ -0,0 +1,391 @@
+package nftables
+
+import (
+	"os/exec"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/disk"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/firewall"
+	"github.com/pritunl/pritunl-cloud/instance"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/paths"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/pritunl/pritunl-cloud/vm"
+	"github.com/sirupsen/logrus"
+)
+
+func diffRuleset(a, b *Ruleset) bool {
+	return a.Script() != b.Script()
+}
+
+func (r *Ruleset) Apply() (err error) {
+	err = utils.ExistsMkdir(paths.GetTempPath(), 0755)
+	if err != nil {
+		return
+	}
+
+	scriptPath := paths.GetNftablesTempPath()
+	defer utils.Remove(scriptPath)
+
+	err = utils.CreateWrite(scriptPath, r.Script(), 0600)
+	if err != nil {
+		return
+	}
+
+	args := []string{"-f", scriptPath}
+	name := "nft"
+	if r.Namespace != "0" {
+		args = append([]string{"netns", "exec", r.Namespace, "nft"},
+			args...)
+		name = "ip"
+	}
+
+	output, err := utils.ExecCombinedOutput("", name, args...)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"namespace": r.Namespace,
+			"output":    output,
+			"error":     err,
+		}).Error("nftables: Failed to apply nftables ruleset")
+
+		err = &errortypes.ExecError{
+			errors.Wrap(err, "nftables: Failed to apply nftables ruleset"),
+		}
+		return
+	}
+
+	return
+}
+
+func (r *Ruleset) Remove() (err error) {
+	return newRuleset(r.Namespace).Apply()
+}
+
+func applyState(oldState, newState *State, namespaces []string) (err error) {
+	changed := false
+	namespacesSet := set.NewSet()
+	for _, namespace := range namespaces {
+		namespacesSet.Add(namespace)
+	}
+
+	for namespace, ruleset := range oldState.Namespaces {
+		if _, ok := newState.Namespaces[namespace]; ok {
+			continue
+		}
+
+		if namespace != "0" && !namespacesSet.Contains(namespace) {
+			continue
+		}
+
+		err = ruleset.Remove()
+		if err != nil {
+			return
+		}
+	}
+
+	for _, ruleset := range newState.Namespaces {
+		if ruleset.Namespace != "0" &&
+			!namespacesSet.Contains(ruleset.Namespace) {
+
+			_, err = utils.ExecCombinedOutputLogged(
+				[]string{"File exists"},
+				"ip", "netns",
+				"add", ruleset.Namespace,
+			)
+			if err != nil {
+				return
+			}
+		}
+
+		oldRuleset := oldState.Namespaces[ruleset.Namespace]
+		if oldRuleset != nil && !diffRuleset(oldRuleset, ruleset) {
+			continue
+		}
+
+		if !changed {
+			changed = true
+			logrus.Info("nftables: Updating nftables")
+		}
+
+		err = ruleset.Apply()
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func UpdateState(nodeSelf *node.Node, instances []*instance.Instance,
+	namespaces []string, nodeFirewall []*firewall.Rule,
+	firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule, logDropped set.Set) (
+	err error) {
+
+	lockId := stateLock.Lock()
+	defer stateLock.Unlock(lockId)
+
+	nodeNetworkMode := node.Self.NetworkMode
+	if nodeNetworkMode == "" {
+		nodeNetworkMode = node.Dhcp
+	}
+	nodeNetworkMode6 := node.Self.NetworkMode6
+
+	externalNetwork := true
+	if nodeNetworkMode == node.Internal {
+		externalNetwork = false
+	}
+
+	externalNetwork6 := false
+	if nodeNetworkMode6 != "" && (nodeNetworkMode != nodeNetworkMode6 ||
+		(nodeNetworkMode6 == node.Static)) {
+
+		externalNetwork6 = true
+	}
+
+	newState := &State{
+		Namespaces: map[string]*Ruleset{},
+	}
+
+	hostRuleset := newRuleset("0")
+	newState.Namespaces["0"] = hostRuleset
+
+	if nodeFirewall != nil {
+		generateHost(hostRuleset, nodeFirewall)
+	}
+
+	hostNetwork := false
+	if !nodeSelf.HostBlock.IsZero() && nodeSelf.DefaultInterface != "" {
+		hostNetwork = true
+
+		if nodeSelf.HostNat {
+			natExcludes := set.NewSet()
+			for _, natExclude := range nodeSelf.HostNatExcludes {
+				natExcludes.Add(natExclude)
+			}
+
+			generateHostNat(hostRuleset, nodeSelf.DefaultInterface,
+				natExcludes)
+		}
+	}
+
+	for _, inst := range instances {
+		if !inst.IsActive() {
+			continue
+		}
+
+		namespace := vm.GetNamespace(inst.Id, 0)
+		iface := vm.GetIface(inst.Id, 0)
+		ifaceExternal := vm.GetIfaceExternal(inst.Id, 0)
+		ifaceExternal6 := vm.GetIfaceExternal(inst.Id, 1)
+		ifaceHost := vm.GetIfaceHost(inst.Id, 0)
+
+		addr := ""
+		addr6 := ""
+		pubAddr := ""
+		pubAddr6 := ""
+		if inst.PrivateIps != nil && len(inst.PrivateIps) != 0 {
+			addr = inst.PrivateIps[0]
+		}
+		if inst.PrivateIps6 != nil && len(inst.PrivateIps6) != 0 {
+			addr6 = inst.PrivateIps6[0]
+		}
+		if inst.PublicIps != nil && len(inst.PublicIps) != 0 {
+			pubAddr = inst.PublicIps[0]
+		}
+		if inst.PublicIps6 != nil && len(inst.PublicIps6) != 0 {
+			pubAddr6 = inst.PublicIps6[0]
+		}
+
+		_, ok := newState.Namespaces[namespace]
+		if ok {
+			logrus.WithFields(logrus.Fields{
+				"namespace": namespace,
+				"interface": iface,
+			}).Error("nftables: Virtual interface conflict")
+
+			err = &errortypes.ParseError{
+				errors.New("nftables: Virtual interface conflict"),
+			}
+			return
+		}
+
+		ingress := firewalls[namespace]
+		if ingress == nil {
+			logrus.WithFields(logrus.Fields{
+				"instance_id": inst.Id.Hex(),
+				"namespace":   namespace,
+			}).Warn("nftables: Failed to load instance firewall rules")
+			continue
+		}
+
+		ruleset := newRuleset(namespace)
+		newState.Namespaces[namespace] = ruleset
+
+		if externalNetwork {
+			generateInternal(ruleset, ifaceExternal,
+				true, addr, pubAddr, addr6, pubAddr6, ingress)
+		}
+
+		if externalNetwork6 &&
+			(!externalNetwork || ifaceExternal != ifaceExternal6) {
+
+			generateInternal(ruleset, ifaceExternal6,
+				true, addr, pubAddr, addr6, pubAddr6, ingress)
+		}
+
+		if hostNetwork {
+			generateInternal(ruleset, ifaceHost,
+				false, "", "", "", "", ingress)
+		}
+
+		generateVirt(ruleset, iface, ingress,
+			firewallsEgress[namespace], logDropped.Contains(namespace))
+
+		for i := 1; i < len(inst.Virt.NetworkAdapters); i++ {
+			adapterNamespace := vm.GetNamespace(inst.Id, i)
+			adapterIface := vm.GetIface(inst.Id, i)
+
+			adapterIngress := firewalls[adapterNamespace]
+			if adapterIngress == nil {
+				logrus.WithFields(logrus.Fields{
+					"instance_id": inst.Id.Hex(),
+					"namespace":   adapterNamespace,
+				}).Warn("nftables: Failed to load instance firewall rules")
+				continue
+			}
+
+			adapterRuleset := newRuleset(adapterNamespace)
+			newState.Namespaces[adapterNamespace] = adapterRuleset
+
+			generateVirt(adapterRuleset, adapterIface, adapterIngress,
+				firewallsEgress[adapterNamespace],
+				logDropped.Contains(adapterNamespace))
+		}
+	}
+
+	err = applyState(curState, newState, namespaces)
+	if err != nil {
+		return
+	}
+
+	curState = newState
+
+	return
+}
+
+// Removes all pritunl-cloud tables, used when switching to the
+// iptables backend
+func Reset(namespaces []string) (err error) {
+	lockId := stateLock.Lock()
+	defer stateLock.Unlock(lockId)
+
+	_, e := exec.LookPath("nft")
+	if e != nil {
+		curState = nil
+		return
+	}
+
+	err = newRuleset("0").Apply()
+	if err != nil {
+		return
+	}
+
+	for _, namespace := range namespaces {
+		err = newRuleset(namespace).Apply()
+		if err != nil {
+			return
+		}
+	}
+
+	curState = nil
+
+	return
+}
+
+// Rulesets are applied atomically so recovery only needs to reapply
+// the full state
+func Recover() (err error) {
+	db := database.GetDatabase()
+	defer db.Close()
+
+	namespaces, err := utils.GetNamespaces()
+	if err != nil {
+		return
+	}
+
+	disks, err := disk.GetNode(db, node.Self.Id)
+	if err != nil {
+		return
+	}
+
+	instances, err := instance.GetAllVirt(db, &bson.M{
+		"node": node.Self.Id,
+	}, disks)
+	if err != nil {
+		return
+	}
+
+	nodeFirewall, firewalls, firewallsEgress, logDropped, err :=
+		firewall.GetAllRules(db, node.Self, instances)
+	if err != nil {
+		return
+	}
+
+	err = Init(namespaces, instances, nodeFirewall, firewalls,
+		firewallsEgress, logDropped)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func Init(namespaces []string, instances []*instance.Instance,
+	nodeFirewall []*firewall.Rule, firewalls map[string][]*firewall.Rule,
+	firewallsEgress map[string][]*firewall.Rule, logDropped set.Set) (
+	err error) {
+
+	utils.ExecCombinedOutput(
+		"", "sysctl", "-w", "net.bridge.bridge-nf-call-iptables=0",
+	)
+	utils.ExecCombinedOutput(
+		"", "sysctl", "-w", "net.bridge.bridge-nf-call-ip6tables=0",
+	)
+
+	utils.ExecCombinedOutput(
+		"", "modprobe", "nf_conntrack_bridge",
+	)
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil, "sysctl", "-w", "net.ipv4.ip_forward=1",
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil, "sysctl", "-w", "net.ipv6.conf.all.forwarding=1",
+	)
+	if err != nil {
+		return
+	}
+
+	// Rulesets fully replace existing tables, an empty state applies every
+	// namespace on the first update
+	curState = &State{
+		Namespaces: map[string]*Ruleset{},
+	}
+
+	err = UpdateState(node.Self, instances, namespaces,
+		nodeFirewall, firewalls, firewallsEgress, logDropped)
+	if err != nil {
+		return
+	}
+
+	return
+}
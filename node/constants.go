@@ -17,5 +17,8 @@ const (
 	Static   = "static"
 	Internal = "internal"
 
+	Iptables = "iptables"
+	Nftables = "nftables"
+
 	Restart = "restart"
 )
@@ -79,6 +79,7 @@ type Node struct {
 	PciPassthrough       bool                 `bson:"pci_passthrough" json:"pci_passthrough"`
 	PciDevices           []*pci.Device        `bson:"pci_devices" json:"pci_devices"`
 	Firewall             bool                 `bson:"firewall" json:"firewall"`
+	FirewallBackend      string               `bson:"firewall_backend" json:"firewall_backend"`
 	NetworkRoles         []string             `bson:"network_roles" json:"network_roles"`
 	Memory               float64              `bson:"memory" json:"memory"`
 	Load1                float64              `bson:"load1" json:"load1"`
@@ -153,6 +154,7 @@ func (n *Node) Copy() *Node {
 		PciPassthrough:       n.PciPassthrough,
 		PciDevices:           n.PciDevices,
 		Firewall:             n.Firewall,
+		FirewallBackend:      n.FirewallBackend,
 		NetworkRoles:         n.NetworkRoles,
 		Memory:               n.Memory,
 		Load1:                n.Load1,
@@ -365,6 +367,20 @@ func (n *Node) Validate(db *database.Database) (
 		return
 	}
 
+	switch n.FirewallBackend {
+	case Iptables, Nftables:
+		break
+	case "":
+		n.FirewallBackend = Iptables
+		break
+	default:
+		errData = &errortypes.ErrorData{
+			Error:   "invalid_firewall_backend",
+			Message: "Firewall backend invalid",
+		}
+		return
+	}
+
 	if n.ExternalInterfaces == nil {
 		n.ExternalInterfaces = []string{}
 	}
@@ -798,6 +814,7 @@ func (n *Node) update(db *database.Database) (err error) {
 	n.UsbPassthrough = nde.UsbPassthrough
 	n.PciPassthrough = nde.PciPassthrough
 	n.Firewall = nde.Firewall
+	n.FirewallBackend = nde.FirewallBackend
 	n.NetworkRoles = nde.NetworkRoles
 	n.VirtPath = nde.VirtPath
 	n.CachePath = nde.CachePath
@@ -9,10 +9,11 @@ import (
 )
 
 type Organization struct {
-	Id      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Roles   []string           `bson:"roles" json:"roles"`
-	Name    string             `bson:"name" json:"name"`
-	Comment string             `bson:"comment" json:"comment"`
+	Id        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Roles     []string           `bson:"roles" json:"roles"`
+	Name      string             `bson:"name" json:"name"`
+	Comment   string             `bson:"comment" json:"comment"`
+	BackupKey []byte             `bson:"backup_key,omitempty" json:"-"`
 }
 
 func (d *Organization) Validate(db *database.Database) (
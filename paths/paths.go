@@ -54,6 +54,11 @@ func GetImageTempPath() string {
 		fmt.Sprintf("image-%s", primitive.NewObjectID().Hex()))
 }
 
+func GetNftablesTempPath() string {
+	return path.Join(GetTempPath(),
+		fmt.Sprintf("nftables-%s", primitive.NewObjectID().Hex()))
+}
+
 func GetDiskMountPath() string {
 	return path.Join(GetTempPath(), primitive.NewObjectID().Hex())
 }
@@ -93,6 +98,26 @@ func GetPidPath(virtId primitive.ObjectID) string {
 		fmt.Sprintf("%s.pid", virtId.Hex()))
 }
 
+func GetDhcpPidPath(virtId primitive.ObjectID, n int) string {
+	return path.Join(settings.Hypervisor.RunPath,
+		fmt.Sprintf("%s_%d.dhcp.pid", virtId.Hex(), n))
+}
+
+func GetDnsHostsPath(vpcId primitive.ObjectID) string {
+	return path.Join(settings.Hypervisor.RunPath,
+		fmt.Sprintf("%s.hosts", vpcId.Hex()))
+}
+
+func GetDnsServersPath(vpcId primitive.ObjectID) string {
+	return path.Join(settings.Hypervisor.RunPath,
+		fmt.Sprintf("%s.servers", vpcId.Hex()))
+}
+
+func GetDnsOptsPath(vpcId primitive.ObjectID) string {
+	return path.Join(settings.Hypervisor.RunPath,
+		fmt.Sprintf("%s.opts", vpcId.Hex()))
+}
+
 func GetSockPath(virtId primitive.ObjectID) string {
 	return path.Join(settings.Hypervisor.RunPath,
 		fmt.Sprintf("%s.sock", virtId.Hex()))
@@ -0,0 +1,253 @@
+package peering
+
+import (
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/vpc"
+)
+
+type Peering struct {
+	Id               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name             string             `bson:"name" json:"name"`
+	Comment          string             `bson:"comment" json:"comment"`
+	Datacenter       primitive.ObjectID `bson:"datacenter" json:"datacenter"`
+	Organization     primitive.ObjectID `bson:"organization" json:"organization"`
+	Vpc              primitive.ObjectID `bson:"vpc" json:"vpc"`
+	PeerOrganization primitive.ObjectID `bson:"peer_organization" json:"peer_organization"`
+	PeerVpc          primitive.ObjectID `bson:"peer_vpc" json:"peer_vpc"`
+	Accepted         bool               `bson:"accepted" json:"accepted"`
+	PeerAccepted     bool               `bson:"peer_accepted" json:"peer_accepted"`
+	Active           bool               `bson:"active" json:"active"`
+}
+
+func (p *Peering) IsActive() bool {
+	return p.Accepted && p.PeerAccepted
+}
+
+func (p *Peering) GetPeer(vcId primitive.ObjectID) primitive.ObjectID {
+	if p.Vpc == vcId {
+		return p.PeerVpc
+	}
+	return p.Vpc
+}
+
+func (p *Peering) Validate(db *database.Database) (
+	errData *errortypes.ErrorData, err error) {
+
+	if p.Vpc.IsZero() || p.PeerVpc.IsZero() {
+		errData = &errortypes.ErrorData{
+			Error:   "vpc_required",
+			Message: "Missing required VPC",
+		}
+		return
+	}
+
+	if p.Vpc == p.PeerVpc {
+		errData = &errortypes.ErrorData{
+			Error:   "peer_vpc_invalid",
+			Message: "VPC cannot peer with itself",
+		}
+		return
+	}
+
+	vc, err := vpc.Get(db, p.Vpc)
+	if err != nil {
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+			errData = &errortypes.ErrorData{
+				Error:   "vpc_not_found",
+				Message: "VPC not found",
+			}
+		}
+		return
+	}
+
+	// Peer vpcs that do not exist and vpcs of other organizations that
+	// have not granted peering return the same error
+	peerVc, err := vpc.Get(db, p.PeerVpc)
+	if err != nil {
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+			errData = &errortypes.ErrorData{
+				Error:   "peer_vpc_invalid",
+				Message: "Peer VPC invalid",
+			}
+		}
+		return
+	}
+
+	if !peerVc.CanPeer(vc.Organization) {
+		errData = &errortypes.ErrorData{
+			Error:   "peer_vpc_invalid",
+			Message: "Peer VPC invalid",
+		}
+		return
+	}
+
+	p.Organization = vc.Organization
+	p.PeerOrganization = peerVc.Organization
+	p.Datacenter = vc.Datacenter
+	p.Active = p.IsActive()
+
+	if vc.Datacenter != peerVc.Datacenter {
+		errData = &errortypes.ErrorData{
+			Error:   "peer_vpc_datacenter_invalid",
+			Message: "Peer VPC must be in the same datacenter",
+		}
+		return
+	}
+
+	coll := db.VpcPeerings()
+	n, err := coll.CountDocuments(db, &bson.M{
+		"_id": &bson.M{
+			"$ne": p.Id,
+		},
+		"$or": []*bson.M{
+			&bson.M{
+				"vpc":      p.Vpc,
+				"peer_vpc": p.PeerVpc,
+			},
+			&bson.M{
+				"vpc":      p.PeerVpc,
+				"peer_vpc": p.Vpc,
+			},
+		},
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	if n > 0 {
+		errData = &errortypes.ErrorData{
+			Error:   "peering_exists",
+			Message: "VPC peering already exists",
+		}
+		return
+	}
+
+	vcPeerIds, err := GetPeerIds(db, p.Vpc, p.Id)
+	if err != nil {
+		return
+	}
+	vcPeers, err := vpc.GetIds(db, vcPeerIds)
+	if err != nil {
+		return
+	}
+
+	peerVcPeerIds, err := GetPeerIds(db, p.PeerVpc, p.Id)
+	if err != nil {
+		return
+	}
+	peerVcPeers, err := vpc.GetIds(db, peerVcPeerIds)
+	if err != nil {
+		return
+	}
+
+	overlap, err := networksOverlap(vc, peerVc, vcPeers, peerVcPeers)
+	if err != nil {
+		return
+	}
+
+	if overlap {
+		errData = &errortypes.ErrorData{
+			Error: "peer_vpc_network_overlap",
+			Message: "VPC network overlaps with " +
+				"peered VPC network",
+		}
+		return
+	}
+
+	return
+}
+
+// Each namespace routes to all of its peers, the network of each side must
+// not overlap with the other side or any of the existing peers of the
+// other side
+func networksOverlap(vc, peerVc *vpc.Vpc, vcPeers,
+	peerVcPeers []*vpc.Vpc) (overlap bool, err error) {
+
+	checks := []struct {
+		vc     *vpc.Vpc
+		others []*vpc.Vpc
+	}{
+		{vc, append([]*vpc.Vpc{peerVc}, peerVcPeers...)},
+		{peerVc, append([]*vpc.Vpc{vc}, vcPeers...)},
+	}
+
+	for _, check := range checks {
+		network1, e := check.vc.GetNetwork()
+		if e != nil {
+			err = e
+			return
+		}
+
+		for _, vc2 := range check.others {
+			if vc2.Id == check.vc.Id {
+				continue
+			}
+
+			network2, e := vc2.GetNetwork()
+			if e != nil {
+				err = e
+				return
+			}
+
+			if network1.Contains(network2.IP) ||
+				network2.Contains(network1.IP) {
+
+				overlap = true
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (p *Peering) Commit(db *database.Database) (err error) {
+	coll := db.VpcPeerings()
+
+	err = coll.Commit(p.Id, p)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (p *Peering) CommitFields(db *database.Database, fields set.Set) (
+	err error) {
+
+	coll := db.VpcPeerings()
+
+	err = coll.CommitFields(p.Id, p, fields)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (p *Peering) Insert(db *database.Database) (err error) {
+	coll := db.VpcPeerings()
+
+	if !p.Id.IsZero() {
+		err = &errortypes.DatabaseError{
+			errors.New("peering: Peering already exists"),
+		}
+		return
+	}
+
+	_, err = coll.InsertOne(db, p)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
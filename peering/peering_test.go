@@ -0,0 +1,62 @@
+package peering
+
+import (
+	"testing"
+
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/vpc"
+)
+
+func newVpc(network string) *vpc.Vpc {
+	return &vpc.Vpc{
+		Id:      primitive.NewObjectID(),
+		Network: network,
+	}
+}
+
+func TestNetworksOverlapHubSpokes(t *testing.T) {
+	hub := newVpc("10.0.0.0/16")
+	spokeA := newVpc("10.1.0.0/16")
+	spokeB := newVpc("10.1.0.0/24")
+
+	// Hub is already peered with spoke A, peering spoke B to the hub
+	// must be rejected since the hub would route both spokes
+	overlap, err := networksOverlap(spokeB, hub, nil, []*vpc.Vpc{spokeA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !overlap {
+		t.Error("Expected overlap of spoke with existing hub peer")
+	}
+
+	// Same peering requested from the hub side
+	overlap, err = networksOverlap(hub, spokeB, []*vpc.Vpc{spokeA}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !overlap {
+		t.Error("Expected overlap of spoke with existing hub peer")
+	}
+
+	// Peering is not transitive, existing peers of the hub and of the
+	// spoke are never routed to each other and may overlap
+	spokeC := newVpc("10.2.0.0/16")
+	other := newVpc("10.1.0.0/24")
+	overlap, err = networksOverlap(hub, spokeC, []*vpc.Vpc{spokeA},
+		[]*vpc.Vpc{other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overlap {
+		t.Error("Unexpected overlap of unrelated peer networks")
+	}
+
+	spokeD := newVpc("10.3.0.0/16")
+	overlap, err = networksOverlap(hub, spokeD, []*vpc.Vpc{spokeA}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overlap {
+		t.Error("Unexpected overlap of distinct spoke networks")
+	}
+}
@@ -0,0 +1,303 @@
+package peering
+
+import (
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/mongo-go-driver/mongo/options"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/pritunl/pritunl-cloud/vpc"
+)
+
+func orgQuery(orgId primitive.ObjectID) []*bson.M {
+	return []*bson.M{
+		&bson.M{
+			"organization": orgId,
+		},
+		&bson.M{
+			"peer_organization": orgId,
+		},
+	}
+}
+
+func Get(db *database.Database, peeringId primitive.ObjectID) (
+	peer *Peering, err error) {
+
+	coll := db.VpcPeerings()
+	peer = &Peering{}
+
+	err = coll.FindOneId(peeringId, peer)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func GetOrg(db *database.Database, orgId, peeringId primitive.ObjectID) (
+	peer *Peering, err error) {
+
+	coll := db.VpcPeerings()
+	peer = &Peering{}
+
+	err = coll.FindOne(db, &bson.M{
+		"_id": peeringId,
+		"$or": orgQuery(orgId),
+	}).Decode(peer)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func GetAll(db *database.Database, query *bson.M) (
+	peers []*Peering, err error) {
+
+	coll := db.VpcPeerings()
+	peers = []*Peering{}
+
+	cursor, err := coll.Find(db, query)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		peer := &Peering{}
+		err = cursor.Decode(peer)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		peers = append(peers, peer)
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func GetAllPaged(db *database.Database, query *bson.M,
+	page, pageCount int64) (peers []*Peering, count int64, err error) {
+
+	coll := db.VpcPeerings()
+	peers = []*Peering{}
+
+	count, err = coll.CountDocuments(db, query)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	page = utils.Min64(page, count/pageCount)
+	skip := utils.Min64(page*pageCount, count)
+
+	cursor, err := coll.Find(
+		db,
+		query,
+		&options.FindOptions{
+			Sort: &bson.D{
+				{"name", 1},
+			},
+			Skip:  &skip,
+			Limit: &pageCount,
+		},
+	)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		peer := &Peering{}
+		err = cursor.Decode(peer)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		peers = append(peers, peer)
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+// Returns the ids of all vpcs peered with the vpc, including pending
+// peerings so that accepting a peering cannot introduce an overlap
+func GetPeerIds(db *database.Database, vcId,
+	excludeId primitive.ObjectID) (peerIds []primitive.ObjectID, err error) {
+
+	peers, err := GetAll(db, &bson.M{
+		"_id": &bson.M{
+			"$ne": excludeId,
+		},
+		"$or": []*bson.M{
+			&bson.M{
+				"vpc": vcId,
+			},
+			&bson.M{
+				"peer_vpc": vcId,
+			},
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	peerIds = []primitive.ObjectID{}
+	for _, peer := range peers {
+		peerIds = append(peerIds, peer.GetPeer(vcId))
+	}
+
+	return
+}
+
+// Returns a map of vpc ids to the vpc ids of all active peers, peerings
+// where the peer vpc no longer grants the organization are excluded
+func GetDatacenterActive(db *database.Database, dcId primitive.ObjectID,
+	vpcsMap map[primitive.ObjectID]*vpc.Vpc) (
+	peersMap map[primitive.ObjectID][]primitive.ObjectID, err error) {
+
+	peers, err := GetAll(db, &bson.M{
+		"datacenter": dcId,
+		"active":     true,
+	})
+	if err != nil {
+		return
+	}
+
+	peersMap = map[primitive.ObjectID][]primitive.ObjectID{}
+	for _, peer := range peers {
+		peerVc := vpcsMap[peer.PeerVpc]
+		if peerVc == nil || !peerVc.CanPeer(peer.Organization) {
+			continue
+		}
+
+		peersMap[peer.Vpc] = append(peersMap[peer.Vpc], peer.PeerVpc)
+		peersMap[peer.PeerVpc] = append(peersMap[peer.PeerVpc], peer.Vpc)
+	}
+
+	return
+}
+
+func Remove(db *database.Database, peeringId primitive.ObjectID) (
+	err error) {
+
+	coll := db.VpcPeerings()
+
+	_, err = coll.DeleteOne(db, &bson.M{
+		"_id": peeringId,
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+		default:
+			return
+		}
+	}
+
+	return
+}
+
+func RemoveOrg(db *database.Database, orgId, peeringId primitive.ObjectID) (
+	err error) {
+
+	coll := db.VpcPeerings()
+
+	_, err = coll.DeleteOne(db, &bson.M{
+		"_id": peeringId,
+		"$or": orgQuery(orgId),
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+		default:
+			return
+		}
+	}
+
+	return
+}
+
+func RemoveMulti(db *database.Database, peeringIds []primitive.ObjectID) (
+	err error) {
+
+	coll := db.VpcPeerings()
+
+	_, err = coll.DeleteMany(db, &bson.M{
+		"_id": &bson.M{
+			"$in": peeringIds,
+		},
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func RemoveMultiOrg(db *database.Database, orgId primitive.ObjectID,
+	peeringIds []primitive.ObjectID) (err error) {
+
+	coll := db.VpcPeerings()
+
+	_, err = coll.DeleteMany(db, &bson.M{
+		"_id": &bson.M{
+			"$in": peeringIds,
+		},
+		"$or": orgQuery(orgId),
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func RemoveVpcs(db *database.Database, vcIds []primitive.ObjectID) (
+	err error) {
+
+	coll := db.VpcPeerings()
+
+	_, err = coll.DeleteMany(db, &bson.M{
+		"$or": []*bson.M{
+			&bson.M{
+				"vpc": &bson.M{
+					"$in": vcIds,
+				},
+			},
+			&bson.M{
+				"peer_vpc": &bson.M{
+					"$in": vcIds,
+				},
+			},
+		},
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
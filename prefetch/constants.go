@@ -0,0 +1,7 @@
+package prefetch
+
+const (
+	Cached  = "cached"
+	Failed  = "failed"
+	Skipped = "skipped"
+)
@@ -0,0 +1,73 @@
+package prefetch
+
+import (
+	"time"
+
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/mongo-go-driver/mongo/options"
+	"github.com/pritunl/pritunl-cloud/database"
+)
+
+type Entry struct {
+	Image    primitive.ObjectID `bson:"image" json:"image"`
+	Name     string             `bson:"name" json:"name"`
+	Etag     string             `bson:"etag" json:"etag"`
+	Size     int64              `bson:"size" json:"size"`
+	State    string             `bson:"state" json:"state"`
+	Error    string             `bson:"error" json:"error"`
+	LastUsed time.Time          `bson:"last_used" json:"last_used"`
+}
+
+type Status struct {
+	Id        primitive.ObjectID `bson:"_id" json:"id"`
+	Zone      primitive.ObjectID `bson:"zone" json:"zone"`
+	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
+	Free      uint64             `bson:"free" json:"free"`
+	Total     uint64             `bson:"total" json:"total"`
+	CacheSize int64              `bson:"cache_size" json:"cache_size"`
+	Evicted   int                `bson:"evicted" json:"evicted"`
+	Entries   []*Entry           `bson:"entries" json:"entries"`
+}
+
+func (s *Status) Commit(db *database.Database) (err error) {
+	coll := db.PrefetchStatus()
+
+	opts := &options.UpdateOptions{}
+	opts.SetUpsert(true)
+
+	_, err = coll.UpdateOne(db, &bson.M{
+		"_id": s.Id,
+	}, &bson.M{
+		"$set": s,
+	}, opts)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
+func Get(db *database.Database, ndeId primitive.ObjectID) (
+	status *Status, err error) {
+
+	coll := db.PrefetchStatus()
+	status = &Status{}
+
+	err = coll.FindOneId(ndeId, status)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func NewStatus(ndeId, zoneId primitive.ObjectID) *Status {
+	return &Status{
+		Id:        ndeId,
+		Zone:      zoneId,
+		Timestamp: time.Now(),
+		Entries:   []*Entry{},
+	}
+}
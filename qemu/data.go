@@ -272,6 +272,8 @@ func Destroy(db *database.Database, virt *vm.VirtualMachine) (err error) {
 	store.RemDisks(virt.Id)
 	store.RemAddress(virt.Id)
 	store.RemRoutes(virt.Id)
+	store.RemPeers(virt.Id)
+	store.RemNat(virt.Id)
 
 	return
 }
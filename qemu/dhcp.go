@@ -0,0 +1,215 @@
+package qemu
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/netfilter"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/paths"
+	"github.com/pritunl/pritunl-cloud/settings"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/pritunl/pritunl-cloud/vm"
+)
+
+type dhcpConf struct {
+	Mac       string
+	Addr      net.IP
+	Gateway   net.IP
+	Mask      net.IPMask
+	Addr6     net.IP
+	Mtu       string
+	Primary   bool
+	Namespace string
+	Vlan      string
+	Dns       bool
+	VpcId     primitive.ObjectID
+	Domain    string
+	HostsPath string
+}
+
+func getDhcpPid(virtId primitive.ObjectID, index int) (pid string) {
+	pidPath := paths.GetDhcpPidPath(virtId, index)
+
+	pidData, _ := ioutil.ReadFile(pidPath)
+	if pidData != nil {
+		pid = strings.TrimSpace(string(pidData))
+	}
+
+	return
+}
+
+// Writes the internal dns domain of the vpc to the files read by the dns
+// servers, the files are read again on reload to follow vpc renames
+func WriteDnsDomain(vpcId primitive.ObjectID, domain string) (
+	changed bool, err error) {
+
+	files := map[string]string{
+		paths.GetDnsServersPath(vpcId): fmt.Sprintf(
+			"server=/%s/\n", domain),
+		paths.GetDnsOptsPath(vpcId): fmt.Sprintf(
+			"option:domain-search,%s\n", domain),
+	}
+
+	for pth, data := range files {
+		curData, _ := ioutil.ReadFile(pth)
+		if curData != nil && string(curData) == data {
+			continue
+		}
+
+		err = utils.CreateWrite(pth, data, 0644)
+		if err != nil {
+			return
+		}
+
+		changed = true
+	}
+
+	return
+}
+
+// Reloads the internal dns hosts and domain of the instance dns servers
+func ReloadDns(virt *vm.VirtualMachine) {
+	for i := range virt.NetworkAdapters {
+		pid := getDhcpPid(virt.Id, i)
+		if pid != "" {
+			_, _ = utils.ExecCombinedOutput("", "kill", "-HUP", pid)
+		}
+	}
+}
+
+func networkStopDhcp(virt *vm.VirtualMachine, index int) {
+	pidPath := paths.GetDhcpPidPath(virt.Id, index)
+	pid := getDhcpPid(virt.Id, index)
+
+	if pid != "" {
+		_, _ = utils.ExecCombinedOutput("", "kill", pid)
+	}
+
+	_ = utils.RemoveAll(pidPath)
+
+	netfilter.RemoveDhcpFilter(vm.GetNamespace(virt.Id, index))
+}
+
+func networkStopDhcpAll(virt *vm.VirtualMachine) {
+	for i := range virt.NetworkAdapters {
+		networkStopDhcp(virt, i)
+	}
+}
+
+// Starts a dhcp server on the instance bridge that only offers the
+// address allocated to the instance, ipv6 addresses are provided with
+// router advertisements and dhcpv6. When internal dns is enabled the
+// same server resolves vpc instance names on the gateway address.
+func networkConfDhcp(virt *vm.VirtualMachine, index int,
+	conf *dhcpConf) (err error) {
+
+	networkStopDhcp(virt, index)
+
+	if !virt.DhcpServer && !conf.Dns {
+		return
+	}
+
+	err = utils.ExistsMkdir(settings.Hypervisor.RunPath, 0755)
+	if err != nil {
+		return
+	}
+
+	args := []string{
+		"ip", "netns", "exec", conf.Namespace,
+		"dnsmasq",
+		"--conf-file=/dev/null",
+		"--pid-file=" + paths.GetDhcpPidPath(virt.Id, index),
+		"--interface=br0",
+		"--except-interface=lo",
+		"--bind-interfaces",
+	}
+
+	if conf.Dns {
+		_, err = WriteDnsDomain(conf.VpcId, conf.Domain)
+		if err != nil {
+			return
+		}
+
+		args = append(args,
+			"--no-resolv",
+			"--no-hosts",
+			"--bogus-priv",
+			"--domain-needed",
+			"--server="+settings.Hypervisor.DnsServer,
+			"--server="+settings.Hypervisor.DnsServer2,
+			"--servers-file="+paths.GetDnsServersPath(conf.VpcId),
+			"--addn-hosts="+conf.HostsPath,
+		)
+	} else {
+		args = append(args, "--port=0")
+	}
+
+	if virt.DhcpServer {
+		args = append(args,
+			"--leasefile-ro",
+			fmt.Sprintf("--dhcp-range=%s,static,%s",
+				conf.Addr.String(), net.IP(conf.Mask).String()),
+			fmt.Sprintf("--dhcp-host=%s,%s,[%s]",
+				conf.Mac, conf.Addr.String(), conf.Addr6.String()),
+			fmt.Sprintf("--dhcp-range=%s,static,64", conf.Addr6.String()),
+			"--enable-ra",
+		)
+
+		if conf.Primary {
+			dnsServers := fmt.Sprintf("%s,%s",
+				settings.Hypervisor.DnsServer,
+				settings.Hypervisor.DnsServer2)
+			if conf.Dns {
+				dnsServers = conf.Gateway.String()
+			}
+
+			args = append(args,
+				fmt.Sprintf("--dhcp-option=option:router,%s",
+					conf.Gateway.String()),
+				fmt.Sprintf("--dhcp-option=option:dns-server,%s",
+					dnsServers),
+			)
+			if conf.Dns {
+				args = append(args,
+					"--dhcp-optsfile="+paths.GetDnsOptsPath(conf.VpcId),
+				)
+			}
+		} else {
+			args = append(args, "--dhcp-option=option:router")
+		}
+
+		raParam := "--ra-param=br0"
+		if conf.Mtu != "" {
+			args = append(args,
+				fmt.Sprintf("--dhcp-option=option:mtu,%s", conf.Mtu))
+			raParam += ",mtu:" + conf.Mtu
+		}
+		if conf.Primary {
+			raParam += ",60"
+		} else {
+			raParam += ",60,0"
+		}
+		args = append(args, raParam)
+	}
+
+	// The bridge is shared with the vpc vlan, dhcp and router
+	// advertisement replies must not reach other instances in the vpc
+	if virt.DhcpServer {
+		err = netfilter.ApplyDhcpFilter(node.Self, conf.Namespace,
+			conf.Vlan)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(nil, args[0], args[1:]...)
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -0,0 +1,120 @@
+package qemu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/floatingip"
+	"github.com/pritunl/pritunl-cloud/iproute"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/store"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/pritunl/pritunl-cloud/vm"
+)
+
+// Replaces the static external address of a running instance without
+// restarting it, restart is returned when the new address is on a
+// different block interface and the namespace must be recreated
+func UpdateStaticAddr(db *database.Database, instId primitive.ObjectID,
+	curAddr string) (restart bool, err error) {
+
+	namespace := vm.GetNamespace(instId, 0)
+	ifaceExternal := vm.GetIfaceExternal(instId, 0)
+	ifaceExternalVirt := vm.GetIfaceVirt(instId, 0)
+
+	blck, staticAddr, externalIface, err := floatingip.GetStaticAddr(
+		db, node.Self, instId)
+	if err != nil {
+		return
+	}
+
+	if staticAddr.String() == curAddr {
+		return
+	}
+
+	master, err := os.Readlink(
+		filepath.Join("/sys/class/net", ifaceExternalVirt, "master"))
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "qemu: Failed to read external interface master"),
+		}
+		return
+	}
+
+	if filepath.Base(master) != externalIface {
+		restart = true
+		return
+	}
+
+	staticGateway := blck.GetGateway()
+	staticMask := blck.GetMask()
+	if staticGateway == nil || staticMask == nil {
+		err = &errortypes.ParseError{
+			errors.New("qemu: Invalid block gateway cidr"),
+		}
+		return
+	}
+
+	staticSize, _ := staticMask.Size()
+	staticCidr := fmt.Sprintf("%s/%d", staticAddr.String(), staticSize)
+
+	address, _, err := iproute.AddressGetIface(namespace, ifaceExternal)
+	if err != nil {
+		return
+	}
+
+	if address != nil && address.Local == staticAddr.String() {
+		store.RemAddress(instId)
+		return
+	}
+
+	if address != nil {
+		_, err = utils.ExecCombinedOutputLogged(
+			[]string{
+				"Cannot assign requested address",
+			},
+			"ip", "netns", "exec", namespace,
+			"ip", "addr",
+			"del", fmt.Sprintf("%s/%d", address.Local, address.Prefix),
+			"dev", ifaceExternal,
+		)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		[]string{"File exists"},
+		"ip", "netns", "exec", namespace,
+		"ip", "addr",
+		"add", staticCidr,
+		"dev", ifaceExternal,
+	)
+	if err != nil {
+		return
+	}
+
+	_, err = utils.ExecCombinedOutputLogged(
+		nil,
+		"ip", "netns", "exec", namespace,
+		"ip", "route",
+		"replace", "default",
+		"via", staticGateway.String(),
+	)
+	if err != nil {
+		return
+	}
+
+	_, _ = utils.ExecCombinedOutput(
+		"", "ip", "netns", "exec", namespace,
+		"arping", "-c", "1", "-U", "-I", ifaceExternal, staticAddr.String())
+
+	store.RemAddress(instId)
+
+	return
+}
@@ -14,11 +14,13 @@ import (
 	"github.com/pritunl/pritunl-cloud/block"
 	"github.com/pritunl/pritunl-cloud/database"
 	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/floatingip"
 	"github.com/pritunl/pritunl-cloud/interfaces"
 	"github.com/pritunl/pritunl-cloud/iproute"
 	"github.com/pritunl/pritunl-cloud/iptables"
 	"github.com/pritunl/pritunl-cloud/node"
 	"github.com/pritunl/pritunl-cloud/paths"
+	"github.com/pritunl/pritunl-cloud/resolver"
 	"github.com/pritunl/pritunl-cloud/settings"
 	"github.com/pritunl/pritunl-cloud/store"
 	"github.com/pritunl/pritunl-cloud/utils"
@@ -93,8 +95,13 @@ func NetworkConfClear(virt *vm.VirtualMachine) (err error) {
 	interfaces.RemoveVirtIface(ifaceExternalVirt6)
 	interfaces.RemoveVirtIface(ifaceInternalVirt)
 
+	networkConfClearAdapters(virt)
+	networkStopDhcpAll(virt)
+
 	store.RemAddress(virt.Id)
 	store.RemRoutes(virt.Id)
+	store.RemPeers(virt.Id)
+	store.RemNat(virt.Id)
 
 	return
 }
@@ -488,8 +495,8 @@ func NetworkConf(db *database.Database,
 
 	if externalNetwork {
 		if nodeNetworkMode == node.Static {
-			blck, staticAddr, externalIface, err = node.Self.GetStaticAddr(
-				db, virt.Id)
+			blck, staticAddr, externalIface, err = floatingip.GetStaticAddr(
+				db, node.Self, virt.Id)
 			if err != nil {
 				return
 			}
@@ -934,6 +941,25 @@ func NetworkConf(db *database.Database,
 		return
 	}
 
+	err = networkConfDhcp(virt, 0, &dhcpConf{
+		Mac:       adapter.MacAddress,
+		Addr:      addr,
+		Gateway:   gatewayAddr,
+		Mask:      vcNet.Mask,
+		Addr6:     addr6,
+		Mtu:       updateMtuInstance,
+		Primary:   true,
+		Namespace: namespace,
+		Vlan:      ifaceVlan,
+		Dns:       vc.InternalDns,
+		VpcId:     vc.Id,
+		Domain:    resolver.GetDomain(vc),
+		HostsPath: paths.GetDnsHostsPath(vc.Id),
+	})
+	if err != nil {
+		return
+	}
+
 	_ = networkStopDhClient(virt)
 
 	if externalNetwork {
@@ -1302,8 +1328,24 @@ func NetworkConf(db *database.Database,
 		}
 	}
 
+	privateIps := []string{addr.String()}
+	privateIps6 := []string{addr6.String()}
+	for i := 1; i < len(virt.NetworkAdapters); i++ {
+		adapterAddr, adapterAddr6, e := networkConfAdapter(db, virt, i,
+			vxlan, updateMtuInternal, updateMtuInstance)
+		if e != nil {
+			err = e
+			return
+		}
+
+		privateIps = append(privateIps, adapterAddr.String())
+		privateIps6 = append(privateIps6, adapterAddr6.String())
+	}
+
 	store.RemAddress(virt.Id)
 	store.RemRoutes(virt.Id)
+	store.RemPeers(virt.Id)
+	store.RemNat(virt.Id)
 
 	hostIps := []string{}
 	if hostStaticAddr != nil {
@@ -1313,8 +1355,8 @@ func NetworkConf(db *database.Database,
 	coll := db.Instances()
 	err = coll.UpdateId(virt.Id, &bson.M{
 		"$set": &bson.M{
-			"private_ips":       []string{addr.String()},
-			"private_ips6":      []string{addr6.String()},
+			"private_ips":       privateIps,
+			"private_ips6":      privateIps6,
 			"network_namespace": namespace,
 			"host_ips":          hostIps,
 		},
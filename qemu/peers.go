@@ -0,0 +1,46 @@
+package qemu
+
+import (
+	"strings"
+
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/pritunl/pritunl-cloud/vm"
+)
+
+func GetPeers(instId primitive.ObjectID) (vpcIds []int, err error) {
+	namespace := vm.GetNamespace(instId, 0)
+
+	output, _ := utils.ExecCombinedOutputLogged(
+		[]string{
+			"No such file or directory",
+		},
+		"ip", "netns", "exec", namespace,
+		"ip", "-o", "link", "show",
+	)
+
+	if output == "" {
+		return
+	}
+
+	vpcIds = []int{}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		iface := strings.TrimSuffix(fields[1], ":")
+		iface = strings.Split(iface, "@")[0]
+
+		vpcId, ok := vm.ParseIfacePeer(instId, iface)
+		if !ok {
+			continue
+		}
+
+		vpcIds = append(vpcIds, vpcId)
+	}
+
+	return
+}
@@ -100,7 +100,7 @@ func GetRoutes(instId primitive.ObjectID) (routes []vpc.Route,
 			}
 
 			target := net.ParseIP(fields[1])
-			if target == nil {
+			if target == nil || target.IsUnspecified() {
 				continue
 			}
 
@@ -113,5 +113,90 @@ func GetRoutes(instId primitive.ObjectID) (routes []vpc.Route,
 		}
 	}
 
+	routes = append(routes, getBlackholeRoutes(namespace, false)...)
+	routes6 = append(routes6, getBlackholeRoutes(namespace, true)...)
+
+	return
+}
+
+func getBlackholeRoutes(namespace string, ipv6 bool) (routes []vpc.Route) {
+	routes = []vpc.Route{}
+
+	family := "-4"
+	if ipv6 {
+		family = "-6"
+	}
+
+	output, _ := utils.ExecCombinedOutputLogged(
+		nil,
+		"ip", "netns", "exec", namespace,
+		"ip", family, "route",
+		"show", "type", "blackhole",
+	)
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "blackhole" {
+			continue
+		}
+
+		metric := ""
+		for i, field := range fields {
+			if field == "metric" && i+1 < len(fields) {
+				metric = fields[i+1]
+			}
+		}
+		if metric != "97" {
+			continue
+		}
+
+		destination := fields[1]
+		if !strings.Contains(destination, "/") {
+			if ipv6 {
+				destination += "/128"
+			} else {
+				destination += "/32"
+			}
+		}
+
+		_, network, e := net.ParseCIDR(destination)
+		if e != nil || network == nil {
+			continue
+		}
+
+		routes = append(routes, vpc.Route{
+			Destination: network.String(),
+			Blackhole:   true,
+		})
+	}
+
+	return
+}
+
+func GetDefaultRoute(instId primitive.ObjectID) (gateway string,
+	exists bool, err error) {
+
+	namespace := vm.GetNamespace(instId, 0)
+
+	output, err := utils.ExecCombinedOutputLogged(
+		nil,
+		"ip", "netns", "exec", namespace,
+		"ip", "route", "show", "default",
+	)
+	if err != nil {
+		return
+	}
+	exists = true
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "default" || fields[1] != "via" {
+			continue
+		}
+
+		gateway = fields[2]
+		break
+	}
+
 	return
 }
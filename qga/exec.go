@@ -0,0 +1,111 @@
+package qga
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+)
+
+type cmdArgs struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+type cmdError struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+type cmdReturn struct {
+	Return interface{} `json:"return"`
+	Error  *cmdError   `json:"error"`
+}
+
+func runCommand(sockPath string, cmd *cmdArgs, resp interface{},
+	timeout time.Duration) (err error) {
+
+	conn, err := net.DialTimeout(
+		"unix",
+		sockPath,
+		3*time.Second,
+	)
+	if err != nil {
+		err = &errortypes.ConnectionError{
+			errors.Wrap(err, "qga: Failed to connect to guest agent"),
+		}
+		return
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return
+	}
+
+	cmdByte, err := json.Marshal(cmd)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "qga: Failed to parse guest agent command"),
+		}
+		return
+	}
+
+	_, err = conn.Write(cmdByte)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "qga: Failed to write to guest agent"),
+		}
+		return
+	}
+
+	returnData := &cmdReturn{
+		Return: resp,
+	}
+	err = json.NewDecoder(conn).Decode(returnData)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "qga: Failed to read from guest agent"),
+		}
+		return
+	}
+
+	if returnData.Error != nil {
+		err = &errortypes.ApiError{
+			errors.Newf("qga: Return error %s", returnData.Error.Desc),
+		}
+		return
+	}
+
+	return
+}
+
+func FsFreeze(sockPath string) (err error) {
+	cmd := &cmdArgs{
+		Execute: "guest-fsfreeze-freeze",
+	}
+
+	count := 0
+	err = runCommand(sockPath, cmd, &count, 30*time.Second)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func FsThaw(sockPath string) (err error) {
+	cmd := &cmdArgs{
+		Execute: "guest-fsfreeze-thaw",
+	}
+
+	count := 0
+	err = runCommand(sockPath, cmd, &count, 30*time.Second)
+	if err != nil {
+		return
+	}
+
+	return
+}
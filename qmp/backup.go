@@ -169,12 +169,28 @@ func driveBackupCheck(vmId primitive.ObjectID, deviceName string) (
 func BackupDisk(vmId primitive.ObjectID, dsk *disk.Disk,
 	destPth string) (err error) {
 
+	err = BackupDiskStarted(vmId, dsk, destPth, nil)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// BackupDiskStarted backs up the disk to the destination path and calls
+// started once the backup job has captured a point in time
+func BackupDiskStarted(vmId primitive.ObjectID, dsk *disk.Disk,
+	destPth string, started func()) (err error) {
+
 	logrus.WithFields(logrus.Fields{
 		"instance_id": vmId.Hex(),
 		"disk_id":     dsk.Id.Hex(),
 	}).Info("qmp: Backing up disk")
 
 	deviceName, err := driveBackup(vmId, dsk, destPth)
+	if started != nil {
+		started()
+	}
 	if err != nil {
 		return
 	}
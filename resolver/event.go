@@ -0,0 +1,54 @@
+package resolver
+
+import (
+	"sync"
+
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/pritunl-cloud/event"
+)
+
+var (
+	changed     = true
+	changedLock = sync.Mutex{}
+)
+
+// Returns true if instances or vpcs have changed since the last call
+func Changed() bool {
+	changedLock.Lock()
+	defer changedLock.Unlock()
+
+	if changed {
+		changed = false
+		return true
+	}
+
+	return false
+}
+
+// Marks the hosts as changed to update on the next deploy
+func SetChanged() {
+	changedLock.Lock()
+	changed = true
+	changedLock.Unlock()
+}
+
+func handleDispatch(evt *event.EventPublish) {
+	dispatch := &event.Dispatch{}
+
+	data, err := bson.Marshal(evt.Data)
+	if err == nil {
+		err = bson.Unmarshal(data, dispatch)
+	}
+
+	if err == nil && dispatch.Type != "instance.change" &&
+		dispatch.Type != "vpc.change" {
+
+		return
+	}
+
+	SetChanged()
+}
+
+func init() {
+	event.Register("dispatch", handleDispatch)
+}
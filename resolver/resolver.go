@@ -0,0 +1,158 @@
+package resolver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/instance"
+	"github.com/pritunl/pritunl-cloud/vpc"
+)
+
+type host struct {
+	Name  string
+	Addr  string
+	Addr6 string
+}
+
+// Formats a name as a dns label
+func FormatName(name string) string {
+	name = strings.ToLower(name)
+
+	label := ""
+	for _, c := range name {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			label += string(c)
+		} else if !strings.HasSuffix(label, "-") {
+			label += "-"
+		}
+	}
+
+	label = strings.Trim(label, "-")
+	if len(label) > 63 {
+		label = strings.Trim(label[:63], "-")
+	}
+
+	return label
+}
+
+func GetDomain(vc *vpc.Vpc) string {
+	name := FormatName(vc.Name)
+	if name == "" {
+		name = vc.Id.Hex()
+	}
+
+	return name + ".internal"
+}
+
+// Returns the hosts file data for each vpc with the private addresses of
+// all instances in the vpc
+func GetHosts(db *database.Database, vcs []*vpc.Vpc) (
+	hosts map[primitive.ObjectID]string, err error) {
+
+	hosts = map[primitive.ObjectID]string{}
+	if len(vcs) == 0 {
+		return
+	}
+
+	vcsMap := map[primitive.ObjectID]*vpc.Vpc{}
+	vcIds := []primitive.ObjectID{}
+	for _, vc := range vcs {
+		vcsMap[vc.Id] = vc
+		vcIds = append(vcIds, vc.Id)
+		hosts[vc.Id] = ""
+	}
+
+	coll := db.VpcsIp()
+	vpcIps := []*vpc.VpcIp{}
+
+	cursor, err := coll.Find(db, &bson.M{
+		"vpc": &bson.M{
+			"$in": vcIds,
+		},
+		"instance": &bson.M{
+			"$ne": nil,
+		},
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	instIds := []primitive.ObjectID{}
+	for cursor.Next(db) {
+		vpcIp := &vpc.VpcIp{}
+		err = cursor.Decode(vpcIp)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		vpcIps = append(vpcIps, vpcIp)
+		instIds = append(instIds, vpcIp.Instance)
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	if len(instIds) == 0 {
+		return
+	}
+
+	insts, err := instance.GetAllName(db, &bson.M{
+		"_id": &bson.M{
+			"$in": instIds,
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	names := map[primitive.ObjectID]string{}
+	for _, inst := range insts {
+		names[inst.Id] = FormatName(inst.Name)
+	}
+
+	vpcHosts := map[primitive.ObjectID][]*host{}
+	for _, vpcIp := range vpcIps {
+		name := names[vpcIp.Instance]
+		if name == "" {
+			continue
+		}
+
+		vc := vcsMap[vpcIp.Vpc]
+		addr, _ := vpcIp.GetIps()
+
+		vpcHosts[vc.Id] = append(vpcHosts[vc.Id], &host{
+			Name:  fmt.Sprintf("%s.%s", name, GetDomain(vc)),
+			Addr:  addr.String(),
+			Addr6: vc.GetIp6(addr).String(),
+		})
+	}
+
+	for vcId, hsts := range vpcHosts {
+		sort.Slice(hsts, func(i, j int) bool {
+			if hsts[i].Name == hsts[j].Name {
+				return hsts[i].Addr < hsts[j].Addr
+			}
+			return hsts[i].Name < hsts[j].Name
+		})
+
+		data := ""
+		for _, hst := range hsts {
+			data += fmt.Sprintf("%s %s\n", hst.Addr, hst.Name)
+			data += fmt.Sprintf("%s %s\n", hst.Addr6, hst.Name)
+		}
+
+		hosts[vcId] = data
+	}
+
+	return
+}
@@ -21,6 +21,11 @@ type hypervisor struct {
 	StartTimeout     int    `bson:"start_timeout" default:"45"`
 	StopTimeout      int    `bson:"stop_timeout" default:"180"`
 	RefreshRate      int    `bson:"refresh_rate" default:"90"`
+	BackingGrace     int    `bson:"backing_grace" default:"24"`
+	BackingFlatten   bool   `bson:"backing_flatten"`
+	CacheMinFree     int    `bson:"cache_min_free" default:"20"`
+	DnsServer        string `bson:"dns_server" default:"8.8.8.8"`
+	DnsServer2       string `bson:"dns_server2" default:"8.8.4.4"`
 }
 
 func newHypervisor() interface{} {
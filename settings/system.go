@@ -9,18 +9,25 @@ const (
 var System *system
 
 type system struct {
-	Id                   string `bson:"_id"`
-	Name                 string `bson:"name"`
-	DatabaseVersion      int    `bson:"database_version"`
-	Demo                 bool   `bson:"demo"`
-	License              string `bson:"license"`
-	AdminCookieAuthKey   []byte `bson:"admin_cookie_auth_key"`
-	AdminCookieCryptoKey []byte `bson:"admin_cookie_crypto_key"`
-	UserCookieAuthKey    []byte `bson:"user_cookie_auth_key"`
-	UserCookieCryptoKey  []byte `bson:"user_cookie_crypto_key"`
-	AcmeKeyAlgorithm     string `bson:"acme_key_algorithm" default:"rsa"`
-	DiskBackupWindow     int    `bson:"disk_backup_window" default:"6"`
-	DiskBackupTime       int    `bson:"disk_backup_time" default:"10"`
+	Id                    string `bson:"_id"`
+	Name                  string `bson:"name"`
+	DatabaseVersion       int    `bson:"database_version"`
+	Demo                  bool   `bson:"demo"`
+	License               string `bson:"license"`
+	AdminCookieAuthKey    []byte `bson:"admin_cookie_auth_key"`
+	AdminCookieCryptoKey  []byte `bson:"admin_cookie_crypto_key"`
+	UserCookieAuthKey     []byte `bson:"user_cookie_auth_key"`
+	UserCookieCryptoKey   []byte `bson:"user_cookie_crypto_key"`
+	AcmeKeyAlgorithm      string `bson:"acme_key_algorithm" default:"rsa"`
+	DiskBackupWindow      int    `bson:"disk_backup_window" default:"6"`
+	DiskBackupTime        int    `bson:"disk_backup_time" default:"10"`
+	DiskBackupFrequency   int    `bson:"disk_backup_frequency" default:"24"`
+	DiskBackupKeepDaily   int    `bson:"disk_backup_keep_daily"`
+	DiskBackupKeepWeekly  int    `bson:"disk_backup_keep_weekly"`
+	DiskBackupKeepMonthly int    `bson:"disk_backup_keep_monthly"`
+	DiskBackupVerifyCount int    `bson:"disk_backup_verify_count" default:"2"`
+	BackupMasterKey       []byte `bson:"backup_master_key"`
+	ImageImportMaxSize    int    `bson:"image_import_max_size" default:"100"`
 }
 
 func newSystem() interface{} {
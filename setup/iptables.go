@@ -6,8 +6,7 @@ import (
 	"github.com/pritunl/pritunl-cloud/disk"
 	"github.com/pritunl/pritunl-cloud/firewall"
 	"github.com/pritunl/pritunl-cloud/instance"
-	"github.com/pritunl/pritunl-cloud/ipset"
-	"github.com/pritunl/pritunl-cloud/iptables"
+	"github.com/pritunl/pritunl-cloud/netfilter"
 	"github.com/pritunl/pritunl-cloud/node"
 	"github.com/pritunl/pritunl-cloud/utils"
 )
@@ -33,23 +32,14 @@ func Iptables() (err error) {
 		return
 	}
 
-	nodeFirewall, firewalls, err := firewall.GetAllIngress(
-		db, node.Self, instances)
+	nodeFirewall, firewalls, firewallsEgress, logDropped, err :=
+		firewall.GetAllRules(db, node.Self, instances)
 	if err != nil {
 		return
 	}
 
-	err = ipset.Init(namespaces, instances, nodeFirewall, firewalls)
-	if err != nil {
-		return
-	}
-
-	err = iptables.Init(namespaces, instances, nodeFirewall, firewalls)
-	if err != nil {
-		return
-	}
-
-	err = ipset.InitNames(namespaces, instances, nodeFirewall, firewalls)
+	err = netfilter.Init(namespaces, instances, nodeFirewall, firewalls,
+		firewallsEgress, logDropped)
 	if err != nil {
 		return
 	}
@@ -13,8 +13,10 @@ import (
 	"github.com/pritunl/pritunl-cloud/domain"
 	"github.com/pritunl/pritunl-cloud/errortypes"
 	"github.com/pritunl/pritunl-cloud/firewall"
+	"github.com/pritunl/pritunl-cloud/floatingip"
 	"github.com/pritunl/pritunl-cloud/instance"
 	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/peering"
 	"github.com/pritunl/pritunl-cloud/qemu"
 	"github.com/pritunl/pritunl-cloud/utils"
 	"github.com/pritunl/pritunl-cloud/vm"
@@ -36,6 +38,8 @@ type State struct {
 	interfacesSet    set.Set
 	nodeFirewall     []*firewall.Rule
 	firewalls        map[string][]*firewall.Rule
+	firewallsEgress  map[string][]*firewall.Rule
+	logDropped       set.Set
 	disks            []*disk.Disk
 	virtsMap         map[primitive.ObjectID]*vm.VirtualMachine
 	instances        []*instance.Instance
@@ -44,6 +48,10 @@ type State struct {
 	domainRecordsMap map[primitive.ObjectID][]*domain.Record
 	vpcs             []*vpc.Vpc
 	vpcsMap          map[primitive.ObjectID]*vpc.Vpc
+	vpcPeers         map[primitive.ObjectID][]*vpc.Vpc
+	vpcInstanceIps   map[primitive.ObjectID]vpc.InstanceIps
+	floatingIps      map[primitive.ObjectID]*floatingip.FloatingIp
+	floatingAddrs    set.Set
 	addInstances     set.Set
 	remInstances     set.Set
 	running          []string
@@ -97,6 +105,14 @@ func (s *State) Firewalls() map[string][]*firewall.Rule {
 	return s.firewalls
 }
 
+func (s *State) FirewallsEgress() map[string][]*firewall.Rule {
+	return s.firewallsEgress
+}
+
+func (s *State) LogDropped() set.Set {
+	return s.logDropped
+}
+
 func (s *State) DomainRecords(instId primitive.ObjectID) []*domain.Record {
 	return s.domainRecordsMap[instId]
 }
@@ -121,6 +137,24 @@ func (s *State) Vpcs() []*vpc.Vpc {
 	return s.vpcs
 }
 
+func (s *State) VpcPeers(vpcId primitive.ObjectID) []*vpc.Vpc {
+	return s.vpcPeers[vpcId]
+}
+
+func (s *State) VpcInstanceIps(vpcId primitive.ObjectID) vpc.InstanceIps {
+	return s.vpcInstanceIps[vpcId]
+}
+
+func (s *State) FloatingIp(
+	instId primitive.ObjectID) *floatingip.FloatingIp {
+
+	return s.floatingIps[instId]
+}
+
+func (s *State) IsFloatingAddr(addr string) bool {
+	return s.floatingAddrs.Contains(addr)
+}
+
 func (s *State) DiskInUse(instId, dskId primitive.ObjectID) bool {
 	curVirt := s.virtsMap[instId]
 
@@ -267,13 +301,15 @@ func (s *State) init() (err error) {
 	}
 	s.virtsMap = virtsMap
 
-	nodeFirewall, firewalls, err := firewall.GetAllIngress(
-		db, s.nodeSelf, instances)
+	nodeFirewall, firewalls, firewallsEgress, logDropped, err :=
+		firewall.GetAllRules(db, s.nodeSelf, instances)
 	if err != nil {
 		return
 	}
 	s.nodeFirewall = nodeFirewall
 	s.firewalls = firewalls
+	s.firewallsEgress = firewallsEgress
+	s.logDropped = logDropped
 
 	vpcs := []*vpc.Vpc{}
 	vpcsMap := map[primitive.ObjectID]*vpc.Vpc{}
@@ -290,6 +326,79 @@ func (s *State) init() (err error) {
 	s.vpcs = vpcs
 	s.vpcsMap = vpcsMap
 
+	vpcPeers := map[primitive.ObjectID][]*vpc.Vpc{}
+	if !s.nodeDatacenter.IsZero() {
+		peersMap, e := peering.GetDatacenterActive(db,
+			s.nodeDatacenter, vpcsMap)
+		if e != nil {
+			err = e
+			return
+		}
+
+		for vcId, peerIds := range peersMap {
+			for _, peerId := range peerIds {
+				peerVc := vpcsMap[peerId]
+				if peerVc == nil {
+					continue
+				}
+
+				vpcPeers[vcId] = append(vpcPeers[vcId], peerVc)
+			}
+		}
+	}
+	s.vpcPeers = vpcPeers
+
+	routeInstIds := set.NewSet()
+	for _, vc := range vpcs {
+		for _, route := range vc.Routes {
+			if !route.TargetInstance.IsZero() {
+				routeInstIds.Add(route.TargetInstance)
+			}
+		}
+
+		for _, sub := range vc.Subnets {
+			for _, route := range sub.Routes {
+				if !route.TargetInstance.IsZero() {
+					routeInstIds.Add(route.TargetInstance)
+				}
+			}
+		}
+	}
+
+	instIds := []primitive.ObjectID{}
+	for instIdInf := range routeInstIds.Iter() {
+		instIds = append(instIds, instIdInf.(primitive.ObjectID))
+	}
+
+	vpcInstanceIps, err := vpc.GetInstanceIps(db, instIds)
+	if err != nil {
+		return
+	}
+	s.vpcInstanceIps = vpcInstanceIps
+
+	floatingIps := map[primitive.ObjectID]*floatingip.FloatingIp{}
+	floatingAddrs := set.NewSet()
+	if !s.nodeDatacenter.IsZero() {
+		fips, e := floatingip.GetAll(db, &bson.M{
+			"datacenter": s.nodeDatacenter,
+		})
+		if e != nil {
+			err = e
+			return
+		}
+
+		for _, fip := range fips {
+			if fip.Address != "" {
+				floatingAddrs.Add(fip.Address)
+			}
+			if !fip.Instance.IsZero() {
+				floatingIps[fip.Instance] = fip
+			}
+		}
+	}
+	s.floatingIps = floatingIps
+	s.floatingAddrs = floatingAddrs
+
 	recrds, err := domain.GetRecordAll(db, &bson.M{
 		"node": s.nodeSelf.Id,
 	})
@@ -23,6 +23,23 @@ func Get(db *database.Database, storeId primitive.ObjectID) (
 	return
 }
 
+func GetName(db *database.Database, name string) (
+	store *Storage, err error) {
+
+	coll := db.Storages()
+	store = &Storage{}
+
+	err = coll.FindOne(db, &bson.M{
+		"name": name,
+	}).Decode(store)
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
+
 func GetAll(db *database.Database) (stores []*Storage, err error) {
 	coll := db.Storages()
 	stores = []*Storage{}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+)
+
+var (
+	natStores     = map[primitive.ObjectID]NatStore{}
+	natStoresLock = sync.Mutex{}
+)
+
+type NatStore struct {
+	Gateway   string
+	Timestamp time.Time
+}
+
+func GetNat(instId primitive.ObjectID) (natStore NatStore, ok bool) {
+	natStoresLock.Lock()
+	natStore, ok = natStores[instId]
+	natStoresLock.Unlock()
+
+	return
+}
+
+func SetNat(instId primitive.ObjectID, gateway string) {
+	natStoresLock.Lock()
+	natStores[instId] = NatStore{
+		Gateway:   gateway,
+		Timestamp: time.Now(),
+	}
+	natStoresLock.Unlock()
+}
+
+func RemNat(instId primitive.ObjectID) {
+	natStoresLock.Lock()
+	delete(natStores, instId)
+	natStoresLock.Unlock()
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+)
+
+var (
+	peersStores     = map[primitive.ObjectID]PeersStore{}
+	peersStoresLock = sync.Mutex{}
+)
+
+type PeersStore struct {
+	VpcIds    []int
+	Timestamp time.Time
+}
+
+func GetPeers(instId primitive.ObjectID) (peersStore PeersStore, ok bool) {
+	peersStoresLock.Lock()
+	peersStore, ok = peersStores[instId]
+	peersStoresLock.Unlock()
+
+	if ok {
+		peersStore.VpcIds = append([]int{}, peersStore.VpcIds...)
+	}
+
+	return
+}
+
+func SetPeers(instId primitive.ObjectID, vpcIds []int) {
+	peersStoresLock.Lock()
+	peersStores[instId] = PeersStore{
+		VpcIds:    append([]int{}, vpcIds...),
+		Timestamp: time.Now(),
+	}
+	peersStoresLock.Unlock()
+}
+
+func RemPeers(instId primitive.ObjectID) {
+	peersStoresLock.Lock()
+	delete(peersStores, instId)
+	peersStoresLock.Unlock()
+}
@@ -4,12 +4,13 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/dropbox/godropbox/container/set"
 	"github.com/pritunl/pritunl-cloud/constants"
 	"github.com/pritunl/pritunl-cloud/database"
 	"github.com/pritunl/pritunl-cloud/deploy"
 	"github.com/pritunl/pritunl-cloud/firewall"
 	"github.com/pritunl/pritunl-cloud/instance"
-	"github.com/pritunl/pritunl-cloud/iptables"
+	"github.com/pritunl/pritunl-cloud/netfilter"
 	"github.com/pritunl/pritunl-cloud/node"
 	"github.com/pritunl/pritunl-cloud/state"
 )
@@ -33,12 +34,13 @@ func syncNodeFirewall() {
 	defer db.Close()
 
 	if !node.Self.Firewall {
-		err := iptables.UpdateState(node.Self, []*instance.Instance{},
-			[]string{}, nil, map[string][]*firewall.Rule{})
+		err := netfilter.Update(node.Self, []*instance.Instance{},
+			[]string{}, nil, map[string][]*firewall.Rule{},
+			map[string][]*firewall.Rule{}, set.NewSet())
 		if err != nil {
 			logrus.WithFields(logrus.Fields{
 				"error": err,
-			}).Error("sync: Failed to update iptables")
+			}).Error("sync: Failed to update firewall")
 		}
 		return
 	}
@@ -54,8 +56,9 @@ func syncNodeFirewall() {
 
 		ingress := firewall.MergeIngress(fires)
 
-		err = iptables.UpdateState(node.Self, []*instance.Instance{},
-			[]string{}, ingress, map[string][]*firewall.Rule{})
+		err = netfilter.Update(node.Self, []*instance.Instance{},
+			[]string{}, ingress, map[string][]*firewall.Rule{},
+			map[string][]*firewall.Rule{}, set.NewSet())
 		if err != nil {
 			if i < 1 {
 				err = nil
@@ -64,13 +67,13 @@ func syncNodeFirewall() {
 			} else {
 				logrus.WithFields(logrus.Fields{
 					"error": err,
-				}).Error("sync: Failed to update iptables, resetting state")
+				}).Error("sync: Failed to update firewall, resetting state")
 				for {
-					err = iptables.Recover()
+					err = netfilter.Recover()
 					if err != nil {
 						logrus.WithFields(logrus.Fields{
 							"error": err,
-						}).Error("sync: Failed to recover iptables, retrying")
+						}).Error("sync: Failed to recover firewall, retrying")
 						continue
 					}
 					break
@@ -10,11 +10,16 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/backing"
+	"github.com/pritunl/pritunl-cloud/data"
 	"github.com/pritunl/pritunl-cloud/database"
 	"github.com/pritunl/pritunl-cloud/disk"
 	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/image"
 	"github.com/pritunl/pritunl-cloud/node"
 	"github.com/pritunl/pritunl-cloud/paths"
+	"github.com/pritunl/pritunl-cloud/settings"
 	"github.com/pritunl/pritunl-cloud/utils"
 )
 
@@ -24,16 +29,27 @@ var backingClean = &Task{
 		13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23},
 	Mins:    []int{0, 5, 10, 15, 20, 25, 30, 35, 40, 45, 50, 55},
 	Handler: backingCleanHandler,
+	Local:   true,
 }
 
 func backingCleanHandler(db *database.Database) (err error) {
 	backingDir := paths.GetBackingPath()
 
-	diskKeys, err := disk.GetAllKeys(db, node.Self.Id)
+	grace := time.Duration(settings.Hypervisor.BackingGrace) * time.Hour
+	if grace < 5*time.Minute {
+		grace = 5 * time.Minute
+	}
+
+	disks, err := disk.GetAllBacking(db, node.Self.Id)
 	if err != nil {
 		return
 	}
 
+	diskKeys := map[string][]*disk.Disk{}
+	for _, dsk := range disks {
+		diskKeys[dsk.BackingImage] = append(diskKeys[dsk.BackingImage], dsk)
+	}
+
 	exists, err := utils.ExistsDir(backingDir)
 	if !exists {
 		return
@@ -47,30 +63,120 @@ func backingCleanHandler(db *database.Database) (err error) {
 		return
 	}
 
+	report := backing.NewReport(node.Self.Id)
+	images := map[primitive.ObjectID]*image.Image{}
+	now := time.Now()
+
 	for _, item := range items {
 		name := item.Name()
 		pth := filepath.Join(backingDir, name)
 
-		if strings.HasPrefix(name, "image-") {
-			keys := strings.Split(name, "-")
-			if len(keys) != 3 {
+		if !strings.HasPrefix(name, "image-") {
+			continue
+		}
+
+		keys := strings.Split(name, "-")
+		if len(keys) != 3 {
+			continue
+		}
+		key := fmt.Sprintf("%s-%s", keys[1], keys[2])
+		dsks := diskKeys[key]
+		lastUsed := item.ModTime()
+
+		if len(dsks) == 0 {
+			if time.Since(lastUsed) > grace {
+				logrus.WithFields(logrus.Fields{
+					"key":  key,
+					"path": pth,
+				}).Info("task: Removing unused backing image")
+
+				e := os.Remove(pth)
+				if e == nil {
+					report.Removed += 1
+					report.RemovedSize += item.Size()
+				}
 				continue
 			}
-			key := fmt.Sprintf("%s-%s", keys[1], keys[2])
+		} else {
+			e := os.Chtimes(pth, now, now)
+			if e != nil {
+				logrus.WithFields(logrus.Fields{
+					"path":  pth,
+					"error": e,
+				}).Error("task: Failed to update backing image time")
+			} else {
+				lastUsed = now
+			}
+		}
+
+		bImg := &backing.Image{
+			Name:     name,
+			Etag:     keys[2],
+			Size:     item.Size(),
+			Disks:    []primitive.ObjectID{},
+			Orphaned: len(dsks) == 0,
+			LastUsed: lastUsed,
+		}
+		for _, dsk := range dsks {
+			bImg.Disks = append(bImg.Disks, dsk.Id)
+		}
+
+		imgId, ok := utils.ParseObjectId(keys[1])
+		if ok {
+			bImg.Image = imgId
+
+			img, cached := images[imgId]
+			if !cached {
+				img, err = image.Get(db, imgId)
+				if err != nil {
+					if _, ok := err.(*database.NotFoundError); ok {
+						img = nil
+						err = nil
+					} else {
+						return
+					}
+				}
+				images[imgId] = img
+			}
+
+			if img != nil {
+				bImg.ImageName = img.Name
+				bImg.Current = img.Etag == bImg.Etag
+				bImg.Deprecated = !bImg.Current ||
+					img.Lifecycle == image.Deprecated ||
+					img.Lifecycle == image.Obsolete
+			} else {
+				bImg.Deprecated = true
+			}
+		} else {
+			bImg.Deprecated = true
+		}
 
-			if !diskKeys.Contains(key) {
-				if time.Since(item.ModTime()) > 5*time.Minute {
+		report.Add(bImg)
+
+		if settings.Hypervisor.BackingFlatten && bImg.Deprecated {
+			for _, dsk := range dsks {
+				flattened, e := data.FlattenDisk(db, dsk)
+				if e != nil {
 					logrus.WithFields(logrus.Fields{
-						"key":  key,
-						"path": pth,
-					}).Info("task: Removing unused backing image")
-					os.Remove(pth)
+						"disk_id": dsk.Id.Hex(),
+						"error":   e,
+					}).Error("task: Failed to flatten disk")
 					continue
 				}
+
+				if flattened {
+					report.Flattened += 1
+				}
 			}
 		}
 	}
 
+	err = report.Commit(db)
+	if err != nil {
+		return
+	}
+
 	return
 }
 
@@ -0,0 +1,165 @@
+package task
+
+import (
+	"time"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/data"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/disk"
+	"github.com/pritunl/pritunl-cloud/event"
+	"github.com/pritunl/pritunl-cloud/image"
+	"github.com/pritunl/pritunl-cloud/settings"
+	"github.com/pritunl/pritunl-cloud/storage"
+	"github.com/sirupsen/logrus"
+)
+
+var backupPrune = &Task{
+	Name: "backup_prune",
+	Hours: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23},
+	Mins:    []int{35},
+	Handler: backupPruneHandler,
+}
+
+var backupVerify = &Task{
+	Name:    "backup_verify",
+	Hours:   []int{2},
+	Mins:    []int{50},
+	Handler: backupVerifyHandler,
+}
+
+type backupVerifyEvent struct {
+	Image        primitive.ObjectID `bson:"image" json:"image"`
+	Disk         primitive.ObjectID `bson:"disk" json:"disk"`
+	Organization primitive.ObjectID `bson:"organization" json:"organization"`
+	State        string             `bson:"state" json:"state"`
+	Error        string             `bson:"error" json:"error"`
+}
+
+func backupPruneHandler(db *database.Database) (err error) {
+	dskIds, err := image.DistinctDisks(db)
+	if err != nil {
+		return
+	}
+
+	pruned := 0
+	for _, dskId := range dskIds {
+		var policy *disk.BackupPolicy
+
+		dsk, e := disk.Get(db, dskId)
+		if e != nil {
+			if _, ok := e.(*database.NotFoundError); !ok {
+				err = e
+				return
+			}
+			policy = disk.GetDefaultBackupPolicy()
+		} else {
+			policy = dsk.GetBackupPolicy()
+		}
+
+		count, e := data.PruneBackups(db, dskId, policy)
+		pruned += count
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"disk_id": dskId.Hex(),
+				"error":   e,
+			}).Error("task: Failed to prune disk backups")
+			continue
+		}
+	}
+
+	if pruned > 0 {
+		event.PublishDispatch(db, "image.change")
+	}
+
+	return
+}
+
+func backupVerifyHandler(db *database.Database) (err error) {
+	count := settings.System.DiskBackupVerifyCount
+	if count <= 0 {
+		return
+	}
+
+	imgs, err := image.GetVerifySample(db, int64(count))
+	if err != nil {
+		return
+	}
+
+	for _, img := range imgs {
+		store, e := storage.Get(db, img.Storage)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"image_id":   img.Id.Hex(),
+				"storage_id": img.Storage.Hex(),
+				"error":      e,
+			}).Error("task: Failed to get backup storage")
+
+			backupVerifySkip(db, img)
+			continue
+		}
+
+		available, e := data.ImageAvailable(store, img)
+		if e != nil || !available {
+			backupVerifySkip(db, img)
+			continue
+		}
+
+		evt := &backupVerifyEvent{
+			Image:        img.Id,
+			Disk:         img.Disk,
+			Organization: img.Organization,
+			State:        image.Verified,
+		}
+
+		e = data.VerifyBackup(db, img)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"image_id":   img.Id.Hex(),
+				"disk_id":    img.Disk.Hex(),
+				"storage_id": img.Storage.Hex(),
+				"key":        img.Key,
+				"error":      e,
+			}).Error("task: Disk backup verification failed")
+
+			evt.State = image.VerifyFailed
+			evt.Error = e.Error()
+		}
+
+		e = event.Publish(db, "backup.verify", evt)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"image_id": img.Id.Hex(),
+				"error":    e,
+			}).Error("task: Failed to publish backup verify event")
+		}
+	}
+
+	if len(imgs) > 0 {
+		event.PublishDispatch(db, "image.change")
+	}
+
+	return
+}
+
+// Archived or unavailable backups are marked as skipped to move them to
+// the end of the verify sample
+func backupVerifySkip(db *database.Database, img *image.Image) {
+	img.LastVerified = time.Now()
+	img.VerifyState = image.VerifySkipped
+
+	err := img.CommitFields(db, set.NewSet("verify_state", "last_verified"))
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"image_id": img.Id.Hex(),
+			"error":    err,
+		}).Error("task: Failed to update skipped backup verify")
+	}
+}
+
+func init() {
+	register(backupPrune)
+	register(backupVerify)
+}
@@ -0,0 +1,53 @@
+package task
+
+import (
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/domain"
+	"github.com/sirupsen/logrus"
+)
+
+var domainRecords = &Task{
+	Name:    "domain_records",
+	Hours:   AllHours,
+	Mins:    AllMins,
+	Handler: domainRecordsHandler,
+}
+
+func domainRecordsHandler(db *database.Database) (err error) {
+	domns, err := domain.GetAll(db, &bson.M{
+		"$or": []*bson.M{
+			&bson.M{
+				"records.0": &bson.M{
+					"$exists": true,
+				},
+			},
+			&bson.M{
+				"applied_records.0": &bson.M{
+					"$exists": true,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	for _, domn := range domns {
+		e := domn.SyncRecords(db)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"domain_id":   domn.Id.Hex(),
+				"domain_name": domn.Name,
+				"error":       e,
+			}).Error("task: Failed to sync domain records")
+			continue
+		}
+	}
+
+	return
+}
+
+func init() {
+	register(domainRecords)
+}
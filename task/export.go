@@ -0,0 +1,121 @@
+package task
+
+import (
+	"sync"
+
+	"github.com/pritunl/pritunl-cloud/data"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/event"
+	"github.com/pritunl/pritunl-cloud/export"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/zone"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	imageExportLock    = sync.Mutex{}
+	imageExportRunning = false
+)
+
+var exportClean = &Task{
+	Name: "export_clean",
+	Hours: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23},
+	Mins:    []int{20},
+	Handler: exportCleanHandler,
+}
+
+var imageExport = &Task{
+	Name: "image_export",
+	Hours: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23},
+	Mins: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14,
+		15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29,
+		30, 31, 32, 33, 34, 35, 36, 37, 38, 39, 40, 41, 42, 43, 44,
+		45, 46, 47, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59},
+	Handler: imageExportHandler,
+	Local:   true,
+}
+
+func exportCleanHandler(db *database.Database) (err error) {
+	exps, err := export.GetExpired(db)
+	if err != nil {
+		return
+	}
+
+	for _, exp := range exps {
+		if exp.State == export.Exporting {
+			continue
+		}
+
+		e := data.DeleteExport(db, exp)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"export_id": exp.Id.Hex(),
+				"error":     e,
+			}).Error("task: Failed to remove expired export")
+			continue
+		}
+	}
+
+	if len(exps) > 0 {
+		event.PublishDispatch(db, "export.change")
+	}
+
+	return
+}
+
+// Image exports run one at a time on each hypervisor node in the export
+// datacenter, a run continues until no pending exports remain
+func imageExportHandler(db *database.Database) (err error) {
+	if !node.Self.IsHypervisor() || node.Self.Zone.IsZero() {
+		return
+	}
+
+	imageExportLock.Lock()
+	if imageExportRunning {
+		imageExportLock.Unlock()
+		return
+	}
+	imageExportRunning = true
+	imageExportLock.Unlock()
+
+	defer func() {
+		imageExportLock.Lock()
+		imageExportRunning = false
+		imageExportLock.Unlock()
+	}()
+
+	zne, err := zone.Get(db, node.Self.Zone)
+	if err != nil {
+		return
+	}
+
+	for {
+		exp, e := export.ClaimImage(db, zne.Datacenter, node.Self.Id)
+		if e != nil {
+			err = e
+			return
+		}
+
+		if exp == nil {
+			break
+		}
+
+		e = data.ExportImage(db, exp)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"export_id": exp.Id.Hex(),
+				"image_id":  exp.Image.Hex(),
+				"error":     e,
+			}).Error("task: Failed to export image")
+		}
+	}
+
+	return
+}
+
+func init() {
+	register(exportClean)
+	register(imageExport)
+}
@@ -0,0 +1,71 @@
+package task
+
+import (
+	"time"
+
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/firewall"
+	"github.com/pritunl/pritunl-cloud/instance"
+	"github.com/pritunl/pritunl-cloud/netfilter"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/vm"
+)
+
+var firewallStats = &Task{
+	Name: "firewall_stats",
+	Hours: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23},
+	Mins:    []int{0, 5, 10, 15, 20, 25, 30, 35, 40, 45, 50, 55},
+	Handler: firewallStatsHandler,
+	Local:   true,
+}
+
+func firewallStatsHandler(db *database.Database) (err error) {
+	if !node.Self.IsHypervisor() {
+		return
+	}
+
+	stats, err := netfilter.GetStats()
+	if err != nil {
+		return
+	}
+
+	if len(stats) == 0 {
+		return
+	}
+
+	insts, err := instance.GetAll(db, &bson.M{
+		"node": node.Self.Id,
+	})
+	if err != nil {
+		return
+	}
+
+	timestamp := time.Now()
+	for _, inst := range insts {
+		ruleStats := stats[vm.GetNamespace(inst.Id, 0)]
+		if ruleStats == nil {
+			continue
+		}
+
+		stat := &firewall.Stats{
+			Id:           inst.Id,
+			Organization: inst.Organization,
+			Node:         node.Self.Id,
+			Timestamp:    timestamp,
+			Rules:        ruleStats,
+		}
+
+		err = stat.Commit(db)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func init() {
+	register(firewallStats)
+}
@@ -0,0 +1,135 @@
+package task
+
+import (
+	"os"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/pritunl/pritunl-cloud/data"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/image"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/prefetch"
+	"github.com/pritunl/pritunl-cloud/settings"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/sirupsen/logrus"
+)
+
+var imagePrefetch = &Task{
+	Name: "image_prefetch",
+	Hours: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23},
+	Mins:       []int{2, 12, 22, 32, 42, 52},
+	Handler:    imagePrefetchHandler,
+	RunOnStart: true,
+	Local:      true,
+}
+
+func imagePrefetchHandler(db *database.Database) (err error) {
+	if !node.Self.IsHypervisor() || node.Self.Zone.IsZero() {
+		return
+	}
+
+	cacheDir := node.Self.GetCachePath()
+	minFree := uint64(settings.Hypervisor.CacheMinFree) * 1073741824
+
+	err = utils.ExistsMkdir(cacheDir, 0755)
+	if err != nil {
+		return
+	}
+
+	imgs, err := image.GetPrefetch(db, node.Self.Zone)
+	if err != nil {
+		return
+	}
+
+	pinned := set.NewSet()
+	for _, img := range imgs {
+		pinned.Add(data.GetImageCacheName(img))
+	}
+
+	status := prefetch.NewStatus(node.Self.Id, node.Self.Zone)
+
+	status.Evicted, err = data.EvictImageCache(minFree, pinned)
+	if err != nil {
+		return
+	}
+
+	for _, img := range imgs {
+		entry := &prefetch.Entry{
+			Image: img.Id,
+			Name:  img.Name,
+			Etag:  img.Etag,
+		}
+		status.Entries = append(status.Entries, entry)
+
+		pth := data.GetImageCachePath(img)
+		exists, e := utils.ExistsFile(pth)
+		if e != nil {
+			err = e
+			return
+		}
+
+		if !exists {
+			free, _, e := utils.DiskUsage(cacheDir)
+			if e != nil {
+				err = e
+				return
+			}
+
+			if free < minFree {
+				entry.State = prefetch.Skipped
+				entry.Error = "Insufficient free space in cache"
+				continue
+			}
+
+			logrus.WithFields(logrus.Fields{
+				"image_id": img.Id.Hex(),
+				"path":     pth,
+			}).Info("task: Prefetching image")
+
+			_, e = data.PrefetchImage(db, img)
+			if e != nil {
+				logrus.WithFields(logrus.Fields{
+					"image_id": img.Id.Hex(),
+					"error":    e,
+				}).Error("task: Failed to prefetch image")
+
+				entry.State = prefetch.Failed
+				entry.Error = e.Error()
+				continue
+			}
+		}
+
+		info, e := os.Stat(pth)
+		if e != nil {
+			entry.State = prefetch.Failed
+			entry.Error = e.Error()
+			continue
+		}
+
+		entry.State = prefetch.Cached
+		entry.Size = info.Size()
+		entry.LastUsed = info.ModTime()
+	}
+
+	status.Free, status.Total, err = utils.DiskUsage(cacheDir)
+	if err != nil {
+		return
+	}
+
+	status.CacheSize, err = data.GetImageCacheSize()
+	if err != nil {
+		return
+	}
+
+	err = status.Commit(db)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func init() {
+	register(imagePrefetch)
+}
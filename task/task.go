@@ -20,6 +20,7 @@ type Task struct {
 	Retry      bool
 	Handler    func(*database.Database) error
 	RunOnStart bool
+	Local      bool
 }
 
 func (t *Task) scheduled(hour, min int) bool {
@@ -39,9 +40,13 @@ func (t *Task) run(now time.Time) {
 	db := database.GetDatabase()
 	defer db.Close()
 
+	jobId := fmt.Sprintf("%s-%d", t.Name, now.Unix()-int64(now.Second()))
+	if t.Local {
+		jobId = fmt.Sprintf("%s-%s", jobId, node.Self.Id.Hex())
+	}
+
 	job := &Job{
-		Id: fmt.Sprintf(
-			"%s-%d", t.Name, now.Unix()-int64(now.Second())),
+		Id:        jobId,
 		Name:      t.Name,
 		State:     Running,
 		Retry:     t.Retry,
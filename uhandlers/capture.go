@@ -0,0 +1,193 @@
+package uhandlers
+
+import (
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/capture"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/demo"
+	"github.com/pritunl/pritunl-cloud/disk"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/event"
+	"github.com/pritunl/pritunl-cloud/image"
+	"github.com/pritunl/pritunl-cloud/instance"
+	"github.com/pritunl/pritunl-cloud/utils"
+)
+
+type captureData struct {
+	Name       string          `json:"name"`
+	Comment    string          `json:"comment"`
+	Mode       string          `json:"mode"`
+	Generalize bool            `json:"generalize"`
+	Metadata   *image.Metadata `json:"metadata"`
+}
+
+func instanceCapturePost(c *gin.Context) {
+	if demo.Blocked(c) {
+		return
+	}
+
+	db := c.MustGet("db").(*database.Database)
+	userOrg := c.MustGet("organization").(primitive.ObjectID)
+	dta := &captureData{}
+
+	instanceId, ok := utils.ParseObjectId(c.Param("instance_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	err := c.Bind(dta)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Bind error"),
+		}
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	inst, err := instance.GetOrg(db, userOrg, instanceId)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	dsk, err := disk.GetInstanceIndex(db, inst.Id, "0")
+	if err != nil {
+		if _, ok := err.(*database.NotFoundError); ok {
+			errData := &errortypes.ErrorData{
+				Error:   "disk_not_found",
+				Message: "Instance does not have a root disk",
+			}
+			c.JSON(400, errData)
+		} else {
+			utils.AbortWithError(c, 500, err)
+		}
+		return
+	}
+
+	if dsk.State != disk.Available {
+		errData := &errortypes.ErrorData{
+			Error:   "disk_not_available",
+			Message: "Disk must be available to capture",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	cpt := capture.NewCapture()
+	cpt.Name = dta.Name
+	cpt.Comment = dta.Comment
+	cpt.Organization = userOrg
+	cpt.Instance = inst.Id
+	cpt.Disk = dsk.Id
+	cpt.Mode = dta.Mode
+	cpt.Generalize = dta.Generalize
+	cpt.Metadata = dta.Metadata
+
+	errData, err := cpt.Validate(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if errData != nil {
+		c.JSON(400, errData)
+		return
+	}
+
+	err = cpt.Insert(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	dsk.State = disk.Capture
+	err = dsk.CommitFields(db, set.NewSet("state"))
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	event.PublishDispatch(db, "disk.change")
+	event.PublishDispatch(db, "capture.change")
+
+	c.JSON(200, cpt)
+}
+
+func captureGet(c *gin.Context) {
+	db := c.MustGet("db").(*database.Database)
+	userOrg := c.MustGet("organization").(primitive.ObjectID)
+
+	captureId, ok := utils.ParseObjectId(c.Param("capture_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	cpt, err := capture.GetOrg(db, userOrg, captureId)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, cpt)
+}
+
+func capturesGet(c *gin.Context) {
+	db := c.MustGet("db").(*database.Database)
+	userOrg := c.MustGet("organization").(primitive.ObjectID)
+
+	cpts, err := capture.GetAll(db, &bson.M{
+		"organization": userOrg,
+	})
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, cpts)
+}
+
+func captureDelete(c *gin.Context) {
+	if demo.Blocked(c) {
+		return
+	}
+
+	db := c.MustGet("db").(*database.Database)
+	userOrg := c.MustGet("organization").(primitive.ObjectID)
+
+	captureId, ok := utils.ParseObjectId(c.Param("capture_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	cpt, err := capture.GetOrg(db, userOrg, captureId)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if cpt.State == capture.Pending || cpt.State == capture.Capturing {
+		errData := &errortypes.ErrorData{
+			Error:   "capture_active",
+			Message: "Cannot remove active capture",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	err = capture.Remove(db, cpt.Id)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	event.PublishDispatch(db, "capture.change")
+
+	c.JSON(200, nil)
+}
@@ -41,6 +41,7 @@ type diskData struct {
 	Size             int                `json:"size"`
 	NewSize          int                `json:"new_size"`
 	Backup           bool               `json:"backup"`
+	BackupPolicy     *disk.BackupPolicy `json:"backup_policy"`
 }
 
 type disksMultiData struct {
@@ -90,6 +91,7 @@ func diskPut(c *gin.Context) {
 		"delete_protection",
 		"index",
 		"backup",
+		"backup_policy",
 		"new_size",
 	)
 
@@ -112,6 +114,7 @@ func diskPut(c *gin.Context) {
 	dsk.DeleteProtection = dta.DeleteProtection
 	dsk.Index = dta.Index
 	dsk.Backup = dta.Backup
+	dsk.BackupPolicy = dta.BackupPolicy
 
 	if dsk.State == disk.Available && dta.State == disk.Snapshot {
 		dsk.State = disk.Snapshot
@@ -280,6 +283,7 @@ func diskPost(c *gin.Context) {
 		Backing:          dta.Backing,
 		Size:             dta.Size,
 		Backup:           dta.Backup,
+		BackupPolicy:     dta.BackupPolicy,
 	}
 
 	errData, err := dsk.Validate(db)
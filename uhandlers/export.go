@@ -0,0 +1,306 @@
+package uhandlers
+
+import (
+	"time"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/data"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/datacenter"
+	"github.com/pritunl/pritunl-cloud/demo"
+	"github.com/pritunl/pritunl-cloud/disk"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/event"
+	"github.com/pritunl/pritunl-cloud/export"
+	"github.com/pritunl/pritunl-cloud/image"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/pritunl/pritunl-cloud/zone"
+)
+
+type exportData struct {
+	Name        string             `json:"name"`
+	Format      string             `json:"format"`
+	Datacenter  primitive.ObjectID `json:"datacenter"`
+	ExpireHours int                `json:"expire_hours"`
+}
+
+func newExport(dta *exportData, name string) (exp *export.Export) {
+	exp = export.NewExport()
+	exp.Name = dta.Name
+	exp.Format = dta.Format
+	exp.Timestamp = time.Now()
+
+	if exp.Name == "" {
+		exp.Name = name
+	}
+	if exp.Format == "" {
+		exp.Format = export.Qcow2
+	}
+	if dta.ExpireHours > 0 {
+		exp.Expires = exp.Timestamp.Add(
+			time.Duration(dta.ExpireHours) * time.Hour)
+	}
+
+	return
+}
+
+func imageExportPost(c *gin.Context) {
+	if demo.Blocked(c) {
+		return
+	}
+
+	db := c.MustGet("db").(*database.Database)
+	userOrg := c.MustGet("organization").(primitive.ObjectID)
+	dta := &exportData{}
+
+	imageId, ok := utils.ParseObjectId(c.Param("image_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	err := c.Bind(dta)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Bind error"),
+		}
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	img, err := image.GetOrgPublic(db, userOrg, imageId)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if dta.Datacenter.IsZero() {
+		errData := &errortypes.ErrorData{
+			Error:   "datacenter_required",
+			Message: "Missing required datacenter",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	exists, err := datacenter.ExistsOrg(db, userOrg, dta.Datacenter)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+	if !exists {
+		utils.AbortWithStatus(c, 405)
+		return
+	}
+
+	dc, err := datacenter.Get(db, dta.Datacenter)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	img.Json()
+
+	exp := newExport(dta, img.Name)
+	exp.Organization = userOrg
+	exp.Image = img.Id
+	exp.Datacenter = dc.Id
+	exp.Storage = dc.PrivateStorage
+
+	errData, err := exp.Validate(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if errData != nil {
+		c.JSON(400, errData)
+		return
+	}
+
+	err = exp.Insert(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	event.PublishDispatch(db, "export.change")
+
+	c.JSON(200, exp)
+}
+
+func diskExportPost(c *gin.Context) {
+	if demo.Blocked(c) {
+		return
+	}
+
+	db := c.MustGet("db").(*database.Database)
+	userOrg := c.MustGet("organization").(primitive.ObjectID)
+	dta := &exportData{}
+
+	diskId, ok := utils.ParseObjectId(c.Param("disk_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	err := c.Bind(dta)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Bind error"),
+		}
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	dsk, err := disk.GetOrg(db, userOrg, diskId)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if dsk.State != disk.Available && dsk.State != disk.Export {
+		errData := &errortypes.ErrorData{
+			Error:   "disk_not_available",
+			Message: "Disk must be available to export",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	nde, err := node.Get(db, dsk.Node)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	zne, err := zone.Get(db, nde.Zone)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	dc, err := datacenter.Get(db, zne.Datacenter)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	exp := newExport(dta, dsk.Name)
+	exp.Organization = userOrg
+	exp.Disk = dsk.Id
+	exp.Storage = dc.PrivateStorage
+
+	errData, err := exp.Validate(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if errData != nil {
+		c.JSON(400, errData)
+		return
+	}
+
+	err = exp.Insert(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	dsk.State = disk.Export
+	err = dsk.CommitFields(db, set.NewSet("state"))
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	event.PublishDispatch(db, "disk.change")
+	event.PublishDispatch(db, "export.change")
+
+	c.JSON(200, exp)
+}
+
+func exportGet(c *gin.Context) {
+	db := c.MustGet("db").(*database.Database)
+	userOrg := c.MustGet("organization").(primitive.ObjectID)
+
+	exportId, ok := utils.ParseObjectId(c.Param("export_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	exp, err := export.GetOrg(db, userOrg, exportId)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	err = data.GetExportUrl(db, exp)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, exp)
+}
+
+func exportsGet(c *gin.Context) {
+	db := c.MustGet("db").(*database.Database)
+	userOrg := c.MustGet("organization").(primitive.ObjectID)
+
+	exps, err := export.GetAll(db, &bson.M{
+		"organization": userOrg,
+	})
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	for _, exp := range exps {
+		err = data.GetExportUrl(db, exp)
+		if err != nil {
+			utils.AbortWithError(c, 500, err)
+			return
+		}
+	}
+
+	c.JSON(200, exps)
+}
+
+func exportDelete(c *gin.Context) {
+	if demo.Blocked(c) {
+		return
+	}
+
+	db := c.MustGet("db").(*database.Database)
+	userOrg := c.MustGet("organization").(primitive.ObjectID)
+
+	exportId, ok := utils.ParseObjectId(c.Param("export_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	exp, err := export.GetOrg(db, userOrg, exportId)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	err = data.DeleteExport(db, exp)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	event.PublishDispatch(db, "export.change")
+
+	c.JSON(200, nil)
+}
@@ -24,6 +24,8 @@ type firewallData struct {
 	Comment      string             `json:"comment"`
 	NetworkRoles []string           `json:"network_roles"`
 	Ingress      []*firewall.Rule   `json:"ingress"`
+	Egress       []*firewall.Rule   `json:"egress"`
+	LogDropped   bool               `json:"log_dropped"`
 }
 
 type firewallsData struct {
@@ -65,12 +67,16 @@ func firewallPut(c *gin.Context) {
 	fire.Comment = data.Comment
 	fire.NetworkRoles = data.NetworkRoles
 	fire.Ingress = data.Ingress
+	fire.Egress = data.Egress
+	fire.LogDropped = data.LogDropped
 
 	fields := set.NewSet(
 		"name",
 		"comment",
 		"network_roles",
 		"ingress",
+		"egress",
+		"log_dropped",
 	)
 
 	errData, err := fire.Validate(db)
@@ -121,6 +127,8 @@ func firewallPost(c *gin.Context) {
 		Organization: userOrg,
 		NetworkRoles: data.NetworkRoles,
 		Ingress:      data.Ingress,
+		Egress:       data.Egress,
+		LogDropped:   data.LogDropped,
 	}
 
 	errData, err := fire.Validate(db)
@@ -218,6 +226,31 @@ func firewallGet(c *gin.Context) {
 	c.JSON(200, fire)
 }
 
+func firewallStatsGet(c *gin.Context) {
+	db := c.MustGet("db").(*database.Database)
+	userOrg := c.MustGet("organization").(primitive.ObjectID)
+
+	firewallId, ok := utils.ParseObjectId(c.Param("firewall_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	fire, err := firewall.GetOrg(db, userOrg, firewallId)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	stats, err := fire.GetInstanceStats(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, stats)
+}
+
 func firewallsGet(c *gin.Context) {
 	db := c.MustGet("db").(*database.Database)
 	userOrg := c.MustGet("organization").(primitive.ObjectID)
@@ -65,6 +65,10 @@ func Register(engine *gin.Engine) {
 	orgGroup.DELETE("/balancer", balancersDelete)
 	orgGroup.DELETE("/balancer/:balancer_id", balancerDelete)
 
+	orgGroup.GET("/capture", capturesGet)
+	orgGroup.GET("/capture/:capture_id", captureGet)
+	orgGroup.DELETE("/capture/:capture_id", captureDelete)
+
 	orgGroup.GET("/certificate", certificatesGet)
 	orgGroup.GET("/certificate/:cert_id", certificateGet)
 	orgGroup.PUT("/certificate/:cert_id", certificatePut)
@@ -95,11 +99,17 @@ func Register(engine *gin.Engine) {
 	orgGroup.POST("/disk", diskPost)
 	orgGroup.DELETE("/disk", disksDelete)
 	orgGroup.DELETE("/disk/:disk_id", diskDelete)
+	orgGroup.POST("/disk/:disk_id/export", diskExportPost)
 
 	csrfGroup.GET("/event", eventGet)
 
+	orgGroup.GET("/export", exportsGet)
+	orgGroup.GET("/export/:export_id", exportGet)
+	orgGroup.DELETE("/export/:export_id", exportDelete)
+
 	orgGroup.GET("/firewall", firewallsGet)
 	orgGroup.GET("/firewall/:firewall_id", firewallGet)
+	orgGroup.GET("/firewall/:firewall_id/stats", firewallStatsGet)
 	orgGroup.PUT("/firewall/:firewall_id", firewallPut)
 	orgGroup.POST("/firewall", firewallPost)
 	orgGroup.DELETE("/firewall", firewallsDelete)
@@ -108,6 +118,9 @@ func Register(engine *gin.Engine) {
 	orgGroup.GET("/image", imagesGet)
 	orgGroup.GET("/image/:image_id", imageGet)
 	orgGroup.PUT("/image/:image_id", imagePut)
+	orgGroup.POST("/image", imagePost)
+	orgGroup.POST("/image/:image_id/restore", imageRestorePost)
+	orgGroup.POST("/image/:image_id/export", imageExportPost)
 	orgGroup.DELETE("/image", imagesDelete)
 	orgGroup.DELETE("/image/:image_id", imageDelete)
 
@@ -115,6 +128,8 @@ func Register(engine *gin.Engine) {
 	orgGroup.PUT("/instance", instancesPut)
 	orgGroup.GET("/instance/:instance_id", instanceGet)
 	orgGroup.GET("/instance/:instance_id/vnc", instanceVncGet)
+	orgGroup.GET("/instance/:instance_id/firewall_log", instanceFirewallLogGet)
+	orgGroup.POST("/instance/:instance_id/capture", instanceCapturePost)
 	orgGroup.PUT("/instance/:instance_id", instancePut)
 	orgGroup.POST("/instance", instancePost)
 	orgGroup.DELETE("/instance", instancesDelete)
@@ -137,6 +152,19 @@ func Register(engine *gin.Engine) {
 	orgGroup.DELETE("/vpc", vpcsDelete)
 	orgGroup.DELETE("/vpc/:vpc_id", vpcDelete)
 
+	orgGroup.GET("/peering", peeringsGet)
+	orgGroup.GET("/peering/:peering_id", peeringGet)
+	orgGroup.PUT("/peering/:peering_id", peeringPut)
+	orgGroup.POST("/peering", peeringPost)
+	orgGroup.DELETE("/peering", peeringsDelete)
+	orgGroup.DELETE("/peering/:peering_id", peeringDelete)
+
+	orgGroup.GET("/floating_ip", floatingIpsGet)
+	orgGroup.GET("/floating_ip/:floating_ip_id", floatingIpGet)
+	orgGroup.PUT("/floating_ip/:floating_ip_id", floatingIpPut)
+	orgGroup.DELETE("/floating_ip", floatingIpsDelete)
+	orgGroup.DELETE("/floating_ip/:floating_ip_id", floatingIpDelete)
+
 	orgGroup.GET("/zone", zonesGet)
 
 	engine.GET("/robots.txt", middlewear.RobotsGet)
@@ -2,6 +2,10 @@ package uhandlers
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"path"
 	"strconv"
 	"strings"
 
@@ -14,16 +18,59 @@ import (
 	"github.com/pritunl/pritunl-cloud/database"
 	"github.com/pritunl/pritunl-cloud/datacenter"
 	"github.com/pritunl/pritunl-cloud/demo"
+	"github.com/pritunl/pritunl-cloud/disk"
 	"github.com/pritunl/pritunl-cloud/errortypes"
 	"github.com/pritunl/pritunl-cloud/event"
 	"github.com/pritunl/pritunl-cloud/image"
+	"github.com/pritunl/pritunl-cloud/instance"
+	"github.com/pritunl/pritunl-cloud/node"
+	"github.com/pritunl/pritunl-cloud/paths"
+	"github.com/pritunl/pritunl-cloud/storage"
 	"github.com/pritunl/pritunl-cloud/utils"
+	"github.com/pritunl/pritunl-cloud/zone"
 )
 
 type imageData struct {
-	Id      primitive.ObjectID `json:"id"`
-	Name    string             `json:"name"`
-	Comment string             `json:"comment"`
+	Id           primitive.ObjectID `json:"id"`
+	Name         string             `json:"name"`
+	Comment      string             `json:"comment"`
+	OsFamily     string             `json:"os_family"`
+	OsVersion    string             `json:"os_version"`
+	Architecture string             `json:"architecture"`
+	MinDisk      int                `json:"min_disk"`
+	MinMemory    int                `json:"min_memory"`
+	DefaultUser  string             `json:"default_user"`
+	CloudInit    bool               `json:"cloud_init"`
+	Tags         []string           `json:"tags"`
+	Lifecycle    string             `json:"lifecycle"`
+}
+
+type imageRestoreData struct {
+	Name             string             `json:"name"`
+	Comment          string             `json:"comment"`
+	Node             primitive.ObjectID `json:"node"`
+	Instance         primitive.ObjectID `json:"instance"`
+	Index            string             `json:"index"`
+	Size             int                `json:"size"`
+	DeleteProtection bool               `json:"delete_protection"`
+}
+
+type imageImportData struct {
+	Name       string             `json:"name"`
+	Comment    string             `json:"comment"`
+	Datacenter primitive.ObjectID `json:"datacenter"`
+	Url        string             `json:"url"`
+	Firmware   string             `json:"firmware"`
+	Format     string             `json:"format"`
+	Checksum   string             `json:"checksum"`
+	Signature  string             `json:"signature"`
+	SigningKey string             `json:"signing_key"`
+}
+
+type imageImportStatus struct {
+	Id    primitive.ObjectID `json:"id"`
+	Name  string             `json:"name"`
+	State string             `json:"state"`
 }
 
 type imagesData struct {
@@ -63,10 +110,28 @@ func imagePut(c *gin.Context) {
 
 	img.Name = dta.Name
 	img.Comment = dta.Comment
+	img.OsFamily = dta.OsFamily
+	img.OsVersion = dta.OsVersion
+	img.Architecture = dta.Architecture
+	img.MinDisk = dta.MinDisk
+	img.MinMemory = dta.MinMemory
+	img.DefaultUser = dta.DefaultUser
+	img.CloudInit = dta.CloudInit
+	img.Tags = dta.Tags
+	img.Lifecycle = dta.Lifecycle
 
 	fields := set.NewSet(
 		"name",
 		"comment",
+		"os_family",
+		"os_version",
+		"architecture",
+		"min_disk",
+		"min_memory",
+		"default_user",
+		"cloud_init",
+		"tags",
+		"lifecycle",
 	)
 
 	errData, err := img.Validate(db)
@@ -91,6 +156,401 @@ func imagePut(c *gin.Context) {
 	c.JSON(200, img)
 }
 
+// Reads the upload form fields until the file part, fields must precede
+// the file to validate the import before the file is written
+func imageUploadBind(c *gin.Context, dta *imageImportData) (
+	file *multipart.Part, err error) {
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Failed to read upload"),
+		}
+		return
+	}
+
+	for {
+		part, e := reader.NextPart()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(e, "handler: Failed to read upload"),
+			}
+			return
+		}
+
+		if part.FormName() == "file" {
+			file = part
+			break
+		}
+
+		valueByt, e := ioutil.ReadAll(io.LimitReader(part, 65536))
+		if e != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(e, "handler: Failed to read upload"),
+			}
+			return
+		}
+		value := string(valueByt)
+
+		switch part.FormName() {
+		case "name":
+			dta.Name = value
+		case "comment":
+			dta.Comment = value
+		case "datacenter":
+			dta.Datacenter, _ = primitive.ObjectIDFromHex(value)
+		case "firmware":
+			dta.Firmware = value
+		case "format":
+			dta.Format = value
+		case "checksum":
+			dta.Checksum = value
+		case "signature":
+			dta.Signature = value
+		case "signing_key":
+			dta.SigningKey = value
+		}
+	}
+
+	if file == nil {
+		err = &errortypes.ParseError{
+			errors.New("handler: Missing image upload file"),
+		}
+		return
+	}
+
+	return
+}
+
+func imagePost(c *gin.Context) {
+	if demo.Blocked(c) {
+		return
+	}
+
+	db := c.MustGet("db").(*database.Database)
+	userOrg := c.MustGet("organization").(primitive.ObjectID)
+	dta := &imageImportData{}
+	srcPth := ""
+	started := false
+	var file *multipart.Part
+	var err error
+
+	defer func() {
+		if srcPth != "" && !started {
+			utils.Remove(srcPth)
+		}
+	}()
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, err = imageUploadBind(c, dta)
+		if err != nil {
+			utils.AbortWithError(c, 500, err)
+			return
+		}
+	} else {
+		err = c.Bind(dta)
+		if err != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(err, "handler: Bind error"),
+			}
+			utils.AbortWithError(c, 500, err)
+			return
+		}
+
+		if dta.Url == "" {
+			errData := &errortypes.ErrorData{
+				Error:   "image_source_required",
+				Message: "Missing image url or upload",
+			}
+			c.JSON(400, errData)
+			return
+		}
+	}
+
+	if dta.Format != "" && !data.ValidImageFormat(dta.Format) {
+		errData := &errortypes.ErrorData{
+			Error:   "image_format_invalid",
+			Message: "Image format is invalid",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	switch dta.Firmware {
+	case "", image.Unknown, image.Bios, image.Uefi:
+	default:
+		errData := &errortypes.ErrorData{
+			Error:   "image_firmware_invalid",
+			Message: "Image firmware is invalid",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	if dta.Signature != "" && dta.SigningKey == "" {
+		errData := &errortypes.ErrorData{
+			Error:   "image_signing_key_required",
+			Message: "Image signature requires signing key",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	if dta.Datacenter.IsZero() {
+		errData := &errortypes.ErrorData{
+			Error:   "datacenter_required",
+			Message: "Missing required datacenter",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	exists, err := datacenter.ExistsOrg(db, userOrg, dta.Datacenter)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+	if !exists {
+		utils.AbortWithStatus(c, 405)
+		return
+	}
+
+	dc, err := datacenter.Get(db, dta.Datacenter)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if dc.PrivateStorage.IsZero() {
+		errData := &errortypes.ErrorData{
+			Error:   "private_storage_required",
+			Message: "Datacenter does not have private storage",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	if file != nil {
+		err = utils.ExistsMkdir(paths.GetTempPath(), 0755)
+		if err != nil {
+			utils.AbortWithError(c, 500, err)
+			return
+		}
+
+		srcPth = paths.GetImageTempPath()
+		err = data.WriteImageFile(file, srcPth)
+		if err != nil {
+			utils.AbortWithError(c, 500, err)
+			return
+		}
+	}
+
+	name := dta.Name
+	if name == "" && dta.Url != "" {
+		name = path.Base(strings.SplitN(dta.Url, "?", 2)[0])
+	}
+	if name == "" {
+		name = "Imported Image"
+	}
+
+	opts := &data.ImportOptions{
+		Id:           primitive.NewObjectID(),
+		Name:         name,
+		Comment:      dta.Comment,
+		Organization: userOrg,
+		Firmware:     dta.Firmware,
+		Format:       dta.Format,
+		Checksum:     dta.Checksum,
+		Signature:    dta.Signature,
+		SigningKey:   dta.SigningKey,
+	}
+
+	go data.RunImport(dc, opts, dta.Url, srcPth)
+	started = true
+
+	c.JSON(200, &imageImportStatus{
+		Id:    opts.Id,
+		Name:  opts.Name,
+		State: "importing",
+	})
+}
+
+func imageRestorePost(c *gin.Context) {
+	if demo.Blocked(c) {
+		return
+	}
+
+	db := c.MustGet("db").(*database.Database)
+	userOrg := c.MustGet("organization").(primitive.ObjectID)
+	dta := &imageRestoreData{}
+
+	imageId, ok := utils.ParseObjectId(c.Param("image_id"))
+	if !ok {
+		utils.AbortWithStatus(c, 400)
+		return
+	}
+
+	err := c.Bind(dta)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "handler: Bind error"),
+		}
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	img, err := image.GetOrg(db, userOrg, imageId)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if !img.Restorable() {
+		errData := &errortypes.ErrorData{
+			Error:   "invalid_restore_image",
+			Message: "Only backup and snapshot images can be restored",
+		}
+
+		c.JSON(400, errData)
+		return
+	}
+
+	store, err := storage.Get(db, img.Storage)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	available, err := data.ImageAvailable(store, img)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+	if !available {
+		errData := &errortypes.ErrorData{
+			Error:   "image_not_available",
+			Message: "Image not restored from archive",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	ndeId := dta.Node
+	size := dta.Size
+
+	if !dta.Instance.IsZero() {
+		inst, e := instance.GetOrg(db, userOrg, dta.Instance)
+		if e != nil {
+			if _, ok := e.(*database.NotFoundError); ok {
+				utils.AbortWithStatus(c, 405)
+			} else {
+				utils.AbortWithError(c, 500, e)
+			}
+			return
+		}
+
+		if ndeId.IsZero() {
+			ndeId = inst.Node
+		} else if ndeId != inst.Node {
+			errData := &errortypes.ErrorData{
+				Error:   "instance_node_invalid",
+				Message: "Node must match instance node",
+			}
+			c.JSON(400, errData)
+			return
+		}
+	}
+
+	if !img.Disk.IsZero() {
+		srcDsk, e := disk.GetOrg(db, userOrg, img.Disk)
+		if e != nil {
+			if _, ok := e.(*database.NotFoundError); !ok {
+				utils.AbortWithError(c, 500, e)
+				return
+			}
+		} else {
+			if ndeId.IsZero() {
+				ndeId = srcDsk.Node
+			}
+			if srcDsk.Size > size {
+				size = srcDsk.Size
+			}
+		}
+	}
+
+	if ndeId.IsZero() {
+		errData := &errortypes.ErrorData{
+			Error:   "node_required",
+			Message: "Missing required node",
+		}
+		c.JSON(400, errData)
+		return
+	}
+
+	nde, err := node.Get(db, ndeId)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	zne, err := zone.Get(db, nde.Zone)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	exists, err := datacenter.ExistsOrg(db, userOrg, zne.Datacenter)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+	if !exists {
+		utils.AbortWithStatus(c, 405)
+		return
+	}
+
+	name := dta.Name
+	if name == "" {
+		name = fmt.Sprintf("%s-restore", img.Name)
+	}
+
+	dsk := &disk.Disk{
+		Name:             name,
+		Comment:          dta.Comment,
+		Organization:     userOrg,
+		Instance:         dta.Instance,
+		Index:            dta.Index,
+		Node:             nde.Id,
+		Image:            img.Id,
+		DeleteProtection: dta.DeleteProtection,
+		Size:             size,
+	}
+
+	errData, err := dsk.Validate(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if errData != nil {
+		c.JSON(400, errData)
+		return
+	}
+
+	err = dsk.Insert(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	event.PublishDispatch(db, "disk.change")
+
+	c.JSON(200, dsk)
+}
+
 func imageDelete(c *gin.Context) {
 	if demo.Blocked(c) {
 		return
@@ -159,6 +619,10 @@ func imageGet(c *gin.Context) {
 	}
 
 	img.Json()
+	if img.Organization != userOrg {
+		img.Shares = []primitive.ObjectID{}
+		img.PublishedDatacenters = []primitive.ObjectID{}
+	}
 
 	c.JSON(200, img)
 }
@@ -188,6 +652,9 @@ func imagesGet(c *gin.Context) {
 			"storage": &bson.M{
 				"$in": dc.PublicStorages,
 			},
+			"lifecycle": &bson.M{
+				"$ne": image.Obsolete,
+			},
 		}
 
 		images, err := image.GetAllNames(db, query)
@@ -201,9 +668,33 @@ func imagesGet(c *gin.Context) {
 		}
 
 		if !dc.PrivateStorage.IsZero() {
+			access := []*bson.M{
+				&bson.M{
+					"organization": userOrg,
+				},
+				&bson.M{
+					"shares": userOrg,
+				},
+			}
+
+			exists, err := datacenter.ExistsOrg(db, userOrg, dc.Id)
+			if err != nil {
+				utils.AbortWithError(c, 500, err)
+				return
+			}
+
+			if exists {
+				access = append(access, &bson.M{
+					"published_datacenters": dc.Id,
+				})
+			}
+
 			query = &bson.M{
-				"organization": userOrg,
-				"storage":      dc.PrivateStorage,
+				"$or":     access,
+				"storage": dc.PrivateStorage,
+				"lifecycle": &bson.M{
+					"$ne": image.Obsolete,
+				},
 			}
 
 			images2, err := image.GetAllNames(db, query)
@@ -223,17 +714,14 @@ func imagesGet(c *gin.Context) {
 		page, _ := strconv.ParseInt(c.Query("page"), 10, 0)
 		pageCount, _ := strconv.ParseInt(c.Query("page_count"), 10, 0)
 
+		dcIds, err := datacenter.DistinctOrg(db, userOrg)
+		if err != nil {
+			utils.AbortWithError(c, 500, err)
+			return
+		}
+
 		query := bson.M{
-			"$or": []*bson.M{
-				&bson.M{
-					"organization": userOrg,
-				},
-				&bson.M{
-					"organization": &bson.M{
-						"$exists": false,
-					},
-				},
-			},
+			"$or": image.OrgAccessQuery(userOrg, dcIds),
 		}
 
 		imageId, ok := utils.ParseObjectId(c.Query("id"))
@@ -246,16 +734,7 @@ func imagesGet(c *gin.Context) {
 			query = bson.M{
 				"$and": []*bson.M{
 					&bson.M{
-						"$or": []*bson.M{
-							&bson.M{
-								"organization": userOrg,
-							},
-							&bson.M{
-								"organization": &bson.M{
-									"$exists": false,
-								},
-							},
-						},
+						"$or": image.OrgAccessQuery(userOrg, dcIds),
 					},
 					&bson.M{
 						"$or": []*bson.M{
@@ -282,6 +761,16 @@ func imagesGet(c *gin.Context) {
 			query["type"] = typ
 		}
 
+		tag := strings.TrimSpace(c.Query("tag"))
+		if tag != "" {
+			query["tags"] = tag
+		}
+
+		lifecycle := strings.TrimSpace(c.Query("lifecycle"))
+		if lifecycle != "" {
+			query["lifecycle"] = lifecycle
+		}
+
 		images, count, err := image.GetAll(db, &query, page, pageCount)
 		if err != nil {
 			utils.AbortWithError(c, 500, err)
@@ -290,6 +779,10 @@ func imagesGet(c *gin.Context) {
 
 		for _, img := range images {
 			img.Json()
+			if img.Organization != userOrg {
+				img.Shares = []primitive.ObjectID{}
+				img.PublishedDatacenters = []primitive.ObjectID{}
+			}
 		}
 
 		dta := &imagesData{
@@ -13,18 +13,24 @@ import (
 	"github.com/pritunl/pritunl-cloud/datacenter"
 	"github.com/pritunl/pritunl-cloud/demo"
 	"github.com/pritunl/pritunl-cloud/event"
+	"github.com/pritunl/pritunl-cloud/peering"
 	"github.com/pritunl/pritunl-cloud/utils"
 	"github.com/pritunl/pritunl-cloud/vpc"
 )
 
 type vpcData struct {
-	Id         primitive.ObjectID `json:"id"`
-	Name       string             `json:"name"`
-	Comment    string             `json:"comment"`
-	Network    string             `json:"network"`
-	Subnets    []*vpc.Subnet      `json:"subnets"`
-	Datacenter primitive.ObjectID `json:"datacenter"`
-	Routes     []*vpc.Route       `json:"routes"`
+	Id                primitive.ObjectID   `json:"id"`
+	Name              string               `json:"name"`
+	Comment           string               `json:"comment"`
+	Network           string               `json:"network"`
+	Subnets           []*vpc.Subnet        `json:"subnets"`
+	Datacenter        primitive.ObjectID   `json:"datacenter"`
+	Routes            []*vpc.Route         `json:"routes"`
+	InternalDns       bool                 `json:"internal_dns"`
+	PeerOrganizations []primitive.ObjectID `json:"peer_organizations"`
+	NatGateway        bool                 `json:"nat_gateway"`
+	NatZone           primitive.ObjectID   `json:"nat_zone"`
+	NatSubnet         primitive.ObjectID   `json:"nat_subnet"`
 }
 
 type vpcsData struct {
@@ -80,12 +86,25 @@ func vpcPut(c *gin.Context) {
 	vc.Comment = data.Comment
 	vc.Routes = data.Routes
 	vc.Subnets = data.Subnets
+	vc.InternalDns = data.InternalDns
+	vc.PeerOrganizations = data.PeerOrganizations
+	vc.NatGateway = data.NatGateway
+	vc.NatZone = data.NatZone
+	vc.NatSubnet = data.NatSubnet
 
 	fields := set.NewSet(
 		"name",
 		"comment",
 		"routes",
 		"subnets",
+		"internal_dns",
+		"peer_organizations",
+		"nat_gateway",
+		"nat_zone",
+		"nat_subnet",
+		"nat_block",
+		"nat_address",
+		"nat_private",
 	)
 
 	errData, err := vc.Validate(db)
@@ -110,6 +129,22 @@ func vpcPut(c *gin.Context) {
 		return
 	}
 
+	errData, err = vc.InitNat(db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	if errData != nil {
+		c.JSON(400, errData)
+		return
+	}
+
+	if !vc.NatGateway {
+		fields.Add("nat_node")
+		fields.Add("nat_timestamp")
+	}
+
 	err = vc.CommitFields(db, fields)
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
@@ -151,13 +186,15 @@ func vpcPost(c *gin.Context) {
 	}
 
 	vc := &vpc.Vpc{
-		Name:         data.Name,
-		Comment:      data.Comment,
-		Network:      data.Network,
-		Subnets:      data.Subnets,
-		Organization: userOrg,
-		Datacenter:   data.Datacenter,
-		Routes:       data.Routes,
+		Name:              data.Name,
+		Comment:           data.Comment,
+		Network:           data.Network,
+		Subnets:           data.Subnets,
+		Organization:      userOrg,
+		Datacenter:        data.Datacenter,
+		Routes:            data.Routes,
+		InternalDns:       data.InternalDns,
+		PeerOrganizations: data.PeerOrganizations,
 	}
 
 	vc.InitVpc()
@@ -216,6 +253,12 @@ func vpcDelete(c *gin.Context) {
 		return
 	}
 
+	err = peering.RemoveVpcs(db, []primitive.ObjectID{vpcId})
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
 	event.PublishDispatch(db, "vpc.change")
 
 	c.JSON(200, nil)
@@ -254,6 +297,12 @@ func vpcsDelete(c *gin.Context) {
 		return
 	}
 
+	err = peering.RemoveVpcs(db, data)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
 	event.PublishDispatch(db, "vpc.change")
 
 	c.JSON(200, nil)
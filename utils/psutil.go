@@ -5,6 +5,7 @@ import (
 
 	"github.com/dropbox/godropbox/errors"
 	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/shirou/gopsutil/disk"
 	"github.com/shirou/gopsutil/load"
 	"github.com/shirou/gopsutil/mem"
 )
@@ -24,6 +25,21 @@ func MemoryUsed() (used, total float64, err error) {
 	return
 }
 
+func DiskUsage(pth string) (free, total uint64, err error) {
+	usage, err := disk.Usage(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrapf(err, "utils: Failed to read disk usage"),
+		}
+		return
+	}
+
+	free = usage.Free
+	total = usage.Total
+
+	return
+}
+
 type LoadStat struct {
 	CpuUnits int
 	Load1    float64
@@ -5,6 +5,7 @@ import (
 	"crypto/md5"
 	"encoding/base32"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/pritunl/mongo-go-driver/bson/primitive"
@@ -150,6 +151,30 @@ func GetIfaceVlan(id primitive.ObjectID, n int) string {
 	return fmt.Sprintf("x%s%d", strings.ToLower(hashSum), n)
 }
 
+func GetIfacePeer(id primitive.ObjectID, vpcId int) string {
+	hash := md5.New()
+	hash.Write([]byte(id.Hex()))
+	hashSum := base32.StdEncoding.EncodeToString(hash.Sum(nil))[:8]
+	return fmt.Sprintf("y%s%d", strings.ToLower(hashSum), vpcId)
+}
+
+func ParseIfacePeer(id primitive.ObjectID, iface string) (
+	vpcId int, ok bool) {
+
+	prefix := strings.TrimSuffix(GetIfacePeer(id, 0), "0")
+	if !strings.HasPrefix(iface, prefix) {
+		return
+	}
+
+	vpcId, err := strconv.Atoi(iface[len(prefix):])
+	if err != nil {
+		return
+	}
+	ok = true
+
+	return
+}
+
 func GetNamespace(id primitive.ObjectID, n int) string {
 	hash := md5.New()
 	hash.Write([]byte(id.Hex()))
@@ -157,6 +182,27 @@ func GetNamespace(id primitive.ObjectID, n int) string {
 	return fmt.Sprintf("n%s%d", strings.ToLower(hashSum), n)
 }
 
+func GetNamespaceNat(vcId primitive.ObjectID) string {
+	hash := md5.New()
+	hash.Write([]byte(vcId.Hex()))
+	hashSum := base32.StdEncoding.EncodeToString(hash.Sum(nil))[:12]
+	return fmt.Sprintf("g%s0", strings.ToLower(hashSum))
+}
+
+func GetIfaceNat(vcId primitive.ObjectID, n int) string {
+	hash := md5.New()
+	hash.Write([]byte(vcId.Hex()))
+	hashSum := base32.StdEncoding.EncodeToString(hash.Sum(nil))[:12]
+	return fmt.Sprintf("u%s%d", strings.ToLower(hashSum), n)
+}
+
+func GetIfaceNatVirt(vcId primitive.ObjectID, n int) string {
+	hash := md5.New()
+	hash.Write([]byte(vcId.Hex()))
+	hashSum := base32.StdEncoding.EncodeToString(hash.Sum(nil))[:12]
+	return fmt.Sprintf("w%s%d", strings.ToLower(hashSum), n)
+}
+
 func GetHostVxlanIface(parentIface string) string {
 	hash := md5.New()
 	hash.Write([]byte(parentIface))
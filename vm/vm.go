@@ -25,6 +25,7 @@ type VirtualMachine struct {
 	Uefi                bool               `json:"uefi"`
 	NoPublicAddress     bool               `json:"no_public_address"`
 	NoHostAddress       bool               `json:"no_host_address"`
+	DhcpServer          bool               `json:"dhcp_server"`
 	UsbDevices          []*UsbDevice       `json:"usb_devices"`
 	UsbDevicesAvailable bool               `json:"-"`
 	PciDevices          []*PciDevice       `json:"pci_devices"`
@@ -95,6 +96,7 @@ type NetworkAdapter struct {
 	Subnet     primitive.ObjectID `json:"subnet"`
 	IpAddress  string             `json:"ip_address,omitempty"`
 	IpAddress6 string             `json:"ip_address6,omitempty"`
+	StaticIp   string             `json:"static_ip,omitempty"`
 }
 
 func (v *VirtualMachine) Commit(db *database.Database) (err error) {
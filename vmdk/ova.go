@@ -0,0 +1,297 @@
+package vmdk
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/utils"
+)
+
+const ovfTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope vmw:buildId="build-0" xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:cim="http://schemas.dmtf.org/wbem/wscim/1/common" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vmw="http://www.vmware.com/schema/ovf" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <References>
+    <File ovf:href="%s" ovf:id="file1" ovf:size="%d"/>
+  </References>
+  <DiskSection>
+    <Info>Virtual disk information</Info>
+    <Disk ovf:capacity="%d" ovf:capacityAllocationUnits="byte" ovf:diskId="vmdisk1" ovf:fileRef="file1" ovf:format="http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"/>
+  </DiskSection>
+  <NetworkSection>
+    <Info>The list of logical networks</Info>
+    <Network ovf:name="VM Network">
+      <Description>The VM Network network</Description>
+    </Network>
+  </NetworkSection>
+  <VirtualSystem ovf:id="%s">
+    <Info>A virtual machine</Info>
+    <Name>%s</Name>
+    <OperatingSystemSection ovf:id="101">
+      <Info>The kind of installed guest operating system</Info>
+    </OperatingSystemSection>
+    <VirtualHardwareSection>
+      <Info>Virtual hardware requirements</Info>
+      <System>
+        <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+        <vssd:InstanceID>0</vssd:InstanceID>
+        <vssd:VirtualSystemIdentifier>%s</vssd:VirtualSystemIdentifier>
+        <vssd:VirtualSystemType>vmx-10</vssd:VirtualSystemType>
+      </System>
+      <Item>
+        <rasd:AllocationUnits>hertz * 10^6</rasd:AllocationUnits>
+        <rasd:Description>Number of Virtual CPUs</rasd:Description>
+        <rasd:ElementName>%d virtual CPU(s)</rasd:ElementName>
+        <rasd:InstanceID>1</rasd:InstanceID>
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>%d</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:AllocationUnits>byte * 2^20</rasd:AllocationUnits>
+        <rasd:Description>Memory Size</rasd:Description>
+        <rasd:ElementName>%dMB of memory</rasd:ElementName>
+        <rasd:InstanceID>2</rasd:InstanceID>
+        <rasd:ResourceType>4</rasd:ResourceType>
+        <rasd:VirtualQuantity>%d</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:Address>0</rasd:Address>
+        <rasd:Description>SCSI Controller</rasd:Description>
+        <rasd:ElementName>SCSI Controller 0</rasd:ElementName>
+        <rasd:InstanceID>3</rasd:InstanceID>
+        <rasd:ResourceSubType>lsilogic</rasd:ResourceSubType>
+        <rasd:ResourceType>6</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>0</rasd:AddressOnParent>
+        <rasd:ElementName>Hard Disk 1</rasd:ElementName>
+        <rasd:HostResource>ovf:/disk/vmdisk1</rasd:HostResource>
+        <rasd:InstanceID>4</rasd:InstanceID>
+        <rasd:Parent>3</rasd:Parent>
+        <rasd:ResourceType>17</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>0</rasd:AddressOnParent>
+        <rasd:AutomaticAllocation>true</rasd:AutomaticAllocation>
+        <rasd:Connection>VM Network</rasd:Connection>
+        <rasd:ElementName>Network Adapter 1</rasd:ElementName>
+        <rasd:InstanceID>5</rasd:InstanceID>
+        <rasd:ResourceSubType>VmxNet3</rasd:ResourceSubType>
+        <rasd:ResourceType>10</rasd:ResourceType>
+      </Item>
+    </VirtualHardwareSection>
+  </VirtualSystem>
+</Envelope>
+`
+
+type OvaConfig struct {
+	Name       string
+	Processors int
+	Memory     int
+}
+
+type imageInfo struct {
+	VirtualSize int64 `json:"virtual-size"`
+}
+
+func Convert(srcPth, dstPth string, streamOptimized bool) (err error) {
+	args := []string{
+		"convert", "-O", "vmdk",
+	}
+	if streamOptimized {
+		args = append(args, "-o", "subformat=streamOptimized")
+	}
+	args = append(args, srcPth, dstPth)
+
+	_, err = utils.ExecCombinedOutputLogged(nil, "qemu-img", args...)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func GetCapacity(pth string) (capacity int64, err error) {
+	output, err := utils.ExecOutput("",
+		"qemu-img", "info", "--output=json", pth)
+	if err != nil {
+		return
+	}
+
+	info := &imageInfo{}
+	err = json.Unmarshal([]byte(output), info)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "vmdk: Failed to parse disk info"),
+		}
+		return
+	}
+
+	capacity = info.VirtualSize
+
+	return
+}
+
+func writeTarFile(writer *tar.Writer, name string, size int64,
+	reader io.Reader) (err error) {
+
+	err = writer.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "vmdk: Failed to write ova header"),
+		}
+		return
+	}
+
+	_, err = io.Copy(writer, reader)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "vmdk: Failed to write ova file"),
+		}
+		return
+	}
+
+	return
+}
+
+func fileSha256(pth string) (hash string, err error) {
+	file, err := os.Open(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "vmdk: Failed to open file"),
+		}
+		return
+	}
+	defer file.Close()
+
+	hsh := sha256.New()
+	_, err = io.Copy(hsh, file)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "vmdk: Failed to read file"),
+		}
+		return
+	}
+
+	hash = fmt.Sprintf("%x", hsh.Sum(nil))
+
+	return
+}
+
+func WriteOva(srcPth, ovaPth string, conf *OvaConfig) (err error) {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9') || r == '-' || r == '_' {
+
+			return r
+		}
+		return '_'
+	}, conf.Name)
+	if name == "" {
+		name = "disk"
+	}
+
+	processors := conf.Processors
+	if processors < 1 {
+		processors = 1
+	}
+	memory := conf.Memory
+	if memory < 1 {
+		memory = 1024
+	}
+
+	capacity, err := GetCapacity(srcPth)
+	if err != nil {
+		return
+	}
+
+	vmdkName := name + "-disk1.vmdk"
+	vmdkPth := path.Join(path.Dir(ovaPth), vmdkName)
+	defer utils.Remove(vmdkPth)
+
+	err = Convert(srcPth, vmdkPth, true)
+	if err != nil {
+		return
+	}
+
+	vmdkInfo, err := os.Stat(vmdkPth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "vmdk: Failed to stat vmdk"),
+		}
+		return
+	}
+
+	ovf := fmt.Sprintf(ovfTemplate, vmdkName, vmdkInfo.Size(), capacity,
+		name, name, name, processors, processors, memory, memory)
+	ovfName := name + ".ovf"
+
+	vmdkHash, err := fileSha256(vmdkPth)
+	if err != nil {
+		return
+	}
+	ovfHash := fmt.Sprintf("%x", sha256.Sum256([]byte(ovf)))
+
+	manifest := fmt.Sprintf("SHA256(%s)= %s\nSHA256(%s)= %s\n",
+		ovfName, ovfHash, vmdkName, vmdkHash)
+
+	ovaFile, err := os.OpenFile(ovaPth,
+		os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "vmdk: Failed to create ova"),
+		}
+		return
+	}
+	defer ovaFile.Close()
+
+	writer := tar.NewWriter(ovaFile)
+
+	err = writeTarFile(writer, ovfName, int64(len(ovf)),
+		strings.NewReader(ovf))
+	if err != nil {
+		return
+	}
+
+	err = writeTarFile(writer, name+".mf", int64(len(manifest)),
+		strings.NewReader(manifest))
+	if err != nil {
+		return
+	}
+
+	vmdkFile, err := os.Open(vmdkPth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "vmdk: Failed to open vmdk"),
+		}
+		return
+	}
+	defer vmdkFile.Close()
+
+	err = writeTarFile(writer, vmdkName, vmdkInfo.Size(), vmdkFile)
+	if err != nil {
+		return
+	}
+
+	err = writer.Close()
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "vmdk: Failed to write ova"),
+		}
+		return
+	}
+
+	return
+}
@@ -0,0 +1,248 @@
+package vpc
+
+import (
+	"time"
+
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/block"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/zone"
+)
+
+const (
+	NatTtl       = 30 * time.Second
+	NatHeartbeat = 10 * time.Second
+)
+
+func (v *Vpc) validateNat(db *database.Database) (
+	errData *errortypes.ErrorData, err error) {
+
+	if !v.NatGateway {
+		v.NatZone = primitive.NilObjectID
+		v.NatSubnet = primitive.NilObjectID
+		v.NatBlock = primitive.NilObjectID
+		return
+	}
+
+	if v.NatZone.IsZero() {
+		errData = &errortypes.ErrorData{
+			Error:   "nat_zone_required",
+			Message: "Missing required NAT gateway zone",
+		}
+		return
+	}
+
+	zne, err := zone.Get(db, v.NatZone)
+	if err != nil {
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+			errData = &errortypes.ErrorData{
+				Error:   "nat_zone_invalid",
+				Message: "NAT gateway zone invalid",
+			}
+		}
+		return
+	}
+
+	if zne.Datacenter != v.Datacenter {
+		errData = &errortypes.ErrorData{
+			Error:   "nat_zone_invalid",
+			Message: "NAT gateway zone must be in VPC datacenter",
+		}
+		return
+	}
+
+	if v.GetSubnet(v.NatSubnet) == nil {
+		errData = &errortypes.ErrorData{
+			Error:   "nat_subnet_invalid",
+			Message: "NAT gateway subnet invalid",
+		}
+		return
+	}
+
+	if v.NatBlock.IsZero() {
+		errData = &errortypes.ErrorData{
+			Error:   "nat_block_required",
+			Message: "Missing required NAT gateway block",
+		}
+		return
+	}
+
+	blck, err := block.Get(db, v.NatBlock)
+	if err != nil {
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+			errData = &errortypes.ErrorData{
+				Error:   "nat_block_invalid",
+				Message: "NAT gateway block invalid",
+			}
+		}
+		return
+	}
+
+	if blck.Type == block.IPv6 {
+		errData = &errortypes.ErrorData{
+			Error:   "nat_block_invalid",
+			Message: "NAT gateway block must be IPv4",
+		}
+		return
+	}
+
+	return
+}
+
+// Allocates the public block address and private vpc address used by the
+// nat gateway, addresses are released when the gateway is disabled
+func (v *Vpc) InitNat(db *database.Database) (
+	errData *errortypes.ErrorData, err error) {
+	if !v.NatGateway {
+		err = v.RemoveNat(db)
+		if err != nil {
+			return
+		}
+
+		return
+	}
+
+	blck, blckIp, err := block.GetInstanceIp(db, v.Id, block.External)
+	if err != nil {
+		return
+	}
+
+	if blckIp != nil && blck.Id != v.NatBlock {
+		err = block.RemoveIp(db, blckIp.Id)
+		if err != nil {
+			return
+		}
+		blckIp = nil
+	}
+
+	if blckIp != nil {
+		v.NatAddress = blckIp.GetIp().String()
+	} else {
+		blck, err = block.Get(db, v.NatBlock)
+		if err != nil {
+			return
+		}
+
+		ip, e := blck.GetIp(db, v.Id, block.External)
+		if e != nil {
+			if _, ok := e.(*block.BlockFull); ok {
+				errData = &errortypes.ErrorData{
+					Error:   "nat_block_full",
+					Message: "NAT gateway block has no available addresses",
+				}
+			} else {
+				err = e
+			}
+			return
+		}
+
+		v.NatAddress = ip.String()
+	}
+
+	vpcIp := &VpcIp{}
+	err = db.VpcsIp().FindOne(db, &bson.M{
+		"vpc":      v.Id,
+		"instance": v.Id,
+	}).Decode(vpcIp)
+	if err != nil {
+		err = database.ParseError(err)
+		vpcIp = nil
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+		} else {
+			return
+		}
+	}
+
+	if vpcIp != nil && vpcIp.Subnet != v.NatSubnet {
+		err = RemoveInstanceIp(db, v.Id, v.Id)
+		if err != nil {
+			return
+		}
+	}
+
+	ip, _, err := v.GetIp(db, v.NatSubnet, v.Id)
+	if err != nil {
+		return
+	}
+	v.NatPrivate = ip.String()
+
+	return
+}
+
+func (v *Vpc) RemoveNat(db *database.Database) (err error) {
+	err = block.RemoveInstanceIps(db, v.Id)
+	if err != nil {
+		return
+	}
+
+	err = RemoveInstanceIp(db, v.Id, v.Id)
+	if err != nil {
+		return
+	}
+
+	v.NatAddress = ""
+	v.NatPrivate = ""
+	v.NatNode = primitive.NilObjectID
+	v.NatTimestamp = time.Time{}
+
+	return
+}
+
+func (v *Vpc) NatExpired() bool {
+	return v.NatNode.IsZero() || time.Since(v.NatTimestamp) > NatTtl
+}
+
+// Acquire or renew the nat gateway lease, the update only matches if no
+// other node has taken the lease since the vpc was loaded
+func (v *Vpc) NatLease(db *database.Database, ndeId primitive.ObjectID) (
+	acquired bool, err error) {
+
+	if v.NatNode == ndeId && time.Since(v.NatTimestamp) < NatHeartbeat {
+		acquired = true
+		return
+	}
+
+	if v.NatNode != ndeId && !v.NatExpired() {
+		return
+	}
+
+	coll := db.Vpcs()
+	timestamp := time.Now()
+
+	query := bson.M{
+		"_id":         v.Id,
+		"nat_gateway": true,
+	}
+	if v.NatNode.IsZero() {
+		query["nat_node"] = nil
+	} else {
+		query["nat_node"] = v.NatNode
+		query["nat_timestamp"] = v.NatTimestamp
+	}
+
+	resp, err := coll.UpdateOne(db, query, &bson.M{
+		"$set": &bson.M{
+			"nat_node":      ndeId,
+			"nat_timestamp": timestamp,
+		},
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	if resp.MatchedCount == 0 {
+		return
+	}
+
+	v.NatNode = ndeId
+	v.NatTimestamp = timestamp
+	acquired = true
+
+	return
+}
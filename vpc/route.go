@@ -0,0 +1,323 @@
+package vpc
+
+import (
+	"net"
+	"strings"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+)
+
+// Private addresses of instances in a vpc
+type InstanceIps map[primitive.ObjectID]net.IP
+
+func routeKey(route *Route) string {
+	return route.Destination + "-" + route.Target
+}
+
+// Returns the stored routes of the vpc and its subnets, unchanged routes
+// skip the subnet reachability check to allow updating existing vpcs
+func (v *Vpc) getCurrentRoutes(db *database.Database) (
+	curRoutes set.Set, err error) {
+
+	curRoutes = set.NewSet()
+
+	if v.Id.IsZero() {
+		return
+	}
+
+	curVc, err := Get(db, v.Id)
+	if err != nil {
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+		}
+		return
+	}
+
+	for _, route := range curVc.Routes {
+		curRoutes.Add(routeKey(route))
+	}
+	for _, sub := range curVc.Subnets {
+		for _, route := range sub.Routes {
+			curRoutes.Add(routeKey(route))
+		}
+	}
+
+	return
+}
+
+func (v *Vpc) validateRoutes(db *database.Database, routes []*Route,
+	curRoutes set.Set, network, network6 *net.IPNet) (
+	errData *errortypes.ErrorData, err error) {
+
+	destinations := set.NewSet()
+	for _, route := range routes {
+		if destinations.Contains(route.Destination) {
+			errData = &errortypes.ErrorData{
+				Error:   "duplicate_destination",
+				Message: "Duplicate route destinations",
+			}
+			return
+		}
+		destinations.Add(route.Destination)
+
+		_, destination, e := net.ParseCIDR(route.Destination)
+		if e != nil {
+			errData = &errortypes.ErrorData{
+				Error:   "route_destination_invalid",
+				Message: "Route destination invalid",
+			}
+			return
+		}
+		route.Destination = destination.String()
+
+		if route.Destination == "0.0.0.0/0" || route.Destination == "::/0" {
+			errData = &errortypes.ErrorData{
+				Error:   "route_destination_invalid",
+				Message: "Route destination invalid",
+			}
+			return
+		}
+
+		if route.Blackhole {
+			route.Target = ""
+			route.TargetInstance = primitive.NilObjectID
+			continue
+		}
+
+		if !route.TargetInstance.IsZero() {
+			route.Target = ""
+
+			exists, e := v.existsInstance(db, route.TargetInstance)
+			if e != nil {
+				err = e
+				return
+			}
+
+			if !exists {
+				errData = &errortypes.ErrorData{
+					Error:   "route_target_instance_invalid",
+					Message: "Route target instance not in VPC",
+				}
+				return
+			}
+
+			continue
+		}
+
+		if strings.Contains(route.Destination, ":") !=
+			strings.Contains(route.Target, ":") {
+
+			errData = &errortypes.ErrorData{
+				Error:   "route_target_destination_invalid",
+				Message: "Route target/destination invalid",
+			}
+			return
+		}
+
+		target := net.ParseIP(route.Target)
+		if target == nil {
+			errData = &errortypes.ErrorData{
+				Error:   "route_target_invalid",
+				Message: "Route target invalid",
+			}
+			return
+		}
+		route.Target = target.String()
+
+		if route.Target == "0.0.0.0" {
+			errData = &errortypes.ErrorData{
+				Error:   "route_target_invalid",
+				Message: "Route target invalid",
+			}
+			return
+		}
+
+		if !strings.Contains(route.Target, ":") {
+			if !network.Contains(target) {
+				errData = &errortypes.ErrorData{
+					Error:   "route_target_invalid_network",
+					Message: "Route target not in VPC network",
+				}
+				return
+			}
+
+			if curRoutes.Contains(routeKey(route)) {
+				continue
+			}
+
+			reachable := false
+			for _, sub := range v.Subnets {
+				subNetwork, e := sub.GetNetwork()
+				if e != nil {
+					continue
+				}
+
+				if subNetwork.Contains(target) {
+					reachable = true
+					break
+				}
+			}
+
+			if !reachable {
+				errData = &errortypes.ErrorData{
+					Error:   "route_target_unreachable",
+					Message: "Route target not in a VPC subnet",
+				}
+				return
+			}
+		} else {
+			if !network6.Contains(target) {
+				errData = &errortypes.ErrorData{
+					Error:   "route_target_invalid_network6",
+					Message: "Route target not in VPC IPv6 network",
+				}
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (v *Vpc) existsInstance(db *database.Database,
+	instId primitive.ObjectID) (exists bool, err error) {
+
+	coll := db.Instances()
+
+	n, err := coll.CountDocuments(db, &bson.M{
+		"_id": instId,
+		"$or": []*bson.M{
+			&bson.M{
+				"vpc": v.Id,
+			},
+			&bson.M{
+				"network_adapters.vpc": v.Id,
+			},
+		},
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	if n > 0 {
+		exists = true
+	}
+
+	return
+}
+
+// Returns the vpc routes merged with the subnet routes, subnet routes
+// replace vpc routes with the same destination. Instance targets are
+// resolved with the instance addresses in the vpc and routes to instances
+// without an address are skipped
+func (v *Vpc) GetSubnetRoutes(subId primitive.ObjectID,
+	instIps InstanceIps) (routes []Route) {
+
+	routesMap := map[string]*Route{}
+	destinations := []string{}
+
+	for _, route := range v.Routes {
+		if routesMap[route.Destination] == nil {
+			destinations = append(destinations, route.Destination)
+		}
+		routesMap[route.Destination] = route
+	}
+
+	sub := v.GetSubnet(subId)
+	if sub != nil {
+		for _, route := range sub.Routes {
+			if routesMap[route.Destination] == nil {
+				destinations = append(destinations, route.Destination)
+			}
+			routesMap[route.Destination] = route
+		}
+	}
+
+	routes = []Route{}
+	for _, destination := range destinations {
+		route := routesMap[destination]
+
+		if route.Blackhole {
+			routes = append(routes, Route{
+				Destination: route.Destination,
+				Blackhole:   true,
+			})
+			continue
+		}
+
+		target := route.Target
+		if !route.TargetInstance.IsZero() {
+			addr := instIps[route.TargetInstance]
+			if addr == nil {
+				continue
+			}
+
+			if strings.Contains(route.Destination, ":") {
+				target = v.GetIp6(addr).String()
+			} else {
+				target = addr.String()
+			}
+		}
+
+		routes = append(routes, Route{
+			Destination: route.Destination,
+			Target:      target,
+		})
+	}
+
+	return
+}
+
+// Returns the private addresses of the instances for each vpc
+func GetInstanceIps(db *database.Database, instIds []primitive.ObjectID) (
+	vpcIps map[primitive.ObjectID]InstanceIps, err error) {
+
+	coll := db.VpcsIp()
+	vpcIps = map[primitive.ObjectID]InstanceIps{}
+
+	if len(instIds) == 0 {
+		return
+	}
+
+	cursor, err := coll.Find(db, &bson.M{
+		"instance": &bson.M{
+			"$in": instIds,
+		},
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+	defer cursor.Close(db)
+
+	for cursor.Next(db) {
+		vpcIp := &VpcIp{}
+		err = cursor.Decode(vpcIp)
+		if err != nil {
+			err = database.ParseError(err)
+			return
+		}
+
+		instIps := vpcIps[vpcIp.Vpc]
+		if instIps == nil {
+			instIps = InstanceIps{}
+			vpcIps[vpcIp.Vpc] = instIps
+		}
+
+		addr, _ := vpcIp.GetIps()
+		instIps[vpcIp.Instance] = addr
+	}
+
+	err = cursor.Err()
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	return
+}
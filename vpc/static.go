@@ -0,0 +1,270 @@
+package vpc
+
+import (
+	"net"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/mongo-go-driver/bson"
+	"github.com/pritunl/mongo-go-driver/bson/primitive"
+	"github.com/pritunl/mongo-go-driver/mongo/options"
+	"github.com/pritunl/pritunl-cloud/database"
+	"github.com/pritunl/pritunl-cloud/errortypes"
+	"github.com/pritunl/pritunl-cloud/utils"
+)
+
+func (v *Vpc) validateReservations(db *database.Database, sub *Subnet,
+	subNetwork *net.IPNet) (errData *errortypes.ErrorData, err error) {
+
+	if sub.Reservations == nil {
+		sub.Reservations = []*Reservation{}
+	}
+
+	for _, reservation := range sub.Reservations {
+		if reservation.Stop == "" {
+			reservation.Stop = reservation.Start
+		}
+
+		startIp := net.ParseIP(reservation.Start).To4()
+		stopIp := net.ParseIP(reservation.Stop).To4()
+		if startIp == nil || stopIp == nil {
+			errData = &errortypes.ErrorData{
+				Error:   "subnet_reservation_invalid",
+				Message: "Subnet reservation address invalid",
+			}
+			return
+		}
+
+		if !subNetwork.Contains(startIp) || !subNetwork.Contains(stopIp) {
+			errData = &errortypes.ErrorData{
+				Error:   "subnet_reservation_range_invalid",
+				Message: "Subnet reservation outside of subnet network",
+			}
+			return
+		}
+
+		if utils.IpAddress2Int(startIp) > utils.IpAddress2Int(stopIp) {
+			errData = &errortypes.ErrorData{
+				Error:   "subnet_reservation_range_invalid",
+				Message: "Subnet reservation start after stop",
+			}
+			return
+		}
+
+		reservation.Start = startIp.String()
+		reservation.Stop = stopIp.String()
+
+		if sub.Id.IsZero() || v.Id.IsZero() {
+			continue
+		}
+
+		start, stop, e := reservation.GetIndexRange()
+		if e != nil {
+			err = e
+			return
+		}
+
+		coll := db.VpcsIp()
+
+		count, e := coll.CountDocuments(db, &bson.M{
+			"vpc":    v.Id,
+			"subnet": sub.Id,
+			"ip": &bson.M{
+				"$gte": start,
+				"$lte": stop,
+			},
+			"instance": &bson.M{
+				"$ne": nil,
+			},
+		})
+		if e != nil {
+			err = database.ParseError(e)
+			return
+		}
+
+		if count > 0 {
+			errData = &errortypes.ErrorData{
+				Error:   "subnet_reservation_conflict",
+				Message: "Subnet reservation contains assigned addresses",
+			}
+			return
+		}
+	}
+
+	return
+}
+
+// Returns the address index of a static private address, only the first
+// address of each instance and gateway pair can be assigned
+func (v *Vpc) ValidateStaticIp(db *database.Database, subId,
+	instId primitive.ObjectID, addr string) (
+	errData *errortypes.ErrorData, err error) {
+
+	sub := v.GetSubnet(subId)
+	if sub == nil {
+		errData = &errortypes.ErrorData{
+			Error:   "vpc_subnet_missing",
+			Message: "VPC subnet does not exist",
+		}
+		return
+	}
+
+	ip := net.ParseIP(addr).To4()
+	if ip == nil {
+		errData = &errortypes.ErrorData{
+			Error:   "static_private_ip_invalid",
+			Message: "Static private IP invalid",
+		}
+		return
+	}
+
+	index, e := utils.Int2IpIndex(utils.IpAddress2Int(ip))
+	if e != nil {
+		errData = &errortypes.ErrorData{
+			Error:   "static_private_ip_invalid",
+			Message: "Static private IP must be an even address",
+		}
+		return
+	}
+
+	start, stop, err := sub.GetIndexRange()
+	if err != nil {
+		return
+	}
+
+	if index < start || index > stop {
+		errData = &errortypes.ErrorData{
+			Error:   "static_private_ip_range_invalid",
+			Message: "Static private IP outside of subnet network",
+		}
+		return
+	}
+
+	if sub.IsReserved(index) {
+		errData = &errortypes.ErrorData{
+			Error:   "static_private_ip_reserved",
+			Message: "Static private IP is in a subnet reservation",
+		}
+		return
+	}
+
+	coll := db.VpcsIp()
+
+	count, err := coll.CountDocuments(db, &bson.M{
+		"vpc": v.Id,
+		"ip":  index,
+		"instance": &bson.M{
+			"$nin": []interface{}{nil, instId},
+		},
+	})
+	if err != nil {
+		err = database.ParseError(err)
+		return
+	}
+
+	if count > 0 {
+		errData = &errortypes.ErrorData{
+			Error:   "static_private_ip_conflict",
+			Message: "Static private IP is assigned to another instance",
+		}
+		return
+	}
+
+	return
+}
+
+// Assigns a static private address to the instance replacing any existing
+// address in the vpc
+func (v *Vpc) SetStaticIp(db *database.Database,
+	subId, instId primitive.ObjectID, addr string) (err error) {
+
+	ip := net.ParseIP(addr).To4()
+	if ip == nil {
+		err = &errortypes.ParseError{
+			errors.New("vpc: Failed to parse static address"),
+		}
+		return
+	}
+
+	index, err := utils.Int2IpIndex(utils.IpAddress2Int(ip))
+	if err != nil {
+		return
+	}
+
+	coll := db.VpcsIp()
+	vpcIp := &VpcIp{}
+
+	err = coll.FindOne(db, &bson.M{
+		"vpc":      v.Id,
+		"instance": instId,
+	}).Decode(vpcIp)
+	if err != nil {
+		err = database.ParseError(err)
+		vpcIp = nil
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+		} else {
+			return
+		}
+	}
+
+	if vpcIp != nil {
+		if vpcIp.Subnet == subId && vpcIp.Ip == index {
+			return
+		}
+
+		err = RemoveInstanceIp(db, instId, v.Id)
+		if err != nil {
+			return
+		}
+	}
+
+	vpcIp = &VpcIp{}
+	opts := &options.FindOneAndUpdateOptions{}
+	opts.SetReturnDocument(options.After)
+
+	err = coll.FindOneAndUpdate(
+		db,
+		&bson.M{
+			"vpc":      v.Id,
+			"subnet":   subId,
+			"ip":       index,
+			"instance": nil,
+		},
+		&bson.M{
+			"$set": &bson.M{
+				"instance": instId,
+			},
+		},
+		opts,
+	).Decode(vpcIp)
+	if err != nil {
+		err = database.ParseError(err)
+		if _, ok := err.(*database.NotFoundError); ok {
+			err = nil
+		} else {
+			return
+		}
+	} else {
+		return
+	}
+
+	vpcIp = &VpcIp{
+		Vpc:      v.Id,
+		Subnet:   subId,
+		Ip:       index,
+		Instance: instId,
+	}
+
+	_, err = coll.InsertOne(db, vpcIp)
+	if err != nil {
+		err = database.ParseError(err)
+		if _, ok := err.(*database.DuplicateKeyError); ok {
+			err = &errortypes.DatabaseError{
+				errors.New("vpc: Static address already assigned"),
+			}
+		}
+		return
+	}
+
+	return
+}
@@ -9,10 +9,36 @@ import (
 	"github.com/pritunl/pritunl-cloud/utils"
 )
 
+type Reservation struct {
+	Start   string `bson:"start" json:"start"`
+	Stop    string `bson:"stop" json:"stop"`
+	Comment string `bson:"comment" json:"comment"`
+}
+
+// Returns the range of address indexes that overlap the reservation, each
+// index is an instance and gateway address pair
+func (r *Reservation) GetIndexRange() (start, stop int64, err error) {
+	startIp := net.ParseIP(r.Start).To4()
+	stopIp := net.ParseIP(r.Stop).To4()
+	if startIp == nil || stopIp == nil {
+		err = &errortypes.ParseError{
+			errors.New("vpc: Failed to parse subnet reservation"),
+		}
+		return
+	}
+
+	start = utils.IpAddress2Int(startIp) / 2
+	stop = utils.IpAddress2Int(stopIp) / 2
+
+	return
+}
+
 type Subnet struct {
-	Id      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name    string             `bson:"name" json:"name"`
-	Network string             `bson:"network" json:"network"`
+	Id           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name         string             `bson:"name" json:"name"`
+	Network      string             `bson:"network" json:"network"`
+	Reservations []*Reservation     `bson:"reservations" json:"reservations"`
+	Routes       []*Route           `bson:"routes" json:"routes"`
 }
 
 func (s *Subnet) GetNetwork() (network *net.IPNet, err error) {
@@ -44,3 +70,18 @@ func (s *Subnet) GetIndexRange() (start, stop int64, err error) {
 
 	return
 }
+
+func (s *Subnet) IsReserved(index int64) bool {
+	for _, reservation := range s.Reservations {
+		start, stop, err := reservation.GetIndexRange()
+		if err != nil {
+			continue
+		}
+
+		if index >= start && index <= stop {
+			return true
+		}
+	}
+
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/pritunl/mongo-go-driver/bson"
 	"github.com/pritunl/mongo-go-driver/bson/primitive"
 	"github.com/pritunl/mongo-go-driver/mongo/options"
+	"github.com/pritunl/pritunl-cloud/block"
 	"github.com/pritunl/pritunl-cloud/database"
 	"github.com/pritunl/pritunl-cloud/utils"
 )
@@ -306,6 +307,11 @@ func DistinctIds(db *database.Database, matchIds []primitive.ObjectID) (
 }
 
 func Remove(db *database.Database, vcId primitive.ObjectID) (err error) {
+	err = block.RemoveInstanceIps(db, vcId)
+	if err != nil {
+		return
+	}
+
 	coll := db.VpcsIp()
 
 	_, err = coll.DeleteMany(db, &bson.M{
@@ -337,6 +343,19 @@ func Remove(db *database.Database, vcId primitive.ObjectID) (err error) {
 func RemoveOrg(db *database.Database, orgId, vcId primitive.ObjectID) (
 	err error) {
 
+	exists, err := ExistsOrg(db, orgId, vcId)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return
+	}
+
+	err = block.RemoveInstanceIps(db, vcId)
+	if err != nil {
+		return
+	}
+
 	coll := db.VpcsIp()
 
 	_, err = coll.DeleteMany(db, &bson.M{
@@ -367,6 +386,13 @@ func RemoveOrg(db *database.Database, orgId, vcId primitive.ObjectID) (
 }
 
 func RemoveMulti(db *database.Database, vcIds []primitive.ObjectID) (err error) {
+	for _, vcId := range vcIds {
+		err = block.RemoveInstanceIps(db, vcId)
+		if err != nil {
+			return
+		}
+	}
+
 	coll := db.VpcsIp()
 
 	_, err = coll.DeleteMany(db, &bson.M{
@@ -15,27 +15,39 @@ import (
 	"github.com/pritunl/pritunl-cloud/utils"
 	"math/rand"
 	"net"
-	"strings"
+	"time"
 )
 
 type Route struct {
-	Destination string `bson:"destination" json:"destination"`
-	Target      string `bson:"target" json:"target"`
-	Link        bool   `bson:"link" json:"link"`
+	Destination    string             `bson:"destination" json:"destination"`
+	Target         string             `bson:"target" json:"target"`
+	TargetInstance primitive.ObjectID `bson:"target_instance,omitempty" json:"target_instance"`
+	Blackhole      bool               `bson:"blackhole" json:"blackhole"`
+	Link           bool               `bson:"link" json:"link"`
 }
 
 type Vpc struct {
-	Id           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name         string             `bson:"name" json:"name"`
-	Comment      string             `bson:"comment" json:"comment"`
-	VpcId        int                `bson:"vpc_id" json:"vpc_id"`
-	Network      string             `bson:"network" json:"network"`
-	Network6     string             `bson:"-" json:"network6"`
-	Subnets      []*Subnet          `bson:"subnets" json:"subnets"`
-	Organization primitive.ObjectID `bson:"organization" json:"organization"`
-	Datacenter   primitive.ObjectID `bson:"datacenter" json:"datacenter"`
-	Routes       []*Route           `bson:"routes" json:"routes"`
-	curSubnets   []*Subnet          `bson:"-" json:"-"`
+	Id                primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Name              string               `bson:"name" json:"name"`
+	Comment           string               `bson:"comment" json:"comment"`
+	VpcId             int                  `bson:"vpc_id" json:"vpc_id"`
+	Network           string               `bson:"network" json:"network"`
+	Network6          string               `bson:"-" json:"network6"`
+	Subnets           []*Subnet            `bson:"subnets" json:"subnets"`
+	Organization      primitive.ObjectID   `bson:"organization" json:"organization"`
+	Datacenter        primitive.ObjectID   `bson:"datacenter" json:"datacenter"`
+	Routes            []*Route             `bson:"routes" json:"routes"`
+	InternalDns       bool                 `bson:"internal_dns" json:"internal_dns"`
+	PeerOrganizations []primitive.ObjectID `bson:"peer_organizations" json:"peer_organizations"`
+	NatGateway        bool                 `bson:"nat_gateway" json:"nat_gateway"`
+	NatZone           primitive.ObjectID   `bson:"nat_zone,omitempty" json:"nat_zone"`
+	NatSubnet         primitive.ObjectID   `bson:"nat_subnet,omitempty" json:"nat_subnet"`
+	NatBlock          primitive.ObjectID   `bson:"nat_block,omitempty" json:"nat_block"`
+	NatAddress        string               `bson:"nat_address" json:"nat_address"`
+	NatPrivate        string               `bson:"nat_private" json:"nat_private"`
+	NatNode           primitive.ObjectID   `bson:"nat_node,omitempty" json:"nat_node"`
+	NatTimestamp      time.Time            `bson:"nat_timestamp" json:"nat_timestamp"`
+	curSubnets        []*Subnet            `bson:"-" json:"-"`
 }
 
 func (v *Vpc) Validate(db *database.Database) (
@@ -135,6 +147,11 @@ func (v *Vpc) Validate(db *database.Database) (
 			return
 		}
 
+		errData, err = v.validateReservations(db, sub, subNetwork)
+		if err != nil || errData != nil {
+			return
+		}
+
 		subStart, subStop, e := sub.GetIndexRange()
 		if e != nil {
 			err = e
@@ -179,84 +196,49 @@ func (v *Vpc) Validate(db *database.Database) (
 		}
 	}
 
-	if v.Routes == nil {
-		v.Routes = []*Route{}
-	}
+	peerOrgs := []primitive.ObjectID{}
+	peerOrgsSet := set.NewSet()
+	for _, orgId := range v.PeerOrganizations {
+		if orgId.IsZero() || orgId == v.Organization ||
+			peerOrgsSet.Contains(orgId) {
 
-	destinations := set.NewSet()
-	for _, route := range v.Routes {
-		if destinations.Contains(route.Destination) {
-			errData = &errortypes.ErrorData{
-				Error:   "duplicate_destination",
-				Message: "Duplicate route destinations",
-			}
-			return
+			continue
 		}
-		destinations.Add(route.Destination)
+		peerOrgsSet.Add(orgId)
+		peerOrgs = append(peerOrgs, orgId)
+	}
+	v.PeerOrganizations = peerOrgs
 
-		if strings.Contains(route.Destination, ":") !=
-			strings.Contains(route.Target, ":") {
+	if v.Routes == nil {
+		v.Routes = []*Route{}
+	}
 
-			errData = &errortypes.ErrorData{
-				Error:   "route_target_destination_invalid",
-				Message: "Route target/destination invalid",
-			}
-			return
-		}
+	curRoutes, err := v.getCurrentRoutes(db)
+	if err != nil {
+		return
+	}
 
-		_, destination, e := net.ParseCIDR(route.Destination)
-		if e != nil {
-			errData = &errortypes.ErrorData{
-				Error:   "route_destination_invalid",
-				Message: "Route destination invalid",
-			}
-			return
-		}
-		route.Destination = destination.String()
+	errData, err = v.validateRoutes(db, v.Routes, curRoutes,
+		network, network6)
+	if err != nil || errData != nil {
+		return
+	}
 
-		if route.Destination == "0.0.0.0/0" || route.Destination == "::/0" {
-			errData = &errortypes.ErrorData{
-				Error:   "route_destination_invalid",
-				Message: "Route destination invalid",
-			}
-			return
+	for _, sub := range v.Subnets {
+		if sub.Routes == nil {
+			sub.Routes = []*Route{}
 		}
 
-		target := net.ParseIP(route.Target)
-		if target == nil {
-			errData = &errortypes.ErrorData{
-				Error:   "route_target_invalid",
-				Message: "Route target invalid",
-			}
-			return
-		}
-		route.Target = target.String()
-
-		if route.Target == "0.0.0.0" {
-			errData = &errortypes.ErrorData{
-				Error:   "route_target_invalid",
-				Message: "Route target invalid",
-			}
+		errData, err = v.validateRoutes(db, sub.Routes, curRoutes,
+			network, network6)
+		if err != nil || errData != nil {
 			return
 		}
+	}
 
-		if !strings.Contains(route.Target, ":") {
-			if !network.Contains(target) {
-				errData = &errortypes.ErrorData{
-					Error:   "route_target_invalid_network",
-					Message: "Route target not in VPC network",
-				}
-				return
-			}
-		} else {
-			if !network6.Contains(target) {
-				errData = &errortypes.ErrorData{
-					Error:   "route_target_invalid_network6",
-					Message: "Route target not in VPC IPv6 network",
-				}
-				return
-			}
-		}
+	errData, err = v.validateNat(db)
+	if err != nil {
+		return
 	}
 
 	return
@@ -314,6 +296,22 @@ func (v *Vpc) PostCommit(db *database.Database) (
 	return
 }
 
+// Returns true if the organization owns the vpc or has been granted
+// peering with the vpc
+func (v *Vpc) CanPeer(orgId primitive.ObjectID) bool {
+	if v.Organization == orgId {
+		return true
+	}
+
+	for _, peerOrg := range v.PeerOrganizations {
+		if peerOrg == orgId {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (v *Vpc) Json() {
 	netHash := md5.New()
 	netHash.Write(v.Id[:])
@@ -451,13 +449,34 @@ func (v *Vpc) GetIp(db *database.Database,
 		opts := &options.FindOneAndUpdateOptions{}
 		opts.SetReturnDocument(options.After)
 
+		query := bson.M{
+			"vpc":      v.Id,
+			"subnet":   subId,
+			"instance": nil,
+		}
+
+		reserved := []*bson.M{}
+		for _, reservation := range subnet.Reservations {
+			start, stop, e := reservation.GetIndexRange()
+			if e != nil {
+				err = e
+				return
+			}
+
+			reserved = append(reserved, &bson.M{
+				"ip": &bson.M{
+					"$gte": start,
+					"$lte": stop,
+				},
+			})
+		}
+		if len(reserved) > 0 {
+			query["$nor"] = reserved
+		}
+
 		err = coll.FindOneAndUpdate(
 			db,
-			&bson.M{
-				"vpc":      v.Id,
-				"subnet":   subId,
-				"instance": nil,
-			},
+			&query,
 			&bson.M{
 				"$set": &bson.M{
 					"instance": instId,
@@ -520,6 +539,11 @@ func (v *Vpc) GetIp(db *database.Database,
 				return
 			}
 
+			if subnet.IsReserved(curIp) {
+				curIp += 1
+				continue
+			}
+
 			vpcIp = &VpcIp{
 				Vpc:      v.Id,
 				Subnet:   subId,